@@ -20,6 +20,14 @@ func main() {
 	// Initialize logger with config
 	logger.Initialize(cfg)
 
+	if err := cfg.Validate(); err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Secrets are redacted by Config.LogValue
+	slog.Info("Loaded configuration", "config", cfg)
+
 	// Create and configure server
 	srv := server.NewServer(cfg)
 
@@ -34,8 +42,8 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Graceful shutdown; the pre-shutdown delay comes on top of the drain time
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second+cfg.PreShutdownDelay)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
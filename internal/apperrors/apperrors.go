@@ -0,0 +1,115 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Domain error kinds. Wrap these (or use Newf) so handlers can classify
+// errors with errors.Is instead of inspecting message text.
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrConflict        = errors.New("conflict")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrUnavailable     = errors.New("unavailable")
+
+	// ErrDatabaseUnavailable is an ErrUnavailable for the database in
+	// particular, so clients can tell it apart from other dependencies
+	ErrDatabaseUnavailable = fmt.Errorf("database %w", ErrUnavailable)
+)
+
+// Code is a stable, machine-readable error code sent to clients as "code"
+// next to the human-readable "error" message. Messages may be reworded;
+// codes may not.
+type Code string
+
+// Error codes. Add new ones here and to the README rather than inventing
+// them at call sites.
+const (
+	CodeValidation           Code = "VALIDATION_ERROR"
+	CodeUnauthorized         Code = "UNAUTHORIZED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeMethodNotAllowed     Code = "METHOD_NOT_ALLOWED"
+	CodeNotAcceptable        Code = "NOT_ACCEPTABLE"
+	CodeConflict             Code = "CONFLICT"
+	CodeUnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE"
+	CodeRangeNotSatisfiable  Code = "RANGE_NOT_SATISFIABLE"
+	CodeRateLimited          Code = "RATE_LIMITED"
+	CodeInternal             Code = "INTERNAL_ERROR"
+	CodeDBUnavailable        Code = "DB_UNAVAILABLE"
+	CodeUnavailable          Code = "SERVICE_UNAVAILABLE"
+	CodeReadOnly             Code = "READ_ONLY"
+	CodeTimeout              Code = "TIMEOUT"
+)
+
+// domainError carries a client-facing message while unwrapping to its kind
+type domainError struct {
+	kind    error
+	message string
+}
+
+func (e *domainError) Error() string {
+	return e.message
+}
+
+func (e *domainError) Unwrap() error {
+	return e.kind
+}
+
+// Newf returns an error with the formatted message that matches kind with errors.Is
+func Newf(kind error, format string, args ...interface{}) error {
+	return &domainError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+// StatusFor returns the HTTP status code for err based on its domain kind,
+// defaulting to 500 for unclassified errors
+func StatusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTooManyRequests):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CodeFor returns the error code for err based on its domain kind,
+// defaulting to CodeInternal for unclassified errors
+func CodeFor(err error) Code {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, ErrInvalidInput):
+		return CodeValidation
+	case errors.Is(err, ErrConflict):
+		return CodeConflict
+	case errors.Is(err, ErrUnauthorized):
+		return CodeUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return CodeForbidden
+	case errors.Is(err, ErrTooManyRequests):
+		return CodeRateLimited
+	case errors.Is(err, ErrDatabaseUnavailable):
+		return CodeDBUnavailable
+	case errors.Is(err, ErrUnavailable):
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
@@ -0,0 +1,83 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "Not found", err: ErrNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Invalid input", err: ErrInvalidInput, expectedStatus: http.StatusBadRequest},
+		{name: "Conflict", err: ErrConflict, expectedStatus: http.StatusConflict},
+		{name: "Unauthorized", err: ErrUnauthorized, expectedStatus: http.StatusUnauthorized},
+		{name: "Forbidden", err: ErrForbidden, expectedStatus: http.StatusForbidden},
+		{name: "Too many requests", err: ErrTooManyRequests, expectedStatus: http.StatusTooManyRequests},
+		{name: "Unavailable", err: ErrUnavailable, expectedStatus: http.StatusServiceUnavailable},
+		{name: "Wrapped with fmt.Errorf", err: fmt.Errorf("guest book message %w", ErrNotFound), expectedStatus: http.StatusNotFound},
+		{name: "Created with Newf", err: Newf(ErrInvalidInput, "name is %s", "bad"), expectedStatus: http.StatusBadRequest},
+		{name: "Unclassified", err: errors.New("boom"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusFor(tt.err); got != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, got)
+			}
+		})
+	}
+}
+
+func TestCodeFor(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedCode Code
+	}{
+		{name: "Not found", err: ErrNotFound, expectedCode: CodeNotFound},
+		{name: "Invalid input", err: Newf(ErrInvalidInput, "name is %s", "bad"), expectedCode: CodeValidation},
+		{name: "Conflict", err: ErrConflict, expectedCode: CodeConflict},
+		{name: "Unauthorized", err: ErrUnauthorized, expectedCode: CodeUnauthorized},
+		{name: "Forbidden", err: ErrForbidden, expectedCode: CodeForbidden},
+		{name: "Too many requests", err: ErrTooManyRequests, expectedCode: CodeRateLimited},
+		{name: "Database unavailable", err: Newf(ErrDatabaseUnavailable, "database is unavailable"), expectedCode: CodeDBUnavailable},
+		{name: "Other dependency unavailable", err: fmt.Errorf("captcha verification %w", ErrUnavailable), expectedCode: CodeUnavailable},
+		{name: "Unclassified", err: errors.New("boom"), expectedCode: CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeFor(tt.err); got != tt.expectedCode {
+				t.Errorf("Expected code %s, got %s", tt.expectedCode, got)
+			}
+		})
+	}
+}
+
+func TestStatusFor_DatabaseUnavailable(t *testing.T) {
+	if got := StatusFor(ErrDatabaseUnavailable); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, got)
+	}
+}
+
+func TestNewf(t *testing.T) {
+	err := Newf(ErrInvalidInput, "name must be between %d and %d characters", 2, 100)
+
+	if err.Error() != "name must be between 2 and 100 characters" {
+		t.Errorf("Expected message without kind prefix, got %q", err.Error())
+	}
+
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Error("Expected error to match ErrInvalidInput")
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		t.Error("Expected error not to match ErrNotFound")
+	}
+}
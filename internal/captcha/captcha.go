@@ -0,0 +1,97 @@
+// Package captcha verifies CAPTCHA tokens with reCAPTCHA or hCaptcha, which
+// share the same siteverify API
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/config"
+)
+
+// Verification endpoints of the supported providers
+const (
+	RecaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+	HCaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+)
+
+// maxResponseSize bounds how much of a verification response is read
+const maxResponseSize = 64 << 10
+
+// ErrRejected is returned for tokens the provider doesn't accept
+var ErrRejected = apperrors.Newf(apperrors.ErrInvalidInput, "captcha verification failed")
+
+// Verifier checks tokens with a provider's siteverify endpoint
+type Verifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// New creates a verifier for the configured provider, or for VerifyURL
+// when it is set
+func New(cfg config.CaptchaConfig) *Verifier {
+	verifyURL := cfg.VerifyURL
+	if verifyURL == "" {
+		verifyURL = RecaptchaVerifyURL
+		if cfg.Provider == "hcaptcha" {
+			verifyURL = HCaptchaVerifyURL
+		}
+	}
+
+	return &Verifier{
+		url:    verifyURL,
+		secret: cfg.Secret,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// siteverifyResponse is the part of the provider's answer that is used
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify asks the provider whether token was solved, passing remoteIP along
+// when known. A rejected token is ErrRejected; a provider that can't be
+// reached or answers unexpectedly is an apperrors.ErrUnavailable.
+func (v *Verifier) Verify(ctx context.Context, token, remoteIP string) error {
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build captcha verification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification %w: %w", apperrors.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha verification %w: provider answered %s", apperrors.ErrUnavailable, resp.Status)
+	}
+
+	var result siteverifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification %w: invalid provider response: %w", apperrors.ErrUnavailable, err)
+	}
+
+	if !result.Success {
+		slog.Info("Rejected captcha token", "error_codes", result.ErrorCodes)
+		return ErrRejected
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/config"
+)
+
+func TestNew_ProviderURLs(t *testing.T) {
+	tests := []struct {
+		cfg      config.CaptchaConfig
+		expected string
+	}{
+		{cfg: config.CaptchaConfig{Provider: "recaptcha"}, expected: RecaptchaVerifyURL},
+		{cfg: config.CaptchaConfig{Provider: "hcaptcha"}, expected: HCaptchaVerifyURL},
+		{cfg: config.CaptchaConfig{Provider: "hcaptcha", VerifyURL: "http://localhost:9000/verify"}, expected: "http://localhost:9000/verify"},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.cfg).url; got != tt.expected {
+			t.Errorf("Expected %+v to verify at %s, got %s", tt.cfg, tt.expected, got)
+		}
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectedErr error
+	}{
+		{name: "Accepted", status: http.StatusOK, body: `{"success": true}`},
+		{name: "Rejected", status: http.StatusOK, body: `{"success": false, "error-codes": ["invalid-input-response"]}`, expectedErr: apperrors.ErrInvalidInput},
+		{name: "Provider error", status: http.StatusInternalServerError, body: `oops`, expectedErr: apperrors.ErrUnavailable},
+		{name: "Invalid response", status: http.StatusOK, body: `<html>`, expectedErr: apperrors.ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("Expected POST, got %s", r.Method)
+				}
+				if r.PostFormValue("secret") != "s3cret" || r.PostFormValue("response") != "token" || r.PostFormValue("remoteip") != "203.0.113.7" {
+					t.Errorf("Unexpected verification form %v", r.PostForm)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer provider.Close()
+
+			verifier := New(config.CaptchaConfig{Secret: "s3cret", VerifyURL: provider.URL, Timeout: time.Second})
+			err := verifier.Verify(context.Background(), "token", "203.0.113.7")
+
+			if tt.expectedErr == nil && err != nil {
+				t.Fatalf("Expected the token to be accepted, got %v", err)
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifier_Verify_Unreachable(t *testing.T) {
+	provider := httptest.NewServer(http.NotFoundHandler())
+	provider.Close()
+
+	verifier := New(config.CaptchaConfig{Secret: "s3cret", VerifyURL: provider.URL, Timeout: time.Second})
+	if err := verifier.Verify(context.Background(), "token", ""); !errors.Is(err, apperrors.ErrUnavailable) {
+		t.Errorf("Expected an unreachable provider to be unavailable, got %v", err)
+	}
+}
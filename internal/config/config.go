@@ -1,17 +1,123 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
+	// Host is the interface to bind to; empty means all interfaces
+	Host  string
 	Port  string
 	Debug bool
-	DB    DatabaseConfig
+	// LogRequestBodies logs write request bodies, with secrets redacted.
+	// It only takes effect in debug mode.
+	LogRequestBodies bool
+	// JSONCharset is the charset parameter on JSON Content-Types; empty
+	// omits it. Bodies are always UTF-8, so only utf-8 is accepted.
+	JSONCharset string
+	// StringIDs serializes message ids as JSON strings, for JavaScript
+	// clients that would lose precision on ids past 2^53
+	StringIDs  bool
+	DB         DatabaseConfig
+	Log        LogConfig
+	Validation ValidationConfig
+	CORS       CORSConfig
+	Security   SecurityHeadersConfig
+	Features   FeaturesConfig
+	// ModerationEnabled holds new messages as pending until an admin approves them
+	ModerationEnabled bool
+	// AdminToken is the bearer token for /api/v1/admin; empty disables the admin API
+	AdminToken string
+	// AuditLogDB stores audit entries for writes in the audit_log table,
+	// in addition to logging them
+	AuditLogDB bool
+	// AsyncWorkers is how many goroutines run background tasks, such as
+	// storing audit entries; AsyncQueueSize is how many tasks may wait for
+	// them before new ones are dropped
+	AsyncWorkers   int
+	AsyncQueueSize int
+	// EditWindow is how long after creation a message may be edited; 0
+	// allows edits at any time
+	EditWindow time.Duration
+	// IdempotencyKeyTTL is how long an Idempotency-Key replays the message
+	// it created; later requests with the key create a new one. 0 keeps
+	// keys forever.
+	IdempotencyKeyTTL time.Duration
+	// MaxOffset rejects list requests that skip more messages than this with
+	// a 400, sparing the database deep OFFSET scans; 0 means no limit
+	MaxOffset int
+	// MaxMessagesPerEmail rejects new messages with 429 once an email
+	// address has this many, in any moderation status; 0 means no limit
+	MaxMessagesPerEmail int
+	// StrictPagination answers list requests whose page or page_size isn't
+	// a number with a 400 instead of falling back to the defaults
+	StrictPagination bool
+	// SnapshotTTL is how long a pagination snapshot stays open for clients
+	// to page through; 0 disables snapshots. At most MaxSnapshots are open
+	// at once, each holding a database connection.
+	SnapshotTTL  time.Duration
+	MaxSnapshots int
+	// ReadOnly rejects all write requests, for maintenance windows
+	ReadOnly bool
+	// MaxInflight caps concurrently served requests; 0 means unlimited
+	MaxInflight int
+	// RequestTimeout caps how long a handler may run before the client gets
+	// a 503; 0 disables the limit
+	RequestTimeout time.Duration
+	// ClientTimeoutMax caps the timeout clients may ask for with the
+	// X-Request-Timeout header; 0 ignores the header
+	ClientTimeoutMax time.Duration
+	// HealthCheckTimeout bounds how long /api/v1/health waits for each
+	// dependency before reporting it unhealthy
+	HealthCheckTimeout time.Duration
+	// CacheControlMaxAge lets caches reuse successful public GET responses
+	// for this long; 0 sends no Cache-Control header
+	CacheControlMaxAge time.Duration
+	// PreShutdownDelay is how long Shutdown keeps serving with /readyz
+	// failing before it drains connections; 0 drains immediately
+	PreShutdownDelay time.Duration
+	// SystemdSocket serves on the socket passed by systemd socket
+	// activation, when there is one, instead of binding Address
+	SystemdSocket bool
+	// TrailingSlash is how paths with a trailing slash that only exist
+	// without it are handled: "redirect" (default) answers 308 to the
+	// canonical path, "strict" answers 404
+	TrailingSlash string
+	// H2C serves HTTP/2 over plaintext alongside HTTP/1.1, for proxies
+	// that terminate TLS and forward over HTTP/2
+	H2C bool
+	// RobotsTxt is served at /robots.txt; empty serves one disallowing
+	// all crawling. In ROBOTS_TXT, \n stands for a newline.
+	RobotsTxt string
+	// TempDir, when set, must be writable for /readyz to report ready
+	TempDir string
+	// SanitizeInput is how names and messages are sanitized against HTML
+	// injection on write: "none" (default), "escape", or "strip"
+	SanitizeInput string
+	// PprofEnabled serves net/http/pprof on PprofAddress, kept off the
+	// public API listener
+	PprofEnabled bool
+	PprofAddress string
+	Seed         SeedConfig
+	Captcha      CaptchaConfig
+	// CaptureMetadata stores a salted hash of the client IP and the user
+	// agent with each message, visible only to admins
+	CaptureMetadata bool
+	// MetadataSalt keys the IP hash; required when CaptureMetadata is on
+	MetadataSalt string
 }
 
 type DatabaseConfig struct {
@@ -21,6 +127,238 @@ type DatabaseConfig struct {
 	Name     string
 	Port     int
 	SSLMode  string
+	// StrictSSL turns the warning about an unencrypted connection to a
+	// remote database into a startup error
+	StrictSSL bool
+	// QueryExecMode overrides pgx's default query exec mode, e.g.
+	// "simple_protocol" for PgBouncer in transaction mode; empty keeps
+	// pgx's default (cache_statement)
+	QueryExecMode string
+	// Schema is set as the search_path of every connection, so the tables
+	// are created and queried in it; empty keeps the server's default
+	Schema string
+	// ApplicationName is sent as application_name, with the build's
+	// revision appended when known, so the service can be told apart in
+	// pg_stat_activity
+	ApplicationName string
+	// StatementTimeout is set as statement_timeout on every connection, so
+	// Postgres cancels slower statements itself; 0 keeps the server's
+	// setting
+	StatementTimeout time.Duration
+	MaxConns         int
+	MinConns         int
+	// Warmup opens MinConns connections at startup, within WarmupTimeout,
+	// so the first requests don't wait for connections to be established
+	Warmup        bool
+	WarmupTimeout time.Duration
+	// WarmupQuery holds /readyz back until a count of the messages takes
+	// under WarmupQueryThreshold, so the first users don't find the query
+	// path cold
+	WarmupQuery          bool
+	WarmupQueryThreshold time.Duration
+	// BreakerThreshold is how many consecutive failed queries open the
+	// circuit breaker; 0 disables it
+	BreakerThreshold int
+	// BreakerCooldown is how long the open breaker fails queries before
+	// letting one probe through. It doubles after each failed probe, up
+	// to BreakerMaxCooldown.
+	BreakerCooldown    time.Duration
+	BreakerMaxCooldown time.Duration
+	// RetryAttempts is how many times batch and idempotent writes are tried
+	// when they fail with a serialization failure or deadlock; 0 or 1
+	// disables retries. RetryBackoff is the wait before the first retry, doubled
+	// before each later one.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+	// ReplicaURLs are connection strings for read replicas; reads are
+	// spread across them round-robin while writes go to the primary
+	ReplicaURLs []string
+}
+
+type LogConfig struct {
+	// AccessFormat selects an Apache-style access log ("common" or
+	// "combined"). Empty keeps the structured slog request log.
+	AccessFormat string
+	// AccessOutput is where access logs go: "stderr", "stdout" or a file
+	// path, appended to. It defaults to stderr because app logs go to
+	// stdout, and the two formats don't mix well on one stream.
+	AccessOutput string
+	// SampleRate is the fraction of successful (2xx) requests that get a
+	// "Request completed" log, from 0 to 1; other responses are always
+	// logged. It doesn't apply to access logs.
+	SampleRate float64
+	// SlowThreshold makes requests taking at least this long log a "Slow
+	// request" warning with extra detail, whatever the sample rate or
+	// access log format; 0 disables it
+	SlowThreshold time.Duration
+}
+
+// CORSConfig controls the cross-origin headers sent with every response
+type CORSConfig struct {
+	// Disabled leaves out the CORS middleware and all its headers, for
+	// deployments behind a gateway that handles CORS itself
+	Disabled bool
+	// AllowedOrigins lists the origins allowed to call the API; empty or
+	// containing "*" allows any origin
+	AllowedOrigins []string
+	// AllowCredentials sends Access-Control-Allow-Credentials: true. Browsers
+	// ignore it alongside a wildcard origin, so it needs explicit origins.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight result; 0 omits
+	// Access-Control-Max-Age
+	MaxAge time.Duration
+}
+
+// SecurityHeadersConfig controls the hardening headers sent with every
+// response
+type SecurityHeadersConfig struct {
+	// Enabled sends X-Content-Type-Options: nosniff along with the headers
+	// below; false sends none of them
+	Enabled bool
+	// FrameOptions is the X-Frame-Options value, DENY or SAMEORIGIN; empty
+	// omits the header
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy value; empty omits the header
+	ReferrerPolicy string
+	// HSTSMaxAge sends Strict-Transport-Security on requests made over
+	// TLS; 0 omits it
+	HSTSMaxAge time.Duration
+}
+
+// FrameOptionsValues are the accepted SECURITY_FRAME_OPTIONS values
+var FrameOptionsValues = []string{"DENY", "SAMEORIGIN"}
+
+// AllowsAnyOrigin reports whether every origin is allowed
+func (c CORSConfig) AllowsAnyOrigin() bool {
+	if len(c.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// FeaturesConfig switches optional endpoints on or off per environment.
+// Disabled endpoints aren't registered, so they answer 404.
+type FeaturesConfig struct {
+	// EnableSearch serves GET /api/v1/guestbook/search
+	EnableSearch bool
+	// EnableStats serves GET /api/v1/guestbook/count, /timeline and
+	// /api/v1/stats/message-lengths
+	EnableStats bool
+	// EnableNeighbors serves GET /api/v1/guestbook/{id}/neighbors
+	EnableNeighbors bool
+	// EnableAPIIndex answers OPTIONS / and /api/v1 with the registered
+	// resources and their methods
+	EnableAPIIndex bool
+}
+
+// DefaultFeatures returns the features enabled when no FEATURE_* variable
+// is set: all of them
+func DefaultFeatures() FeaturesConfig {
+	return FeaturesConfig{
+		EnableSearch:    true,
+		EnableStats:     true,
+		EnableNeighbors: true,
+		EnableAPIIndex:  true,
+	}
+}
+
+// Enabled returns the names of the enabled features, for logging
+func (f FeaturesConfig) Enabled() []string {
+	enabled := []string{}
+	if f.EnableSearch {
+		enabled = append(enabled, "search")
+	}
+	if f.EnableStats {
+		enabled = append(enabled, "stats")
+	}
+	if f.EnableNeighbors {
+		enabled = append(enabled, "neighbors")
+	}
+	if f.EnableAPIIndex {
+		enabled = append(enabled, "api_index")
+	}
+	return enabled
+}
+
+// SeedConfig describes the welcome message inserted into an empty guest book
+type SeedConfig struct {
+	Enabled bool
+	Name    string
+	Email   string
+	Message string
+	// File is a JSON or CSV file of messages imported on startup when the
+	// guest book is empty
+	File string
+}
+
+// CaptchaConfig enables CAPTCHA verification of new messages
+type CaptchaConfig struct {
+	Enabled bool
+	// Provider is "recaptcha" or "hcaptcha"; both share the siteverify API
+	Provider string
+	// Secret is the provider's server-side secret key
+	Secret string
+	// VerifyURL overrides the provider's verification endpoint
+	VerifyURL string
+	// Timeout bounds each verification request
+	Timeout time.Duration
+}
+
+// CaptchaProviders are the accepted CAPTCHA_PROVIDER values
+var CaptchaProviders = []string{"recaptcha", "hcaptcha"}
+
+// ValidationConfig bounds user input. Lengths are in characters (Unicode
+// code points), which is what responses report as char_count and what the
+// name column's VARCHAR limit counts.
+type ValidationConfig struct {
+	NameMin    int
+	NameMax    int
+	MessageMin int
+	MessageMax int
+	// MessageMaxBytes caps a message's UTF-8 encoded size, bounding the
+	// storage it takes however many bytes its characters need; 0 means
+	// 4 bytes per character of MessageMax, the most UTF-8 ever takes
+	MessageMaxBytes int
+}
+
+// MessageByteLimit returns the effective MessageMaxBytes
+func (v ValidationConfig) MessageByteLimit() int {
+	if v.MessageMaxBytes > 0 {
+		return v.MessageMaxBytes
+	}
+	return v.MessageMax * utf8.UTFMax
+}
+
+// schemaPattern matches the unquoted Postgres identifiers accepted as
+// DB_SCHEMA. The name ends up in a SET statement, so anything else is
+// rejected rather than escaped.
+var schemaPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// applicationNamePattern matches DB_APPLICATION_NAME values Postgres keeps
+// as given: it truncates application_name to 63 bytes and replaces
+// characters outside printable ASCII
+var applicationNamePattern = regexp.MustCompile(`^[ -~]{0,63}$`)
+
+// QueryExecModes are the accepted DB_QUERY_EXEC_MODE values, matching the
+// names pgx uses for its default_query_exec_mode connection parameter
+var QueryExecModes = []string{"cache_statement", "cache_describe", "describe_exec", "exec", "simple_protocol"}
+
+// maxNameColumnLength is the size of the name VARCHAR column
+const maxNameColumnLength = 100
+
+// DefaultValidationConfig returns the built-in field length bounds
+func DefaultValidationConfig() ValidationConfig {
+	return ValidationConfig{
+		NameMin:    2,
+		NameMax:    100,
+		MessageMin: 10,
+		MessageMax: 1000,
+	}
 }
 
 func Load() Config {
@@ -38,23 +376,533 @@ func Load() Config {
 
 	dbPort, _ := strconv.Atoi(getEnv("DB_PORT", "5432"))
 
+	validation := DefaultValidationConfig()
+	features := DefaultFeatures()
+
 	return Config{
-		Port:  port,
-		Debug: debug,
+		Host:             getEnv("BIND_ADDRESS", os.Getenv("HOST")),
+		Port:             port,
+		Debug:            debug,
+		LogRequestBodies: os.Getenv("LOG_REQUEST_BODIES") == "true",
+		JSONCharset:      getEnv("JSON_CHARSET", "utf-8"),
+		StringIDs:        os.Getenv("STRING_IDS") == "true",
 		DB: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", ""),
-			Name:     getEnv("DB_NAME", "postgres"),
-			Port:     dbPort,
-			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+			Host:                 getEnv("DB_HOST", "localhost"),
+			User:                 getEnv("DB_USER", "postgres"),
+			Password:             getEnv("DB_PASSWORD", ""),
+			Name:                 getEnv("DB_NAME", "postgres"),
+			Port:                 dbPort,
+			SSLMode:              getEnv("DB_SSL_MODE", "disable"),
+			StrictSSL:            os.Getenv("STRICT_SSL") == "true",
+			QueryExecMode:        os.Getenv("DB_QUERY_EXEC_MODE"),
+			Schema:               getEnv("DB_SCHEMA", "public"),
+			ApplicationName:      getEnv("DB_APPLICATION_NAME", "guestbook-api"),
+			StatementTimeout:     getEnvDuration("DB_STATEMENT_TIMEOUT", 30*time.Second),
+			MaxConns:             getEnvInt("DB_MAX_CONNS", 25),
+			MinConns:             getEnvInt("DB_MIN_CONNS", 5),
+			ReplicaURLs:          getEnvList("DB_REPLICA_URLS"),
+			Warmup:               getEnvBool("DB_WARMUP", false),
+			WarmupTimeout:        getEnvDuration("DB_WARMUP_TIMEOUT", 10*time.Second),
+			WarmupQuery:          getEnvBool("DB_WARMUP_QUERY", false),
+			WarmupQueryThreshold: getEnvDuration("DB_WARMUP_QUERY_THRESHOLD", 200*time.Millisecond),
+
+			BreakerThreshold:   getEnvInt("DB_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:    getEnvDuration("DB_BREAKER_COOLDOWN", 5*time.Second),
+			BreakerMaxCooldown: getEnvDuration("DB_BREAKER_MAX_COOLDOWN", time.Minute),
+
+			RetryAttempts: getEnvInt("DB_RETRY_ATTEMPTS", 3),
+			RetryBackoff:  getEnvDuration("DB_RETRY_BACKOFF", 50*time.Millisecond),
+		},
+		Log: LogConfig{
+			AccessFormat:  getEnv("LOG_ACCESS_FORMAT", ""),
+			AccessOutput:  getEnv("LOG_ACCESS_OUTPUT", "stderr"),
+			SampleRate:    getEnvFloat("LOG_SAMPLE_RATE", 1),
+			SlowThreshold: getEnvDuration("LOG_SLOW_THRESHOLD", 0),
+		},
+		Validation: ValidationConfig{
+			NameMin:         getEnvInt("NAME_MIN", validation.NameMin),
+			NameMax:         getEnvInt("NAME_MAX", validation.NameMax),
+			MessageMin:      getEnvInt("MESSAGE_MIN", validation.MessageMin),
+			MessageMax:      getEnvInt("MESSAGE_MAX", validation.MessageMax),
+			MessageMaxBytes: getEnvInt("MESSAGE_MAX_BYTES", validation.MessageMaxBytes),
+		},
+		CORS: CORSConfig{
+			Disabled:         !getEnvBool("CORS_ENABLED", true),
+			AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+			AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+			MaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+		},
+		Security: SecurityHeadersConfig{
+			Enabled:        getEnvBool("SECURITY_HEADERS", true),
+			FrameOptions:   getEnv("SECURITY_FRAME_OPTIONS", "DENY"),
+			ReferrerPolicy: getEnv("SECURITY_REFERRER_POLICY", "no-referrer"),
+			HSTSMaxAge:     getEnvDuration("SECURITY_HSTS_MAX_AGE", 0),
+		},
+		Features: FeaturesConfig{
+			EnableSearch:    getEnvBool("FEATURE_SEARCH", features.EnableSearch),
+			EnableStats:     getEnvBool("FEATURE_STATS", features.EnableStats),
+			EnableNeighbors: getEnvBool("FEATURE_NEIGHBORS", features.EnableNeighbors),
+			EnableAPIIndex:  getEnvBool("FEATURE_API_INDEX", features.EnableAPIIndex),
+		},
+		ModerationEnabled:   os.Getenv("MODERATION_ENABLED") == "true",
+		AdminToken:          os.Getenv("ADMIN_TOKEN"),
+		AuditLogDB:          os.Getenv("AUDIT_LOG_DB") == "true",
+		AsyncWorkers:        getEnvInt("ASYNC_WORKERS", 4),
+		AsyncQueueSize:      getEnvInt("ASYNC_QUEUE_SIZE", 1000),
+		EditWindow:          getEnvDuration("EDIT_WINDOW", 15*time.Minute),
+		IdempotencyKeyTTL:   getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		MaxOffset:           getEnvInt("MAX_OFFSET", 100000),
+		StrictPagination:    getEnvBool("STRICT_PAGINATION", false),
+		SnapshotTTL:         getEnvDuration("PAGINATION_SNAPSHOT_TTL", 0),
+		MaxSnapshots:        getEnvInt("PAGINATION_SNAPSHOT_MAX", 5),
+		MaxMessagesPerEmail: getEnvInt("MAX_MESSAGES_PER_EMAIL", 0),
+		ReadOnly:            os.Getenv("READ_ONLY") == "true",
+		MaxInflight:         getEnvInt("MAX_INFLIGHT", 0),
+		RequestTimeout:      getEnvDuration("REQUEST_TIMEOUT", 0),
+		ClientTimeoutMax:    getEnvDuration("CLIENT_TIMEOUT_MAX", 30*time.Second),
+		HealthCheckTimeout:  getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		PreShutdownDelay:    getEnvDuration("PRE_SHUTDOWN_DELAY", 0),
+		SystemdSocket:       os.Getenv("SYSTEMD_SOCKET") == "true",
+		CacheControlMaxAge:  getEnvDuration("CACHE_CONTROL_MAX_AGE", 0),
+		TrailingSlash:       getEnv("TRAILING_SLASH", "redirect"),
+		H2C:                 os.Getenv("ENABLE_H2C") == "true",
+		RobotsTxt:           strings.ReplaceAll(os.Getenv("ROBOTS_TXT"), `\n`, "\n"),
+		TempDir:             os.Getenv("TEMP_DIR"),
+		SanitizeInput:       getEnv("SANITIZE_INPUT", "none"),
+		PprofEnabled:        os.Getenv("ENABLE_PPROF") == "true",
+		PprofAddress:        getEnv("PPROF_ADDRESS", "localhost:6060"),
+		CaptureMetadata:     os.Getenv("CAPTURE_METADATA") == "true",
+		MetadataSalt:        os.Getenv("METADATA_SALT"),
+		Seed: SeedConfig{
+			Enabled: os.Getenv("SEED_MESSAGE") == "true",
+			Name:    getEnv("SEED_NAME", "Guest Book"),
+			Email:   getEnv("SEED_EMAIL", "welcome@example.com"),
+			Message: getEnv("SEED_MESSAGE_TEXT", "Welcome to the guest book! Be the first to leave a message."),
+			File:    os.Getenv("SEED_FILE"),
+		},
+		Captcha: CaptchaConfig{
+			Enabled:   os.Getenv("CAPTCHA_ENABLED") == "true",
+			Provider:  getEnv("CAPTCHA_PROVIDER", "recaptcha"),
+			Secret:    os.Getenv("CAPTCHA_SECRET"),
+			VerifyURL: os.Getenv("CAPTCHA_VERIFY_URL"),
+			Timeout:   getEnvDuration("CAPTCHA_TIMEOUT", 5*time.Second),
 		},
 	}
 }
 
+// Address returns the host:port the server listens on
+func (c Config) Address() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+// Validate checks the configuration for values that would prevent startup
+func (c Config) Validate() error {
+	host, port, err := net.SplitHostPort(c.Address())
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", c.Address(), err)
+	}
+
+	if host != "" && net.ParseIP(host) == nil && !isValidHostname(host) {
+		return fmt.Errorf("invalid listen host %q: must be an IP address or hostname", host)
+	}
+
+	portNum, err := strconv.Atoi(port)
+	if err != nil || portNum < 0 || portNum > 65535 {
+		return fmt.Errorf("invalid port %q: must be a number between 0 and 65535", port)
+	}
+
+	if c.DB.MinConns < 0 || c.DB.MaxConns < 1 || c.DB.MinConns > c.DB.MaxConns {
+		return fmt.Errorf("invalid database pool size: min %d, max %d", c.DB.MinConns, c.DB.MaxConns)
+	}
+
+	if c.DB.Warmup && c.DB.WarmupTimeout <= 0 {
+		return fmt.Errorf("invalid DB_WARMUP_TIMEOUT %s: must be positive", c.DB.WarmupTimeout)
+	}
+
+	if c.DB.WarmupQuery && c.DB.WarmupQueryThreshold <= 0 {
+		return fmt.Errorf("invalid DB_WARMUP_QUERY_THRESHOLD %s: must be positive", c.DB.WarmupQueryThreshold)
+	}
+
+	if c.DB.SSLMode == "disable" && !isLocalHost(c.DB.Host) {
+		if c.DB.StrictSSL {
+			return fmt.Errorf("DB_SSL_MODE=disable is not allowed for remote database host %q when STRICT_SSL is set", c.DB.Host)
+		}
+		slog.Warn("Database connection to a remote host is unencrypted; set DB_SSL_MODE to require or higher",
+			"host", c.DB.Host, "ssl_mode", c.DB.SSLMode)
+	}
+
+	if c.DB.QueryExecMode != "" && !slices.Contains(QueryExecModes, c.DB.QueryExecMode) {
+		return fmt.Errorf("invalid DB_QUERY_EXEC_MODE %q: must be one of %s", c.DB.QueryExecMode, strings.Join(QueryExecModes, ", "))
+	}
+
+	if c.DB.Schema != "" && !schemaPattern.MatchString(c.DB.Schema) {
+		return fmt.Errorf("invalid DB_SCHEMA %q: must start with a letter or underscore, contain only letters, digits and underscores, and be at most 63 characters", c.DB.Schema)
+	}
+
+	// Postgres takes whole milliseconds, and 0 would disable the timeout
+	if c.DB.StatementTimeout < 0 || (c.DB.StatementTimeout > 0 && c.DB.StatementTimeout < time.Millisecond) {
+		return fmt.Errorf("invalid DB_STATEMENT_TIMEOUT %s: must be 0 or at least 1ms", c.DB.StatementTimeout)
+	}
+
+	if !applicationNamePattern.MatchString(c.DB.ApplicationName) {
+		return fmt.Errorf("invalid DB_APPLICATION_NAME %q: must be at most 63 printable ASCII characters", c.DB.ApplicationName)
+	}
+
+	if c.DB.BreakerThreshold < 0 {
+		return fmt.Errorf("DB_BREAKER_THRESHOLD must not be negative, got %d", c.DB.BreakerThreshold)
+	}
+
+	if c.DB.BreakerThreshold > 0 && (c.DB.BreakerCooldown <= 0 || c.DB.BreakerMaxCooldown < c.DB.BreakerCooldown) {
+		return fmt.Errorf("invalid database breaker cooldown %s (max %s): must be positive and at most DB_BREAKER_MAX_COOLDOWN", c.DB.BreakerCooldown, c.DB.BreakerMaxCooldown)
+	}
+
+	if c.DB.RetryAttempts < 0 || c.DB.RetryBackoff < 0 {
+		return fmt.Errorf("invalid database retries: DB_RETRY_ATTEMPTS and DB_RETRY_BACKOFF must not be negative, got %d and %s", c.DB.RetryAttempts, c.DB.RetryBackoff)
+	}
+
+	// Written this way round so NaN is rejected too
+	if !(c.Log.SampleRate >= 0 && c.Log.SampleRate <= 1) {
+		return fmt.Errorf("LOG_SAMPLE_RATE must be between 0 and 1, got %g", c.Log.SampleRate)
+	}
+
+	if c.Log.SlowThreshold < 0 {
+		return fmt.Errorf("LOG_SLOW_THRESHOLD must not be negative, got %s", c.Log.SlowThreshold)
+	}
+
+	if c.AsyncWorkers < 1 || c.AsyncQueueSize < 0 {
+		return fmt.Errorf("invalid background task pool: ASYNC_WORKERS must be at least 1 and ASYNC_QUEUE_SIZE not negative, got %d and %d", c.AsyncWorkers, c.AsyncQueueSize)
+	}
+
+	if c.EditWindow < 0 {
+		return fmt.Errorf("invalid EDIT_WINDOW %s: must not be negative", c.EditWindow)
+	}
+
+	if c.IdempotencyKeyTTL < 0 {
+		return fmt.Errorf("invalid IDEMPOTENCY_KEY_TTL %s: must not be negative", c.IdempotencyKeyTTL)
+	}
+
+	if c.SnapshotTTL < 0 {
+		return fmt.Errorf("invalid PAGINATION_SNAPSHOT_TTL %s: must not be negative", c.SnapshotTTL)
+	}
+
+	// Every open snapshot holds a connection, so they mustn't be able to
+	// take them all
+	if c.SnapshotTTL > 0 && (c.MaxSnapshots < 1 || c.MaxSnapshots >= c.DB.MaxConns) {
+		return fmt.Errorf("invalid PAGINATION_SNAPSHOT_MAX %d: must be at least 1 and less than DB_MAX_CONNS (%d)", c.MaxSnapshots, c.DB.MaxConns)
+	}
+
+	if c.MaxOffset < 0 {
+		return fmt.Errorf("invalid MAX_OFFSET %d: must not be negative", c.MaxOffset)
+	}
+
+	if c.MaxMessagesPerEmail < 0 {
+		return fmt.Errorf("invalid MAX_MESSAGES_PER_EMAIL %d: must not be negative", c.MaxMessagesPerEmail)
+	}
+
+	if c.MaxInflight < 0 {
+		return fmt.Errorf("MAX_INFLIGHT must not be negative, got %d", c.MaxInflight)
+	}
+
+	if c.RequestTimeout < 0 {
+		return fmt.Errorf("REQUEST_TIMEOUT must not be negative, got %s", c.RequestTimeout)
+	}
+
+	if c.ClientTimeoutMax < 0 {
+		return fmt.Errorf("CLIENT_TIMEOUT_MAX must not be negative, got %s", c.ClientTimeoutMax)
+	}
+
+	if c.HealthCheckTimeout <= 0 {
+		return fmt.Errorf("HEALTH_CHECK_TIMEOUT must be positive, got %s", c.HealthCheckTimeout)
+	}
+
+	if c.PreShutdownDelay < 0 {
+		return fmt.Errorf("PRE_SHUTDOWN_DELAY must not be negative, got %s", c.PreShutdownDelay)
+	}
+
+	if c.JSONCharset != "" && !strings.EqualFold(c.JSONCharset, "utf-8") {
+		return fmt.Errorf("invalid JSON_CHARSET %q: must be utf-8, or empty", c.JSONCharset)
+	}
+
+	if c.Security.FrameOptions != "" && !slices.Contains(FrameOptionsValues, c.Security.FrameOptions) {
+		return fmt.Errorf("invalid SECURITY_FRAME_OPTIONS %q: must be one of %s, or empty", c.Security.FrameOptions, strings.Join(FrameOptionsValues, ", "))
+	}
+
+	if c.Security.HSTSMaxAge < 0 {
+		return fmt.Errorf("SECURITY_HSTS_MAX_AGE must not be negative, got %s", c.Security.HSTSMaxAge)
+	}
+
+	if c.CacheControlMaxAge < 0 {
+		return fmt.Errorf("CACHE_CONTROL_MAX_AGE must not be negative, got %s", c.CacheControlMaxAge)
+	}
+
+	if c.CORS.MaxAge < 0 {
+		return fmt.Errorf("CORS_MAX_AGE must not be negative, got %s", c.CORS.MaxAge)
+	}
+
+	if c.CORS.AllowCredentials && c.CORS.AllowsAnyOrigin() {
+		return fmt.Errorf("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list specific origins instead of *")
+	}
+
+	switch c.TrailingSlash {
+	case "", "redirect", "strict":
+	default:
+		return fmt.Errorf("invalid TRAILING_SLASH %q: must be redirect or strict", c.TrailingSlash)
+	}
+
+	switch c.SanitizeInput {
+	case "", "none", "escape", "strip":
+	default:
+		return fmt.Errorf("invalid SANITIZE_INPUT %q: must be none, escape, or strip", c.SanitizeInput)
+	}
+
+	if ext := strings.ToLower(filepath.Ext(c.Seed.File)); c.Seed.File != "" && ext != ".json" && ext != ".csv" {
+		return fmt.Errorf("invalid SEED_FILE %q: must be a .json or .csv file", c.Seed.File)
+	}
+
+	if c.Captcha.Enabled {
+		if !slices.Contains(CaptchaProviders, c.Captcha.Provider) {
+			return fmt.Errorf("invalid CAPTCHA_PROVIDER %q: must be one of %s", c.Captcha.Provider, strings.Join(CaptchaProviders, ", "))
+		}
+		if c.Captcha.Secret == "" {
+			return fmt.Errorf("CAPTCHA_SECRET is required when CAPTCHA_ENABLED is set")
+		}
+		if c.Captcha.Timeout <= 0 {
+			return fmt.Errorf("invalid CAPTCHA_TIMEOUT %s: must be positive", c.Captcha.Timeout)
+		}
+	}
+
+	if c.CaptureMetadata && c.MetadataSalt == "" {
+		return fmt.Errorf("METADATA_SALT is required when CAPTURE_METADATA is enabled")
+	}
+
+	if c.PprofEnabled {
+		if _, _, err := net.SplitHostPort(c.PprofAddress); err != nil {
+			return fmt.Errorf("invalid PPROF_ADDRESS %q: %w", c.PprofAddress, err)
+		}
+		if c.PprofAddress == c.Address() {
+			return fmt.Errorf("PPROF_ADDRESS %q must differ from the API listen address", c.PprofAddress)
+		}
+	}
+
+	if err := c.Validation.Validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate checks that the bounds are positive, ordered, and fit the schema
+func (v ValidationConfig) Validate() error {
+	if v.NameMin < 1 || v.NameMin > v.NameMax {
+		return fmt.Errorf("invalid name length bounds %d-%d", v.NameMin, v.NameMax)
+	}
+
+	if v.NameMax > maxNameColumnLength {
+		return fmt.Errorf("NAME_MAX %d exceeds the name column length of %d", v.NameMax, maxNameColumnLength)
+	}
+
+	if v.MessageMin < 1 || v.MessageMin > v.MessageMax {
+		return fmt.Errorf("invalid message length bounds %d-%d", v.MessageMin, v.MessageMax)
+	}
+
+	// Every character takes at least a byte, so a smaller cap would make
+	// MESSAGE_MAX unreachable
+	if v.MessageMaxBytes < 0 || (v.MessageMaxBytes > 0 && v.MessageMaxBytes < v.MessageMax) {
+		return fmt.Errorf("invalid MESSAGE_MAX_BYTES %d: must be 0 or at least MESSAGE_MAX (%d)", v.MessageMaxBytes, v.MessageMax)
+	}
+
+	return nil
+}
+
+// redacted replaces a secret with a fixed mask, keeping empty values visible
+// so it's clear whether the secret is set at all
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "***"
+}
+
+// LogValue implements slog.LogValuer so logging a Config never exposes secrets
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("host", c.Host),
+		slog.String("port", c.Port),
+		slog.Bool("debug", c.Debug),
+		slog.Bool("log_request_bodies", c.LogRequestBodies),
+		slog.String("json_charset", c.JSONCharset),
+		slog.Bool("string_ids", c.StringIDs),
+		slog.Any("db", c.DB),
+		slog.String("log_access_format", c.Log.AccessFormat),
+		slog.String("log_access_output", c.Log.AccessOutput),
+		slog.Float64("log_sample_rate", c.Log.SampleRate),
+		slog.Duration("log_slow_threshold", c.Log.SlowThreshold),
+		slog.Any("validation", c.Validation),
+		slog.Bool("cors_enabled", !c.CORS.Disabled),
+		slog.String("cors_allowed_origins", strings.Join(c.CORS.AllowedOrigins, ",")),
+		slog.Bool("cors_allow_credentials", c.CORS.AllowCredentials),
+		slog.Duration("cors_max_age", c.CORS.MaxAge),
+		slog.Bool("security_headers", c.Security.Enabled),
+		slog.String("security_frame_options", c.Security.FrameOptions),
+		slog.String("security_referrer_policy", c.Security.ReferrerPolicy),
+		slog.Duration("security_hsts_max_age", c.Security.HSTSMaxAge),
+		slog.String("features", strings.Join(c.Features.Enabled(), ",")),
+		slog.Bool("moderation_enabled", c.ModerationEnabled),
+		slog.String("admin_token", redacted(c.AdminToken)),
+		slog.Bool("audit_log_db", c.AuditLogDB),
+		slog.Int("async_workers", c.AsyncWorkers),
+		slog.Int("async_queue_size", c.AsyncQueueSize),
+		slog.Duration("edit_window", c.EditWindow),
+		slog.Duration("idempotency_key_ttl", c.IdempotencyKeyTTL),
+		slog.Int("max_offset", c.MaxOffset),
+		slog.Bool("strict_pagination", c.StrictPagination),
+		slog.Duration("pagination_snapshot_ttl", c.SnapshotTTL),
+		slog.Int("pagination_snapshot_max", c.MaxSnapshots),
+		slog.Int("max_messages_per_email", c.MaxMessagesPerEmail),
+		slog.Bool("read_only", c.ReadOnly),
+		slog.Int("max_inflight", c.MaxInflight),
+		slog.Duration("request_timeout", c.RequestTimeout),
+		slog.Duration("client_timeout_max", c.ClientTimeoutMax),
+		slog.Duration("health_check_timeout", c.HealthCheckTimeout),
+		slog.Duration("pre_shutdown_delay", c.PreShutdownDelay),
+		slog.Bool("systemd_socket", c.SystemdSocket),
+		slog.Duration("cache_control_max_age", c.CacheControlMaxAge),
+		slog.String("trailing_slash", c.TrailingSlash),
+		slog.Bool("h2c", c.H2C),
+		slog.String("temp_dir", c.TempDir),
+		slog.String("sanitize_input", c.SanitizeInput),
+		slog.Bool("pprof_enabled", c.PprofEnabled),
+		slog.String("pprof_address", c.PprofAddress),
+		slog.Bool("seed_message", c.Seed.Enabled),
+		slog.String("seed_file", c.Seed.File),
+		slog.Bool("captcha_enabled", c.Captcha.Enabled),
+		slog.String("captcha_provider", c.Captcha.Provider),
+		slog.String("captcha_secret", redacted(c.Captcha.Secret)),
+		slog.Bool("capture_metadata", c.CaptureMetadata),
+		slog.String("metadata_salt", redacted(c.MetadataSalt)),
+	)
+}
+
+// LogValue implements slog.LogValuer, redacting the password
+func (d DatabaseConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("host", d.Host),
+		slog.Int("port", d.Port),
+		slog.String("user", d.User),
+		slog.String("password", redacted(d.Password)),
+		slog.String("name", d.Name),
+		slog.String("ssl_mode", d.SSLMode),
+		slog.Bool("strict_ssl", d.StrictSSL),
+		slog.String("query_exec_mode", d.QueryExecMode),
+		slog.String("schema", d.Schema),
+		slog.String("application_name", d.ApplicationName),
+		slog.Duration("statement_timeout", d.StatementTimeout),
+		slog.Int("max_conns", d.MaxConns),
+		slog.Int("min_conns", d.MinConns),
+		slog.Bool("warmup", d.Warmup),
+		slog.Duration("warmup_timeout", d.WarmupTimeout),
+		slog.Bool("warmup_query", d.WarmupQuery),
+		slog.Duration("warmup_query_threshold", d.WarmupQueryThreshold),
+		slog.Int("replicas", len(d.ReplicaURLs)),
+		slog.Int("breaker_threshold", d.BreakerThreshold),
+		slog.Duration("breaker_cooldown", d.BreakerCooldown),
+		slog.Duration("breaker_max_cooldown", d.BreakerMaxCooldown),
+		slog.Int("retry_attempts", d.RetryAttempts),
+		slog.Duration("retry_backoff", d.RetryBackoff),
+	)
+}
+
+// isLocalHost reports whether host refers to this machine: loopback, or
+// empty or a Unix socket directory, which connect without TCP
+func isLocalHost(host string) bool {
+	if host == "" || host == "localhost" || strings.HasPrefix(host, "/") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isValidHostname(host string) bool {
+	for _, r := range host {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return i
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s=%q, using default %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s=%q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s=%q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
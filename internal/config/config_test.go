@@ -0,0 +1,765 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a minimal configuration that passes Validate
+func validConfig() Config {
+	return Config{
+		Port:               "4260",
+		DB:                 DatabaseConfig{MaxConns: 25, MinConns: 5},
+		Validation:         DefaultValidationConfig(),
+		HealthCheckTimeout: 2 * time.Second,
+		AsyncWorkers:       4,
+	}
+}
+
+func TestConfig_Address(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		port     string
+		expected string
+	}{
+		{
+			name:     "All interfaces",
+			host:     "",
+			port:     "4260",
+			expected: ":4260",
+		},
+		{
+			name:     "IPv4 loopback",
+			host:     "127.0.0.1",
+			port:     "4260",
+			expected: "127.0.0.1:4260",
+		},
+		{
+			name:     "IPv6 loopback",
+			host:     "::1",
+			port:     "4260",
+			expected: "[::1]:4260",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Host: tt.host, Port: tt.port}
+			if got := cfg.Address(); got != tt.expected {
+				t.Errorf("Expected address %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_Address(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		port      string
+		expectErr bool
+	}{
+		{name: "Default", host: "", port: "4260", expectErr: false},
+		{name: "Loopback", host: "127.0.0.1", port: "8080", expectErr: false},
+		{name: "IPv6", host: "::1", port: "8080", expectErr: false},
+		{name: "Random port", host: "", port: "0", expectErr: false},
+		{name: "Non-numeric port", host: "", port: "http", expectErr: true},
+		{name: "Port out of range", host: "", port: "70000", expectErr: true},
+		{name: "Hostname", host: "localhost", port: "8080", expectErr: false},
+		{name: "Host containing port", host: "127.0.0.1:80", port: "8080", expectErr: true},
+		{name: "Host with spaces", host: "bad host", port: "8080", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Host, cfg.Port = tt.host, tt.port
+			err := cfg.Validate()
+			if tt.expectErr && err == nil {
+				t.Error("Expected validation error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("Expected no validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidationConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(v *ValidationConfig)
+		expectErr bool
+	}{
+		{name: "Defaults", modify: func(v *ValidationConfig) {}, expectErr: false},
+		{name: "Tighter bounds", modify: func(v *ValidationConfig) { v.NameMin, v.NameMax = 5, 50 }, expectErr: false},
+		{name: "Zero name min", modify: func(v *ValidationConfig) { v.NameMin = 0 }, expectErr: true},
+		{name: "Name min above max", modify: func(v *ValidationConfig) { v.NameMin = 60; v.NameMax = 50 }, expectErr: true},
+		{name: "Name max beyond column", modify: func(v *ValidationConfig) { v.NameMax = 101 }, expectErr: true},
+		{name: "Message min above max", modify: func(v *ValidationConfig) { v.MessageMin = 2000 }, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := DefaultValidationConfig()
+			tt.modify(&v)
+
+			err := v.Validate()
+			if tt.expectErr && err == nil {
+				t.Error("Expected validation error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("Expected no validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad_ValidationLimits(t *testing.T) {
+	t.Setenv("NAME_MIN", "3")
+	t.Setenv("NAME_MAX", "50")
+	t.Setenv("MESSAGE_MIN", "")
+	t.Setenv("MESSAGE_MAX", "not-a-number")
+
+	cfg := Load()
+
+	expected := ValidationConfig{NameMin: 3, NameMax: 50, MessageMin: 10, MessageMax: 1000}
+	if cfg.Validation != expected {
+		t.Errorf("Expected validation config %+v, got %+v", expected, cfg.Validation)
+	}
+}
+
+func TestConfig_Validate_SanitizeInput(t *testing.T) {
+	for _, mode := range []string{"", "none", "escape", "strip"} {
+		cfg := validConfig()
+		cfg.SanitizeInput = mode
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected SANITIZE_INPUT=%q to be valid, got %v", mode, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.SanitizeInput = "bluemonday"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected unknown SANITIZE_INPUT to be rejected")
+	}
+}
+
+func TestConfig_Validate_TrailingSlash(t *testing.T) {
+	for _, mode := range []string{"", "redirect", "strict"} {
+		cfg := validConfig()
+		cfg.TrailingSlash = mode
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected TRAILING_SLASH=%q to be valid, got %v", mode, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.TrailingSlash = "ignore"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected unknown TRAILING_SLASH to be rejected")
+	}
+}
+
+func TestConfig_Validate_CacheControlMaxAge(t *testing.T) {
+	cfg := validConfig()
+	cfg.CacheControlMaxAge = time.Minute
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a positive CACHE_CONTROL_MAX_AGE to be valid, got %v", err)
+	}
+
+	cfg.CacheControlMaxAge = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative CACHE_CONTROL_MAX_AGE to be rejected")
+	}
+}
+
+func TestConfig_Validate_JSONCharset(t *testing.T) {
+	for _, value := range []string{"", "utf-8", "UTF-8"} {
+		cfg := validConfig()
+		cfg.JSONCharset = value
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected JSON_CHARSET=%q to be valid, got %v", value, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.JSONCharset = "iso-8859-1"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected JSON_CHARSET=iso-8859-1 to be rejected")
+	}
+}
+
+func TestConfig_Validate_SecurityHeaders(t *testing.T) {
+	for _, value := range []string{"", "DENY", "SAMEORIGIN"} {
+		cfg := validConfig()
+		cfg.Security.FrameOptions = value
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected SECURITY_FRAME_OPTIONS=%q to be valid, got %v", value, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Security.FrameOptions = "ALLOW-FROM https://example.com"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected unknown SECURITY_FRAME_OPTIONS to be rejected")
+	}
+
+	cfg = validConfig()
+	cfg.Security.HSTSMaxAge = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative SECURITY_HSTS_MAX_AGE to be rejected")
+	}
+}
+
+func TestConfig_Validate_CORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    CORSConfig
+		wantErr bool
+	}{
+		{name: "Defaults", cors: CORSConfig{}, wantErr: false},
+		{name: "Credentials with specific origins", cors: CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}, wantErr: false},
+		{name: "Credentials with any origin", cors: CORSConfig{AllowCredentials: true}, wantErr: true},
+		{name: "Credentials with wildcard origin", cors: CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true}, wantErr: true},
+		{name: "Negative max age", cors: CORSConfig{MaxAge: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.CORS = tt.cors
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_SSLMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		host        string
+		sslMode     string
+		strict      bool
+		wantErr     bool
+		wantWarning bool
+	}{
+		{name: "Local host without SSL", host: "localhost", sslMode: "disable"},
+		{name: "Loopback IP without SSL", host: "127.0.0.1", sslMode: "disable", strict: true},
+		{name: "Unix socket without SSL", host: "/var/run/postgresql", sslMode: "disable", strict: true},
+		{name: "Remote host without SSL", host: "db.example.com", sslMode: "disable", wantWarning: true},
+		{name: "Remote host without SSL in strict mode", host: "db.example.com", sslMode: "disable", strict: true, wantErr: true},
+		{name: "Remote host with SSL in strict mode", host: "10.0.0.5", sslMode: "require", strict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			defer slog.SetDefault(previous)
+
+			cfg := validConfig()
+			cfg.DB.Host = tt.host
+			cfg.DB.SSLMode = tt.sslMode
+			cfg.DB.StrictSSL = tt.strict
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			warned := strings.Contains(logs.String(), "level=WARN")
+			if warned != tt.wantWarning {
+				t.Errorf("Expected warning %v, got logs %q", tt.wantWarning, logs.String())
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_QueryExecMode(t *testing.T) {
+	for _, mode := range append([]string{""}, QueryExecModes...) {
+		cfg := validConfig()
+		cfg.DB.QueryExecMode = mode
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected DB_QUERY_EXEC_MODE %q to be valid, got %v", mode, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.DB.QueryExecMode = "prepared"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an unknown DB_QUERY_EXEC_MODE to be rejected")
+	}
+}
+
+func TestConfig_Validate_Schema(t *testing.T) {
+	for _, schema := range []string{"", "public", "tenant_a", "_staging2", strings.Repeat("s", 63)} {
+		cfg := validConfig()
+		cfg.DB.Schema = schema
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected DB_SCHEMA %q to be valid, got %v", schema, err)
+		}
+	}
+
+	for _, schema := range []string{"2fast", "tenant-a", "public; DROP TABLE guest_book_messages", `tenant"a`, "ümlaut", strings.Repeat("s", 64)} {
+		cfg := validConfig()
+		cfg.DB.Schema = schema
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected DB_SCHEMA %q to be rejected", schema)
+		}
+	}
+}
+
+func TestLoad_Schema(t *testing.T) {
+	if got := Load().DB.Schema; got != "public" {
+		t.Errorf("Expected DB_SCHEMA to default to public, got %q", got)
+	}
+
+	t.Setenv("DB_SCHEMA", "tenant_a")
+	if got := Load().DB.Schema; got != "tenant_a" {
+		t.Errorf("Expected DB_SCHEMA tenant_a, got %q", got)
+	}
+}
+
+func TestLoad_StrictPagination(t *testing.T) {
+	if Load().StrictPagination {
+		t.Error("Expected STRICT_PAGINATION to default to false")
+	}
+
+	t.Setenv("STRICT_PAGINATION", "true")
+	if !Load().StrictPagination {
+		t.Error("Expected STRICT_PAGINATION=true to enable strict pagination")
+	}
+}
+
+func TestLoad_CORSEnabled(t *testing.T) {
+	if Load().CORS.Disabled {
+		t.Error("Expected CORS to be enabled by default")
+	}
+
+	t.Setenv("CORS_ENABLED", "false")
+	if !Load().CORS.Disabled {
+		t.Error("Expected CORS_ENABLED=false to disable CORS")
+	}
+}
+
+func TestConfig_Validate_ApplicationName(t *testing.T) {
+	for _, name := range []string{"", "guestbook-api", "guestbook api (eu-west)"} {
+		cfg := validConfig()
+		cfg.DB.ApplicationName = name
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected DB_APPLICATION_NAME=%q to be valid, got %v", name, err)
+		}
+	}
+
+	for _, name := range []string{strings.Repeat("a", 64), "gästebuch", "guestbook\napi"} {
+		cfg := validConfig()
+		cfg.DB.ApplicationName = name
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected DB_APPLICATION_NAME=%q to be rejected", name)
+		}
+	}
+}
+
+func TestValidationConfig_MessageByteLimit(t *testing.T) {
+	limits := DefaultValidationConfig()
+	if got := limits.MessageByteLimit(); got != 4*limits.MessageMax {
+		t.Errorf("Expected the default byte limit to allow 4 bytes per character, got %d", got)
+	}
+
+	limits.MessageMaxBytes = 2000
+	if got := limits.MessageByteLimit(); got != 2000 {
+		t.Errorf("Expected MESSAGE_MAX_BYTES to be used, got %d", got)
+	}
+	if err := limits.Validate(); err != nil {
+		t.Errorf("Expected MESSAGE_MAX_BYTES 2000 to be valid, got %v", err)
+	}
+
+	limits.MessageMaxBytes = limits.MessageMax - 1
+	if err := limits.Validate(); err == nil {
+		t.Error("Expected MESSAGE_MAX_BYTES below MESSAGE_MAX to be rejected")
+	}
+}
+
+func TestConfig_Validate_Retry(t *testing.T) {
+	cfg := validConfig()
+	cfg.DB.RetryAttempts = 3
+	cfg.DB.RetryBackoff = 50 * time.Millisecond
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected retry settings to be valid, got %v", err)
+	}
+
+	cfg.DB.RetryAttempts = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative DB_RETRY_ATTEMPTS to be rejected")
+	}
+
+	cfg.DB.RetryAttempts = 3
+	cfg.DB.RetryBackoff = -time.Millisecond
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative DB_RETRY_BACKOFF to be rejected")
+	}
+}
+
+func TestConfig_Validate_Snapshots(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		maxSnapshots int
+		expectErr    bool
+	}{
+		{name: "Disabled", ttl: 0, maxSnapshots: 0, expectErr: false},
+		{name: "Enabled", ttl: time.Minute, maxSnapshots: 5, expectErr: false},
+		{name: "Negative TTL", ttl: -time.Minute, maxSnapshots: 5, expectErr: true},
+		{name: "No snapshots allowed", ttl: time.Minute, maxSnapshots: 0, expectErr: true},
+		{name: "As many snapshots as connections", ttl: time.Minute, maxSnapshots: 25, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.SnapshotTTL = tt.ttl
+			cfg.MaxSnapshots = tt.maxSnapshots
+
+			if err := cfg.Validate(); (err != nil) != tt.expectErr {
+				t.Errorf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_StatementTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Millisecond, 30 * time.Second} {
+		cfg := validConfig()
+		cfg.DB.StatementTimeout = timeout
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected DB_STATEMENT_TIMEOUT=%s to be valid, got %v", timeout, err)
+		}
+	}
+
+	for _, timeout := range []time.Duration{-time.Second, 500 * time.Microsecond} {
+		cfg := validConfig()
+		cfg.DB.StatementTimeout = timeout
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected DB_STATEMENT_TIMEOUT=%s to be rejected", timeout)
+		}
+	}
+}
+
+func TestConfig_Validate_WarmupQuery(t *testing.T) {
+	cfg := validConfig()
+	cfg.DB.WarmupQuery = true
+	cfg.DB.WarmupQueryThreshold = 200 * time.Millisecond
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a positive DB_WARMUP_QUERY_THRESHOLD to be valid, got %v", err)
+	}
+
+	cfg.DB.WarmupQueryThreshold = 0
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected DB_WARMUP_QUERY_THRESHOLD=0 to be rejected when DB_WARMUP_QUERY is set")
+	}
+
+	cfg.DB.WarmupQuery = false
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected the threshold to be ignored without DB_WARMUP_QUERY, got %v", err)
+	}
+}
+
+func TestConfig_Validate_Breaker(t *testing.T) {
+	tests := []struct {
+		name        string
+		threshold   int
+		cooldown    time.Duration
+		maxCooldown time.Duration
+		wantErr     bool
+	}{
+		{name: "Disabled", threshold: 0},
+		{name: "Defaults", threshold: 5, cooldown: 5 * time.Second, maxCooldown: time.Minute},
+		{name: "Fixed cooldown", threshold: 5, cooldown: 5 * time.Second, maxCooldown: 5 * time.Second},
+		{name: "Negative threshold", threshold: -1, wantErr: true},
+		{name: "Zero cooldown", threshold: 5, maxCooldown: time.Minute, wantErr: true},
+		{name: "Max below cooldown", threshold: 5, cooldown: time.Minute, maxCooldown: time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.DB.BreakerThreshold = tt.threshold
+			cfg.DB.BreakerCooldown = tt.cooldown
+			cfg.DB.BreakerMaxCooldown = tt.maxCooldown
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_MetadataSalt(t *testing.T) {
+	cfg := validConfig()
+	cfg.CaptureMetadata = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected CAPTURE_METADATA without METADATA_SALT to be rejected")
+	}
+
+	cfg.MetadataSalt = "pepper"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected salted metadata capture to be valid, got %v", err)
+	}
+}
+
+func TestConfig_Validate_PprofAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{name: "Separate port", address: "localhost:6060", wantErr: false},
+		{name: "Missing port", address: "localhost", wantErr: true},
+		{name: "Same as API address", address: "127.0.0.1:8080", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Host = "127.0.0.1"
+			cfg.Port = "8080"
+			cfg.PprofEnabled = true
+			cfg.PprofAddress = tt.address
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig_LogValue_RedactsSecrets(t *testing.T) {
+	cfg := Config{
+		Port: "4260",
+		DB: DatabaseConfig{
+			Host:     "db.internal",
+			User:     "guestbook",
+			Password: "super-secret-password",
+			Name:     "guestbook_prod",
+			Port:     5432,
+			MaxConns: 25,
+			MinConns: 5,
+		},
+		AdminToken:   "super-secret-token",
+		MetadataSalt: "super-secret-salt",
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("Loaded configuration", "config", cfg)
+
+	output := buf.String()
+	for _, secret := range []string{cfg.DB.Password, cfg.AdminToken, cfg.MetadataSalt} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Expected secret %q to be redacted, got %s", secret, output)
+		}
+	}
+
+	var entry struct {
+		Config struct {
+			Port       string `json:"port"`
+			AdminToken string `json:"admin_token"`
+			DB         struct {
+				Host     string `json:"host"`
+				Password string `json:"password"`
+				MaxConns int    `json:"max_conns"`
+			} `json:"db"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal log entry: %v", err)
+	}
+
+	if entry.Config.DB.Password != "***" {
+		t.Errorf("Expected password to be masked as ***, got %q", entry.Config.DB.Password)
+	}
+	if entry.Config.AdminToken != "***" {
+		t.Errorf("Expected admin token to be masked as ***, got %q", entry.Config.AdminToken)
+	}
+	if entry.Config.DB.Host != "db.internal" || entry.Config.Port != "4260" || entry.Config.DB.MaxConns != 25 {
+		t.Errorf("Expected non-secret fields to be logged, got %+v", entry.Config)
+	}
+}
+
+func TestFeaturesConfig_Enabled(t *testing.T) {
+	if got := strings.Join(DefaultFeatures().Enabled(), ","); got != "search,stats,neighbors,api_index" {
+		t.Errorf("Expected all features enabled by default, got %q", got)
+	}
+
+	features := DefaultFeatures()
+	features.EnableStats = false
+	if got := strings.Join(features.Enabled(), ","); got != "search,neighbors,api_index" {
+		t.Errorf("Expected stats to be disabled, got %q", got)
+	}
+
+	if got := (FeaturesConfig{}).Enabled(); len(got) != 0 {
+		t.Errorf("Expected no enabled features, got %v", got)
+	}
+}
+
+func TestLoad_Features(t *testing.T) {
+	t.Setenv("FEATURE_SEARCH", "false")
+	t.Setenv("FEATURE_STATS", "")
+	t.Setenv("FEATURE_NEIGHBORS", "not-a-bool")
+	t.Setenv("FEATURE_API_INDEX", "false")
+
+	cfg := Load()
+
+	expected := FeaturesConfig{EnableSearch: false, EnableStats: true, EnableNeighbors: true, EnableAPIIndex: false}
+	if cfg.Features != expected {
+		t.Errorf("Expected features %+v, got %+v", expected, cfg.Features)
+	}
+}
+
+func TestConfig_Validate_LogSampleRate(t *testing.T) {
+	for _, rate := range []float64{0, 0.01, 1} {
+		cfg := validConfig()
+		cfg.Log.SampleRate = rate
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected LOG_SAMPLE_RATE=%g to be valid, got %v", rate, err)
+		}
+	}
+
+	for _, rate := range []float64{-0.1, 1.5, math.NaN()} {
+		cfg := validConfig()
+		cfg.Log.SampleRate = rate
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected LOG_SAMPLE_RATE=%g to be rejected", rate)
+		}
+	}
+}
+
+func TestConfig_Validate_SeedFile(t *testing.T) {
+	for _, file := range []string{"", "messages.json", "/data/export.CSV"} {
+		cfg := validConfig()
+		cfg.Seed.File = file
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected SEED_FILE=%q to be valid, got %v", file, err)
+		}
+	}
+
+	for _, file := range []string{"messages.xml", "messages"} {
+		cfg := validConfig()
+		cfg.Seed.File = file
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected SEED_FILE=%q to be rejected", file)
+		}
+	}
+}
+
+func TestLoad_RobotsTxt(t *testing.T) {
+	t.Setenv("ROBOTS_TXT", `User-agent: *\nAllow: /`)
+
+	if got := Load().RobotsTxt; got != "User-agent: *\nAllow: /" {
+		t.Errorf("Expected \\n to become a newline, got %q", got)
+	}
+}
+
+func TestConfig_Validate_HealthCheckTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		cfg := validConfig()
+		cfg.HealthCheckTimeout = timeout
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected HEALTH_CHECK_TIMEOUT=%s to be rejected", timeout)
+		}
+	}
+}
+
+func TestConfig_Validate_MaxOffset(t *testing.T) {
+	cfg := validConfig()
+	cfg.MaxOffset = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative MAX_OFFSET to be rejected")
+	}
+
+	if got := Load().MaxOffset; got != 100000 {
+		t.Errorf("Expected MAX_OFFSET to default to 100000, got %d", got)
+	}
+}
+
+func TestConfig_Validate_Captcha(t *testing.T) {
+	valid := CaptchaConfig{Enabled: true, Provider: "hcaptcha", Secret: "s3cret", Timeout: 5 * time.Second}
+
+	tests := []struct {
+		name    string
+		modify  func(c *CaptchaConfig)
+		wantErr bool
+	}{
+		{name: "Valid", modify: func(c *CaptchaConfig) {}},
+		{name: "Disabled ignores the rest", modify: func(c *CaptchaConfig) { *c = CaptchaConfig{} }},
+		{name: "Unknown provider", modify: func(c *CaptchaConfig) { c.Provider = "turnstile" }, wantErr: true},
+		{name: "Missing secret", modify: func(c *CaptchaConfig) { c.Secret = "" }, wantErr: true},
+		{name: "No timeout", modify: func(c *CaptchaConfig) { c.Timeout = 0 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Captcha = valid
+			tt.modify(&cfg.Captcha)
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_EditWindow(t *testing.T) {
+	cfg := validConfig()
+	cfg.EditWindow = -time.Minute
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative EDIT_WINDOW to be rejected")
+	}
+
+	t.Setenv("EDIT_WINDOW", "1h")
+	if got := Load().EditWindow; got != time.Hour {
+		t.Errorf("Expected EDIT_WINDOW 1h, got %s", got)
+	}
+}
+
+func TestConfig_Validate_IdempotencyKeyTTL(t *testing.T) {
+	cfg := validConfig()
+	cfg.IdempotencyKeyTTL = -time.Minute
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative IDEMPOTENCY_KEY_TTL to be rejected")
+	}
+
+	if got := Load().IdempotencyKeyTTL; got != 24*time.Hour {
+		t.Errorf("Expected IDEMPOTENCY_KEY_TTL to default to 24h, got %s", got)
+	}
+	t.Setenv("IDEMPOTENCY_KEY_TTL", "1h")
+	if got := Load().IdempotencyKeyTTL; got != time.Hour {
+		t.Errorf("Expected IDEMPOTENCY_KEY_TTL 1h, got %s", got)
+	}
+}
+
+func TestLoad_LogAccessOutput(t *testing.T) {
+	// App logs go to stdout, so access logs default elsewhere
+	if got := Load().Log.AccessOutput; got != "stderr" {
+		t.Errorf("Expected LOG_ACCESS_OUTPUT to default to stderr, got %q", got)
+	}
+
+	t.Setenv("LOG_ACCESS_OUTPUT", "/var/log/guestbook/access.log")
+	if got := Load().Log.AccessOutput; got != "/var/log/guestbook/access.log" {
+		t.Errorf("Expected LOG_ACCESS_OUTPUT to be read, got %q", got)
+	}
+}
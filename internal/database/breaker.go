@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/moabdelazem/app/internal/apperrors"
+)
+
+// ErrCircuitOpen is returned instead of querying while the breaker is open.
+// It is an apperrors.ErrDatabaseUnavailable, so handlers answer 503 with
+// the DB_UNAVAILABLE code.
+var ErrCircuitOpen = apperrors.Newf(apperrors.ErrDatabaseUnavailable, "database is unavailable")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every query through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails queries immediately until the cooldown elapses
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe query through to test recovery
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker is a circuit breaker that opens after threshold consecutive
+// failures. Each failed probe doubles the cooldown, up to maxCooldown; a
+// successful one closes the breaker and resets it.
+type Breaker struct {
+	threshold    int
+	baseCooldown time.Duration
+	maxCooldown  time.Duration
+	// now is replaceable for tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	cooldown time.Duration
+	openedAt time.Time
+	// probing is set while the half-open probe is in flight
+	probing bool
+	// generation changes whenever the breaker opens or lets a probe
+	// through, so outcomes of queries allowed before then are stale
+	generation uint64
+}
+
+// BreakerTicket is handed out by Allow and passed back to Record, telling
+// the probe's outcome apart from those of queries allowed earlier
+type BreakerTicket struct {
+	generation uint64
+	probe      bool
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(threshold int, cooldown, maxCooldown time.Duration) *Breaker {
+	if maxCooldown < cooldown {
+		maxCooldown = cooldown
+	}
+	return &Breaker{
+		threshold:    threshold,
+		baseCooldown: cooldown,
+		maxCooldown:  maxCooldown,
+		cooldown:     cooldown,
+		now:          time.Now,
+	}
+}
+
+// State returns the current state, reporting an open breaker whose
+// cooldown has elapsed as half-open
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.cooldown)) {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a query may run, returning ErrCircuitOpen if not.
+// Every allowed query must be followed by exactly one Record with the
+// returned ticket.
+func (b *Breaker) Allow() (BreakerTicket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Before(b.openedAt.Add(b.cooldown)) {
+			return BreakerTicket{}, ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		return b.probe(), nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return BreakerTicket{}, ErrCircuitOpen
+		}
+		return b.probe(), nil
+	}
+	return BreakerTicket{generation: b.generation}, nil
+}
+
+// probe lets the half-open probe through; callers must hold mu
+func (b *Breaker) probe() BreakerTicket {
+	b.generation++
+	b.probing = true
+	return BreakerTicket{generation: b.generation, probe: true}
+}
+
+// Record reports the outcome of the query allowed with ticket. Outcomes of
+// queries allowed before the breaker last opened, or before the current
+// probe, are ignored: they say nothing about whether it has recovered.
+func (b *Breaker) Record(ticket BreakerTicket, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ticket.generation != b.generation {
+		return
+	}
+	if ticket.probe {
+		if !b.probing {
+			return
+		}
+		b.probing = false
+	}
+
+	// A cancelled query says nothing about the database's health; after a
+	// cancelled probe, the next query probes instead
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if !isBreakerFailure(err) {
+		if b.state != BreakerClosed {
+			slog.Info("Database circuit breaker closed")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		b.cooldown = b.baseCooldown
+		return
+	}
+
+	if ticket.probe {
+		b.cooldown = min(b.cooldown*2, b.maxCooldown)
+		b.open(err)
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open(err)
+	}
+}
+
+// open trips the breaker, making outstanding tickets stale; callers must
+// hold mu
+func (b *Breaker) open(err error) {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.generation++
+	slog.Warn("Database circuit breaker opened", "cooldown", b.cooldown, "error", err)
+}
+
+// isBreakerFailure reports whether err suggests the database itself is
+// unhealthy. Missing rows, cancelled requests and errors Postgres reported
+// about a query (such as constraint violations) don't.
+func isBreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	return !errors.As(err, &pgErr)
+}
+
+// errClientDeadline is the cause of contexts made by WithClientDeadline
+var errClientDeadline = errors.New("client deadline exceeded")
+
+// WithClientDeadline returns ctx with a timeout the client asked for.
+// Queries cut off by it don't count against the circuit breaker: they say
+// nothing about the database's health, and counting them would let any
+// client open the breaker by asking for tiny timeouts.
+func WithClientDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, timeout, errClientDeadline)
+}
+
+// queryOutcome is err as the breaker should see it: queries stopped by a
+// client deadline count as cancelled
+func queryOutcome(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), errClientDeadline) {
+		return context.Canceled
+	}
+	return err
+}
+
+// breakerQuerier runs queries through a breaker
+type breakerQuerier struct {
+	q       Querier
+	breaker *Breaker
+}
+
+func (q breakerQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	ticket, err := q.breaker.Allow()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	tag, err := q.q.Exec(ctx, sql, args...)
+	q.breaker.Record(ticket, queryOutcome(ctx, err))
+	return tag, err
+}
+
+func (q breakerQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	ticket, err := q.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.q.Query(ctx, sql, args...)
+	if err != nil {
+		q.breaker.Record(ticket, queryOutcome(ctx, err))
+		return nil, err
+	}
+	return &breakerRows{Rows: rows, ctx: ctx, breaker: q.breaker, ticket: ticket}, nil
+}
+
+func (q breakerQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	ticket, err := q.breaker.Allow()
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return breakerRow{row: q.q.QueryRow(ctx, sql, args...), ctx: ctx, breaker: q.breaker, ticket: ticket}
+}
+
+// breakerRows records the outcome when the result set is closed, since
+// errors reading rows only surface then
+type breakerRows struct {
+	pgx.Rows
+	ctx     context.Context
+	breaker *Breaker
+	ticket  BreakerTicket
+	once    sync.Once
+}
+
+func (r *breakerRows) Close() {
+	r.Rows.Close()
+	r.once.Do(func() { r.breaker.Record(r.ticket, queryOutcome(r.ctx, r.Rows.Err())) })
+}
+
+// breakerRow records the outcome of its Scan
+type breakerRow struct {
+	row     pgx.Row
+	ctx     context.Context
+	breaker *Breaker
+	ticket  BreakerTicket
+}
+
+func (r breakerRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	r.breaker.Record(r.ticket, queryOutcome(r.ctx, err))
+	return err
+}
+
+// errRow is a row that fails to scan with err
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
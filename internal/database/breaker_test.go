@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/moabdelazem/app/internal/apperrors"
+)
+
+// failingQuerier is a fake pool whose queries fail with err, counting calls
+type failingQuerier struct {
+	err   error
+	calls int
+}
+
+func (q *failingQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	q.calls++
+	return pgconn.CommandTag{}, q.err
+}
+
+func (q *failingQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.calls++
+	return nil, q.err
+}
+
+func (q *failingQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.calls++
+	return errRow{err: q.err}
+}
+
+// newTestBreaker returns a breaker on a fake clock advanced by the returned func
+func newTestBreaker(threshold int, cooldown, maxCooldown time.Duration) (*Breaker, func(time.Duration)) {
+	now := time.Now()
+	b := NewBreaker(threshold, cooldown, maxCooldown)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+// record runs one query through the breaker with outcome err
+func record(t *testing.T, b *Breaker, err error) {
+	t.Helper()
+	ticket, allowErr := b.Allow()
+	if allowErr != nil {
+		t.Fatalf("Expected the query to be allowed, got %v", allowErr)
+	}
+	b.Record(ticket, err)
+}
+
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	pool := &failingQuerier{err: errors.New("connection refused")}
+	breaker, advance := newTestBreaker(3, time.Second, time.Minute)
+	db := NewWithPools(pool)
+	db.UseBreaker(breaker)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := db.WritePool().Exec(ctx, "SELECT 1"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected query %d to reach the database", i+1)
+		}
+	}
+	if state := db.BreakerState(); state != BreakerOpen {
+		t.Fatalf("Expected the breaker to open after 3 failures, got %s", state)
+	}
+
+	// Open: queries fail fast without touching the pool
+	err := db.ReadPool().QueryRow(ctx, "SELECT 1").Scan()
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, apperrors.ErrUnavailable) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if pool.calls != 3 {
+		t.Errorf("Expected no queries while open, got %d calls", pool.calls)
+	}
+
+	// Half-open: one probe goes through and fails, doubling the cooldown
+	advance(time.Second)
+	if state := db.BreakerState(); state != BreakerHalfOpen {
+		t.Fatalf("Expected half-open after the cooldown, got %s", state)
+	}
+	db.WritePool().Exec(ctx, "SELECT 1")
+	if pool.calls != 4 || db.BreakerState() != BreakerOpen {
+		t.Fatalf("Expected a failed probe to reopen the breaker, got %d calls, %s", pool.calls, db.BreakerState())
+	}
+
+	advance(time.Second)
+	if state := db.BreakerState(); state != BreakerOpen {
+		t.Errorf("Expected the cooldown to have doubled, got %s after 1s", state)
+	}
+
+	// A successful probe closes the breaker
+	advance(time.Second)
+	pool.err = nil
+	if _, err := db.WritePool().Exec(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	if state := db.BreakerState(); state != BreakerClosed {
+		t.Errorf("Expected the breaker to close, got %s", state)
+	}
+}
+
+func TestBreaker_HalfOpenAllowsOneProbe(t *testing.T) {
+	breaker, advance := newTestBreaker(1, time.Second, time.Second)
+	record(t, breaker, errors.New("connection refused"))
+	advance(time.Second)
+
+	probe, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("Expected the probe to be allowed, got %v", err)
+	}
+	if _, err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a second query to wait for the probe, got %v", err)
+	}
+
+	// A cancelled probe leaves the breaker half-open for the next query
+	breaker.Record(probe, context.Canceled)
+	if _, err := breaker.Allow(); err != nil {
+		t.Errorf("Expected a new probe after a cancelled one, got %v", err)
+	}
+}
+
+func TestBreaker_IgnoresStaleOutcomes(t *testing.T) {
+	breaker, advance := newTestBreaker(1, time.Second, time.Second)
+
+	// A query allowed while closed finishes only after the breaker opened
+	stale, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("Expected the query to be allowed, got %v", err)
+	}
+	record(t, breaker, errors.New("connection refused"))
+	advance(time.Second)
+
+	probe, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("Expected the probe to be allowed, got %v", err)
+	}
+
+	breaker.Record(stale, nil)
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Errorf("Expected a stale success to leave the breaker half-open, got %s", state)
+	}
+	if _, err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a stale outcome not to allow a second probe, got %v", err)
+	}
+
+	breaker.Record(probe, nil)
+	if state := breaker.State(); state != BreakerClosed {
+		t.Errorf("Expected the probe to close the breaker, got %s", state)
+	}
+}
+
+func TestBreaker_IgnoresQueryErrors(t *testing.T) {
+	breaker, _ := newTestBreaker(2, time.Second, time.Second)
+
+	for _, err := range []error{
+		pgx.ErrNoRows,
+		context.Canceled,
+		&pgconn.PgError{Code: "23505"},
+		pgx.ErrNoRows,
+	} {
+		record(t, breaker, err)
+	}
+
+	if state := breaker.State(); state != BreakerClosed {
+		t.Errorf("Expected errors the database reported to keep the breaker closed, got %s", state)
+	}
+
+	// Successes reset the count, so failures must be consecutive
+	record(t, breaker, context.DeadlineExceeded)
+	record(t, breaker, nil)
+	record(t, breaker, context.DeadlineExceeded)
+	if state := breaker.State(); state != BreakerClosed {
+		t.Errorf("Expected non-consecutive failures to keep the breaker closed, got %s", state)
+	}
+}
+
+func TestBreaker_IgnoresClientDeadlines(t *testing.T) {
+	pool := &failingQuerier{err: context.DeadlineExceeded}
+	breaker, _ := newTestBreaker(2, time.Second, time.Second)
+	db := NewWithPools(pool)
+	db.UseBreaker(breaker)
+
+	ctx, cancel := WithClientDeadline(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	for i := 0; i < 3; i++ {
+		db.WritePool().Exec(ctx, "SELECT 1")
+		db.ReadPool().QueryRow(ctx, "SELECT 1").Scan()
+	}
+	if state := db.BreakerState(); state != BreakerClosed {
+		t.Fatalf("Expected queries stopped by a client deadline to keep the breaker closed, got %s", state)
+	}
+
+	// The same failures under a server-side deadline still count
+	serverCtx, serverCancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer serverCancel()
+	<-serverCtx.Done()
+
+	for i := 0; i < 2; i++ {
+		db.WritePool().Exec(serverCtx, "SELECT 1")
+	}
+	if state := db.BreakerState(); state != BreakerOpen {
+		t.Errorf("Expected server deadlines to open the breaker, got %s", state)
+	}
+}
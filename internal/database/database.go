@@ -2,62 +2,310 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/moabdelazem/app/internal/config"
 )
 
+// Querier is the query interface shared by pools, connections and
+// transactions, so repositories can run against any of them
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type DB struct {
+	// Pool is the primary database pool
 	Pool *pgxpool.Pool
+
+	replicas []*pgxpool.Pool
+	writer   Querier
+	readers  []Querier
+	next     atomic.Uint64
+	// breaker, when set, guards every query; see UseBreaker
+	breaker *Breaker
+	// retry is how WithRetry repeats conflicting operations; see
+	// SetRetryPolicy
+	retry RetryPolicy
+	// beginner starts the transactions behind BeginSnapshot; nil when the
+	// primary can't start them
+	beginner txBeginner
+}
+
+// NewWithPools creates a DB routing writes to writer and reads round-robin
+// across readers (or writer when there are none). Snapshots are supported
+// when writer can begin transactions. It is mainly useful for tests with
+// fake pools.
+func NewWithPools(writer Querier, readers ...Querier) *DB {
+	beginner, _ := writer.(txBeginner)
+	return &DB{writer: writer, readers: readers, beginner: beginner}
 }
 
 func NewConnection(ctx context.Context, cfg *config.Config) (*DB, error) {
-	// Build connection string
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		cfg.DB.User,
-		cfg.DB.Password,
-		cfg.DB.Host,
-		cfg.DB.Port,
-		cfg.DB.Name,
-		cfg.DB.SSLMode,
-	)
+	// Build connection string. The credentials are escaped: a password with
+	// '@' or '/' in it would otherwise be read partly as the host, failing
+	// to connect and leaving that part unmasked in errors.
+	dsn := (&url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.DB.User, cfg.DB.Password),
+		Host:     net.JoinHostPort(cfg.DB.Host, strconv.Itoa(cfg.DB.Port)),
+		Path:     "/" + cfg.DB.Name,
+		RawQuery: url.Values{"sslmode": {cfg.DB.SSLMode}}.Encode(),
+	}).String()
 
-	// Configure connection pool
-	poolConfig, err := pgxpool.ParseConfig(dsn)
+	pool, err := newPool(ctx, dsn, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse database config: %w", err)
+		return nil, err
 	}
 
-	// Set pool configuration
-	poolConfig.MaxConns = 25
-	poolConfig.MinConns = 5
-	poolConfig.MaxConnLifetime = time.Hour
-	poolConfig.MaxConnIdleTime = time.Minute * 30
+	if err := ensureSchema(ctx, pool, cfg.DB.Schema); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	slog.Info("Connected to PostgreSQL database",
+		"host", cfg.DB.Host,
+		"port", cfg.DB.Port,
+		"database", cfg.DB.Name,
+		"schema", cfg.DB.Schema)
+
+	db := &DB{Pool: pool, writer: pool, beginner: pool}
+
+	for i, replicaURL := range cfg.DB.ReplicaURLs {
+		replica, err := newPool(ctx, replicaURL, cfg)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to read replica %d: %w", i+1, err)
+		}
+		db.replicas = append(db.replicas, replica)
+		db.readers = append(db.readers, replica)
+	}
+
+	if len(db.replicas) > 0 {
+		slog.Info("Connected to read replicas", "count", len(db.replicas))
+	}
+
+	if cfg.DB.BreakerThreshold > 0 {
+		db.UseBreaker(NewBreaker(cfg.DB.BreakerThreshold, cfg.DB.BreakerCooldown, cfg.DB.BreakerMaxCooldown))
+	}
+
+	db.SetRetryPolicy(RetryPolicy{Attempts: cfg.DB.RetryAttempts, Backoff: cfg.DB.RetryBackoff})
+
+	return db, nil
+}
+
+// newPool creates and pings a connection pool for dsn. The errors it returns
+// name the server by dsn with its password masked, so a failing replica can
+// be told from the primary without the password reaching the logs.
+func newPool(ctx context.Context, dsn string, cfg *config.Config) (*pgxpool.Pool, error) {
+	poolConfig, err := buildPoolConfig(dsn, cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create connection pool
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+		return nil, fmt.Errorf("failed to create connection pool for %s: %w", maskDSN(dsn), maskError(err, dsn))
 	}
 
 	// Test connection
 	if err := pool.Ping(ctx); err != nil {
 		pool.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, fmt.Errorf("failed to ping database %s: %w", maskDSN(dsn), maskError(err, dsn))
 	}
 
-	slog.Info("Connected to PostgreSQL database",
-		"host", cfg.DB.Host,
-		"port", cfg.DB.Port,
-		"database", cfg.DB.Name)
+	return pool, nil
+}
+
+// buildPoolConfig parses dsn and applies the pool settings from cfg
+func buildPoolConfig(dsn string, cfg *config.Config) (*pgxpool.Config, error) {
+	// Configure connection pool
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", maskError(err, dsn))
+	}
+
+	// Set pool configuration. List requests query the page and the total
+	// concurrently, so each one can hold two connections.
+	poolConfig.MaxConns = int32(cfg.DB.MaxConns)
+	poolConfig.MinConns = int32(cfg.DB.MinConns)
+	poolConfig.MaxConnLifetime = time.Hour
+	poolConfig.MaxConnIdleTime = time.Minute * 30
+
+	if cfg.DB.QueryExecMode != "" {
+		mode, err := queryExecMode(cfg.DB.QueryExecMode)
+		if err != nil {
+			return nil, err
+		}
+		poolConfig.ConnConfig.DefaultQueryExecMode = mode
+	}
+
+	// Unqualified table names resolve in the configured schema on every
+	// connection, replicas included
+	if cfg.DB.Schema != "" {
+		statement := searchPathStatement(cfg.DB.Schema)
+		poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			if _, err := conn.Exec(ctx, statement); err != nil {
+				return fmt.Errorf("failed to set search_path: %w", err)
+			}
+			return nil
+		}
+	}
 
-	return &DB{Pool: pool}, nil
+	// Have Postgres cancel runaway statements itself, even when the
+	// request's context never ends. A timeout in the DSN wins.
+	if _, ok := poolConfig.ConnConfig.RuntimeParams["statement_timeout"]; !ok && cfg.DB.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = statementTimeoutParam(cfg.DB.StatementTimeout)
+	}
+
+	// Identify this service in pg_stat_activity, unless the DSN (such as a
+	// replica URL) names itself
+	if _, ok := poolConfig.ConnConfig.RuntimeParams["application_name"]; !ok && cfg.DB.ApplicationName != "" {
+		poolConfig.ConnConfig.RuntimeParams["application_name"] = applicationName(cfg.DB.ApplicationName, buildRevision())
+	}
+
+	return poolConfig, nil
+}
+
+// statementTimeoutParam formats timeout as the milliseconds statement_timeout
+// takes without a unit
+func statementTimeoutParam(timeout time.Duration) string {
+	return strconv.FormatInt(timeout.Milliseconds(), 10)
+}
+
+// maxApplicationNameLength is how much of application_name Postgres keeps
+const maxApplicationNameLength = 63
+
+// applicationName appends the short VCS revision to name when it is known
+// and fits, as in "guestbook-api@1a2b3c4"
+func applicationName(name, revision string) string {
+	if len(revision) > 7 {
+		revision = revision[:7]
+	}
+	if revision == "" || len(name)+1+len(revision) > maxApplicationNameLength {
+		return name
+	}
+	return name + "@" + revision
+}
+
+// buildRevision returns the VCS revision the binary was built from, or ""
+// when the build didn't record one
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+// searchPathStatement returns the statement that makes schema the only
+// schema in the search_path. Config validation already restricts the name
+// to plain identifiers; quoting it is a second line of defense.
+func searchPathStatement(schema string) string {
+	return "SET search_path TO " + pgx.Identifier{schema}.Sanitize()
+}
+
+// ensureSchema creates schema on the primary if it doesn't exist yet, so
+// table creation can run in it. Existing schemas are left alone, which
+// lets deployments whose user may not create schemas use pre-made ones.
+func ensureSchema(ctx context.Context, pool *pgxpool.Pool, schema string) error {
+	if schema == "" {
+		return nil
+	}
+
+	var exists bool
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)`, schema).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up schema %q: %w", schema, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := pool.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{schema}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to create schema %q: %w", schema, err)
+	}
+	slog.Info("Created database schema", "schema", schema)
+	return nil
+}
+
+// queryExecMode maps a DB_QUERY_EXEC_MODE name to its pgx mode
+func queryExecMode(name string) (pgx.QueryExecMode, error) {
+	switch name {
+	case "cache_statement":
+		return pgx.QueryExecModeCacheStatement, nil
+	case "cache_describe":
+		return pgx.QueryExecModeCacheDescribe, nil
+	case "describe_exec":
+		return pgx.QueryExecModeDescribeExec, nil
+	case "exec":
+		return pgx.QueryExecModeExec, nil
+	case "simple_protocol":
+		return pgx.QueryExecModeSimpleProtocol, nil
+	}
+	return 0, fmt.Errorf("unknown query exec mode %q", name)
+}
+
+// UseBreaker routes every query, on the primary and the replicas, through
+// b so that a failing database is given time to recover instead of being
+// queried by every request. It must be called before the DB is shared.
+func (db *DB) UseBreaker(b *Breaker) {
+	db.breaker = b
+	db.writer = breakerQuerier{q: db.writer, breaker: b}
+	for i, reader := range db.readers {
+		db.readers[i] = breakerQuerier{q: reader, breaker: b}
+	}
+}
+
+// BreakerState returns the state of the circuit breaker, which is always
+// closed when none is in use
+func (db *DB) BreakerState() BreakerState {
+	if db.breaker == nil {
+		return BreakerClosed
+	}
+	return db.breaker.State()
+}
+
+// WritePool returns the primary, which must be used for writes and for
+// reads that cannot tolerate replication lag
+func (db *DB) WritePool() Querier {
+	return db.writer
+}
+
+// ReadPool returns the next read replica in round-robin order, or the
+// primary when no replicas are configured
+func (db *DB) ReadPool() Querier {
+	if len(db.readers) == 0 {
+		return db.writer
+	}
+
+	n := db.next.Add(1) - 1
+	return db.readers[n%uint64(len(db.readers))]
 }
 
 func (db *DB) Close() {
+	for _, replica := range db.replicas {
+		replica.Close()
+	}
+
 	if db.Pool != nil {
 		db.Pool.Close()
 		slog.Info("Database connection closed")
@@ -65,5 +313,8 @@ func (db *DB) Close() {
 }
 
 func (db *DB) Health(ctx context.Context) error {
+	if db.Pool == nil {
+		return errors.New("database pool is not initialized")
+	}
 	return db.Pool.Ping(ctx)
 }
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/moabdelazem/app/internal/config"
+)
+
+// namedQuerier is a fake pool identified by name
+type namedQuerier struct {
+	name string
+}
+
+func (q *namedQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (q *namedQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, nil
+}
+
+func (q *namedQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return nil
+}
+
+func TestDB_ReadPool_RoundRobin(t *testing.T) {
+	primary := &namedQuerier{name: "primary"}
+	replicaA := &namedQuerier{name: "replica-a"}
+	replicaB := &namedQuerier{name: "replica-b"}
+
+	db := NewWithPools(primary, replicaA, replicaB)
+
+	expected := []string{"replica-a", "replica-b", "replica-a", "replica-b"}
+	for i, name := range expected {
+		got := db.ReadPool().(*namedQuerier).name
+		if got != name {
+			t.Errorf("Read %d: expected %s, got %s", i, name, got)
+		}
+	}
+
+	if got := db.WritePool().(*namedQuerier).name; got != "primary" {
+		t.Errorf("Expected writes to go to primary, got %s", got)
+	}
+}
+
+func TestDB_ReadPool_NoReplicas(t *testing.T) {
+	primary := &namedQuerier{name: "primary"}
+	db := NewWithPools(primary)
+
+	if got := db.ReadPool().(*namedQuerier).name; got != "primary" {
+		t.Errorf("Expected reads to fall back to primary, got %s", got)
+	}
+}
+
+func TestQueryExecMode(t *testing.T) {
+	// Every mode config accepts must map to a pgx mode
+	for _, name := range config.QueryExecModes {
+		mode, err := queryExecMode(name)
+		if err != nil {
+			t.Errorf("queryExecMode(%q) returned error: %v", name, err)
+		}
+		if strings.ReplaceAll(mode.String(), " ", "_") != name {
+			t.Errorf("queryExecMode(%q) = %s", name, mode)
+		}
+	}
+
+	if _, err := queryExecMode("bogus"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestSearchPathStatement(t *testing.T) {
+	tests := map[string]string{
+		"public":   `SET search_path TO "public"`,
+		"tenant_a": `SET search_path TO "tenant_a"`,
+		// Validation rejects such names; quoting still keeps them inert
+		`a"; DROP TABLE x; --`: `SET search_path TO "a""; DROP TABLE x; --"`,
+	}
+
+	for schema, expected := range tests {
+		if got := searchPathStatement(schema); got != expected {
+			t.Errorf("searchPathStatement(%q) = %q, want %q", schema, got, expected)
+		}
+	}
+}
+
+func TestBuildPoolConfig_ApplicationName(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		appName  string
+		expected string
+	}{
+		{name: "Configured name", dsn: "postgres://user@localhost/db", appName: "guestbook-api", expected: "guestbook-api"},
+		{name: "Named in the DSN", dsn: "postgres://user@localhost/db?application_name=reporting", appName: "guestbook-api", expected: "reporting"},
+		{name: "Disabled", dsn: "postgres://user@localhost/db", appName: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{DB: config.DatabaseConfig{MaxConns: 5, ApplicationName: tt.appName}}
+
+			poolConfig, err := buildPoolConfig(tt.dsn, cfg)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			got := poolConfig.ConnConfig.RuntimeParams["application_name"]
+			// Test binaries carry no VCS revision, but allow for one
+			if got != tt.expected && !strings.HasPrefix(got, tt.expected+"@") {
+				t.Errorf("Expected application_name %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestApplicationName(t *testing.T) {
+	tests := []struct {
+		name     string
+		appName  string
+		revision string
+		expected string
+	}{
+		{name: "No revision", appName: "guestbook-api", expected: "guestbook-api"},
+		{name: "Short revision", appName: "guestbook-api", revision: "1a2b3c4d5e6f", expected: "guestbook-api@1a2b3c4"},
+		{name: "Too long with revision", appName: strings.Repeat("a", 60), revision: "1a2b3c4d5e6f", expected: strings.Repeat("a", 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applicationName(tt.appName, tt.revision); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBuildPoolConfig_StatementTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		timeout  time.Duration
+		expected string
+	}{
+		{name: "Seconds", dsn: "postgres://user@localhost/db", timeout: 30 * time.Second, expected: "30000"},
+		{name: "Sub-second", dsn: "postgres://user@localhost/db", timeout: 1500 * time.Millisecond, expected: "1500"},
+		{name: "Disabled", dsn: "postgres://user@localhost/db", timeout: 0, expected: ""},
+		{name: "Set in the DSN", dsn: "postgres://user@localhost/db?statement_timeout=5000", timeout: 30 * time.Second, expected: "5000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{DB: config.DatabaseConfig{MaxConns: 5, StatementTimeout: tt.timeout}}
+
+			poolConfig, err := buildPoolConfig(tt.dsn, cfg)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if got := poolConfig.ConnConfig.RuntimeParams["statement_timeout"]; got != tt.expected {
+				t.Errorf("Expected statement_timeout %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maskedPassword stands in for passwords in DSNs and errors
+const maskedPassword = "***"
+
+var (
+	// keywordPassword matches the password in a key=value DSN, quoted or not
+	keywordPassword = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+	// userinfoPassword matches the password in a URL DSN that doesn't parse
+	// as a URL, such as one with an unescaped '%' in its password
+	userinfoPassword = regexp.MustCompile(`^(postgres(?:ql)?://[^:/@]*:)(.*)@`)
+)
+
+// isURLDSN reports whether dsn is in URL form rather than key=value form
+func isURLDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// maskDSN returns dsn with its password replaced by ***, so it can be
+// logged or shown
+func maskDSN(dsn string) string {
+	if !isURLDSN(dsn) {
+		return keywordPassword.ReplaceAllString(dsn, "${1}"+maskedPassword)
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return userinfoPassword.ReplaceAllString(dsn, "${1}"+maskedPassword+"@")
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), maskedPassword)
+	}
+	if query := u.Query(); query.Has("password") {
+		query.Set("password", maskedPassword)
+		u.RawQuery = query.Encode()
+	}
+	// url escapes the asterisks, which would make the mask hard to read
+	return strings.ReplaceAll(u.String(), url.QueryEscape(maskedPassword), maskedPassword)
+}
+
+// dsnPassword returns the password in dsn, or "" when it has none
+func dsnPassword(dsn string) string {
+	if !isURLDSN(dsn) {
+		if m := keywordPassword.FindStringSubmatch(dsn); m != nil {
+			return strings.Trim(m[2], "'")
+		}
+		return ""
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		if m := userinfoPassword.FindStringSubmatch(dsn); m != nil {
+			return m[2]
+		}
+		return ""
+	}
+	if password, ok := u.User.Password(); ok {
+		return password
+	}
+	return u.Query().Get("password")
+}
+
+// maskedError is an error whose message has had a password masked. It
+// unwraps to the original, so errors.Is and errors.As still see through it.
+type maskedError struct {
+	msg string
+	err error
+}
+
+func (e *maskedError) Error() string {
+	return e.msg
+}
+
+func (e *maskedError) Unwrap() error {
+	return e.err
+}
+
+// maskError replaces dsn's password with *** wherever it appears in err's
+// message, escaped or not. pgx redacts the DSNs it quotes, but not every
+// error from a driver, dialer or TLS library is that careful, and these
+// errors end up in logs.
+func maskError(err error, dsn string) error {
+	password := dsnPassword(dsn)
+	if err == nil || password == "" {
+		return err
+	}
+
+	msg := err.Error()
+	for _, secret := range []string{password, url.QueryEscape(password), url.PathEscape(password)} {
+		msg = strings.ReplaceAll(msg, secret, maskedPassword)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &maskedError{msg: msg, err: err}
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE codes for conflicts between concurrent transactions, where
+// Postgres rolls one back and running it again is expected to succeed
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// RetryPolicy says how WithRetry repeats operations that lost a conflict
+// with a concurrent transaction
+type RetryPolicy struct {
+	// Attempts is the total number of tries; 1 or less means no retries
+	Attempts int
+	// Backoff is the wait before the first retry, doubled before each
+	// later one
+	Backoff time.Duration
+}
+
+// SetRetryPolicy sets the policy used by WithRetry. It must be called
+// before the DB is used.
+func (db *DB) SetRetryPolicy(policy RetryPolicy) {
+	db.retry = policy
+}
+
+// WithRetry runs op, running it again under the DB's RetryPolicy while it
+// fails with a serialization failure or deadlock. op must be safe to
+// repeat: a single statement, or a whole transaction. Other errors are
+// returned straight away.
+func (db *DB) WithRetry(ctx context.Context, op func(ctx context.Context) error) error {
+	return retry(ctx, db.retry, op, sleep)
+}
+
+// IsRetryable reports whether err is a serialization failure or deadlock,
+// after which Postgres has rolled the transaction back
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// retry implements WithRetry with a replaceable wait, so tests don't sleep
+func retry(ctx context.Context, policy RetryPolicy, op func(ctx context.Context) error, wait func(ctx context.Context, d time.Duration) error) error {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt >= policy.Attempts || !IsRetryable(err) {
+			return err
+		}
+
+		slog.Warn("Retrying database operation after transaction conflict", "attempt", attempt, "backoff", backoff, "error", err)
+		if waitErr := wait(ctx, backoff); waitErr != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// sleep waits for d, returning early with ctx's error if it is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
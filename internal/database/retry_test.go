@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// noWait stands in for sleep, recording the backoffs it was asked to wait
+type noWait struct {
+	waits []time.Duration
+}
+
+func (w *noWait) wait(ctx context.Context, d time.Duration) error {
+	w.waits = append(w.waits, d)
+	return ctx.Err()
+}
+
+func TestRetry_SucceedsAfterSerializationFailure(t *testing.T) {
+	waiter := &noWait{}
+	calls := 0
+
+	err := retry(context.Background(), RetryPolicy{Attempts: 3, Backoff: 10 * time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("failed to create guest book message: %w", &pgconn.PgError{Code: "40001"})
+		}
+		return nil
+	}, waiter.wait)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 attempts, got %d", calls)
+	}
+	if len(waiter.waits) != 1 || waiter.waits[0] != 10*time.Millisecond {
+		t.Errorf("Expected one 10ms backoff, got %v", waiter.waits)
+	}
+}
+
+func TestRetry_GivesUpAfterAttempts(t *testing.T) {
+	waiter := &noWait{}
+	calls := 0
+	deadlock := &pgconn.PgError{Code: "40P01"}
+
+	err := retry(context.Background(), RetryPolicy{Attempts: 3, Backoff: 10 * time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		return deadlock
+	}, waiter.wait)
+
+	if !errors.Is(err, deadlock) {
+		t.Errorf("Expected the last deadlock error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+	if len(waiter.waits) != 2 || waiter.waits[0] != 10*time.Millisecond || waiter.waits[1] != 20*time.Millisecond {
+		t.Errorf("Expected backoffs of 10ms then 20ms, got %v", waiter.waits)
+	}
+}
+
+func TestRetry_DoesNotRetryOtherErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "Unique violation", err: &pgconn.PgError{Code: "23505"}},
+		{name: "Connection error", err: errors.New("connection refused")},
+		{name: "Cancelled", err: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retry(context.Background(), RetryPolicy{Attempts: 3}, func(ctx context.Context) error {
+				calls++
+				return tt.err
+			}, (&noWait{}).wait)
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+			if calls != 1 {
+				t.Errorf("Expected 1 attempt, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestRetry_StopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := retry(ctx, RetryPolicy{Attempts: 3, Backoff: time.Hour}, func(ctx context.Context) error {
+		calls++
+		return &pgconn.PgError{Code: "40001"}
+	}, sleep)
+
+	if !IsRetryable(err) {
+		t.Errorf("Expected the serialization failure, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", calls)
+	}
+}
+
+func TestDB_WithRetry_DefaultPolicyDoesNotRetry(t *testing.T) {
+	db := NewWithPools(nil)
+
+	calls := 0
+	db.WithRetry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return &pgconn.PgError{Code: "40001"}
+	})
+
+	if calls != 1 {
+		t.Errorf("Expected 1 attempt without a retry policy, got %d", calls)
+	}
+}
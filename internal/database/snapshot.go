@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Snapshot is an open read-only, repeatable-read transaction. Every query
+// run through it sees the database as it was when the snapshot began,
+// whatever is written meanwhile. It holds a connection from the pool until
+// it is rolled back, and can't be used by two goroutines at once.
+type Snapshot interface {
+	Querier
+	Rollback(ctx context.Context) error
+}
+
+// txBeginner starts transactions; pgxpool.Pool implements it
+type txBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// ErrSnapshotsUnsupported is returned by BeginSnapshot when the DB can't
+// start transactions
+var ErrSnapshotsUnsupported = errors.New("database snapshots are not supported")
+
+// BeginSnapshot starts a Snapshot on the primary. Replicas aren't used,
+// since a long-lived transaction on a standby can hold up replication.
+// The caller must roll it back.
+func (db *DB) BeginSnapshot(ctx context.Context) (Snapshot, error) {
+	if db.beginner == nil {
+		return nil, ErrSnapshotsUnsupported
+	}
+
+	var ticket BreakerTicket
+	if db.breaker != nil {
+		var err error
+		if ticket, err = db.breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.beginner.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if db.breaker != nil {
+		db.breaker.Record(ticket, queryOutcome(ctx, err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeTx stands in for a pgx.Tx; calling anything but Rollback panics
+type fakeTx struct {
+	pgx.Tx
+}
+
+func (tx fakeTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// beginningQuerier is a fake pool that can begin transactions, recording
+// the options it was asked for
+type beginningQuerier struct {
+	namedQuerier
+	err     error
+	options []pgx.TxOptions
+}
+
+func (q *beginningQuerier) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	q.options = append(q.options, txOptions)
+	if q.err != nil {
+		return nil, q.err
+	}
+	return fakeTx{}, nil
+}
+
+func TestDB_BeginSnapshot(t *testing.T) {
+	primary := &beginningQuerier{}
+	replica := &beginningQuerier{}
+	db := NewWithPools(primary, replica)
+
+	snapshot, err := db.BeginSnapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer snapshot.Rollback(context.Background())
+
+	if len(primary.options) != 1 || len(replica.options) != 0 {
+		t.Fatalf("Expected the snapshot to begin on the primary only, got %d and %d", len(primary.options), len(replica.options))
+	}
+	want := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	if primary.options[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, primary.options[0])
+	}
+}
+
+func TestDB_BeginSnapshot_Unsupported(t *testing.T) {
+	db := NewWithPools(&namedQuerier{name: "primary"})
+
+	if _, err := db.BeginSnapshot(context.Background()); !errors.Is(err, ErrSnapshotsUnsupported) {
+		t.Errorf("Expected ErrSnapshotsUnsupported, got %v", err)
+	}
+}
+
+func TestDB_BeginSnapshot_Breaker(t *testing.T) {
+	primary := &beginningQuerier{err: errors.New("connection refused")}
+	db := NewWithPools(primary)
+	db.UseBreaker(NewBreaker(1, time.Minute, time.Minute))
+
+	if _, err := db.BeginSnapshot(context.Background()); !errors.Is(err, primary.err) {
+		t.Fatalf("Expected the connection error, got %v", err)
+	}
+	if _, err := db.BeginSnapshot(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the open breaker to fail fast, got %v", err)
+	}
+	if len(primary.options) != 1 {
+		t.Errorf("Expected 1 attempt to begin, got %d", len(primary.options))
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// acquireFunc checks out a pooled connection, returning the func that
+// gives it back
+type acquireFunc func(ctx context.Context) (release func(), err error)
+
+// poolAcquirer adapts a pgx pool to acquireFunc
+func poolAcquirer(pool *pgxpool.Pool) acquireFunc {
+	return func(ctx context.Context) (func(), error) {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return conn.Release, nil
+	}
+}
+
+// Warmup opens n connections on the primary and on each replica before
+// traffic arrives, so the first requests don't pay for connecting. The
+// connections are all held at once, since acquiring one at a time would
+// keep reusing the first, and then released to the pool. It stops at ctx's
+// deadline or the first failure and returns how many connections were
+// warmed in total.
+func (db *DB) Warmup(ctx context.Context, n int) (int, error) {
+	if db.Pool == nil {
+		return 0, nil
+	}
+
+	warmed, err := warmup(ctx, poolAcquirer(db.Pool), n)
+	if err != nil {
+		return warmed, err
+	}
+
+	for _, replica := range db.replicas {
+		count, err := warmup(ctx, poolAcquirer(replica), n)
+		warmed += count
+		if err != nil {
+			return warmed, err
+		}
+	}
+	return warmed, nil
+}
+
+// warmup holds n connections from acquire at once, then releases them
+func warmup(ctx context.Context, acquire acquireFunc, n int) (int, error) {
+	releases := make([]func(), 0, max(n, 0))
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+
+	for range n {
+		release, err := acquire(ctx)
+		if err != nil {
+			return len(releases), err
+		}
+		releases = append(releases, release)
+	}
+	return len(releases), nil
+}
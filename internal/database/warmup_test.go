@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeConnPool hands out up to limit connections, then fails or blocks
+// until the context ends
+type fakeConnPool struct {
+	limit   int
+	block   bool
+	held    int
+	maxHeld int
+}
+
+func (p *fakeConnPool) acquire(ctx context.Context) (func(), error) {
+	if p.held >= p.limit {
+		if !p.block {
+			return nil, errors.New("connection refused")
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	p.held++
+	p.maxHeld = max(p.maxHeld, p.held)
+	return func() { p.held-- }, nil
+}
+
+func TestWarmup(t *testing.T) {
+	pool := &fakeConnPool{limit: 10}
+
+	warmed, err := warmup(context.Background(), pool.acquire, 5)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if warmed != 5 {
+		t.Errorf("Expected 5 connections warmed, got %d", warmed)
+	}
+	if pool.maxHeld != 5 {
+		t.Errorf("Expected all 5 connections to be held at once, got at most %d", pool.maxHeld)
+	}
+	if pool.held != 0 {
+		t.Errorf("Expected every connection to be released, %d still held", pool.held)
+	}
+}
+
+func TestWarmup_StopsOnFailure(t *testing.T) {
+	pool := &fakeConnPool{limit: 2}
+
+	warmed, err := warmup(context.Background(), pool.acquire, 5)
+	if err == nil {
+		t.Fatal("Expected an error once the pool refuses connections")
+	}
+	if warmed != 2 {
+		t.Errorf("Expected 2 connections warmed, got %d", warmed)
+	}
+	if pool.held != 0 {
+		t.Errorf("Expected every connection to be released, %d still held", pool.held)
+	}
+}
+
+func TestWarmup_Timeout(t *testing.T) {
+	pool := &fakeConnPool{limit: 3, block: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	warmed, err := warmup(ctx, pool.acquire, 5)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if warmed != 3 {
+		t.Errorf("Expected 3 connections warmed before the timeout, got %d", warmed)
+	}
+	if pool.held != 0 {
+		t.Errorf("Expected every connection to be released, %d still held", pool.held)
+	}
+}
+
+func TestDB_Warmup_WithoutPool(t *testing.T) {
+	db := NewWithPools(&namedQuerier{name: "primary"})
+
+	warmed, err := db.Warmup(context.Background(), 5)
+	if err != nil || warmed != 0 {
+		t.Errorf("Expected nothing to warm without a pgx pool, got %d, %v", warmed, err)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+)
+
+// errTrailingData is returned by decodeJSONBody for a body with anything
+// but whitespace after its JSON value
+var errTrailingData = errors.New("request body must contain a single JSON object")
+
+// decodeJSONBody decodes a request body holding exactly one JSON value into
+// v. json.Decoder stops after the first value, so without the check a body
+// such as {...}{...} or {...}garbage would be accepted.
+func decodeJSONBody(body io.Reader, v any) error {
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errTrailingData
+	}
+
+	return nil
+}
+
+// respondDecodeError writes a 400 for a request body that failed to decode,
+// with details pointing client developers at the problem
+func respondDecodeError(w http.ResponseWriter, err error) {
+	RespondJSON(w, http.StatusBadRequest, map[string]string{
+		"error":   "Invalid request body",
+		"code":    string(apperrors.CodeValidation),
+		"details": describeDecodeError(err),
+	})
+}
+
+// describeDecodeError turns a json.Decoder error into a client-facing
+// explanation without exposing Go type names
+func describeDecodeError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, errTrailingData):
+		return errTrailingData.Error()
+	case errors.Is(err, io.EOF):
+		return "empty request body"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "request body ends with incomplete JSON"
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed JSON at byte offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Sprintf("request body must be a JSON object, got %s", typeErr.Value)
+		}
+		return fmt.Sprintf("field %q must be a %s, got %s", typeErr.Field, jsonTypeName(typeErr), typeErr.Value)
+	default:
+		return "request body is not valid JSON"
+	}
+}
+
+// jsonTypeName names the JSON type expected by an UnmarshalTypeError
+func jsonTypeName(err *json.UnmarshalTypeError) string {
+	switch err.Type.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+func TestGuestBookHandler_CreateGuestBookMessage_DecodeErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedDetails string
+	}{
+		{
+			name:            "Empty body",
+			body:            "",
+			expectedDetails: "empty request body",
+		},
+		{
+			name:            "Syntax error",
+			body:            `{"name": "John", "email": }`,
+			expectedDetails: "malformed JSON at byte offset 27",
+		},
+		{
+			name:            "Truncated body",
+			body:            `{"name": "John"`,
+			expectedDetails: "request body ends with incomplete JSON",
+		},
+		{
+			name:            "Wrong field type",
+			body:            `{"name": 42, "email": "john@example.com", "message": "Hello there!"}`,
+			expectedDetails: `field "name" must be a string, got number`,
+		},
+		{
+			name:            "Trailing object",
+			body:            `{"name": "John", "email": "john@example.com", "message": "Hello there!"}{"name": "Jane"}`,
+			expectedDetails: "request body must contain a single JSON object",
+		},
+		{
+			name:            "Trailing garbage",
+			body:            `{"name": "John", "email": "john@example.com", "message": "Hello there!"}garbage`,
+			expectedDetails: "request body must contain a single JSON object",
+		},
+		{
+			name:            "Not an object",
+			body:            `["John"]`,
+			expectedDetails: "request body must be a JSON object, got array",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.CreateGuestBookMessage(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+
+			var errorResp map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &errorResp); err != nil {
+				t.Fatalf("Failed to unmarshal error response: %v", err)
+			}
+
+			if errorResp["error"] != "Invalid request body" {
+				t.Errorf("Expected 'Invalid request body' error, got %q", errorResp["error"])
+			}
+			if errorResp["code"] != "VALIDATION_ERROR" {
+				t.Errorf("Expected code VALIDATION_ERROR, got %q", errorResp["code"])
+			}
+			if errorResp["details"] != tt.expectedDetails {
+				t.Errorf("Expected details %q, got %q", tt.expectedDetails, errorResp["details"])
+			}
+		})
+	}
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{name: "Clean", body: `{"ids": [1, 2]}`},
+		{name: "Trailing whitespace", body: "{\"ids\": [1, 2]}\r\n\t "},
+		{name: "Trailing object", body: `{"ids": [1, 2]}{"ids": [3]}`, wantErr: errTrailingData},
+		{name: "Trailing garbage", body: `{"ids": [1, 2]}garbage`, wantErr: errTrailingData},
+		{name: "Trailing value", body: `{"ids": [1, 2]} 3`, wantErr: errTrailingData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req models.DeleteMessages
+			err := decodeJSONBody(strings.NewReader(tt.body), &req)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !slices.Equal(req.IDs, []int{1, 2}) {
+				t.Errorf("Expected IDs [1 2], got %v", req.IDs)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_CreateGuestBookMessage_TrailingNewline(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	body := `{"name": "John", "email": "john@example.com", "message": "Hello there, guest book!"}` + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateGuestBookMessage(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d for a body ending in a newline, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+}
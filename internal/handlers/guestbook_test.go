@@ -2,13 +2,21 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/config"
 	"github.com/moabdelazem/app/internal/models"
 )
 
@@ -113,7 +121,22 @@ func TestGuestBookHandler_GetGuestBookMessage(t *testing.T) {
 		{
 			name:           "Get message with invalid ID",
 			messageID:      "invalid",
-			expectedStatus: http.StatusNotFound,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Get message with zero ID",
+			messageID:      "0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Get message with negative ID",
+			messageID:      "-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Get message with out-of-range ID",
+			messageID:      "999999999999999999999999999999",
+			expectedStatus: http.StatusBadRequest,
 		},
 	}
 
@@ -371,3 +394,1434 @@ func TestGuestBookHandler_CreateGuestBookMessage_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestGuestBookHandler_GetGuestBookMessages_ConditionalGet(t *testing.T) {
+	mockService := NewMockGuestBookService()
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	lastModified, _ := mockService.GetLastModified(context.Background())
+	lastModified = lastModified.UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name            string
+		ifModifiedSince string
+		expectedStatus  int
+	}{
+		{
+			name:            "No If-Modified-Since header",
+			ifModifiedSince: "",
+			expectedStatus:  http.StatusOK,
+		},
+		{
+			name:            "If-Modified-Since equal to last modified",
+			ifModifiedSince: lastModified.Format(http.TimeFormat),
+			expectedStatus:  http.StatusNotModified,
+		},
+		{
+			name:            "If-Modified-Since newer than last modified",
+			ifModifiedSince: lastModified.Add(time.Hour).Format(http.TimeFormat),
+			expectedStatus:  http.StatusNotModified,
+		},
+		{
+			name:            "If-Modified-Since older than last modified",
+			ifModifiedSince: lastModified.Add(-time.Hour).Format(http.TimeFormat),
+			expectedStatus:  http.StatusOK,
+		},
+		{
+			name:            "Invalid If-Modified-Since header",
+			ifModifiedSince: "not a date",
+			expectedStatus:  http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if got := w.Header().Get("Last-Modified"); got != lastModified.Format(http.TimeFormat) {
+				t.Errorf("Expected Last-Modified %q, got %q", lastModified.Format(http.TimeFormat), got)
+			}
+
+			if tt.expectedStatus == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("Expected empty body for 304, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_EmptyOmitsLastModified(t *testing.T) {
+	mockService := &MockGuestBookService{nextID: 1}
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+	req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if got := w.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("Expected no Last-Modified header, got %q", got)
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_HugePage(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?page=99999999999&page_size=100", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.PaginatedResponse[models.GuestBookMessage]
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Items) != 0 {
+		t.Errorf("Expected no messages, got %d", len(response.Items))
+	}
+	if response.Pagination.Total != 2 || response.Pagination.TotalPages != 1 {
+		t.Errorf("Expected the real totals, got %+v", response.Pagination)
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_OutOfRange(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	tests := []struct {
+		name               string
+		query              string
+		expectedCount      int
+		expectedOutOfRange bool
+	}{
+		{name: "Last page", query: "?page=1&page_size=10", expectedCount: 2},
+		{name: "Past the last page", query: "?page=3&page_size=10", expectedCount: 0, expectedOutOfRange: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessages(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var response struct {
+				Messages   []map[string]interface{} `json:"messages"`
+				Pagination map[string]interface{}   `json:"pagination"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response.Messages == nil || len(response.Messages) != tt.expectedCount {
+				t.Errorf("Expected a messages array of %d, got %v", tt.expectedCount, response.Messages)
+			}
+
+			outOfRange, present := response.Pagination["out_of_range"]
+			if present != tt.expectedOutOfRange || (present && outOfRange != true) {
+				t.Errorf("Expected out_of_range present=%v, got %v", tt.expectedOutOfRange, response.Pagination)
+			}
+			if tt.expectedOutOfRange && response.Pagination["page"] != float64(3) {
+				t.Errorf("Expected the requested page to be kept, got %v", response.Pagination["page"])
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_ByEmail(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?email=jane.smith%40example.com", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.PaginatedResponse[models.GuestBookMessage]
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Items) != 1 || response.Items[0].Email != "jane.smith@example.com" {
+		t.Errorf("Expected only Jane's message, got %+v", response.Items)
+	}
+	if response.Pagination.Total != 1 || response.Pagination.TotalPages != 1 {
+		t.Errorf("Expected the filtered totals, got %+v", response.Pagination)
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_ByTag(t *testing.T) {
+	mockService := NewMockGuestBookService()
+	mockService.messages[0].Tags = []string{"greeting"}
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?tag=Greeting", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.PaginatedResponse[models.GuestBookMessage]
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Items) != 1 || response.Items[0].ID != 1 {
+		t.Errorf("Expected only the tagged message, got %+v", response.Items)
+	}
+	if response.Pagination.Total != 1 {
+		t.Errorf("Expected the filtered total, got %+v", response.Pagination)
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_EmailAndTag(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?tag=greeting&email=john.doe%40example.com", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessageRaw(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	tests := []struct {
+		name           string
+		messageID      string
+		expectedStatus int
+	}{
+		{name: "Existing message", messageID: "1", expectedStatus: http.StatusOK},
+		{name: "Missing message", messageID: "999", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/"+tt.messageID+"/raw", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.messageID})
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessageRaw(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+				t.Errorf("Expected Content-Type text/plain; charset=utf-8, got %q", contentType)
+			}
+			if body := w.Body.String(); body != "Hello, this is a test message!" {
+				t.Errorf("Expected only the message text, got %q", body)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_StrictPagination(t *testing.T) {
+	tests := []struct {
+		name           string
+		strict         bool
+		expectedStatus int
+	}{
+		{name: "Lenient falls back to defaults", strict: false, expectedStatus: http.StatusOK},
+		{name: "Strict rejects", strict: true, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+			handler.strictPagination = tt.strict
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?page=abc", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_InvalidEmail(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?email=not-an-email", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_EmptyDataset(t *testing.T) {
+	mockService := &MockGuestBookService{nextID: 1}
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if !strings.Contains(w.Body.String(), `"messages":[]`) {
+		t.Errorf("Expected body to contain an empty messages array, got %s", w.Body.String())
+	}
+}
+
+func TestGuestBookHandler_CreateGuestBookMessage_ConfiguredLimits(t *testing.T) {
+	validation := config.DefaultValidationConfig()
+	validation.NameMin = 5
+	mockService := NewMockGuestBookServiceWithConfig(config.Config{Validation: validation})
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	body, _ := json.Marshal(models.CreateGuestBookMessage{
+		Name:    "Bob",
+		Email:   "bob@example.com",
+		Message: "This is a test message for the guest book.",
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateGuestBookMessage(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var errorResp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &errorResp); err != nil {
+		t.Fatalf("Failed to unmarshal error response: %v", err)
+	}
+
+	expected := "name must be between 5 and 100 characters"
+	if errorResp["error"] != expected {
+		t.Errorf("Expected error %q, got %q", expected, errorResp["error"])
+	}
+}
+
+func TestGuestBookHandler_CreateGuestBookMessage_IdempotencyKey(t *testing.T) {
+	mockService := NewMockGuestBookService()
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	body, _ := json.Marshal(models.CreateGuestBookMessage{
+		Name:    "Bob Smith",
+		Email:   "bob@example.com",
+		Message: "This is a test message for the guest book.",
+	})
+
+	post := func(key string) models.GuestBookMessage {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+
+		handler.CreateGuestBookMessage(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+		}
+
+		var message models.GuestBookMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &message); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return message
+	}
+
+	first := post("retry-key-1")
+	retried := post("retry-key-1")
+	if retried.ID != first.ID {
+		t.Errorf("Expected retried request to return message %d, got %d", first.ID, retried.ID)
+	}
+
+	other := post("retry-key-2")
+	if other.ID == first.ID {
+		t.Errorf("Expected a new message for a different key, got %d again", other.ID)
+	}
+
+	if len(mockService.messages) != 4 {
+		t.Errorf("Expected 4 messages after one retry, got %d", len(mockService.messages))
+	}
+}
+
+func TestGuestBookHandler_CreateGuestBookMessage_ValidateOnly(t *testing.T) {
+	valid := `{"name":"Bob Smith","email":"bob@example.com","message":"This is a test message for the guest book."}`
+	invalid := `{"name":"B","email":"bob@example.com","message":"This is a test message for the guest book."}`
+
+	tests := []struct {
+		name              string
+		url               string
+		prefer            string
+		body              string
+		expectedStatus    int
+		expectPreferApply bool
+	}{
+		{name: "Valid via query", url: "/api/v1/guestbook?validate_only=true", body: valid, expectedStatus: http.StatusOK},
+		{name: "Valid via Prefer", url: "/api/v1/guestbook", prefer: "return=minimal, validate-only", body: valid, expectedStatus: http.StatusOK, expectPreferApply: true},
+		{name: "Invalid via query", url: "/api/v1/guestbook?validate_only=true", body: invalid, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid via Prefer", url: "/api/v1/guestbook", prefer: "validate-only", body: invalid, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockGuestBookService()
+			handler := NewGuestBookHandlerWithService(mockService)
+
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.prefer != "" {
+				req.Header.Set("Prefer", tt.prefer)
+			}
+			w := httptest.NewRecorder()
+
+			handler.CreateGuestBookMessage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if len(mockService.messages) != 2 {
+				t.Errorf("Expected nothing to be stored, got %d messages", len(mockService.messages))
+			}
+			if applied := w.Header().Get("Preference-Applied") == "validate-only"; applied != tt.expectPreferApply {
+				t.Errorf("Expected Preference-Applied: %v, got %q", tt.expectPreferApply, w.Header().Get("Preference-Applied"))
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var result models.DryRunResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if !result.DryRun || result.Message.Name != "Bob Smith" {
+				t.Errorf("Expected a dry run echoing the message, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_CreateGuestBookMessage_ReturnPreference(t *testing.T) {
+	body := `{"name":"Bob Smith","email":"bob@example.com","message":"This is a test message for the guest book."}`
+
+	tests := []struct {
+		name              string
+		prefer            string
+		expectBody        bool
+		expectedPreferred string
+	}{
+		{name: "No preference", prefer: "", expectBody: true, expectedPreferred: ""},
+		{name: "Representation", prefer: "return=representation", expectBody: true, expectedPreferred: "return=representation"},
+		{name: "Minimal", prefer: "return=minimal", expectBody: false, expectedPreferred: "return=minimal"},
+		{name: "Minimal among others", prefer: "respond-async, RETURN=\"minimal\"; foo=bar", expectBody: false, expectedPreferred: "return=minimal"},
+		{name: "Unknown return value", prefer: "return=everything", expectBody: true, expectedPreferred: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockGuestBookService()
+			handler := NewGuestBookHandlerWithService(mockService)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.prefer != "" {
+				req.Header.Set("Prefer", tt.prefer)
+			}
+			w := httptest.NewRecorder()
+
+			handler.CreateGuestBookMessage(w, req)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+			}
+			if len(mockService.messages) != 3 {
+				t.Errorf("Expected the message to be stored, got %d messages", len(mockService.messages))
+			}
+			if location := w.Header().Get("Location"); location != "/api/v1/guestbook/3" {
+				t.Errorf("Expected Location /api/v1/guestbook/3, got %q", location)
+			}
+			if applied := w.Header().Get("Preference-Applied"); applied != tt.expectedPreferred {
+				t.Errorf("Expected Preference-Applied %q, got %q", tt.expectedPreferred, applied)
+			}
+			// The author needs the edit token whatever the representation
+			if token := w.Header().Get("Edit-Token"); token != mockEditToken(3) {
+				t.Errorf("Expected Edit-Token %q, got %q", mockEditToken(3), token)
+			}
+
+			if !tt.expectBody {
+				if w.Body.Len() != 0 {
+					t.Errorf("Expected an empty body, got %q", w.Body.String())
+				}
+				return
+			}
+
+			var message models.GuestBookMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &message); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if message.ID != 3 || message.Name != "Bob Smith" {
+				t.Errorf("Expected the created message, got %+v", message)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookTimeline(t *testing.T) {
+	mockService := NewMockGuestBookService()
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	tests := []struct {
+		name         string
+		queryParams  string
+		expectedDays int
+	}{
+		{name: "Default range", queryParams: "", expectedDays: 30},
+		{name: "Custom range", queryParams: "?days=7", expectedDays: 7},
+		{name: "Invalid range", queryParams: "?days=abc", expectedDays: 30},
+		{name: "Range over maximum", queryParams: "?days=5000", expectedDays: 365},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/timeline"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookTimeline(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var timeline []models.DailyCount
+			if err := json.Unmarshal(w.Body.Bytes(), &timeline); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if len(timeline) != tt.expectedDays {
+				t.Errorf("Expected %d days, got %d", tt.expectedDays, len(timeline))
+			}
+
+			// Both seeded messages were created within the last two hours
+			total := 0
+			for _, day := range timeline {
+				total += day.Count
+			}
+			if total != 2 {
+				t.Errorf("Expected 2 messages across the timeline, got %d", total)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetMessageLengthStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []models.GuestBookMessage
+		expected models.MessageLengthStats
+	}{
+		// The seeded messages are 30 and 40 characters long
+		{name: "Seeded messages", expected: models.MessageLengthStats{Min: 30, Avg: 35, Max: 40, Median: 35}},
+		{name: "No messages", messages: []models.GuestBookMessage{}, expected: models.MessageLengthStats{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockGuestBookService()
+			if tt.messages != nil {
+				mockService.messages = tt.messages
+			}
+			handler := NewGuestBookHandlerWithService(mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/stats/message-lengths", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetMessageLengthStats(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var stats models.MessageLengthStats
+			if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if stats != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, stats)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookCount(t *testing.T) {
+	tests := []struct {
+		name          string
+		service       *MockGuestBookService
+		expectedCount int
+	}{
+		{name: "Seeded messages", service: NewMockGuestBookService(), expectedCount: 2},
+		{name: "Empty dataset", service: &MockGuestBookService{nextID: 1}, expectedCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewGuestBookHandlerWithService(tt.service)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/count", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookCount(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var response map[string]int
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response["count"] != tt.expectedCount {
+				t.Errorf("Expected count %d, got %d", tt.expectedCount, response["count"])
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookCount_Filters(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{name: "By email", query: "?email=john.doe@example.com", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "By email with no messages", query: "?email=nobody@example.com", expectedStatus: http.StatusOK, expectedCount: 0},
+		{name: "By tag", query: "?tag=Greeting", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "Invalid email", query: "?email=not-an-email", expectedStatus: http.StatusBadRequest},
+		{name: "Email and tag", query: "?email=john.doe@example.com&tag=greeting", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockGuestBookService()
+			mockService.messages[1].Tags = []string{"greeting"}
+			handler := NewGuestBookHandlerWithService(mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/count"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookCount(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response map[string]int
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response["count"] != tt.expectedCount {
+				t.Errorf("Expected count %d, got %d", tt.expectedCount, response["count"])
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_PatchGuestBookMessage(t *testing.T) {
+	tests := []struct {
+		name            string
+		messageID       string
+		editToken       string
+		requestBody     string
+		expectedStatus  int
+		expectedName    string
+		expectedMessage string
+	}{
+		{
+			name:            "Just the message",
+			messageID:       "1",
+			editToken:       mockEditToken(1),
+			requestBody:     `{"message": "An edited test message"}`,
+			expectedStatus:  http.StatusOK,
+			expectedName:    "John Doe",
+			expectedMessage: "An edited test message",
+		},
+		{
+			name:            "Just the name",
+			messageID:       "1",
+			editToken:       mockEditToken(1),
+			requestBody:     `{"name": "Johnny"}`,
+			expectedStatus:  http.StatusOK,
+			expectedName:    "Johnny",
+			expectedMessage: "Hello, this is a test message!",
+		},
+		{
+			name:           "Empty patch",
+			messageID:      "1",
+			editToken:      mockEditToken(1),
+			requestBody:    `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Present field is validated",
+			messageID:      "1",
+			editToken:      mockEditToken(1),
+			requestBody:    `{"name": ""}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			messageID:      "1",
+			editToken:      mockEditToken(1),
+			requestBody:    `{"name":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing edit token",
+			messageID:      "1",
+			requestBody:    `{"name": "Johnny"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Another message's edit token",
+			messageID:      "1",
+			editToken:      mockEditToken(2),
+			requestBody:    `{"name": "Johnny"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Non-existent message",
+			messageID:      "999",
+			editToken:      mockEditToken(999),
+			requestBody:    `{"name": "Johnny"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockGuestBookService()
+			handler := NewGuestBookHandlerWithService(mockService)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/guestbook/"+tt.messageID, strings.NewReader(tt.requestBody))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.messageID})
+			if tt.editToken != "" {
+				req.Header.Set("Edit-Token", tt.editToken)
+			}
+			w := httptest.NewRecorder()
+
+			handler.PatchGuestBookMessage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var msg models.GuestBookMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if msg.Name != tt.expectedName || msg.Message != tt.expectedMessage {
+				t.Errorf("Expected name %q and message %q, got %q and %q", tt.expectedName, tt.expectedMessage, msg.Name, msg.Message)
+			}
+			if msg.Email != "john.doe@example.com" {
+				t.Errorf("Expected the email to be left unchanged, got %q", msg.Email)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_UpdateGuestBookMessageStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		messageID      string
+		requestBody    string
+		expectedStatus int
+	}{
+		{
+			name:           "Reject existing message",
+			messageID:      "1",
+			requestBody:    `{"status": "rejected"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid status",
+			messageID:      "1",
+			requestBody:    `{"status": "deleted"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			messageID:      "1",
+			requestBody:    `{"status":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Non-existent message",
+			messageID:      "999",
+			requestBody:    `{"status": "approved"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockGuestBookService()
+			handler := NewGuestBookHandlerWithService(mockService)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/guestbook/"+tt.messageID+"/status", strings.NewReader(tt.requestBody))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.messageID})
+			w := httptest.NewRecorder()
+
+			handler.UpdateGuestBookMessageStatus(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var msg models.GuestBookMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if msg.Status != models.StatusRejected {
+				t.Errorf("Expected status %q, got %q", models.StatusRejected, msg.Status)
+			}
+
+			// Rejected messages disappear from the public list
+			listReq := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+			listW := httptest.NewRecorder()
+			handler.GetGuestBookMessages(listW, listReq)
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(listW.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal list response: %v", err)
+			}
+			if messages := response["messages"].([]interface{}); len(messages) != 1 {
+				t.Errorf("Expected 1 public message after rejection, got %d", len(messages))
+			}
+		})
+	}
+}
+
+// parseLinkHeader parses an RFC 8288 Link header into a rel -> URL map
+func parseLinkHeader(t *testing.T, header string) map[string]string {
+	t.Helper()
+
+	links := make(map[string]string)
+	if header == "" {
+		return links
+	}
+
+	for _, part := range strings.Split(header, ",") {
+		segments := strings.Split(strings.TrimSpace(part), ";")
+		if len(segments) != 2 {
+			t.Fatalf("Malformed link %q", part)
+		}
+
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			t.Fatalf("Malformed link target %q", target)
+		}
+
+		rel := strings.TrimSpace(segments[1])
+		if !strings.HasPrefix(rel, `rel="`) || !strings.HasSuffix(rel, `"`) {
+			t.Fatalf("Malformed link rel %q", rel)
+		}
+
+		links[rel[len(`rel="`):len(rel)-1]] = target[1 : len(target)-1]
+	}
+
+	return links
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_LinkHeader(t *testing.T) {
+	mockService := NewMockGuestBookService()
+	for i := 0; i < 3; i++ {
+		mockService.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+			Name:    "Test User",
+			Email:   "test@example.com",
+			Message: "This is a test message for the guest book.",
+		})
+	}
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	// 5 messages at 2 per page = 3 pages
+	tests := []struct {
+		name          string
+		queryParams   string
+		expectedLinks map[string]string
+	}{
+		{
+			name:        "First page",
+			queryParams: "?page=1&page_size=2",
+			expectedLinks: map[string]string{
+				"first": "/api/v1/guestbook?page=1&page_size=2",
+				"next":  "/api/v1/guestbook?page=2&page_size=2",
+				"last":  "/api/v1/guestbook?page=3&page_size=2",
+			},
+		},
+		{
+			name:        "Middle page preserves other query params",
+			queryParams: "?page=2&page_size=2&foo=bar",
+			expectedLinks: map[string]string{
+				"first": "/api/v1/guestbook?foo=bar&page=1&page_size=2",
+				"prev":  "/api/v1/guestbook?foo=bar&page=1&page_size=2",
+				"next":  "/api/v1/guestbook?foo=bar&page=3&page_size=2",
+				"last":  "/api/v1/guestbook?foo=bar&page=3&page_size=2",
+			},
+		},
+		{
+			name:        "Last page",
+			queryParams: "?page=3&page_size=2",
+			expectedLinks: map[string]string{
+				"first": "/api/v1/guestbook?page=1&page_size=2",
+				"prev":  "/api/v1/guestbook?page=2&page_size=2",
+				"last":  "/api/v1/guestbook?page=3&page_size=2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessages(w, req)
+
+			links := parseLinkHeader(t, w.Header().Get("Link"))
+			if len(links) != len(tt.expectedLinks) {
+				t.Errorf("Expected %d links, got %v", len(tt.expectedLinks), links)
+			}
+
+			for rel, expected := range tt.expectedLinks {
+				if links[rel] != expected {
+					t.Errorf("Expected rel=%q to be %q, got %q", rel, expected, links[rel])
+				}
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_LinkHeaderEmpty(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(&MockGuestBookService{nextID: 1})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	links := parseLinkHeader(t, w.Header().Get("Link"))
+	if len(links) != 1 || links["first"] == "" {
+		t.Errorf("Expected only a first link for an empty list, got %v", links)
+	}
+}
+
+func TestGuestBookHandler_GetAdminGuestBookMessage(t *testing.T) {
+	mockService := NewMockGuestBookService()
+	mockService.messages[0].Status = models.StatusPending
+	mockService.messages[0].Metadata = &models.MessageMetadata{IPHash: "abc123", UserAgent: "curl/8.0"}
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	// The public endpoint hides both the pending message and its metadata
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	handler.GetGuestBookMessage(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for pending message, got %d", http.StatusNotFound, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "abc123") {
+		t.Errorf("Expected public response to omit metadata, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/admin/guestbook/1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	w = httptest.NewRecorder()
+	handler.GetAdminGuestBookMessage(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Status   string                 `json:"status"`
+		Metadata models.MessageMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Status != models.StatusPending {
+		t.Errorf("Expected pending message, got status %q", response.Status)
+	}
+	if response.Metadata.IPHash != "abc123" || response.Metadata.UserAgent != "curl/8.0" {
+		t.Errorf("Expected metadata in admin response, got %+v", response.Metadata)
+	}
+}
+
+func TestGuestBookHandler_GetPendingGuestBookMessages(t *testing.T) {
+	t.Run("Queue", func(t *testing.T) {
+		mockService := NewMockGuestBookService()
+		mockService.messages[0].Status = models.StatusRejected
+		mockService.messages[0].Metadata = &models.MessageMetadata{IPHash: "abc123"}
+		for i, name := range []string{"First Pending", "Second Pending", "Third Pending"} {
+			mockService.messages = append(mockService.messages, models.GuestBookMessage{
+				ID:        3 + i,
+				Name:      name,
+				Email:     "pending@example.com",
+				Message:   "Waiting for a moderator to look at this.",
+				Status:    models.StatusPending,
+				Metadata:  &models.MessageMetadata{IPHash: "def456"},
+				CreatedAt: time.Now().Add(time.Duration(i) * time.Minute),
+			})
+		}
+		handler := NewGuestBookHandlerWithService(mockService)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/guestbook/pending?page=1&page_size=2", nil)
+		w := httptest.NewRecorder()
+		handler.GetPendingGuestBookMessages(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var response struct {
+			Messages []struct {
+				ID       int                    `json:"id"`
+				Status   string                 `json:"status"`
+				Metadata models.MessageMetadata `json:"metadata"`
+			} `json:"messages"`
+			Pagination models.Pagination       `json:"pagination"`
+			Counts     models.ModerationCounts `json:"counts"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		if len(response.Messages) != 2 || response.Messages[0].ID != 3 || response.Messages[1].ID != 4 {
+			t.Fatalf("Expected the two oldest pending messages, got %+v", response.Messages)
+		}
+		for _, msg := range response.Messages {
+			if msg.Status != models.StatusPending || msg.Metadata.IPHash != "def456" {
+				t.Errorf("Expected a pending message with metadata, got %+v", msg)
+			}
+		}
+		if want := (models.ModerationCounts{Pending: 3, Approved: 1, Rejected: 1}); response.Counts != want {
+			t.Errorf("Expected counts %+v, got %+v", want, response.Counts)
+		}
+		if response.Pagination.Total != 3 || response.Pagination.TotalPages != 2 || !response.Pagination.HasNext {
+			t.Errorf("Expected 2 pages of 3 pending messages, got %+v", response.Pagination)
+		}
+		if link := w.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+			t.Errorf("Expected a next link, got %q", link)
+		}
+	})
+
+	t.Run("Empty queue", func(t *testing.T) {
+		handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/guestbook/pending", nil)
+		w := httptest.NewRecorder()
+		handler.GetPendingGuestBookMessages(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `"messages":[]`) {
+			t.Errorf("Expected an empty messages array, got %s", w.Body.String())
+		}
+
+		var response models.ModerationQueue
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if want := (models.ModerationCounts{Approved: 2}); response.Counts != want {
+			t.Errorf("Expected counts %+v, got %+v", want, response.Counts)
+		}
+		if response.Pagination.Total != 0 || response.Pagination.TotalPages != 0 || response.Pagination.HasNext {
+			t.Errorf("Expected an empty first page, got %+v", response.Pagination)
+		}
+	})
+}
+
+// recordingGuestBookService captures the message passed to CreateMessage
+type recordingGuestBookService struct {
+	*MockGuestBookService
+	created *models.CreateGuestBookMessage
+}
+
+func (r *recordingGuestBookService) CreateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.GuestBookMessage, error) {
+	r.created = msg
+	return r.MockGuestBookService.CreateMessage(ctx, msg)
+}
+
+func TestGuestBookHandler_CreateGuestBookMessage_PassesRequestMetadata(t *testing.T) {
+	service := &recordingGuestBookService{MockGuestBookService: NewMockGuestBookService()}
+	handler := NewGuestBookHandlerWithService(service)
+
+	body, _ := json.Marshal(models.CreateGuestBookMessage{
+		Name:    "Bob Smith",
+		Email:   "bob@example.com",
+		Message: "This is a test message for the guest book.",
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	req.RemoteAddr = "198.51.100.4:51234"
+	w := httptest.NewRecorder()
+
+	handler.CreateGuestBookMessage(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if service.created.ClientIP != "198.51.100.4" {
+		t.Errorf("Expected client IP 198.51.100.4, got %q", service.created.ClientIP)
+	}
+	if service.created.UserAgent != "test-agent/1.0" {
+		t.Errorf("Expected user agent test-agent/1.0, got %q", service.created.UserAgent)
+	}
+}
+
+// failingGuestBookService returns err from every call, for error mapping tests
+type failingGuestBookService struct {
+	*MockGuestBookService
+	err error
+}
+
+func (f *failingGuestBookService) CreateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.GuestBookMessage, error) {
+	return nil, f.err
+}
+
+func (f *failingGuestBookService) GetMessageByID(ctx context.Context, idStr string) (*models.GuestBookMessage, error) {
+	return nil, f.err
+}
+
+func (f *failingGuestBookService) CountMessages(ctx context.Context) (int, error) {
+	return 0, f.err
+}
+
+func TestGuestBookHandler_ServiceErrorMapping(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Not found",
+			err:            fmt.Errorf("guest book message %w", apperrors.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "guest book message not found",
+		},
+		{
+			name:           "Invalid input",
+			err:            apperrors.Newf(apperrors.ErrInvalidInput, "bad input"),
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "bad input",
+		},
+		{
+			name:           "Conflict",
+			err:            apperrors.Newf(apperrors.ErrConflict, "duplicate message"),
+			expectedStatus: http.StatusConflict,
+			expectedError:  "duplicate message",
+		},
+		{
+			name:           "Unavailable hides details",
+			err:            fmt.Errorf("pool exhausted: %w", apperrors.ErrUnavailable),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedError:  "Failed to retrieve message",
+		},
+		{
+			name:           "Unclassified error hides details",
+			err:            errors.New("connection refused to 10.0.0.1"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "Failed to retrieve message",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewGuestBookHandlerWithService(&failingGuestBookService{
+				MockGuestBookService: NewMockGuestBookService(),
+				err:                  tt.err,
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/1", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var errorResp map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &errorResp); err != nil {
+				t.Fatalf("Failed to unmarshal error response: %v", err)
+			}
+			if errorResp["error"] != tt.expectedError {
+				t.Errorf("Expected error %q, got %q", tt.expectedError, errorResp["error"])
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_SearchGuestBookMessages(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	tests := []struct {
+		name            string
+		queryParams     string
+		expectedStatus  int
+		expectedResults int
+	}{
+		{name: "Matching query", queryParams: "?q=guest", expectedStatus: http.StatusOK, expectedResults: 1},
+		{name: "No matches", queryParams: "?q=nonexistent", expectedStatus: http.StatusOK, expectedResults: 0},
+		{name: "Special characters", queryParams: "?q=" + url.QueryEscape("'); DROP TABLE & !"), expectedStatus: http.StatusOK, expectedResults: 0},
+		{name: "Missing query", queryParams: "", expectedStatus: http.StatusBadRequest},
+		{name: "Blank query", queryParams: "?q=%20%20", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/search"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.SearchGuestBookMessages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Results []struct {
+					ID   int      `json:"id"`
+					Rank *float64 `json:"rank"`
+				} `json:"results"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response.Results == nil {
+				t.Fatal("Expected results to be an array, got null")
+			}
+			if len(response.Results) != tt.expectedResults {
+				t.Errorf("Expected %d results, got %d", tt.expectedResults, len(response.Results))
+			}
+			for _, result := range response.Results {
+				if result.Rank == nil {
+					t.Errorf("Expected result %d to include its rank", result.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessageNeighbors(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+	tests := []struct {
+		name             string
+		id               string
+		expectedStatus   int
+		expectedPrevious string
+		expectedNext     string
+	}{
+		{name: "Oldest message", id: "1", expectedStatus: http.StatusOK, expectedPrevious: "null", expectedNext: "2"},
+		{name: "Newest message", id: "2", expectedStatus: http.StatusOK, expectedPrevious: "1", expectedNext: "null"},
+		{name: "Missing message", id: "999", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/"+tt.id+"/neighbors", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessageNeighbors(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			// neighborID renders a neighbor as its ID, or "null" at a boundary
+			neighborID := func(raw json.RawMessage) string {
+				if string(raw) == "null" {
+					return "null"
+				}
+				var msg models.GuestBookMessage
+				if err := json.Unmarshal(raw, &msg); err != nil {
+					t.Fatalf("Failed to unmarshal neighbor: %v", err)
+				}
+				return strconv.Itoa(msg.ID)
+			}
+
+			if got := neighborID(response["previous"]); got != tt.expectedPrevious {
+				t.Errorf("Expected previous %s, got %s", tt.expectedPrevious, got)
+			}
+			if got := neighborID(response["next"]); got != tt.expectedNext {
+				t.Errorf("Expected next %s, got %s", tt.expectedNext, got)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_DeleteGuestBookMessages(t *testing.T) {
+	tooMany, _ := json.Marshal(models.DeleteMessages{IDs: make([]int, models.MaxDeleteIDs+1)})
+
+	tests := []struct {
+		name            string
+		requestBody     string
+		expectedStatus  int
+		expectedDeleted int
+		expectedLeft    int
+	}{
+		{
+			name:            "Delete existing and missing IDs",
+			requestBody:     `{"ids": [1, 999]}`,
+			expectedStatus:  http.StatusOK,
+			expectedDeleted: 1,
+			expectedLeft:    1,
+		},
+		{
+			name:            "Delete all",
+			requestBody:     `{"ids": [1, 2, 2]}`,
+			expectedStatus:  http.StatusOK,
+			expectedDeleted: 2,
+			expectedLeft:    0,
+		},
+		{
+			name:           "Empty list",
+			requestBody:    `{"ids": []}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLeft:   2,
+		},
+		{
+			name:           "Missing ids",
+			requestBody:    `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLeft:   2,
+		},
+		{
+			name:           "Too many IDs",
+			requestBody:    string(tooMany),
+			expectedStatus: http.StatusBadRequest,
+			expectedLeft:   2,
+		},
+		{
+			name:           "Non-positive ID",
+			requestBody:    `{"ids": [1, 0]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLeft:   2,
+		},
+		{
+			name:           "Invalid JSON",
+			requestBody:    `{"ids": ["1"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLeft:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockGuestBookService()
+			handler := NewGuestBookHandlerWithService(mockService)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/guestbook", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+
+			handler.DeleteGuestBookMessages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if len(mockService.messages) != tt.expectedLeft {
+				t.Errorf("Expected %d messages left, got %d", tt.expectedLeft, len(mockService.messages))
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var result models.DeleteMessagesResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if result.Deleted != tt.expectedDeleted {
+				t.Errorf("Expected %d deleted, got %d", tt.expectedDeleted, result.Deleted)
+			}
+		})
+	}
+}
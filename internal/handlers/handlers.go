@@ -1,31 +1,116 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/captcha"
+	"github.com/moabdelazem/app/internal/config"
 	"github.com/moabdelazem/app/internal/database"
 	"github.com/moabdelazem/app/internal/models"
 	"github.com/moabdelazem/app/internal/repository"
 	"github.com/moabdelazem/app/internal/service"
 )
 
-// RespondJSON writes a JSON response with the given status code and payload
+// respondServiceError writes err with the HTTP status and code for its
+// domain kind. Client errors expose the error message; server errors use
+// fallback so internal details aren't leaked.
+func respondServiceError(w http.ResponseWriter, err error, fallback string) {
+	status := apperrors.StatusFor(err)
+
+	message := err.Error()
+	if status >= http.StatusInternalServerError {
+		message = fallback
+	}
+
+	RespondError(w, status, apperrors.CodeFor(err), message)
+}
+
+// RespondError writes the JSON error envelope: a human-readable message
+// under "error" and a stable code under "code"
+func RespondError(w http.ResponseWriter, status int, code apperrors.Code, message string) {
+	RespondJSON(w, status, map[string]string{
+		"error": message,
+		"code":  string(code),
+	})
+}
+
+// prettyJSON controls whether RespondJSON indents its output
+var prettyJSON atomic.Bool
+
+// SetPrettyJSON enables indented JSON responses, intended for debug mode only
+func SetPrettyJSON(enabled bool) {
+	prettyJSON.Store(enabled)
+}
+
+// DefaultJSONCharset is the charset parameter JSON responses carry unless
+// SetJSONCharset says otherwise
+const DefaultJSONCharset = "utf-8"
+
+// jsonCharset is the charset set by SetJSONCharset; nil means
+// DefaultJSONCharset
+var jsonCharset atomic.Pointer[string]
+
+// SetJSONCharset sets the charset parameter added to JSON Content-Types.
+// An empty charset leaves the parameter off.
+func SetJSONCharset(charset string) {
+	jsonCharset.Store(&charset)
+}
+
+// JSONContentType returns mediaType with the configured charset parameter
+func JSONContentType(mediaType string) string {
+	charset := DefaultJSONCharset
+	if configured := jsonCharset.Load(); configured != nil {
+		charset = *configured
+	}
+	if charset == "" {
+		return mediaType
+	}
+	return mediaType + "; charset=" + charset
+}
+
+// RespondJSON writes a JSON response with the given status code and payload.
+// The payload is encoded before anything is written, so an encoding failure
+// becomes a clean 500 rather than a committed status with a partial body.
+// The payload is shaped for the version negotiated by WithResponseVersion.
 func RespondJSON(w http.ResponseWriter, status int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
+	version := responseVersionOf(w)
+	if version.shape != nil {
+		payload = version.shape(payload)
+	}
 
+	var body bytes.Buffer
 	if payload != nil {
-		if err := json.NewEncoder(w).Encode(payload); err != nil {
+		encoder := json.NewEncoder(&body)
+		if prettyJSON.Load() {
+			encoder.SetIndent("", "  ")
+		}
+
+		if err := encoder.Encode(payload); err != nil {
 			slog.Error("Failed to encode JSON response", "error", err)
-			// Write a simple error message if JSON encoding fails
-			w.Write([]byte(`{"error": "Internal server error"}`))
+			status = http.StatusInternalServerError
+			body.Reset()
+			body.WriteString(`{"error":"Internal server error","code":"INTERNAL_ERROR"}` + "\n")
 		}
 	}
+
+	w.Header().Set("Content-Type", JSONContentType(version.contentType))
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
 }
 
 // HomeHandler handles requests to the root endpoint
@@ -42,11 +127,28 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 
 type GuestBookHandler struct {
 	service GuestBookServiceInterface
+	// strictPagination answers malformed page and page_size values with
+	// 400 instead of using the defaults
+	strictPagination bool
 }
 
-func NewGuestBookHandler(db *database.DB) *GuestBookHandler {
+// NewGuestBookHandler creates a handler backed by db. Background work, such
+// as storing audit entries, runs on tasks.
+func NewGuestBookHandler(db *database.DB, cfg config.Config, tasks service.TaskRunner) *GuestBookHandler {
+	repo := repository.NewGuestBookRepository(db)
+	repo.SetMaxOffset(cfg.MaxOffset)
+	svc := service.NewGuestBookService(repo, cfg)
+	if cfg.AuditLogDB {
+		svc.UseAuditSink(repository.NewAuditRepository(db))
+		svc.UseTasks(tasks)
+	}
+	if cfg.Captcha.Enabled {
+		svc.UseCaptcha(captcha.New(cfg.Captcha))
+	}
+
 	return &GuestBookHandler{
-		service: service.NewGuestBookService(repository.NewGuestBookRepository(db)),
+		service:          svc,
+		strictPagination: cfg.StrictPagination,
 	}
 }
 
@@ -61,40 +163,225 @@ func NewGuestBookHandlerWithService(service GuestBookServiceInterface) *GuestBoo
 func (h *GuestBookHandler) GetGuestBookMessages(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Parse query parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
+	page, pageSize, err := ParsePagination(r)
+	if err != nil && h.strictPagination {
+		RespondError(w, http.StatusBadRequest, apperrors.CodeValidation, err.Error())
+		return
+	}
+
+	// ?snapshot= pages through a consistent view instead of the live list
+	if token := r.URL.Query().Get("snapshot"); token != "" {
+		h.respondSnapshotPage(w, r, token, page, pageSize)
+		return
+	}
+
+	lastModified, err := h.service.GetLastModified(ctx)
+	if err != nil {
+		slog.Error("Failed to get guest book last modified time", "error", err)
+		respondServiceError(w, err, "Failed to retrieve messages")
+		return
+	}
+
+	// Conditional GET: omit Last-Modified entirely when there are no messages
+	if !lastModified.IsZero() {
+		// HTTP dates have second precision
+		lastModified = lastModified.UTC().Truncate(time.Second)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+		if notModifiedSince(r, lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Accept-Ranges", rangeUnit)
+	email := r.URL.Query().Get("email")
+	tag := r.URL.Query().Get("tag")
+	if email != "" && tag != "" {
+		RespondError(w, http.StatusBadRequest, apperrors.CodeValidation, "Filter by email or tag, not both")
+		return
 	}
 
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
+	// Range: messages=first-last is an alternative to page and page_size,
+	// counting positions within the filtered list when there is a filter
+	if rng, ok, err := parseMessageRange(r.Header.Get("Range")); err != nil {
+		RespondError(w, http.StatusBadRequest, apperrors.CodeValidation, "Range must look like messages=0-9")
+		return
+	} else if ok {
+		h.respondMessageRange(w, r, rng, email, tag)
+		return
 	}
 
-	messages, total, err := h.service.GetMessages(ctx, page, pageSize)
+	var (
+		messages []models.GuestBookMessage
+		stream   iter.Seq2[models.GuestBookMessage, error]
+		total    int
+	)
+	// ?email= lists one author's messages by exact address, unlike search;
+	// ?tag= lists one category. The unfiltered list is streamed, since
+	// it's the one most often requested with large pages.
+	switch {
+	case email != "":
+		messages, total, err = h.service.GetMessagesByEmail(ctx, email, page, pageSize)
+	case tag != "":
+		messages, total, err = h.service.GetMessagesByTag(ctx, tag, page, pageSize)
+	default:
+		stream, total, err = h.service.StreamMessages(ctx, page, pageSize)
+	}
 	if err != nil {
 		slog.Error("Failed to get guest book messages", "error", err)
-		RespondJSON(w, http.StatusInternalServerError, map[string]string{
-			"error": "Failed to retrieve messages",
-		})
+		respondServiceError(w, err, "Failed to retrieve messages")
 		return
 	}
 
-	// Calculate pagination info
-	totalPages := (total + pageSize - 1) / pageSize
+	pagination := models.NewPagination(page, pageSize, total)
 
-	response := map[string]interface{}{
-		"messages": messages,
-		"pagination": map[string]interface{}{
-			"page":        page,
-			"page_size":   pageSize,
-			"total":       total,
-			"total_pages": totalPages,
-		},
+	if link := paginationLinkHeader(r.URL, page, pageSize, pagination.TotalPages); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	if stream != nil {
+		respondStreamedPage(w, stream, pagination)
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, models.PaginatedResponse[models.GuestBookMessage]{
+		Items:      messages,
+		Pagination: pagination,
+	})
+}
+
+// paginationLinkHeader builds an RFC 8288 Link header with first, prev, next
+// and last page URLs, omitting rels that don't apply to the current page
+func paginationLinkHeader(u *url.URL, page, pageSize, totalPages int) string {
+	pageURL := func(p int) string {
+		query := u.Query()
+		query.Set("page", strconv.Itoa(p))
+		query.Set("page_size", strconv.Itoa(pageSize))
+		return (&url.URL{Path: u.Path, RawQuery: query.Encode()}).String()
+	}
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(1))}
+	if page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(page-1)))
+	}
+	if page < totalPages {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(page+1)))
+	}
+	if totalPages > 0 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(totalPages)))
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// notModifiedSince reports whether the request's If-Modified-Since header is
+// equal to or newer than lastModified
+func notModifiedSince(r *http.Request, lastModified time.Time) bool {
+	header := r.Header.Get("If-Modified-Since")
+	if header == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.After(since)
+}
+
+// GetGuestBookCount handles GET /api/v1/guestbook/count
+func (h *GuestBookHandler) GetGuestBookCount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// The same filters as the list, so a count matches the list's total
+	email := r.URL.Query().Get("email")
+	tag := r.URL.Query().Get("tag")
+	if email != "" && tag != "" {
+		RespondError(w, http.StatusBadRequest, apperrors.CodeValidation, "Filter by email or tag, not both")
+		return
+	}
+
+	var (
+		count int
+		err   error
+	)
+	switch {
+	case email != "":
+		count, err = h.service.CountMessagesByEmail(ctx, email)
+	case tag != "":
+		count, err = h.service.CountMessagesByTag(ctx, tag)
+	default:
+		count, err = h.service.CountMessages(ctx)
+	}
+	if err != nil {
+		slog.Error("Failed to count guest book messages", "error", err)
+		respondServiceError(w, err, "Failed to count messages")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, map[string]int{
+		"count": count,
+	})
+}
+
+// GetGuestBookTimeline handles GET /api/v1/guestbook/timeline
+func (h *GuestBookHandler) GetGuestBookTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Out-of-range values are clamped by the service
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil {
+		days = service.DefaultTimelineDays
+	}
+
+	timeline, err := h.service.GetTimeline(ctx, days)
+	if err != nil {
+		slog.Error("Failed to get guest book timeline", "error", err)
+		respondServiceError(w, err, "Failed to retrieve timeline")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, timeline)
+}
+
+// GetMessageLengthStats handles GET /api/v1/stats/message-lengths
+func (h *GuestBookHandler) GetMessageLengthStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	stats, err := h.service.GetMessageLengthStats(ctx)
+	if err != nil {
+		slog.Error("Failed to get message length stats", "error", err)
+		respondServiceError(w, err, "Failed to retrieve message length stats")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, stats)
+}
+
+// SearchGuestBookMessages handles GET /api/v1/guestbook/search
+func (h *GuestBookHandler) SearchGuestBookMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query().Get("q")
+
+	// Out-of-range values are clamped by the service
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = service.DefaultSearchLimit
 	}
 
-	RespondJSON(w, http.StatusOK, response)
+	results, err := h.service.SearchMessages(ctx, q, limit)
+	if err != nil {
+		slog.Error("Failed to search guest book messages", "error", err)
+		respondServiceError(w, err, "Failed to search messages")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   q,
+		"results": results,
+	})
 }
 
 // GetGuestBookMessage handles GET /api/v1/guestbook/{id}
@@ -106,61 +393,267 @@ func (h *GuestBookHandler) GetGuestBookMessage(w http.ResponseWriter, r *http.Re
 	message, err := h.service.GetMessageByID(ctx, id)
 	if err != nil {
 		slog.Error("Failed to get guest book message", "id", id, "error", err)
-		RespondJSON(w, http.StatusNotFound, map[string]string{
-			"error": "Message not found",
-		})
+		respondServiceError(w, err, "Failed to retrieve message")
 		return
 	}
 
 	RespondJSON(w, http.StatusOK, message)
 }
 
+// GetGuestBookMessageRaw handles GET /api/v1/guestbook/{id}/raw, answering
+// with just the message text as text/plain for terminals and embedding
+func (h *GuestBookHandler) GetGuestBookMessageRaw(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	message, err := h.service.GetMessageByID(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get guest book message", "id", id, "error", err)
+		respondServiceError(w, err, "Failed to retrieve message")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, message.Message)
+}
+
+// GetGuestBookMessageNeighbors handles GET /api/v1/guestbook/{id}/neighbors
+func (h *GuestBookHandler) GetGuestBookMessageNeighbors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	neighbors, err := h.service.GetMessageNeighbors(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get guest book message neighbors", "id", id, "error", err)
+		respondServiceError(w, err, "Failed to retrieve neighboring messages")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, neighbors)
+}
+
 // CreateGuestBookMessage handles POST /api/v1/guestbook
 func (h *GuestBookHandler) CreateGuestBookMessage(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx := service.WithClientIP(r.Context(), clientIP(r))
 
 	var createMsg models.CreateGuestBookMessage
-	if err := json.NewDecoder(r.Body).Decode(&createMsg); err != nil {
+	if err := decodeJSONBody(r.Body, &createMsg); err != nil {
 		slog.Error("Failed to decode request body", "error", err)
-		RespondJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "Invalid request body",
-		})
+		respondDecodeError(w, err)
+		return
+	}
+	createMsg.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	createMsg.ClientIP = clientIP(r)
+	createMsg.UserAgent = r.UserAgent()
+
+	if dryRun, preferred := validateOnly(r); dryRun {
+		validated, err := h.service.ValidateMessage(ctx, &createMsg)
+		if err != nil {
+			respondServiceError(w, err, "Failed to validate message")
+			return
+		}
+
+		if preferred {
+			w.Header().Set("Preference-Applied", "validate-only")
+		}
+		RespondJSON(w, http.StatusOK, models.DryRunResult{DryRun: true, Message: *validated})
 		return
 	}
 
 	message, err := h.service.CreateMessage(ctx, &createMsg)
 	if err != nil {
 		slog.Error("Failed to create guest book message", "error", err)
-		RespondJSON(w, http.StatusBadRequest, map[string]string{
-			"error": err.Error(),
-		})
+		respondServiceError(w, err, "Failed to create message")
 		return
 	}
 
 	slog.Info("Created new guest book message", "id", message.ID, "name", message.Name)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/guestbook/%d", message.ID))
+	// The edit token is the author's only proof of authorship, so it is
+	// sent whatever representation was asked for
+	if message.EditToken != "" {
+		w.Header().Set("Edit-Token", message.EditToken)
+	}
+
+	switch returnPreference(r) {
+	case "minimal":
+		w.Header().Set("Preference-Applied", "return=minimal")
+		w.WriteHeader(http.StatusCreated)
+		return
+	case "representation":
+		w.Header().Set("Preference-Applied", "return=representation")
+	}
 	RespondJSON(w, http.StatusCreated, message)
 }
 
-// HealthHandler handles health check requests with database connectivity check
-func HealthHandlerWithDB(db *database.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+// returnPreference returns the Prefer: return= value the client asked for,
+// "minimal" or "representation", or "" if it named neither
+func returnPreference(r *http.Request) string {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			// Preferences may carry parameters after a semicolon
+			token, _, _ := strings.Cut(pref, ";")
+			name, value, ok := strings.Cut(strings.TrimSpace(token), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "return") {
+				continue
+			}
+
+			switch value = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`)); value {
+			case "minimal", "representation":
+				return value
+			}
+		}
+	}
+	return ""
+}
 
-		// Check database health
-		if err := db.Health(ctx); err != nil {
-			slog.Error("Database health check failed", "error", err)
-			RespondJSON(w, http.StatusServiceUnavailable, map[string]string{
-				"status": "unhealthy",
-				"error":  "Database connection failed",
-			})
-			return
+// validateOnly reports whether a create should only be validated, requested
+// with ?validate_only=true or a Prefer: validate-only header, and whether the
+// header asked for it
+func validateOnly(r *http.Request) (dryRun, preferred bool) {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "validate-only") {
+				return true, true
+			}
 		}
+	}
+
+	dryRun, _ = strconv.ParseBool(r.URL.Query().Get("validate_only"))
+	return dryRun, false
+}
+
+// PatchGuestBookMessage handles PATCH /api/v1/guestbook/{id}, which changes
+// only the fields present in the body. The Edit-Token header must carry the
+// token returned when the message was created.
+func (h *GuestBookHandler) PatchGuestBookMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := service.WithClientIP(r.Context(), clientIP(r))
+	id := mux.Vars(r)["id"]
+
+	var patch models.PatchGuestBookMessage
+	if err := decodeJSONBody(r.Body, &patch); err != nil {
+		slog.Error("Failed to decode request body", "error", err)
+		respondDecodeError(w, err)
+		return
+	}
+
+	message, err := h.service.PatchMessage(ctx, id, r.Header.Get("Edit-Token"), &patch)
+	if err != nil {
+		slog.Error("Failed to update guest book message", "id", id, "error", err)
+		respondServiceError(w, err, "Failed to update message")
+		return
+	}
+
+	slog.Info("Updated guest book message", "id", message.ID, "fields", patch.Fields())
+	RespondJSON(w, http.StatusOK, message)
+}
 
-		RespondJSON(w, http.StatusOK, map[string]string{
-			"status":   "healthy",
-			"database": "connected",
-		})
+// UpdateGuestBookMessageStatus handles PATCH /api/v1/admin/guestbook/{id}/status
+func (h *GuestBookHandler) UpdateGuestBookMessageStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := service.WithClientIP(r.Context(), clientIP(r))
+	id := mux.Vars(r)["id"]
+
+	var req models.UpdateMessageStatus
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		slog.Error("Failed to decode request body", "error", err)
+		respondDecodeError(w, err)
+		return
+	}
+
+	message, err := h.service.UpdateMessageStatus(ctx, id, req.Status)
+	if err != nil {
+		slog.Error("Failed to update guest book message status", "id", id, "error", err)
+		respondServiceError(w, err, "Failed to update message status")
+		return
+	}
+
+	slog.Info("Updated guest book message status", "id", message.ID, "status", message.Status)
+	RespondJSON(w, http.StatusOK, models.AdminMessage{GuestBookMessage: *message})
+}
+
+// DeleteGuestBookMessages handles DELETE /api/v1/admin/guestbook, which
+// deletes the messages listed in the body's ids array
+func (h *GuestBookHandler) DeleteGuestBookMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := service.WithClientIP(r.Context(), clientIP(r))
+
+	var req models.DeleteMessages
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		slog.Error("Failed to decode request body", "error", err)
+		respondDecodeError(w, err)
+		return
 	}
+
+	deleted, err := h.service.DeleteMessages(ctx, req.IDs)
+	if err != nil {
+		slog.Error("Failed to delete guest book messages", "count", len(req.IDs), "error", err)
+		respondServiceError(w, err, "Failed to delete messages")
+		return
+	}
+
+	slog.Info("Deleted guest book messages", "requested", len(req.IDs), "deleted", deleted)
+	RespondJSON(w, http.StatusOK, models.DeleteMessagesResult{Deleted: deleted})
+}
+
+// GetAdminGuestBookMessage handles GET /api/v1/admin/guestbook/{id}, which
+// returns a message in any moderation status along with its metadata
+func (h *GuestBookHandler) GetAdminGuestBookMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	message, err := h.service.GetMessageForAdmin(ctx, id)
+	if err != nil {
+		slog.Error("Failed to get guest book message for admin", "id", id, "error", err)
+		respondServiceError(w, err, "Failed to retrieve message")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, models.AdminMessage{GuestBookMessage: *message})
+}
+
+// GetPendingGuestBookMessages handles GET /api/v1/admin/guestbook/pending,
+// the moderation queue. It pages like the public list, but oldest first.
+func (h *GuestBookHandler) GetPendingGuestBookMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	page, pageSize, err := ParsePagination(r)
+	if err != nil && h.strictPagination {
+		RespondError(w, http.StatusBadRequest, apperrors.CodeValidation, err.Error())
+		return
+	}
+
+	messages, counts, err := h.service.GetPendingMessages(ctx, page, pageSize)
+	if err != nil {
+		slog.Error("Failed to get pending guest book messages", "error", err)
+		respondServiceError(w, err, "Failed to retrieve pending messages")
+		return
+	}
+
+	pagination := models.NewPagination(page, pageSize, counts.Pending)
+	if link := paginationLinkHeader(r.URL, page, pageSize, pagination.TotalPages); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	items := make([]models.AdminMessage, 0, len(messages))
+	for _, msg := range messages {
+		items = append(items, models.AdminMessage{GuestBookMessage: msg})
+	}
+
+	RespondJSON(w, http.StatusOK, models.ModerationQueue{
+		Messages:   items,
+		Pagination: pagination,
+		Counts:     counts,
+	})
+}
+
+// clientIP returns the host part of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // NotFoundHandler handles 404 errors
@@ -168,6 +661,7 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	slog.Warn("Route not found", "method", r.Method, "path", r.URL.Path)
 	RespondJSON(w, http.StatusNotFound, map[string]interface{}{
 		"error":   "Not Found",
+		"code":    apperrors.CodeNotFound,
 		"message": "The requested resource was not found",
 		"path":    r.URL.Path,
 		"method":  r.Method,
@@ -179,28 +673,55 @@ func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
 	slog.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
 	RespondJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
 		"error":   "Method Not Allowed",
+		"code":    apperrors.CodeMethodNotAllowed,
 		"message": "The request method is not supported for this resource",
 		"path":    r.URL.Path,
 		"method":  r.Method,
 	})
 }
 
-// APIInfoHandler provides information about available endpoints
+// apiEndpoints describes each route, keyed by "METHOD path"
+var apiEndpoints = map[string]string{
+	"GET /":                                     "API information",
+	"OPTIONS /":                                 "Index of every resource and its methods",
+	"OPTIONS /api/v1":                           "Index of the API v1 resources and their methods",
+	"GET /health":                               "Basic health check",
+	"GET /readyz":                               "Readiness check for load balancers",
+	"GET /openapi.json":                         "OpenAPI 3 specification",
+	"GET /api/v1/health":                        "Health of each dependency (database) with latency",
+	"GET /api/v1/runtime":                       "Uptime, Go version, goroutines and memory stats (admin)",
+	"GET /api/v1/guestbook":                     "Get all guest book messages (supports pagination: ?page=1&page_size=10)",
+	"POST /api/v1/guestbook":                    "Create a new guest book message",
+	"GET /api/v1/guestbook/{id}":                "Get a specific guest book message by ID",
+	"PATCH /api/v1/guestbook/{id}":              "Update only the given fields of a message",
+	"GET /api/v1/guestbook/{id}/neighbors":      "Get the previous and next messages by creation order",
+	"GET /api/v1/guestbook/{id}/raw":            "Get just the message text as text/plain",
+	"GET /api/v1/guestbook/count":               "Get the total number of messages",
+	"GET /api/v1/guestbook/search":              "Full-text search ranked by relevance (?q=hello&limit=20, max 100)",
+	"GET /api/v1/guestbook/timeline":            "Get daily message counts (supports ?days=30, max 365)",
+	"GET /api/v1/stats/message-lengths":         "Get the min, average, max and median message length",
+	"DELETE /api/v1/admin/guestbook":            "Delete messages in a batch by ID (admin)",
+	"GET /api/v1/admin/guestbook/pending":       "Moderation queue: pending messages, oldest first, with counts per status (admin)",
+	"GET /api/v1/admin/guestbook/{id}":          "Get any message with its captured metadata (admin)",
+	"PATCH /api/v1/admin/guestbook/{id}/status": "Set a message's moderation status (admin)",
+}
+
+// APIInfoHandler provides information about available endpoints, as an
+// HTML page for browsers and JSON otherwise
 func APIInfoHandler(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Received request on API info endpoint")
 
+	w.Header().Set("Vary", "Accept")
+	if prefersHTML(r) {
+		renderHomePage(w)
+		return
+	}
+
 	apiInfo := map[string]interface{}{
-		"name":        "Guest Book API",
-		"version":     "v1",
-		"description": "A simple guest book API for managing messages",
-		"endpoints": map[string]interface{}{
-			"GET /":                      "API information",
-			"GET /health":                "Basic health check",
-			"GET /api/v1/health":         "Health check with database connectivity",
-			"GET /api/v1/guestbook":      "Get all guest book messages (supports pagination: ?page=1&page_size=10)",
-			"POST /api/v1/guestbook":     "Create a new guest book message",
-			"GET /api/v1/guestbook/{id}": "Get a specific guest book message by ID",
-		},
+		"name":        apiName,
+		"version":     apiVersion,
+		"description": apiDescription,
+		"endpoints":   apiEndpoints,
 		"example_request": map[string]interface{}{
 			"POST /api/v1/guestbook": map[string]interface{}{
 				"name":    "John Doe",
@@ -217,6 +738,28 @@ func APIInfoHandler(w http.ResponseWriter, r *http.Request) {
 type GuestBookServiceInterface interface {
 	InitializeDatabase(ctx context.Context) error
 	CreateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.GuestBookMessage, error)
+	ValidateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.CreateGuestBookMessage, error)
 	GetMessages(ctx context.Context, page, pageSize int) ([]models.GuestBookMessage, int, error)
+	StreamMessages(ctx context.Context, page, pageSize int) (iter.Seq2[models.GuestBookMessage, error], int, error)
+	GetMessagesRange(ctx context.Context, offset, limit int) ([]models.GuestBookMessage, int, error)
+	GetMessagesSnapshot(ctx context.Context, token string, page, pageSize int) ([]models.GuestBookMessage, int, *models.Snapshot, error)
+	CloseSnapshots(ctx context.Context)
+	GetMessagesByEmail(ctx context.Context, email string, page, pageSize int) ([]models.GuestBookMessage, int, error)
+	GetMessagesByTag(ctx context.Context, tag string, page, pageSize int) ([]models.GuestBookMessage, int, error)
+	GetMessagesByEmailRange(ctx context.Context, email string, offset, limit int) ([]models.GuestBookMessage, int, error)
+	GetMessagesByTagRange(ctx context.Context, tag string, offset, limit int) ([]models.GuestBookMessage, int, error)
 	GetMessageByID(ctx context.Context, idStr string) (*models.GuestBookMessage, error)
+	GetMessageNeighbors(ctx context.Context, idStr string) (*models.MessageNeighbors, error)
+	CountMessages(ctx context.Context) (int, error)
+	CountMessagesByEmail(ctx context.Context, email string) (int, error)
+	CountMessagesByTag(ctx context.Context, tag string) (int, error)
+	GetLastModified(ctx context.Context) (time.Time, error)
+	GetTimeline(ctx context.Context, days int) ([]models.DailyCount, error)
+	GetMessageLengthStats(ctx context.Context) (models.MessageLengthStats, error)
+	SearchMessages(ctx context.Context, q string, limit int) ([]models.SearchResult, error)
+	PatchMessage(ctx context.Context, idStr, editToken string, patch *models.PatchGuestBookMessage) (*models.GuestBookMessage, error)
+	UpdateMessageStatus(ctx context.Context, idStr, status string) (*models.GuestBookMessage, error)
+	DeleteMessages(ctx context.Context, ids []int) (int, error)
+	GetMessageForAdmin(ctx context.Context, idStr string) (*models.GuestBookMessage, error)
+	GetPendingMessages(ctx context.Context, page, pageSize int) ([]models.GuestBookMessage, models.ModerationCounts, error)
 }
@@ -1,10 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/database"
+	"github.com/moabdelazem/app/internal/service"
 )
 
 func TestRespondJSON(t *testing.T) {
@@ -68,8 +79,8 @@ func TestRespondJSON(t *testing.T) {
 			}
 
 			contentType := w.Header().Get("Content-Type")
-			if contentType != "application/json" {
-				t.Errorf("Expected Content-Type to be application/json, got %s", contentType)
+			if contentType != "application/json; charset=utf-8" {
+				t.Errorf("Expected Content-Type to be application/json; charset=utf-8, got %s", contentType)
 			}
 		})
 	}
@@ -117,6 +128,40 @@ func TestHealthHandler(t *testing.T) {
 	}
 }
 
+func TestFaviconHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	w := httptest.NewRecorder()
+
+	FaviconHandler(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected an empty body, got %q", w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=86400" {
+		t.Errorf("Expected the response to be cacheable, got Cache-Control %q", got)
+	}
+}
+
+func TestRobotsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	w := httptest.NewRecorder()
+
+	RobotsHandler(DefaultRobotsTxt)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Expected Content-Type text/plain; charset=utf-8, got %q", got)
+	}
+	if w.Body.String() != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("Expected robots.txt to disallow everything, got %q", w.Body.String())
+	}
+}
+
 func TestAPIInfoHandler(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	w := httptest.NewRecorder()
@@ -169,6 +214,7 @@ func TestNotFoundHandler(t *testing.T) {
 	// Check error fields
 	expectedFields := map[string]interface{}{
 		"error":  "Not Found",
+		"code":   "NOT_FOUND",
 		"path":   "/nonexistent",
 		"method": "GET",
 	}
@@ -198,6 +244,7 @@ func TestMethodNotAllowedHandler(t *testing.T) {
 	// Check error fields
 	expectedFields := map[string]interface{}{
 		"error":  "Method Not Allowed",
+		"code":   "METHOD_NOT_ALLOWED",
 		"path":   "/health",
 		"method": "POST",
 	}
@@ -208,3 +255,327 @@ func TestMethodNotAllowedHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestRespondJSON_EncodingFailure(t *testing.T) {
+	// Channels can't be marshaled, and the failure happens mid-object after
+	// the first field has already been encoded
+	payload := struct {
+		Message string   `json:"message"`
+		Updates chan int `json:"updates"`
+	}{Message: "partial", Updates: make(chan int)}
+
+	w := httptest.NewRecorder()
+	RespondJSON(w, http.StatusOK, payload)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+
+	if strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("Expected no partial output, got %q", w.Body.String())
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected a valid JSON error body, got %q: %v", w.Body.String(), err)
+	}
+	if response["error"] != "Internal server error" {
+		t.Errorf("Expected generic error message, got %q", response["error"])
+	}
+	if response["code"] != "INTERNAL_ERROR" {
+		t.Errorf("Expected code INTERNAL_ERROR, got %q", response["code"])
+	}
+}
+
+func TestRespondServiceError(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		expectedStatus  int
+		expectedCode    string
+		expectedMessage string
+	}{
+		{name: "Validation", err: apperrors.Newf(apperrors.ErrInvalidInput, "name is required"), expectedStatus: http.StatusBadRequest, expectedCode: "VALIDATION_ERROR", expectedMessage: "name is required"},
+		{name: "Not found", err: apperrors.Newf(apperrors.ErrNotFound, "guest book message not found"), expectedStatus: http.StatusNotFound, expectedCode: "NOT_FOUND", expectedMessage: "guest book message not found"},
+		{name: "Conflict", err: apperrors.Newf(apperrors.ErrConflict, "already approved"), expectedStatus: http.StatusConflict, expectedCode: "CONFLICT", expectedMessage: "already approved"},
+		{name: "Forbidden", err: service.ErrEditWindowExpired, expectedStatus: http.StatusForbidden, expectedCode: "FORBIDDEN", expectedMessage: "edit window expired"},
+		{name: "Rate limited", err: service.ErrTooManyMessages, expectedStatus: http.StatusTooManyRequests, expectedCode: "RATE_LIMITED", expectedMessage: "too many messages from this email address"},
+		{name: "Database unavailable", err: database.ErrCircuitOpen, expectedStatus: http.StatusServiceUnavailable, expectedCode: "DB_UNAVAILABLE", expectedMessage: "Failed"},
+		{name: "Other dependency unavailable", err: fmt.Errorf("captcha verification %w", apperrors.ErrUnavailable), expectedStatus: http.StatusServiceUnavailable, expectedCode: "SERVICE_UNAVAILABLE", expectedMessage: "Failed"},
+		{name: "Unclassified", err: errors.New("connection reset"), expectedStatus: http.StatusInternalServerError, expectedCode: "INTERNAL_ERROR", expectedMessage: "Failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondServiceError(w, tt.err, "Failed")
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response["code"] != tt.expectedCode {
+				t.Errorf("Expected code %s, got %q", tt.expectedCode, response["code"])
+			}
+			if response["error"] != tt.expectedMessage {
+				t.Errorf("Expected error %q, got %q", tt.expectedMessage, response["error"])
+			}
+		})
+	}
+}
+
+func TestRespondJSON_PrettyJSON(t *testing.T) {
+	payload := map[string]string{"message": "success"}
+
+	tests := []struct {
+		name         string
+		pretty       bool
+		expectedBody string
+	}{
+		{
+			name:         "Compact by default",
+			pretty:       false,
+			expectedBody: "{\"message\":\"success\"}\n",
+		},
+		{
+			name:         "Indented in debug mode",
+			pretty:       true,
+			expectedBody: "{\n  \"message\": \"success\"\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetPrettyJSON(tt.pretty)
+			defer SetPrettyJSON(false)
+
+			w := httptest.NewRecorder()
+			RespondJSON(w, http.StatusOK, payload)
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRespondJSON_Charset(t *testing.T) {
+	tests := []struct {
+		name         string
+		charset      string
+		expectedType string
+	}{
+		{name: "utf-8", charset: "utf-8", expectedType: "application/json; charset=utf-8"},
+		{name: "Upper case", charset: "UTF-8", expectedType: "application/json; charset=UTF-8"},
+		{name: "Omitted", charset: "", expectedType: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetJSONCharset(tt.charset)
+			defer SetJSONCharset(DefaultJSONCharset)
+
+			w := httptest.NewRecorder()
+			RespondJSON(w, http.StatusOK, map[string]string{"message": "success"})
+
+			if contentType := w.Header().Get("Content-Type"); contentType != tt.expectedType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedType, contentType)
+			}
+		})
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	passing := ReadinessCheck{Name: "passing", Check: func(ctx context.Context) error { return nil }}
+	failing := ReadinessCheck{Name: "failing", Check: func(ctx context.Context) error { return errors.New("boom") }}
+
+	tests := []struct {
+		name           string
+		checks         []ReadinessCheck
+		expectedStatus int
+		expectedCheck  string
+	}{
+		{name: "No checks", checks: nil, expectedStatus: http.StatusOK},
+		{name: "All checks pass", checks: []ReadinessCheck{passing, passing}, expectedStatus: http.StatusOK},
+		{name: "One check fails", checks: []ReadinessCheck{passing, failing}, expectedStatus: http.StatusServiceUnavailable, expectedCheck: "failing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			w := httptest.NewRecorder()
+
+			ReadinessHandler(tt.checks...)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var response map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response["check"] != tt.expectedCheck {
+				t.Errorf("Expected failing check %q, got %q", tt.expectedCheck, response["check"])
+			}
+		})
+	}
+}
+
+func TestTempDirWritableCheck(t *testing.T) {
+	t.Run("Writable directory", func(t *testing.T) {
+		dir := t.TempDir()
+
+		if err := TempDirWritableCheck(dir).Check(context.Background()); err != nil {
+			t.Fatalf("Expected writable dir to pass, got %v", err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("Failed to read dir: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected probe file to be removed, found %d entries", len(entries))
+		}
+	})
+
+	t.Run("Missing directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "does-not-exist")
+
+		err := TempDirWritableCheck(dir).Check(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "not writable") {
+			t.Errorf("Expected not writable error, got %v", err)
+		}
+	})
+
+	t.Run("Read-only directory", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root ignores directory permissions")
+		}
+
+		dir := t.TempDir()
+		if err := os.Chmod(dir, 0o555); err != nil {
+			t.Fatalf("Failed to chmod dir: %v", err)
+		}
+		defer os.Chmod(dir, 0o755)
+
+		if err := TempDirWritableCheck(dir).Check(context.Background()); err == nil {
+			t.Error("Expected read-only dir to fail")
+		}
+	})
+}
+
+// slowStartRepo is a fake repository whose first counts are slow, as on a
+// cold database
+type slowStartRepo struct {
+	slowCounts int
+	delay      time.Duration
+	counts     int
+	err        error
+}
+
+func (r *slowStartRepo) Count(ctx context.Context) (int, error) {
+	r.counts++
+	if r.counts <= r.slowCounts {
+		time.Sleep(r.delay)
+	}
+	return 0, r.err
+}
+
+func TestWarmQueryCheck(t *testing.T) {
+	repo := &slowStartRepo{slowCounts: 2, delay: 50 * time.Millisecond}
+	check := WarmQueryCheck(20*time.Millisecond, func(ctx context.Context) error {
+		_, err := repo.Count(ctx)
+		return err
+	})
+	ctx := context.Background()
+
+	for i := range 2 {
+		if err := check.Check(ctx); err == nil || !strings.Contains(err.Error(), "warmup query took") {
+			t.Errorf("Expected slow count %d to fail the check, got %v", i+1, err)
+		}
+	}
+	if err := check.Check(ctx); err != nil {
+		t.Fatalf("Expected a fast count to pass the check, got %v", err)
+	}
+
+	// Once warm it passes without counting, even if counts would fail
+	repo.err = errors.New("connection refused")
+	if err := check.Check(ctx); err != nil {
+		t.Errorf("Expected the check to stay passed, got %v", err)
+	}
+	if repo.counts != 3 {
+		t.Errorf("Expected 3 counts, got %d", repo.counts)
+	}
+}
+
+func TestWarmQueryCheck_QueryFails(t *testing.T) {
+	repo := &slowStartRepo{err: errors.New("connection refused")}
+	check := WarmQueryCheck(time.Second, func(ctx context.Context) error {
+		_, err := repo.Count(ctx)
+		return err
+	})
+
+	if err := check.Check(context.Background()); !errors.Is(err, repo.err) {
+		t.Errorf("Expected the query error, got %v", err)
+	}
+}
+
+func TestAPIInfoHandler_ContentNegotiation(t *testing.T) {
+	tests := []struct {
+		name         string
+		accept       string
+		expectedType string
+	}{
+		{name: "No Accept header", accept: "", expectedType: "application/json; charset=utf-8"},
+		{name: "JSON", accept: "application/json", expectedType: "application/json; charset=utf-8"},
+		{name: "HTML", accept: "text/html", expectedType: "text/html; charset=utf-8"},
+		{name: "Browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expectedType: "text/html; charset=utf-8"},
+		{name: "Wildcard", accept: "*/*", expectedType: "application/json; charset=utf-8"},
+		{name: "JSON preferred over HTML", accept: "text/html;q=0.5, application/json", expectedType: "application/json; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			APIInfoHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			if contentType := w.Header().Get("Content-Type"); contentType != tt.expectedType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedType, contentType)
+			}
+
+			if vary := w.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", vary)
+			}
+
+			body := w.Body.String()
+			if strings.HasPrefix(tt.expectedType, "application/json") {
+				var response map[string]interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				return
+			}
+
+			for _, want := range []string{"<!DOCTYPE html>", "Guest Book API", `href="/openapi.json"`, "GET /api/v1/guestbook"} {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected HTML page to contain %q", want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Component health statuses, from best to worst
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// HealthChecker is a dependency reported by the health endpoint. Check must
+// honour ctx so a hung dependency can't hold the endpoint open.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// healthCheckFunc adapts a name and check function to HealthChecker
+type healthCheckFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (h healthCheckFunc) Name() string                    { return h.name }
+func (h healthCheckFunc) Check(ctx context.Context) error { return h.check(ctx) }
+
+// NewHealthChecker returns a HealthChecker running check under name
+func NewHealthChecker(name string, check func(ctx context.Context) error) HealthChecker {
+	return healthCheckFunc{name: name, check: check}
+}
+
+// ComponentHealth is the outcome of one HealthChecker
+type ComponentHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthReport is the health endpoint's response. Status is the worst of
+// the component statuses.
+type HealthReport struct {
+	Status     string            `json:"status"`
+	Components []ComponentHealth `json:"components"`
+}
+
+// ComponentHealthHandler handles GET /api/v1/health, running every checker
+// concurrently under timeout. It responds 503 when any component is
+// unhealthy.
+func ComponentHealthHandler(timeout time.Duration, checkers ...HealthChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		report := HealthReport{
+			Status:     HealthStatusHealthy,
+			Components: make([]ComponentHealth, len(checkers)),
+		}
+
+		var wg sync.WaitGroup
+		for i, checker := range checkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				report.Components[i] = checkComponent(ctx, checker)
+			}()
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for _, component := range report.Components {
+			if component.Status != HealthStatusHealthy {
+				slog.Error("Health check failed", "component", component.Name, "error", component.Error)
+				report.Status = HealthStatusUnhealthy
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		RespondJSON(w, status, report)
+	}
+}
+
+// checkComponent runs checker and times it. It stops waiting when ctx ends
+// even if the checker doesn't, so a hung dependency can't hold the
+// endpoint open, and reports that as "<name> timeout".
+func checkComponent(ctx context.Context, checker HealthChecker) ComponentHealth {
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	component := ComponentHealth{
+		Name:      checker.Name(),
+		Status:    HealthStatusHealthy,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		component.Status = HealthStatusUnhealthy
+		component.Error = checker.Name() + " timeout"
+	default:
+		component.Status = HealthStatusUnhealthy
+		component.Error = err.Error()
+	}
+
+	return component
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestComponentHealthHandler(t *testing.T) {
+	passing := NewHealthChecker("database", func(ctx context.Context) error { return nil })
+	failing := NewHealthChecker("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	tests := []struct {
+		name           string
+		checkers       []HealthChecker
+		expectedStatus int
+		expectedHealth string
+	}{
+		{name: "No checkers", checkers: nil, expectedStatus: http.StatusOK, expectedHealth: HealthStatusHealthy},
+		{name: "All healthy", checkers: []HealthChecker{passing}, expectedStatus: http.StatusOK, expectedHealth: HealthStatusHealthy},
+		{name: "One unhealthy", checkers: []HealthChecker{passing, failing}, expectedStatus: http.StatusServiceUnavailable, expectedHealth: HealthStatusUnhealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+			w := httptest.NewRecorder()
+
+			ComponentHealthHandler(time.Second, tt.checkers...)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var report HealthReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if report.Status != tt.expectedHealth {
+				t.Errorf("Expected overall status %q, got %q", tt.expectedHealth, report.Status)
+			}
+			if len(report.Components) != len(tt.checkers) {
+				t.Fatalf("Expected %d components, got %d", len(tt.checkers), len(report.Components))
+			}
+
+			// Components are reported in registration order
+			for i, checker := range tt.checkers {
+				component := report.Components[i]
+				if component.Name != checker.Name() {
+					t.Errorf("Expected component %d to be %q, got %q", i, checker.Name(), component.Name)
+				}
+				if (component.Error != "") != (component.Status == HealthStatusUnhealthy) {
+					t.Errorf("Expected an error exactly when %q is unhealthy, got %+v", component.Name, component)
+				}
+			}
+		})
+	}
+}
+
+func TestComponentHealthHandler_ConcurrentWithTimeout(t *testing.T) {
+	// blocking never finishes on its own, so only the timeout ends it
+	blocking := func(name string) HealthChecker {
+		return NewHealthChecker(name, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	ComponentHealthHandler(100*time.Millisecond, blocking("database"), blocking("webhook"))(w, req)
+	elapsed := time.Since(start)
+
+	// Sequential checks would take at least two timeouts
+	if elapsed >= 200*time.Millisecond {
+		t.Errorf("Expected checks to run concurrently, took %s", elapsed)
+	}
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	var report HealthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	for _, component := range report.Components {
+		if component.Status != HealthStatusUnhealthy || component.Error != component.Name+" timeout" {
+			t.Errorf("Expected %q to time out, got %+v", component.Name, component)
+		}
+	}
+}
+
+func TestComponentHealthHandler_CheckerIgnoringContext(t *testing.T) {
+	// A hung database driver that never looks at ctx
+	release := make(chan struct{})
+	defer close(release)
+	hung := NewHealthChecker("database", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	ComponentHealthHandler(50*time.Millisecond, hung)(w, req)
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected the handler to give up after its timeout, took %s", elapsed)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	var report HealthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(report.Components) != 1 || report.Components[0].Error != "database timeout" {
+		t.Errorf("Expected a database timeout, got %+v", report.Components)
+	}
+}
+
+func TestComponentHealthHandler_RequestCancelled(t *testing.T) {
+	blocking := NewHealthChecker("database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	ComponentHealthHandler(time.Minute, blocking)(w, req)
+
+	var report HealthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(report.Components) != 1 || report.Components[0].Error != context.Canceled.Error() {
+		t.Errorf("Expected the check to stop with the request, got %+v", report.Components)
+	}
+}
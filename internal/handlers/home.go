@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiName        = "Guest Book API"
+	apiVersion     = "v1"
+	apiDescription = "A simple guest book API for managing messages"
+)
+
+//go:embed index.html
+var indexHTML string
+
+var homePageTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+// renderHomePage writes the browser-friendly summary of the API
+func renderHomePage(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	err := homePageTemplate.Execute(w, map[string]interface{}{
+		"Name":        apiName,
+		"Version":     apiVersion,
+		"Description": apiDescription,
+		"Endpoints":   apiEndpoints,
+	})
+	if err != nil {
+		slog.Error("Failed to render home page", "error", err)
+	}
+}
+
+// prefersHTML reports whether the Accept header ranks text/html above JSON.
+// Wildcards count towards JSON, so clients that don't ask for HTML
+// explicitly keep getting JSON.
+func prefersHTML(r *http.Request) bool {
+	htmlQ, jsonQ := 0.0, 0.0
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		switch mediaType {
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		case "application/json", "application/*", "*/*":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+
+	return htmlQ > 0 && htmlQ > jsonQ
+}
@@ -3,10 +3,15 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"iter"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/config"
 	"github.com/moabdelazem/app/internal/models"
+	"github.com/moabdelazem/app/internal/service"
 )
 
 // Ensure MockGuestBookService implements GuestBookServiceInterface
@@ -16,9 +21,21 @@ var _ GuestBookServiceInterface = (*MockGuestBookService)(nil)
 type MockGuestBookService struct {
 	messages []models.GuestBookMessage
 	nextID   int
+	config   config.Config
+	// idempotencyKeys maps used Idempotency-Key values to message IDs
+	idempotencyKeys map[string]int
+	// snapshots maps snapshot tokens to the approved messages when each began
+	snapshots map[string][]models.GuestBookMessage
 }
 
 func NewMockGuestBookService() *MockGuestBookService {
+	return NewMockGuestBookServiceWithConfig(config.Config{
+		Validation: config.DefaultValidationConfig(),
+	})
+}
+
+// NewMockGuestBookServiceWithConfig creates a seeded mock that validates with cfg
+func NewMockGuestBookServiceWithConfig(cfg config.Config) *MockGuestBookService {
 	return &MockGuestBookService{
 		messages: []models.GuestBookMessage{
 			{
@@ -26,6 +43,7 @@ func NewMockGuestBookService() *MockGuestBookService {
 				Name:      "John Doe",
 				Email:     "john.doe@example.com",
 				Message:   "Hello, this is a test message!",
+				Status:    models.StatusApproved,
 				CreatedAt: time.Now().Add(-2 * time.Hour),
 				UpdatedAt: time.Now().Add(-2 * time.Hour),
 			},
@@ -34,11 +52,13 @@ func NewMockGuestBookService() *MockGuestBookService {
 				Name:      "Jane Smith",
 				Email:     "jane.smith@example.com",
 				Message:   "Another test message for the guest book.",
+				Status:    models.StatusApproved,
 				CreatedAt: time.Now().Add(-1 * time.Hour),
 				UpdatedAt: time.Now().Add(-1 * time.Hour),
 			},
 		},
 		nextID: 3,
+		config: cfg,
 	}
 }
 
@@ -47,15 +67,30 @@ func (m *MockGuestBookService) InitializeDatabase(ctx context.Context) error {
 }
 
 func (m *MockGuestBookService) CreateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.GuestBookMessage, error) {
-	if err := m.validateCreateMessage(msg); err != nil {
+	if err := service.ValidateCreateMessage(msg, m.config.Validation); err != nil {
 		return nil, err
 	}
 
+	if id, ok := m.idempotencyKeys[msg.IdempotencyKey]; ok && msg.IdempotencyKey != "" {
+		for _, existing := range m.messages {
+			if existing.ID == id {
+				return &existing, nil
+			}
+		}
+	}
+
+	status := models.StatusApproved
+	if m.config.ModerationEnabled {
+		status = models.StatusPending
+	}
+
 	newMessage := models.GuestBookMessage{
 		ID:        m.nextID,
 		Name:      msg.Name,
 		Email:     msg.Email,
 		Message:   msg.Message,
+		Status:    status,
+		Tags:      msg.Tags,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -63,18 +98,76 @@ func (m *MockGuestBookService) CreateMessage(ctx context.Context, msg *models.Cr
 	m.messages = append(m.messages, newMessage)
 	m.nextID++
 
+	if msg.IdempotencyKey != "" {
+		if m.idempotencyKeys == nil {
+			m.idempotencyKeys = make(map[string]int)
+		}
+		m.idempotencyKeys[msg.IdempotencyKey] = newMessage.ID
+	}
+
+	newMessage.EditToken = mockEditToken(newMessage.ID)
 	return &newMessage, nil
 }
 
+func (m *MockGuestBookService) ValidateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.CreateGuestBookMessage, error) {
+	if err := service.ValidateCreateMessage(msg, m.config.Validation); err != nil {
+		return nil, err
+	}
+
+	validated := *msg
+	return &validated, nil
+}
+
+func (m *MockGuestBookService) StreamMessages(ctx context.Context, page, pageSize int) (iter.Seq2[models.GuestBookMessage, error], int, error) {
+	messages, total, err := m.GetMessages(ctx, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return func(yield func(models.GuestBookMessage, error) bool) {
+		for _, msg := range messages {
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}, total, nil
+}
+
 func (m *MockGuestBookService) GetMessages(ctx context.Context, page, pageSize int) ([]models.GuestBookMessage, int, error) {
-	if page < 1 {
-		page = 1
+	return pageOf(m.approvedMessages(), page, pageSize)
+}
+
+// GetMessagesSnapshot pages through a copy of the approved messages taken
+// when the snapshot began
+func (m *MockGuestBookService) GetMessagesSnapshot(ctx context.Context, token string, page, pageSize int) ([]models.GuestBookMessage, int, *models.Snapshot, error) {
+	if token == service.NewSnapshotToken {
+		if m.snapshots == nil {
+			m.snapshots = make(map[string][]models.GuestBookMessage)
+		}
+		token = fmt.Sprintf("snapshot-%d", len(m.snapshots)+1)
+		m.snapshots[token] = m.approvedMessages()
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
+
+	frozen, ok := m.snapshots[token]
+	if !ok {
+		return nil, 0, nil, service.ErrSnapshotNotFound
 	}
 
-	total := len(m.messages)
+	messages, total, err := pageOf(frozen, page, pageSize)
+	return messages, total, &models.Snapshot{Token: token, ExpiresAt: time.Now().Add(time.Minute)}, err
+}
+
+func (m *MockGuestBookService) CloseSnapshots(ctx context.Context) {
+	m.snapshots = nil
+}
+
+// pageOf returns a page of visible, newest first, and the total
+func pageOf(visible []models.GuestBookMessage, page, pageSize int) ([]models.GuestBookMessage, int, error) {
+	page, pageSize = service.NormalizePage(page, pageSize)
+
+	total := len(visible)
+	if page > service.MaxPage {
+		return []models.GuestBookMessage{}, total, nil
+	}
 	offset := (page - 1) * pageSize
 
 	if offset >= total {
@@ -93,17 +186,151 @@ func (m *MockGuestBookService) GetMessages(ctx context.Context, page, pageSize i
 			break
 		}
 		if i < total-offset {
-			result = append(result, m.messages[i])
+			result = append(result, visible[i])
 		}
 	}
 
 	return result, total, nil
 }
 
+func (m *MockGuestBookService) GetMessagesRange(ctx context.Context, offset, limit int) ([]models.GuestBookMessage, int, error) {
+	if offset < 0 || limit < 1 {
+		return nil, 0, apperrors.Newf(apperrors.ErrInvalidInput, "invalid message range")
+	}
+
+	visible := m.approvedMessages()
+	total := len(visible)
+
+	// Newest first
+	result := make([]models.GuestBookMessage, 0)
+	for i := total - 1 - offset; i >= 0 && len(result) < limit; i-- {
+		result = append(result, visible[i])
+	}
+
+	return result, total, nil
+}
+
+func (m *MockGuestBookService) GetMessagesByEmail(ctx context.Context, email string, page, pageSize int) ([]models.GuestBookMessage, int, error) {
+	if !strings.Contains(email, "@") {
+		return nil, 0, apperrors.Newf(apperrors.ErrInvalidInput, "email must be a valid address")
+	}
+
+	return m.filteredPage(page, pageSize, func(msg models.GuestBookMessage) bool {
+		return msg.Email == email
+	})
+}
+
+func (m *MockGuestBookService) GetMessagesByTag(ctx context.Context, tag string, page, pageSize int) ([]models.GuestBookMessage, int, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return nil, 0, apperrors.Newf(apperrors.ErrInvalidInput, "tags must not be empty")
+	}
+
+	return m.filteredPage(page, pageSize, func(msg models.GuestBookMessage) bool {
+		return slices.Contains(msg.Tags, tag)
+	})
+}
+
+func (m *MockGuestBookService) GetMessagesByEmailRange(ctx context.Context, email string, offset, limit int) ([]models.GuestBookMessage, int, error) {
+	if !strings.Contains(email, "@") {
+		return nil, 0, apperrors.Newf(apperrors.ErrInvalidInput, "email must be a valid address")
+	}
+
+	return m.filteredRange(offset, limit, func(msg models.GuestBookMessage) bool {
+		return msg.Email == email
+	})
+}
+
+func (m *MockGuestBookService) GetMessagesByTagRange(ctx context.Context, tag string, offset, limit int) ([]models.GuestBookMessage, int, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return nil, 0, apperrors.Newf(apperrors.ErrInvalidInput, "tags must not be empty")
+	}
+
+	return m.filteredRange(offset, limit, func(msg models.GuestBookMessage) bool {
+		return slices.Contains(msg.Tags, tag)
+	})
+}
+
+// filteredPage returns a page of the approved messages matching keep,
+// newest first, and how many match
+func (m *MockGuestBookService) filteredPage(page, pageSize int, keep func(models.GuestBookMessage) bool) ([]models.GuestBookMessage, int, error) {
+	page, pageSize = service.NormalizePage(page, pageSize)
+	if page > service.MaxPage {
+		_, total, err := m.filteredRange(0, 1, keep)
+		return []models.GuestBookMessage{}, total, err
+	}
+
+	return m.filteredRange((page-1)*pageSize, pageSize, keep)
+}
+
+// filteredRange returns up to limit of the approved messages matching keep,
+// from offset, newest first, and how many match
+func (m *MockGuestBookService) filteredRange(offset, limit int, keep func(models.GuestBookMessage) bool) ([]models.GuestBookMessage, int, error) {
+	if offset < 0 || limit < 1 {
+		return nil, 0, apperrors.Newf(apperrors.ErrInvalidInput, "invalid message range")
+	}
+
+	matching := make([]models.GuestBookMessage, 0)
+	visible := m.approvedMessages()
+	for i := len(visible) - 1; i >= 0; i-- {
+		if keep(visible[i]) {
+			matching = append(matching, visible[i])
+		}
+	}
+
+	total := len(matching)
+	if offset >= total {
+		return []models.GuestBookMessage{}, total, nil
+	}
+
+	return matching[offset:min(offset+limit, total)], total, nil
+}
+
 func (m *MockGuestBookService) GetMessageByID(ctx context.Context, idStr string) (*models.GuestBookMessage, error) {
-	id, err := strconv.Atoi(idStr)
+	id, err := service.ParseMessageID(idStr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range m.approvedMessages() {
+		if msg.ID == id {
+			return &msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+}
+
+// GetMessageNeighbors uses insertion order, which matches creation order for
+// the seeded messages
+func (m *MockGuestBookService) GetMessageNeighbors(ctx context.Context, idStr string) (*models.MessageNeighbors, error) {
+	msg, err := m.GetMessageByID(ctx, idStr)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := m.approvedMessages()
+	neighbors := &models.MessageNeighbors{}
+	for i := range visible {
+		if visible[i].ID != msg.ID {
+			continue
+		}
+		if i > 0 {
+			neighbors.Previous = &visible[i-1]
+		}
+		if i < len(visible)-1 {
+			neighbors.Next = &visible[i+1]
+		}
+	}
+
+	return neighbors, nil
+}
+
+func (m *MockGuestBookService) GetMessageForAdmin(ctx context.Context, idStr string) (*models.GuestBookMessage, error) {
+	id, err := service.ParseMessageID(idStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid message ID")
+		return nil, err
 	}
 
 	for _, msg := range m.messages {
@@ -112,21 +339,223 @@ func (m *MockGuestBookService) GetMessageByID(ctx context.Context, idStr string)
 		}
 	}
 
-	return nil, fmt.Errorf("guest book message not found")
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
 }
 
-func (m *MockGuestBookService) validateCreateMessage(msg *models.CreateGuestBookMessage) error {
-	if len(msg.Name) < 2 || len(msg.Name) > 100 {
-		return fmt.Errorf("name must be between 2 and 100 characters")
+func (m *MockGuestBookService) GetPendingMessages(ctx context.Context, page, pageSize int) ([]models.GuestBookMessage, models.ModerationCounts, error) {
+	page, pageSize = service.NormalizePage(page, pageSize)
+
+	var counts models.ModerationCounts
+	pending := make([]models.GuestBookMessage, 0)
+	for _, msg := range m.messages {
+		switch msg.Status {
+		case models.StatusPending:
+			counts.Pending++
+			pending = append(pending, msg)
+		case models.StatusApproved:
+			counts.Approved++
+		case models.StatusRejected:
+			counts.Rejected++
+		}
+	}
+
+	offset := (page - 1) * pageSize
+	if page > service.MaxPage || offset >= len(pending) {
+		return []models.GuestBookMessage{}, counts, nil
 	}
 
-	if len(msg.Email) == 0 || len(msg.Email) > 255 {
-		return fmt.Errorf("email must be between 1 and 255 characters")
+	return pending[offset:min(offset+pageSize, len(pending))], counts, nil
+}
+
+// mockEditToken is the edit token the mock accepts for the message with id
+func mockEditToken(id int) string {
+	return fmt.Sprintf("edit-token-%d", id)
+}
+
+func (m *MockGuestBookService) PatchMessage(ctx context.Context, idStr, editToken string, patch *models.PatchGuestBookMessage) (*models.GuestBookMessage, error) {
+	id, err := service.ParseMessageID(idStr)
+	if err != nil {
+		return nil, err
+	}
+	if editToken == "" {
+		return nil, service.ErrEditTokenRequired
+	}
+	if editToken != mockEditToken(id) {
+		return nil, service.ErrEditTokenInvalid
 	}
 
-	if len(msg.Message) < 10 || len(msg.Message) > 1000 {
-		return fmt.Errorf("message must be between 10 and 1000 characters")
+	if err := service.ValidatePatchMessage(patch, m.config.Validation); err != nil {
+		return nil, err
 	}
 
-	return nil
+	for i := range m.messages {
+		if m.messages[i].ID == id && m.messages[i].Status == models.StatusApproved {
+			if patch.Name != nil {
+				m.messages[i].Name = *patch.Name
+			}
+			if patch.Email != nil {
+				m.messages[i].Email = *patch.Email
+			}
+			if patch.Message != nil {
+				m.messages[i].Message = *patch.Message
+			}
+			if patch.Tags != nil {
+				m.messages[i].Tags = *patch.Tags
+			}
+			m.messages[i].UpdatedAt = time.Now()
+			msg := m.messages[i]
+			return &msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+}
+
+func (m *MockGuestBookService) UpdateMessageStatus(ctx context.Context, idStr, status string) (*models.GuestBookMessage, error) {
+	id, err := service.ParseMessageID(idStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !models.IsValidStatus(status) {
+		return nil, apperrors.Newf(apperrors.ErrInvalidInput, "invalid status")
+	}
+
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			m.messages[i].Status = status
+			m.messages[i].UpdatedAt = time.Now()
+			msg := m.messages[i]
+			return &msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+}
+
+func (m *MockGuestBookService) DeleteMessages(ctx context.Context, ids []int) (int, error) {
+	if err := service.ValidateDeleteIDs(ids); err != nil {
+		return 0, err
+	}
+
+	kept := m.messages[:0]
+	for _, msg := range m.messages {
+		if !slices.Contains(ids, msg.ID) {
+			kept = append(kept, msg)
+		}
+	}
+	deleted := len(m.messages) - len(kept)
+	m.messages = kept
+
+	return deleted, nil
+}
+
+func (m *MockGuestBookService) SearchMessages(ctx context.Context, q string, limit int) ([]models.SearchResult, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, apperrors.Newf(apperrors.ErrInvalidInput, "search query must not be empty")
+	}
+	if limit < 1 || limit > service.MaxSearchLimit {
+		limit = service.DefaultSearchLimit
+	}
+
+	results := make([]models.SearchResult, 0)
+	for _, msg := range m.approvedMessages() {
+		if len(results) >= limit {
+			break
+		}
+		if strings.Contains(strings.ToLower(msg.Message), strings.ToLower(q)) {
+			results = append(results, models.SearchResult{GuestBookMessage: msg, Rank: 0.1})
+		}
+	}
+
+	return results, nil
+}
+
+// approvedMessages returns the publicly visible messages in insertion order
+func (m *MockGuestBookService) approvedMessages() []models.GuestBookMessage {
+	approved := make([]models.GuestBookMessage, 0, len(m.messages))
+	for _, msg := range m.messages {
+		if msg.Status == models.StatusApproved {
+			approved = append(approved, msg)
+		}
+	}
+	return approved
+}
+
+func (m *MockGuestBookService) CountMessages(ctx context.Context) (int, error) {
+	return len(m.approvedMessages()), nil
+}
+
+func (m *MockGuestBookService) CountMessagesByEmail(ctx context.Context, email string) (int, error) {
+	_, total, err := m.GetMessagesByEmail(ctx, email, 1, 1)
+	return total, err
+}
+
+func (m *MockGuestBookService) CountMessagesByTag(ctx context.Context, tag string) (int, error) {
+	_, total, err := m.GetMessagesByTag(ctx, tag, 1, 1)
+	return total, err
+}
+
+func (m *MockGuestBookService) GetLastModified(ctx context.Context) (time.Time, error) {
+	var latest time.Time
+	for _, msg := range m.messages {
+		if msg.UpdatedAt.After(latest) {
+			latest = msg.UpdatedAt
+		}
+	}
+
+	return latest, nil
+}
+
+func (m *MockGuestBookService) GetMessageLengthStats(ctx context.Context) (models.MessageLengthStats, error) {
+	var lengths []int
+	for _, msg := range m.approvedMessages() {
+		lengths = append(lengths, len(msg.Message))
+	}
+	if len(lengths) == 0 {
+		return models.MessageLengthStats{}, nil
+	}
+	slices.Sort(lengths)
+
+	total := 0
+	for _, n := range lengths {
+		total += n
+	}
+	mid := len(lengths) / 2
+	median := float64(lengths[mid])
+	if len(lengths)%2 == 0 {
+		median = float64(lengths[mid-1]+lengths[mid]) / 2
+	}
+
+	return models.MessageLengthStats{
+		Min:    lengths[0],
+		Avg:    float64(total) / float64(len(lengths)),
+		Max:    lengths[len(lengths)-1],
+		Median: median,
+	}, nil
+}
+
+func (m *MockGuestBookService) GetTimeline(ctx context.Context, days int) ([]models.DailyCount, error) {
+	if days < 1 {
+		days = service.DefaultTimelineDays
+	}
+	if days > service.MaxTimelineDays {
+		days = service.MaxTimelineDays
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	timeline := make([]models.DailyCount, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i)
+		count := 0
+		for _, msg := range m.approvedMessages() {
+			if msg.CreatedAt.UTC().Truncate(24 * time.Hour).Equal(day) {
+				count++
+			}
+		}
+		timeline = append(timeline, models.DailyCount{Date: day.Format(models.DateFormat), Count: count})
+	}
+
+	return timeline, nil
 }
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document for the API. Keep it in sync with
+// the routes in server.RegisterRoutes and the models package; the tests
+// cross-check both.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPIHandler handles GET /openapi.json
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", JSONContentType("application/json"))
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// openAPIDocument is the subset of the spec the tests inspect
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func getOpenAPIDocument(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	w := httptest.NewRecorder()
+
+	OpenAPIHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("Expected Content-Type application/json; charset=utf-8, got %s", contentType)
+	}
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Spec is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	doc := getOpenAPIDocument(t)
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+
+	expectedPaths := map[string]string{
+		"/api/v1/guestbook":                   "get",
+		"/api/v1/guestbook/{id}":              "get",
+		"/api/v1/guestbook/count":             "get",
+		"/api/v1/guestbook/timeline":          "get",
+		"/api/v1/guestbook/search":            "get",
+		"/api/v1/guestbook/{id}/neighbors":    "get",
+		"/api/v1/admin/guestbook/{id}/status": "patch",
+	}
+	for path, method := range expectedPaths {
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("Expected spec to describe %s %s", strings.ToUpper(method), path)
+		}
+	}
+	if _, ok := doc.Paths["/api/v1/guestbook"]["post"]; !ok {
+		t.Error("Expected spec to describe POST /api/v1/guestbook")
+	}
+}
+
+// TestOpenAPIHandler_CoversAPIInfoEndpoints keeps the spec and the
+// hand-written endpoint list from drifting apart
+func TestOpenAPIHandler_CoversAPIInfoEndpoints(t *testing.T) {
+	doc := getOpenAPIDocument(t)
+
+	w := httptest.NewRecorder()
+	APIInfoHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var info struct {
+		Endpoints map[string]string `json:"endpoints"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Failed to unmarshal API info: %v", err)
+	}
+
+	for endpoint := range info.Endpoints {
+		method, path, _ := strings.Cut(endpoint, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("Endpoint %q is missing from the OpenAPI spec", endpoint)
+		}
+	}
+}
+
+// TestOpenAPIHandler_SchemasMatchModels checks every serialized model field
+// is described by its schema
+func TestOpenAPIHandler_SchemasMatchModels(t *testing.T) {
+	doc := getOpenAPIDocument(t)
+
+	tests := []struct {
+		schema string
+		model  interface{}
+	}{
+		{schema: "GuestBookMessage", model: models.GuestBookMessage{CreatedAt: time.Now(), UpdatedAt: time.Now()}},
+		{schema: "AdminMessage", model: models.AdminMessage{GuestBookMessage: models.GuestBookMessage{CreatedAt: time.Now(), UpdatedAt: time.Now()}}},
+		{schema: "SearchResult", model: models.SearchResult{GuestBookMessage: models.GuestBookMessage{CreatedAt: time.Now(), UpdatedAt: time.Now()}}},
+		{schema: "CreateGuestBookMessage", model: models.CreateGuestBookMessage{Tags: []string{"greeting"}, CaptchaToken: "token"}},
+		{schema: "PatchGuestBookMessage", model: models.PatchGuestBookMessage{Name: new(string), Email: new(string), Message: new(string), Tags: &[]string{}}},
+		{schema: "UpdateMessageStatus", model: models.UpdateMessageStatus{}},
+		{schema: "DailyCount", model: models.DailyCount{}},
+		{schema: "MessageLengthStats", model: models.MessageLengthStats{}},
+		{schema: "Pagination", model: models.Pagination{OutOfRange: true, Snapshot: &models.Snapshot{}}},
+		{schema: "Snapshot", model: models.Snapshot{}},
+		{schema: "HealthReport", model: HealthReport{}},
+		{schema: "RuntimeStats", model: RuntimeStats{}},
+		{schema: "MemoryStats", model: MemoryStats{}},
+		{schema: "ComponentHealth", model: ComponentHealth{Error: "boom"}},
+		{schema: "MessageList", model: models.PaginatedResponse[models.GuestBookMessage]{}},
+		{schema: "MessageRange", model: messageRangeResponse{}},
+		{schema: "MessageNeighbors", model: models.MessageNeighbors{}},
+		{schema: "ModerationCounts", model: models.ModerationCounts{}},
+		{schema: "ModerationQueue", model: models.ModerationQueue{}},
+		{schema: "DryRunResult", model: models.DryRunResult{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			schema, ok := doc.Components.Schemas[tt.schema]
+			if !ok {
+				t.Fatalf("Schema %s is missing", tt.schema)
+			}
+
+			data, err := json.Marshal(tt.model)
+			if err != nil {
+				t.Fatalf("Failed to marshal model: %v", err)
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("Failed to unmarshal model: %v", err)
+			}
+
+			for field := range fields {
+				if _, ok := schema.Properties[field]; !ok {
+					t.Errorf("Field %q is missing from schema %s", field, tt.schema)
+				}
+			}
+			if len(schema.Properties) != len(fields) {
+				t.Errorf("Expected %d properties in schema %s, got %d", len(fields), tt.schema, len(schema.Properties))
+			}
+		})
+	}
+}
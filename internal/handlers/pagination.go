@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/service"
+)
+
+// PaginationError reports a page or page_size query parameter that isn't a
+// number. It is an apperrors.ErrInvalidInput.
+type PaginationError struct {
+	Param string
+	Value string
+}
+
+func (e *PaginationError) Error() string {
+	return fmt.Sprintf("%s must be a number, got %q", e.Param, e.Value)
+}
+
+// Unwrap classifies the error as invalid input
+func (e *PaginationError) Unwrap() error {
+	return apperrors.ErrInvalidInput
+}
+
+// ParsePagination reads the page and page_size query parameters, replacing
+// missing or out-of-range values with the defaults. A value that isn't a
+// number is reported as a *PaginationError, but page and pageSize are still
+// usable so lenient callers can ignore it.
+func ParsePagination(r *http.Request) (page, pageSize int, err error) {
+	query := r.URL.Query()
+
+	parse := func(param string) int {
+		value := query.Get(param)
+		if value == "" {
+			return 0
+		}
+		n, parseErr := strconv.Atoi(value)
+		if parseErr != nil && err == nil {
+			err = &PaginationError{Param: param, Value: value}
+		}
+		return n
+	}
+
+	page, pageSize = service.NormalizePage(parse("page"), parse("page_size"))
+	return page, pageSize, err
+}
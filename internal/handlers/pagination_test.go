@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+)
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		name             string
+		query            string
+		expectedPage     int
+		expectedPageSize int
+		expectedParam    string
+	}{
+		{name: "Defaults", query: "", expectedPage: 1, expectedPageSize: 10},
+		{name: "Explicit values", query: "page=3&page_size=25", expectedPage: 3, expectedPageSize: 25},
+		{name: "Page below one", query: "page=0", expectedPage: 1, expectedPageSize: 10},
+		{name: "Page size over the maximum", query: "page_size=1000", expectedPage: 1, expectedPageSize: 10},
+		{name: "Negative page size", query: "page_size=-5", expectedPage: 1, expectedPageSize: 10},
+		{name: "Non-numeric page", query: "page=two&page_size=20", expectedPage: 1, expectedPageSize: 20, expectedParam: "page"},
+		{name: "Non-numeric page size", query: "page=2&page_size=lots", expectedPage: 2, expectedPageSize: 10, expectedParam: "page_size"},
+		{name: "Both non-numeric reports page", query: "page=x&page_size=y", expectedPage: 1, expectedPageSize: 10, expectedParam: "page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?"+tt.query, nil)
+
+			page, pageSize, err := ParsePagination(req)
+
+			if page != tt.expectedPage || pageSize != tt.expectedPageSize {
+				t.Errorf("Expected page %d and page size %d, got %d and %d", tt.expectedPage, tt.expectedPageSize, page, pageSize)
+			}
+
+			if tt.expectedParam == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var paginationErr *PaginationError
+			if !errors.As(err, &paginationErr) {
+				t.Fatalf("Expected a *PaginationError, got %v", err)
+			}
+			if paginationErr.Param != tt.expectedParam {
+				t.Errorf("Expected error for %s, got %s", tt.expectedParam, paginationErr.Param)
+			}
+			if !errors.Is(err, apperrors.ErrInvalidInput) {
+				t.Errorf("Expected error to be invalid input, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/models"
+	"github.com/moabdelazem/app/internal/service"
+)
+
+// rangeUnit is the Range unit accepted by the list endpoint, as in
+// "Range: messages=0-9"
+const rangeUnit = "messages"
+
+var errInvalidRange = errors.New("invalid Range header")
+
+// messageRange is an inclusive span of list positions, newest first
+type messageRange struct {
+	first, last int
+}
+
+// parseMessageRange parses a "messages=first-last" Range header. Like
+// PostgREST, "first-" means as many as one response allows. ok is false
+// when there is no Range header or it uses another unit, which callers
+// ignore as RFC 9110 allows.
+func parseMessageRange(header string) (rng messageRange, ok bool, err error) {
+	if header == "" {
+		return messageRange{}, false, nil
+	}
+
+	unit, spec, found := strings.Cut(header, "=")
+	if !found || strings.TrimSpace(unit) != rangeUnit {
+		return messageRange{}, false, nil
+	}
+
+	// Multiple ranges would need a multipart response
+	if strings.Contains(spec, ",") {
+		return messageRange{}, true, errInvalidRange
+	}
+
+	firstStr, lastStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return messageRange{}, true, errInvalidRange
+	}
+
+	// The upper bound keeps first+MaxRangeLimit from overflowing
+	first, err := strconv.Atoi(firstStr)
+	if err != nil || first < 0 || first > math.MaxInt-service.MaxRangeLimit {
+		return messageRange{}, true, errInvalidRange
+	}
+
+	last := first + service.MaxRangeLimit - 1
+	if lastStr != "" {
+		last, err = strconv.Atoi(lastStr)
+		if err != nil || last < first {
+			return messageRange{}, true, errInvalidRange
+		}
+	}
+
+	// Longer spans are trimmed to what one response allows
+	if last-first >= service.MaxRangeLimit {
+		last = first + service.MaxRangeLimit - 1
+	}
+
+	return messageRange{first: first, last: last}, true, nil
+}
+
+// messageRangeResponse is the body of a Range response. A range needn't
+// line up with pages, so rather than a pagination object its position and
+// the total are in Content-Range.
+type messageRangeResponse struct {
+	Items []models.GuestBookMessage `json:"messages"`
+}
+
+// respondMessageRange serves a Range request on the list endpoint, within
+// the messages from email or with tag when either is set: 206 with
+// Content-Range for a satisfiable range, 416 otherwise
+func (h *GuestBookHandler) respondMessageRange(w http.ResponseWriter, r *http.Request, rng messageRange, email, tag string) {
+	limit := rng.last - rng.first + 1
+
+	var (
+		messages []models.GuestBookMessage
+		total    int
+		err      error
+	)
+	switch {
+	case email != "":
+		messages, total, err = h.service.GetMessagesByEmailRange(r.Context(), email, rng.first, limit)
+	case tag != "":
+		messages, total, err = h.service.GetMessagesByTagRange(r.Context(), tag, rng.first, limit)
+	default:
+		messages, total, err = h.service.GetMessagesRange(r.Context(), rng.first, limit)
+	}
+	if err != nil {
+		slog.Error("Failed to get guest book message range", "error", err)
+		respondServiceError(w, err, "Failed to retrieve messages")
+		return
+	}
+
+	if len(messages) == 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("%s */%d", rangeUnit, total))
+
+		// Only an empty list satisfies a range with no items, and only from
+		// the start. That is the whole list, the first page of no pages.
+		if rng.first > 0 || total > 0 {
+			RespondError(w, http.StatusRequestedRangeNotSatisfiable, apperrors.CodeRangeNotSatisfiable, "Requested range not satisfiable")
+			return
+		}
+		RespondJSON(w, http.StatusOK, models.PaginatedResponse[models.GuestBookMessage]{
+			Items:      messages,
+			Pagination: models.NewPagination(1, limit, total),
+		})
+		return
+	}
+
+	last := rng.first + len(messages) - 1
+	w.Header().Set("Content-Range", fmt.Sprintf("%s %d-%d/%d", rangeUnit, rng.first, last, total))
+	RespondJSON(w, http.StatusPartialContent, messageRangeResponse{Items: messages})
+}
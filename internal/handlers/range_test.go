@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+func TestParseMessageRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected messageRange
+		wantOK   bool
+		wantErr  bool
+	}{
+		{name: "No header", header: ""},
+		{name: "Other unit", header: "bytes=0-9"},
+		{name: "Closed range", header: "messages=0-9", expected: messageRange{first: 0, last: 9}, wantOK: true},
+		{name: "Open-ended range", header: "messages=20-", expected: messageRange{first: 20, last: 119}, wantOK: true},
+		{name: "Span over the limit", header: "messages=0-999", expected: messageRange{first: 0, last: 99}, wantOK: true},
+		{name: "Suffix range", header: "messages=-5", wantOK: true, wantErr: true},
+		{name: "Reversed range", header: "messages=9-0", wantOK: true, wantErr: true},
+		{name: "Not a number", header: "messages=a-b", wantOK: true, wantErr: true},
+		{name: "Multiple ranges", header: "messages=0-9,20-29", wantOK: true, wantErr: true},
+		{name: "Missing dash", header: "messages=5", wantOK: true, wantErr: true},
+		{name: "Overflowing start", header: "messages=9223372036854775807-", wantOK: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng, ok, err := parseMessageRange(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("Expected ok %v, got %v", tt.wantOK, ok)
+			}
+			if err == nil && rng != tt.expected {
+				t.Errorf("Expected range %+v, got %+v", tt.expected, rng)
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_Range(t *testing.T) {
+	tests := []struct {
+		name                 string
+		url                  string
+		rangeHeader          string
+		expectedStatus       int
+		expectedContentRange string
+		expectedIDs          []int
+	}{
+		{name: "First message", url: "/api/v1/guestbook", rangeHeader: "messages=0-0", expectedStatus: http.StatusPartialContent, expectedContentRange: "messages 0-0/2", expectedIDs: []int{2}},
+		{name: "Range past the end is trimmed", url: "/api/v1/guestbook", rangeHeader: "messages=1-9", expectedStatus: http.StatusPartialContent, expectedContentRange: "messages 1-1/2", expectedIDs: []int{1}},
+		{name: "Open-ended range", url: "/api/v1/guestbook", rangeHeader: "messages=0-", expectedStatus: http.StatusPartialContent, expectedContentRange: "messages 0-1/2", expectedIDs: []int{2, 1}},
+		{name: "Unsatisfiable", url: "/api/v1/guestbook", rangeHeader: "messages=5-9", expectedStatus: http.StatusRequestedRangeNotSatisfiable, expectedContentRange: "messages */2"},
+		{name: "Filtered by email", url: "/api/v1/guestbook?email=jane.smith@example.com", rangeHeader: "messages=0-9", expectedStatus: http.StatusPartialContent, expectedContentRange: "messages 0-0/1", expectedIDs: []int{2}},
+		{name: "Filtered range past the end", url: "/api/v1/guestbook?email=john.doe@example.com", rangeHeader: "messages=1-1", expectedStatus: http.StatusRequestedRangeNotSatisfiable, expectedContentRange: "messages */1"},
+		{name: "Malformed", url: "/api/v1/guestbook", rangeHeader: "messages=9-0", expectedStatus: http.StatusBadRequest},
+		{name: "Other unit falls back to pages", url: "/api/v1/guestbook?page_size=1", rangeHeader: "bytes=0-0", expectedStatus: http.StatusOK, expectedIDs: []int{2}},
+		{name: "Query pagination without Range", url: "/api/v1/guestbook?page=2&page_size=1", expectedStatus: http.StatusOK, expectedIDs: []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+
+			handler.GetGuestBookMessages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.expectedContentRange {
+				t.Errorf("Expected Content-Range %q, got %q", tt.expectedContentRange, got)
+			}
+			if got := w.Header().Get("Accept-Ranges"); got != "messages" {
+				t.Errorf("Expected Accept-Ranges: messages, got %q", got)
+			}
+
+			if tt.expectedIDs == nil {
+				return
+			}
+
+			var response models.PaginatedResponse[models.GuestBookMessage]
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			// A range needn't be a page, so it has no page number to report
+			if hasPagination := strings.Contains(w.Body.String(), `"pagination"`); hasPagination != (w.Code == http.StatusOK) {
+				t.Errorf("Expected pagination only outside Range responses, got %s", w.Body.String())
+			}
+			if len(response.Items) != len(tt.expectedIDs) {
+				t.Fatalf("Expected %d messages, got %d", len(tt.expectedIDs), len(response.Items))
+			}
+			for i, id := range tt.expectedIDs {
+				if response.Items[i].ID != id {
+					t.Errorf("Expected message %d at position %d, got %d", id, i, response.Items[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_RangeEmpty(t *testing.T) {
+	handler := NewGuestBookHandlerWithService(&MockGuestBookService{nextID: 1})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+	req.Header.Set("Range", "messages=0-9")
+	w := httptest.NewRecorder()
+
+	handler.GetGuestBookMessages(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Content-Range"); got != "messages */0" {
+		t.Errorf("Expected Content-Range messages */0, got %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/moabdelazem/app/internal/service"
+)
+
+// RuntimeStats is the runtime endpoint's response
+type RuntimeStats struct {
+	StartedAt     time.Time   `json:"started_at"`
+	UptimeSeconds float64     `json:"uptime_seconds"`
+	GoVersion     string      `json:"go_version"`
+	Goroutines    int         `json:"goroutines"`
+	CPUs          int         `json:"cpus"`
+	Memory        MemoryStats `json:"memory"`
+	// ValidationFailures counts rejected creates by the field that failed
+	ValidationFailures map[string]int64 `json:"validation_failures"`
+}
+
+// MemoryStats is the part of runtime.MemStats worth watching
+type MemoryStats struct {
+	AllocBytes      uint64 `json:"alloc_bytes"`
+	TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+	SysBytes        uint64 `json:"sys_bytes"`
+	HeapInuseBytes  uint64 `json:"heap_inuse_bytes"`
+	HeapObjects     uint64 `json:"heap_objects"`
+	NumGC           uint32 `json:"num_gc"`
+	PauseTotalNS    uint64 `json:"pause_total_ns"`
+}
+
+// RuntimeHandler handles GET /api/v1/runtime, reporting uptime since
+// startedAt along with goroutine and memory figures and validation failure
+// counts. ReadMemStats briefly stops the world, so the endpoint is meant
+// for occasional polling.
+func RuntimeHandler(startedAt time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		RespondJSON(w, http.StatusOK, RuntimeStats{
+			StartedAt:     startedAt.UTC(),
+			UptimeSeconds: time.Since(startedAt).Seconds(),
+			GoVersion:     runtime.Version(),
+			Goroutines:    runtime.NumGoroutine(),
+			CPUs:          runtime.NumCPU(),
+			Memory: MemoryStats{
+				AllocBytes:      mem.Alloc,
+				TotalAllocBytes: mem.TotalAlloc,
+				SysBytes:        mem.Sys,
+				HeapInuseBytes:  mem.HeapInuse,
+				HeapObjects:     mem.HeapObjects,
+				NumGC:           mem.NumGC,
+				PauseTotalNS:    mem.PauseTotalNs,
+			},
+			ValidationFailures: service.ValidationFailureCounts(),
+		})
+	}
+}
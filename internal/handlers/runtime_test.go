@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRuntimeHandler(t *testing.T) {
+	startedAt := time.Now().Add(-time.Minute)
+	handler := RuntimeHandler(startedAt)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/runtime", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	for _, field := range []string{"started_at", "uptime_seconds", "go_version", "goroutines", "cpus", "memory", "validation_failures"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("Expected field %q in the response", field)
+		}
+	}
+
+	var stats RuntimeStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if stats.UptimeSeconds < 60 {
+		t.Errorf("Expected at least a minute of uptime, got %f seconds", stats.UptimeSeconds)
+	}
+	if stats.GoVersion == "" || stats.Goroutines < 1 || stats.CPUs < 1 {
+		t.Errorf("Expected runtime details, got %+v", stats)
+	}
+	if stats.Memory.SysBytes == 0 || stats.Memory.HeapInuseBytes == 0 {
+		t.Errorf("Expected memory stats, got %+v", stats.Memory)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// respondSnapshotPage answers GET /api/v1/guestbook?snapshot=<token> with a
+// page read from a snapshot, which the email and tag filters and Range
+// don't apply to
+func (h *GuestBookHandler) respondSnapshotPage(w http.ResponseWriter, r *http.Request, token string, page, pageSize int) {
+	query := r.URL.Query()
+	if query.Get("email") != "" || query.Get("tag") != "" {
+		RespondError(w, http.StatusBadRequest, apperrors.CodeValidation, "Snapshots can't be filtered by email or tag")
+		return
+	}
+
+	messages, total, snapshot, err := h.service.GetMessagesSnapshot(r.Context(), token, page, pageSize)
+	if err != nil {
+		slog.Error("Failed to get guest book messages from snapshot", "error", err)
+		respondServiceError(w, err, "Failed to retrieve messages")
+		return
+	}
+
+	// The page belongs to one client's snapshot, so caches mustn't keep it
+	w.Header().Set("Cache-Control", "no-store")
+
+	pagination := models.NewPagination(page, pageSize, total)
+	pagination.Snapshot = snapshot
+
+	// Links name the snapshot, so following them doesn't begin new ones
+	query.Set("snapshot", snapshot.Token)
+	linkURL := *r.URL
+	linkURL.RawQuery = query.Encode()
+	if link := paginationLinkHeader(&linkURL, page, pageSize, pagination.TotalPages); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	RespondJSON(w, http.StatusOK, models.PaginatedResponse[models.GuestBookMessage]{
+		Items:      messages,
+		Pagination: pagination,
+	})
+}
+
+// CloseSnapshots rolls back open pagination snapshots, so the database can
+// be closed without waiting for them to expire
+func (h *GuestBookHandler) CloseSnapshots(ctx context.Context) {
+	h.service.CloseSnapshots(ctx)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+func TestGuestBookHandler_GetGuestBookMessages_Snapshot(t *testing.T) {
+	mockService := NewMockGuestBookService()
+	handler := NewGuestBookHandlerWithService(mockService)
+
+	get := func(query string) (*httptest.ResponseRecorder, models.PaginatedResponse[models.GuestBookMessage]) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.GetGuestBookMessages(w, req)
+
+		var response models.PaginatedResponse[models.GuestBookMessage]
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+		}
+		return w, response
+	}
+
+	w, first := get("snapshot=new&page=1&page_size=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	snapshot := first.Pagination.Snapshot
+	if snapshot == nil || snapshot.Token != "snapshot-1" || snapshot.ExpiresAt.IsZero() {
+		t.Fatalf("Expected snapshot-1 with an expiry, got %+v", snapshot)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Expected Cache-Control no-store, got %q", got)
+	}
+	if link := w.Header().Get("Link"); !strings.Contains(link, "snapshot=snapshot-1") || strings.Contains(link, "snapshot=new") {
+		t.Errorf("Expected Link to name the snapshot, got %q", link)
+	}
+
+	if _, err := mockService.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+		Name: "Late Writer", Email: "late@example.com", Message: "Written while paging",
+	}); err != nil {
+		t.Fatalf("CreateMessage returned error: %v", err)
+	}
+
+	w, second := get("snapshot=snapshot-1&page=2&page_size=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if second.Pagination.Total != 2 || len(second.Items) != 1 || second.Items[0].ID != 1 {
+		t.Errorf("Expected message 1 of 2 from the snapshot, got %+v", second)
+	}
+
+	// Without a snapshot the new message is listed
+	if _, live := get("page=1&page_size=1"); live.Pagination.Total != 3 || live.Pagination.Snapshot != nil {
+		t.Errorf("Expected 3 live messages without a snapshot, got %+v", live.Pagination)
+	}
+}
+
+func TestGuestBookHandler_GetGuestBookMessages_SnapshotErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "Unknown token", query: "snapshot=made-up", expectedStatus: http.StatusNotFound, expectedCode: "NOT_FOUND"},
+		{name: "Filtered by email", query: "snapshot=new&email=ada@example.com", expectedStatus: http.StatusBadRequest, expectedCode: "VALIDATION_ERROR"},
+		{name: "Filtered by tag", query: "snapshot=new&tag=greeting", expectedStatus: http.StatusBadRequest, expectedCode: "VALIDATION_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewGuestBookHandlerWithService(NewMockGuestBookService())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			handler.GetGuestBookMessages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			var response map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response["code"] != tt.expectedCode {
+				t.Errorf("Expected code %s, got %q", tt.expectedCode, response["code"])
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import "net/http"
+
+// DefaultRobotsTxt asks every crawler to stay out; an API has nothing to index
+const DefaultRobotsTxt = "User-agent: *\nDisallow: /\n"
+
+// FaviconHandler handles GET /favicon.ico. The API has no icon, so browsers
+// get an empty 204 they may cache for a day instead of a logged 404 on
+// every visit.
+func FaviconHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RobotsHandler returns a handler for GET /robots.txt serving content
+func RobotsHandler(content string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content))
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"iter"
+	"log/slog"
+	"net/http"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// respondStreamedPage writes a paginated response, encoding messages as
+// they are read instead of collecting the page first. The JSON matches what
+// RespondJSON produces for the equivalent PaginatedResponse.
+//
+// Headers are committed when the first message arrives, so an error reading
+// it still becomes a clean error response. An error after that can't be
+// reported in the body, so the handler aborts and the client sees a broken
+// connection rather than a truncated but well-formed-looking response.
+func respondStreamedPage(w http.ResponseWriter, messages iter.Seq2[models.GuestBookMessage, error], pagination models.Pagination) {
+	// Indented output is for reading by hand in debug mode, where memory
+	// doesn't matter; buffer it so it looks the same as everywhere else.
+	// Versions that reshape the payload need the whole page too.
+	version := responseVersionOf(w)
+	if prettyJSON.Load() || version.shape != nil {
+		items := []models.GuestBookMessage{}
+		for msg, err := range messages {
+			if err != nil {
+				slog.Error("Failed to get guest book messages", "error", err)
+				respondServiceError(w, err, "Failed to retrieve messages")
+				return
+			}
+			items = append(items, msg)
+		}
+		RespondJSON(w, http.StatusOK, models.PaginatedResponse[models.GuestBookMessage]{Items: items, Pagination: pagination})
+		return
+	}
+
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", JSONContentType(version.contentType))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"messages":[`))
+		started = true
+	}
+
+	first := true
+	for msg, err := range messages {
+		if err == nil {
+			var item []byte
+			item, err = json.Marshal(msg)
+			if err == nil {
+				if !started {
+					start()
+				}
+				if !first {
+					w.Write([]byte(","))
+				}
+				w.Write(item)
+				first = false
+				continue
+			}
+		}
+
+		slog.Error("Failed to stream guest book messages", "error", err, "started", started)
+		if !started {
+			respondServiceError(w, err, "Failed to retrieve messages")
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		start()
+	}
+
+	tail, err := json.Marshal(pagination)
+	if err != nil {
+		slog.Error("Failed to encode pagination", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	w.Write([]byte(`],"pagination":`))
+	w.Write(tail)
+	w.Write([]byte("}\n"))
+}
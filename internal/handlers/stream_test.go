@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// testMessages returns n messages with a mix of tags and HTML-sensitive text
+func testMessages(n int) []models.GuestBookMessage {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	messages := make([]models.GuestBookMessage, n)
+	for i := range messages {
+		messages[i] = models.GuestBookMessage{
+			ID:        i + 1,
+			Name:      fmt.Sprintf("Guest %d", i+1),
+			Email:     fmt.Sprintf("guest%d@example.com", i+1),
+			Message:   "Hello <b>world</b> & \"friends\"  ",
+			Status:    models.StatusApproved,
+			CreatedAt: created,
+			UpdatedAt: created,
+		}
+		if i%2 == 0 {
+			messages[i].Tags = []string{"greeting"}
+		}
+	}
+	return messages
+}
+
+// failingAfter yields messages, then err
+func failingAfter(messages []models.GuestBookMessage, err error) iter.Seq2[models.GuestBookMessage, error] {
+	return func(yield func(models.GuestBookMessage, error) bool) {
+		for _, msg := range messages {
+			if !yield(msg, nil) {
+				return
+			}
+		}
+		yield(models.GuestBookMessage{}, err)
+	}
+}
+
+func TestRespondStreamedPage_MatchesBuffered(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 100} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			messages := testMessages(n)
+			pagination := models.NewPagination(1, 100, n)
+
+			buffered := httptest.NewRecorder()
+			RespondJSON(buffered, http.StatusOK, models.PaginatedResponse[models.GuestBookMessage]{Items: messages, Pagination: pagination})
+
+			streamed := httptest.NewRecorder()
+			respondStreamedPage(streamed, withoutErrors(messages), pagination)
+
+			if streamed.Code != buffered.Code {
+				t.Errorf("Expected status %d, got %d", buffered.Code, streamed.Code)
+			}
+			if got := streamed.Header().Get("Content-Type"); got != buffered.Header().Get("Content-Type") {
+				t.Errorf("Expected Content-Type %q, got %q", buffered.Header().Get("Content-Type"), got)
+			}
+			if streamed.Body.String() != buffered.Body.String() {
+				t.Errorf("Streamed body differs from buffered:\nstreamed: %s\nbuffered: %s", streamed.Body, buffered.Body)
+			}
+		})
+	}
+}
+
+func TestRespondStreamedPage_ErrorBeforeFirstMessage(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondStreamedPage(w, failingAfter(nil, errors.New("connection reset")), models.Pagination{})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if body := w.Body.String(); body != `{"code":"INTERNAL_ERROR","error":"Failed to retrieve messages"}`+"\n" {
+		t.Errorf("Expected a clean error response, got %s", body)
+	}
+}
+
+func TestRespondStreamedPage_ErrorMidStreamAborts(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("Expected the handler to abort with http.ErrAbortHandler, got %v", r)
+		}
+	}()
+
+	respondStreamedPage(w, failingAfter(testMessages(2), errors.New("connection reset")), models.Pagination{})
+	t.Error("Expected respondStreamedPage to abort")
+}
+
+// withoutErrors adapts a slice to a message iterator
+func withoutErrors(messages []models.GuestBookMessage) iter.Seq2[models.GuestBookMessage, error] {
+	return func(yield func(models.GuestBookMessage, error) bool) {
+		for _, msg := range messages {
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+func BenchmarkListResponse(b *testing.B) {
+	messages := testMessages(100)
+	pagination := models.NewPagination(1, 100, 100)
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			RespondJSON(httptest.NewRecorder(), http.StatusOK, models.PaginatedResponse[models.GuestBookMessage]{Items: messages, Pagination: pagination})
+		}
+	})
+
+	b.Run("streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			respondStreamedPage(httptest.NewRecorder(), withoutErrors(messages), pagination)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MediaTypeV1 is the media type clients send in Accept to pin the v1
+// response format. Clients that don't ask for a version get v1 as
+// application/json.
+const MediaTypeV1 = "application/vnd.guestbook.v1+json"
+
+// vendorMediaTypePrefix marks the media types that select a version
+const vendorMediaTypePrefix = "application/vnd.guestbook."
+
+// ErrUnsupportedVersion is returned by NegotiateVersion when the client
+// only accepts response versions this server doesn't have
+var ErrUnsupportedVersion = errors.New("unsupported API version")
+
+// responseVersion is one version of the response format
+type responseVersion struct {
+	contentType string
+	// shape converts a v1 payload into this version's shape before it is
+	// encoded; nil leaves it as is
+	shape func(payload interface{}) interface{}
+}
+
+// defaultVersion is used when the client names no version
+var defaultVersion = responseVersion{contentType: "application/json"}
+
+// responseVersions are the supported versions by media type. A v2 adds an
+// entry here with a shape func.
+var responseVersions = map[string]responseVersion{
+	MediaTypeV1: {contentType: MediaTypeV1},
+}
+
+// SupportedMediaTypes returns the media types that select a version, sorted
+func SupportedMediaTypes() []string {
+	mediaTypes := make([]string, 0, len(responseVersions))
+	for mediaType := range responseVersions {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	slices.Sort(mediaTypes)
+	return mediaTypes
+}
+
+// NegotiateVersion picks the response media type for the Accept header
+// values, preferring the supported version with the highest q. It returns ""
+// when no version is named, so the default applies. Naming only unsupported
+// versions fails with ErrUnsupportedVersion, unless plain JSON is accepted
+// too, in which case the client gets the default.
+func NegotiateVersion(accept []string) (string, error) {
+	chosen, chosenQ := "", 0.0
+	unsupported, fallback := false, false
+
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+			if q <= 0 {
+				continue
+			}
+
+			switch {
+			case strings.HasPrefix(mediaType, vendorMediaTypePrefix):
+				if _, ok := responseVersions[mediaType]; !ok {
+					unsupported = true
+				} else if q > chosenQ {
+					chosen, chosenQ = mediaType, q
+				}
+			case mediaType == "application/json", mediaType == "application/*", mediaType == "*/*":
+				fallback = true
+			}
+		}
+	}
+
+	if chosen == "" && unsupported && !fallback {
+		return "", ErrUnsupportedVersion
+	}
+	return chosen, nil
+}
+
+// versionedWriter carries the negotiated version to RespondJSON
+type versionedWriter struct {
+	http.ResponseWriter
+	version responseVersion
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *versionedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WithResponseVersion returns a writer whose JSON responses use the version
+// for mediaType, as returned by NegotiateVersion. An empty or unknown
+// mediaType leaves w as is.
+func WithResponseVersion(w http.ResponseWriter, mediaType string) http.ResponseWriter {
+	version, ok := responseVersions[mediaType]
+	if !ok {
+		return w
+	}
+	return &versionedWriter{ResponseWriter: w, version: version}
+}
+
+// responseVersionOf finds the version WithResponseVersion attached to w,
+// looking through writers wrapped by later middleware
+func responseVersionOf(w http.ResponseWriter) responseVersion {
+	for {
+		if versioned, ok := w.(*versionedWriter); ok {
+			return versioned.version
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return defaultVersion
+		}
+		w = unwrapper.Unwrap()
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   []string
+		expected string
+		err      error
+	}{
+		{name: "No Accept header", accept: nil, expected: ""},
+		{name: "Plain JSON", accept: []string{"application/json"}, expected: ""},
+		{name: "Wildcard", accept: []string{"*/*"}, expected: ""},
+		{name: "v1", accept: []string{MediaTypeV1}, expected: MediaTypeV1},
+		{name: "v1 among others", accept: []string{"text/html;q=0.9", MediaTypeV1 + ";q=0.8"}, expected: MediaTypeV1},
+		{name: "v1 refused with q=0", accept: []string{MediaTypeV1 + ";q=0"}, expected: ""},
+		{name: "Unknown version", accept: []string{"application/vnd.guestbook.v2+json"}, err: ErrUnsupportedVersion},
+		{name: "Unknown version with JSON fallback", accept: []string{"application/vnd.guestbook.v2+json, application/json;q=0.1"}, expected: ""},
+		{name: "Unknown and supported versions", accept: []string{"application/vnd.guestbook.v2+json", MediaTypeV1 + ";q=0.5"}, expected: MediaTypeV1},
+		{name: "Malformed entries are ignored", accept: []string{";;;, " + MediaTypeV1}, expected: MediaTypeV1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NegotiateVersion(tt.accept)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected media type %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// unwrappingWriter stands in for a writer wrapped by later middleware
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrappingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// TestRespondJSON_Versions checks v1 matches the unversioned output apart
+// from the Content-Type
+func TestRespondJSON_Versions(t *testing.T) {
+	payload := models.DeleteMessagesResult{Deleted: 3}
+
+	unversioned := httptest.NewRecorder()
+	RespondJSON(unversioned, http.StatusOK, payload)
+
+	v1 := httptest.NewRecorder()
+	RespondJSON(unwrappingWriter{WithResponseVersion(v1, MediaTypeV1)}, http.StatusOK, payload)
+
+	if got := unversioned.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("Expected Content-Type application/json without a version, got %q", got)
+	}
+	if want := MediaTypeV1 + "; charset=utf-8"; v1.Header().Get("Content-Type") != want {
+		t.Errorf("Expected Content-Type %q, got %q", want, v1.Header().Get("Content-Type"))
+	}
+	if v1.Body.String() != unversioned.Body.String() {
+		t.Errorf("Expected v1 to match the unversioned body %q, got %q", unversioned.Body.String(), v1.Body.String())
+	}
+}
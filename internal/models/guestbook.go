@@ -1,20 +1,349 @@
 package models
 
 import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
+// Moderation statuses. Only approved messages are publicly visible.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// IsValidStatus reports whether status is a known moderation status
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusApproved, StatusRejected:
+		return true
+	}
+	return false
+}
+
 type GuestBookMessage struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Message   string    `json:"message"`
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+	// Tags are lowercase categories such as "greeting"; never nil once stored
+	Tags      []string  `json:"tags"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Metadata is never serialized on the public model; see AdminMessage
+	Metadata *MessageMetadata `json:"-"`
+	// EditTokenHash is the SHA-256 of the token that authorizes edits; empty
+	// for messages that can't be edited through the public API
+	EditTokenHash string `json:"-"`
+	// EditToken is the token itself, set only on a message just created.
+	// It is sent to its author once and never stored.
+	EditToken string `json:"-"`
+	// IdempotencyFingerprint is the fingerprint of the request that created
+	// the message, set only when a create is answered with it as a replay
+	IdempotencyFingerprint string `json:"-"`
+}
+
+// MessageMetadata is abuse-investigation data captured with a message when
+// CAPTURE_METADATA is on. It is only exposed through admin endpoints.
+type MessageMetadata struct {
+	// IPHash is a salted hash of the client IP, never the raw address
+	IPHash    string `json:"ip_hash,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// AdminMessage is the admin view of a message, which adds its metadata
+type AdminMessage struct {
+	GuestBookMessage
+}
+
+// MarshalJSON adds a metadata field to the public representation
+func (m AdminMessage) MarshalJSON() ([]byte, error) {
+	return marshalWithField(m.GuestBookMessage, "metadata", m.Metadata)
+}
+
+// SearchResult is a message matched by full-text search
+type SearchResult struct {
+	GuestBookMessage
+	// Rank is the ts_rank relevance score; higher is more relevant
+	Rank float64
+}
+
+// MarshalJSON adds a rank field to the public representation
+func (r SearchResult) MarshalJSON() ([]byte, error) {
+	return marshalWithField(r.GuestBookMessage, "rank", r.Rank)
+}
+
+// marshalWithField marshals msg's public representation with one extra field.
+// Embedding GuestBookMessage promotes its MarshalJSON, so wrappers can't rely
+// on struct tags to add fields.
+func marshalWithField(msg GuestBookMessage, key string, value interface{}) ([]byte, error) {
+	public, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(public, &fields); err != nil {
+		return nil, err
+	}
+
+	if fields[key], err = json.Marshal(value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(fields)
+}
+
+// stringIDs is whether messages serialize their id as a string; see
+// SetStringIDs
+var stringIDs atomic.Bool
+
+// SetStringIDs sets whether messages serialize their id as a JSON string,
+// as in "id": "12345", rather than a number. JavaScript clients lose
+// precision on integers past 2^53, which bigint ids could reach.
+func SetStringIDs(enabled bool) {
+	stringIDs.Store(enabled)
+}
+
+// MarshalJSON adds the derived char_count and word_count fields so they are
+// computed at serialization time rather than stored on the model
+func (m GuestBookMessage) MarshalJSON() ([]byte, error) {
+	// alias drops the MarshalJSON method to avoid infinite recursion
+	type alias GuestBookMessage
+
+	// Untagged messages have an empty list, not null
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+
+	var id any = m.ID
+	if stringIDs.Load() {
+		id = strconv.Itoa(m.ID)
+	}
+
+	// ID shadows the alias's id, and comes first to keep it first in the
+	// output
+	return json.Marshal(struct {
+		ID any `json:"id"`
+		alias
+		CharCount int `json:"char_count"`
+		WordCount int `json:"word_count"`
+	}{
+		ID:        id,
+		alias:     alias(m),
+		CharCount: m.CharCount(),
+		WordCount: m.WordCount(),
+	})
+}
+
+// CharCount returns the number of characters (runes) in the message
+func (m GuestBookMessage) CharCount() int {
+	return utf8.RuneCountInString(m.Message)
+}
+
+// WordCount returns the number of whitespace-separated words in the message
+func (m GuestBookMessage) WordCount() int {
+	return len(strings.Fields(m.Message))
 }
 
 type CreateGuestBookMessage struct {
 	Name    string `json:"name" validate:"required,min=2,max=100"`
 	Email   string `json:"email" validate:"required,email,max=255"`
 	Message string `json:"message" validate:"required,min=10,max=1000"`
+	// Tags are optional categories; see MaxTags and MaxTagLength
+	Tags []string `json:"tags,omitempty"`
+	// CaptchaToken is the solved CAPTCHA, required when CAPTCHA_ENABLED is
+	// set. It is only verified, never stored.
+	CaptchaToken string `json:"captcha_token,omitempty"`
+	// IdempotencyKey comes from the Idempotency-Key header. Retried creates
+	// with the same key return the original message instead of a duplicate.
+	// The service stores it scoped to the client, not as sent.
+	IdempotencyKey string `json:"-"`
+	// IdempotencyFingerprint identifies the request body stored with the
+	// key, so a replay with a different body can be refused
+	IdempotencyFingerprint string `json:"-"`
+	// ClientIP and UserAgent describe the request that created the message.
+	// They are only stored, as Metadata, when metadata capture is enabled.
+	ClientIP  string           `json:"-"`
+	UserAgent string           `json:"-"`
+	Metadata  *MessageMetadata `json:"-"`
+	// EditTokenHash is stored with the message; see GuestBookMessage
+	EditTokenHash string `json:"-"`
+}
+
+// PatchGuestBookMessage is the request body for a partial update. Only the
+// fields present in the body are changed: a nil field was left out, while a
+// pointer to "" asks for the empty string (and fails validation).
+type PatchGuestBookMessage struct {
+	Name    *string `json:"name,omitempty"`
+	Email   *string `json:"email,omitempty"`
+	Message *string `json:"message,omitempty"`
+	// Tags replaces the message's tags; an empty array removes them all
+	Tags *[]string `json:"tags,omitempty"`
+}
+
+// Fields returns the JSON names of the fields the patch changes
+func (p *PatchGuestBookMessage) Fields() []string {
+	var fields []string
+	if p.Name != nil {
+		fields = append(fields, "name")
+	}
+	if p.Email != nil {
+		fields = append(fields, "email")
+	}
+	if p.Message != nil {
+		fields = append(fields, "message")
+	}
+	if p.Tags != nil {
+		fields = append(fields, "tags")
+	}
+	return fields
+}
+
+// DryRunResult is the response to a validate-only create: the message as it
+// would have been stored, which it was not
+type DryRunResult struct {
+	DryRun  bool                   `json:"dry_run"`
+	Message CreateGuestBookMessage `json:"message"`
+}
+
+// MaxIdempotencyKeyLength is the size of the idempotency_key column
+const MaxIdempotencyKeyLength = 255
+
+const (
+	// MaxTags is how many tags one message may have
+	MaxTags = 5
+	// MaxTagLength bounds each tag, in characters
+	MaxTagLength = 30
+)
+
+// Pagination describes the page returned by a list endpoint
+type Pagination struct {
+	Page       int  `json:"page"`
+	PageSize   int  `json:"page_size"`
+	Total      int  `json:"total"`
+	TotalPages int  `json:"total_pages"`
+	HasNext    bool `json:"has_next"`
+	HasPrev    bool `json:"has_prev"`
+	// OutOfRange marks a page past the last one. Such pages are answered
+	// as requested, with no items, rather than clamped to the last page,
+	// so a client paging forward can tell it has gone too far.
+	OutOfRange bool `json:"out_of_range,omitempty"`
+	// Snapshot is set when the page was read from a snapshot; pass its
+	// token to read more pages from the same one
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+}
+
+// Snapshot identifies a consistent view of the guest book that a client can
+// page through while messages are being written
+type Snapshot struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewPagination describes page of total items split into pages of
+// pageSize, deriving the page count and whether neighboring pages exist.
+// An empty list has no pages, and a page size below 1 is treated as such;
+// page 1 of an empty list is still in range.
+func NewPagination(page, pageSize, total int) Pagination {
+	totalPages := 0
+	if pageSize > 0 && total > 0 {
+		totalPages = (total + pageSize - 1) / pageSize
+	}
+
+	return Pagination{
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		TotalPages: totalPages,
+		HasNext:    page < totalPages,
+		HasPrev:    page > 1,
+		OutOfRange: page > max(totalPages, 1),
+	}
+}
+
+// PaginatedResponse is one page of a list endpoint's items. The items are
+// serialized as "messages", the field clients of the guest book list read.
+type PaginatedResponse[T any] struct {
+	Items      []T        `json:"messages"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// MessageNeighbors are the approved messages created immediately before and
+// after a message; either is nil at the ends of the guest book
+type MessageNeighbors struct {
+	Previous *GuestBookMessage `json:"previous"`
+	Next     *GuestBookMessage `json:"next"`
+}
+
+// UpdateMessageStatus is the request body for changing a message's moderation status
+type UpdateMessageStatus struct {
+	Status string `json:"status"`
+}
+
+// ModerationCounts is how many messages are in each moderation status
+type ModerationCounts struct {
+	Pending  int `json:"pending"`
+	Approved int `json:"approved"`
+	Rejected int `json:"rejected"`
+}
+
+// ModerationQueue is a page of the messages waiting for moderation, with
+// the counts for every status
+type ModerationQueue struct {
+	Messages   []AdminMessage   `json:"messages"`
+	Pagination Pagination       `json:"pagination"`
+	Counts     ModerationCounts `json:"counts"`
+}
+
+// MaxDeleteIDs caps how many messages one batch delete may remove
+const MaxDeleteIDs = 100
+
+// DeleteMessages is the request body for deleting messages in a batch
+type DeleteMessages struct {
+	IDs []int `json:"ids"`
+}
+
+// DeleteMessagesResult reports how many messages a batch delete removed.
+// IDs that didn't exist aren't counted.
+type DeleteMessagesResult struct {
+	Deleted int `json:"deleted"`
+}
+
+// AuditEntry records a write to the guest book
+type AuditEntry struct {
+	// Action is what was done, such as "create" or "delete"
+	Action string
+	// MessageIDs are the affected messages; for deletes, the requested IDs
+	MessageIDs []int
+	// Actor is who made the request: "admin" for the admin API, otherwise
+	// "anonymous"
+	Actor    string
+	ClientIP string
+	// Detail is action-specific, such as the new status
+	Detail string
+	Time   time.Time
+}
+
+// DateFormat is the layout used for calendar dates in responses
+const DateFormat = "2006-01-02"
+
+// DailyCount is the number of messages created on a calendar day (UTC)
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// MessageLengthStats describes how long approved messages are, in
+// characters. Every field is zero when there are no messages.
+type MessageLengthStats struct {
+	Min    int     `json:"min"`
+	Avg    float64 `json:"avg"`
+	Max    int     `json:"max"`
+	Median float64 `json:"median"`
 }
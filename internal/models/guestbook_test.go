@@ -0,0 +1,277 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestGuestBookMessage_MarshalJSON_Counts(t *testing.T) {
+	tests := []struct {
+		name              string
+		message           string
+		expectedCharCount int
+		expectedWordCount int
+	}{
+		{
+			name:              "ASCII message",
+			message:           "Hello, this is a test message!",
+			expectedCharCount: 30,
+			expectedWordCount: 6,
+		},
+		{
+			name:              "Multi-byte message",
+			message:           "héllo wörld ça va",
+			expectedCharCount: 17,
+			expectedWordCount: 4,
+		},
+		{
+			name:              "CJK and emoji message",
+			message:           "こんにちは 世界 👋🌍",
+			expectedCharCount: 11,
+			expectedWordCount: 3,
+		},
+		{
+			name:              "Extra whitespace",
+			message:           "  spaced\tout\n words  ",
+			expectedCharCount: 21,
+			expectedWordCount: 3,
+		},
+		{
+			name:              "Empty message",
+			message:           "",
+			expectedCharCount: 0,
+			expectedWordCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utf8.RuneCountInString(tt.message); got != tt.expectedCharCount {
+				t.Fatalf("Test case expects %d runes, but message has %d", tt.expectedCharCount, got)
+			}
+
+			msg := GuestBookMessage{
+				ID:        1,
+				Name:      "John Doe",
+				Email:     "john.doe@example.com",
+				Message:   tt.message,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			}
+
+			data, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatalf("Failed to marshal message: %v", err)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(data, &response); err != nil {
+				t.Fatalf("Failed to unmarshal message: %v", err)
+			}
+
+			if response["char_count"] != float64(tt.expectedCharCount) {
+				t.Errorf("Expected char_count %d, got %v", tt.expectedCharCount, response["char_count"])
+			}
+			if response["word_count"] != float64(tt.expectedWordCount) {
+				t.Errorf("Expected word_count %d, got %v", tt.expectedWordCount, response["word_count"])
+			}
+
+			// Stored fields must still be present
+			for _, field := range []string{"id", "name", "email", "message", "created_at", "updated_at"} {
+				if _, exists := response[field]; !exists {
+					t.Errorf("Expected field %q to exist", field)
+				}
+			}
+		})
+	}
+}
+
+func TestGuestBookMessage_MetadataOnlyInAdminView(t *testing.T) {
+	msg := GuestBookMessage{
+		ID:        1,
+		Name:      "John Doe",
+		Email:     "john.doe@example.com",
+		Message:   "Hello there",
+		Status:    StatusApproved,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Metadata:  &MessageMetadata{IPHash: "abc123", UserAgent: "curl/8.0"},
+	}
+
+	public, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %v", err)
+	}
+	for _, secret := range []string{"metadata", "abc123", "curl/8.0"} {
+		if strings.Contains(string(public), secret) {
+			t.Errorf("Expected public JSON to omit %q, got %s", secret, public)
+		}
+	}
+
+	admin, err := json.Marshal(AdminMessage{GuestBookMessage: msg})
+	if err != nil {
+		t.Fatalf("Failed to marshal admin message: %v", err)
+	}
+
+	var response struct {
+		ID        int             `json:"id"`
+		CharCount int             `json:"char_count"`
+		Metadata  MessageMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(admin, &response); err != nil {
+		t.Fatalf("Failed to unmarshal admin message: %v", err)
+	}
+
+	if response.ID != 1 || response.CharCount != 11 {
+		t.Errorf("Expected public fields in admin view, got id %d, char_count %d", response.ID, response.CharCount)
+	}
+	if response.Metadata != *msg.Metadata {
+		t.Errorf("Expected metadata %+v, got %+v", *msg.Metadata, response.Metadata)
+	}
+}
+
+func TestPaginatedResponse_MarshalJSON(t *testing.T) {
+	response := PaginatedResponse[GuestBookMessage]{
+		Items:      []GuestBookMessage{{ID: 1, Message: "Hello there"}},
+		Pagination: NewPagination(2, 1, 3),
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("Failed to marshal response: %v", err)
+	}
+
+	var decoded struct {
+		Messages   []map[string]interface{} `json:"messages"`
+		Pagination map[string]interface{}   `json:"pagination"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(decoded.Messages) != 1 || decoded.Messages[0]["char_count"] != float64(11) {
+		t.Errorf("Expected one message with its derived fields, got %v", decoded.Messages)
+	}
+
+	expected := map[string]interface{}{
+		"page":        float64(2),
+		"page_size":   float64(1),
+		"total":       float64(3),
+		"total_pages": float64(3),
+		"has_next":    true,
+		"has_prev":    true,
+	}
+	for key, value := range expected {
+		if decoded.Pagination[key] != value {
+			t.Errorf("Expected pagination %s to be %v, got %v", key, value, decoded.Pagination[key])
+		}
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     int
+		pageSize int
+		total    int
+		expected Pagination
+	}{
+		{
+			name: "Empty list", page: 1, pageSize: 10, total: 0,
+			expected: Pagination{Page: 1, PageSize: 10, Total: 0, TotalPages: 0},
+		},
+		{
+			name: "Single partial page", page: 1, pageSize: 10, total: 3,
+			expected: Pagination{Page: 1, PageSize: 10, Total: 3, TotalPages: 1},
+		},
+		{
+			name: "Exactly full pages", page: 1, pageSize: 10, total: 20,
+			expected: Pagination{Page: 1, PageSize: 10, Total: 20, TotalPages: 2, HasNext: true},
+		},
+		{
+			name: "Partial last page", page: 3, pageSize: 10, total: 21,
+			expected: Pagination{Page: 3, PageSize: 10, Total: 21, TotalPages: 3, HasPrev: true},
+		},
+		{
+			name: "Middle page", page: 2, pageSize: 10, total: 21,
+			expected: Pagination{Page: 2, PageSize: 10, Total: 21, TotalPages: 3, HasNext: true, HasPrev: true},
+		},
+		{
+			name: "Past the last page", page: 5, pageSize: 10, total: 21,
+			expected: Pagination{Page: 5, PageSize: 10, Total: 21, TotalPages: 3, HasPrev: true, OutOfRange: true},
+		},
+		{
+			name: "Past the end of an empty list", page: 2, pageSize: 10, total: 0,
+			expected: Pagination{Page: 2, PageSize: 10, Total: 0, TotalPages: 0, HasPrev: true, OutOfRange: true},
+		},
+		{
+			name: "Zero page size", page: 1, pageSize: 0, total: 5,
+			expected: Pagination{Page: 1, PageSize: 0, Total: 5, TotalPages: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPagination(tt.page, tt.pageSize, tt.total); got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGuestBookMessage_MarshalJSON_EmptyTags(t *testing.T) {
+	data, err := json.Marshal(GuestBookMessage{ID: 1})
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"tags":[]`) {
+		t.Errorf("Expected untagged messages to have an empty tags array, got %s", data)
+	}
+}
+
+func TestGuestBookMessage_MarshalJSON_StringIDs(t *testing.T) {
+	defer SetStringIDs(false)
+
+	// Past 2^53, where a JavaScript number would round it
+	msg := GuestBookMessage{ID: 9007199254740993, Name: "Ada", Message: "Hello"}
+
+	tests := []struct {
+		name      string
+		stringIDs bool
+		expected  string
+	}{
+		{name: "Numeric ids", stringIDs: false, expected: `9007199254740993`},
+		{name: "String ids", stringIDs: true, expected: `"9007199254740993"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStringIDs(tt.stringIDs)
+
+			for _, v := range []any{msg, AdminMessage{GuestBookMessage: msg}, SearchResult{GuestBookMessage: msg}} {
+				data, err := json.Marshal(v)
+				if err != nil {
+					t.Fatalf("Failed to marshal %T: %v", v, err)
+				}
+
+				var fields map[string]json.RawMessage
+				if err := json.Unmarshal(data, &fields); err != nil {
+					t.Fatalf("Failed to unmarshal %T: %v", v, err)
+				}
+				if got := string(fields["id"]); got != tt.expected {
+					t.Errorf("Expected %T to have id %s, got %s", v, tt.expected, got)
+				}
+			}
+
+			// The id is still the first field
+			data, _ := json.Marshal(msg)
+			if !strings.HasPrefix(string(data), `{"id":`+tt.expected+`,`) {
+				t.Errorf("Expected the id first, got %s", data)
+			}
+		})
+	}
+}
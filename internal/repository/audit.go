@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moabdelazem/app/internal/database"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// AuditRepository stores audit entries in the audit_log table
+type AuditRepository struct {
+	db *database.DB
+}
+
+func NewAuditRepository(db *database.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) CreateTable(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			action VARCHAR(50) NOT NULL,
+			-- No foreign key: entries outlive the messages they describe
+			message_ids INTEGER[] NOT NULL DEFAULT '{}',
+			actor VARCHAR(100) NOT NULL,
+			client_ip VARCHAR(45),
+			detail TEXT,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+	`
+
+	_, err := r.db.WritePool().Exec(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to create audit_log table: %w", err)
+	}
+
+	return nil
+}
+
+// Record inserts an audit entry
+func (r *AuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (action, message_ids, actor, client_ip, detail, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	ids := entry.MessageIDs
+	if ids == nil {
+		ids = []int{}
+	}
+
+	_, err := r.db.WritePool().Exec(ctx, query, entry.Action, ids, entry.Actor,
+		nullIfEmpty(entry.ClientIP), nullIfEmpty(entry.Detail), entry.Time)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	return nil
+}
@@ -2,21 +2,48 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/app/internal/apperrors"
 	"github.com/moabdelazem/app/internal/database"
 	"github.com/moabdelazem/app/internal/models"
 )
 
+// messageColumns is the column list read by scanMessage, in scan order
+const messageColumns = `id, name, email, message, status, created_at, updated_at, ip_hash, user_agent, tags, edit_token_hash`
+
 type GuestBookRepository struct {
 	db *database.DB
+	// maxOffset rejects list queries skipping more rows than this; 0 means
+	// no limit. See SetMaxOffset.
+	maxOffset int
 }
 
 func NewGuestBookRepository(db *database.DB) *GuestBookRepository {
 	return &GuestBookRepository{db: db}
 }
 
+// SetMaxOffset makes list queries with an offset beyond max fail with an
+// apperrors.ErrInvalidInput instead of running. Postgres reads and discards
+// every skipped row, so deep pages get slower the deeper they go. 0 removes
+// the limit. It must be called before the repository is used.
+func (r *GuestBookRepository) SetMaxOffset(max int) {
+	r.maxOffset = max
+}
+
+// checkOffset enforces the limit set with SetMaxOffset
+func (r *GuestBookRepository) checkOffset(offset int) error {
+	if r.maxOffset > 0 && offset > r.maxOffset {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "pagination too deep: results past the first %d are not served", r.maxOffset)
+	}
+	return nil
+}
+
 func (r *GuestBookRepository) CreateTable(ctx context.Context) error {
 	query := `
 		CREATE TABLE IF NOT EXISTS guest_book_messages (
@@ -29,9 +56,57 @@ func (r *GuestBookRepository) CreateTable(ctx context.Context) error {
 		);
 		
 		CREATE INDEX IF NOT EXISTS idx_guest_book_created_at ON guest_book_messages(created_at DESC);
+
+		-- Moderation status; the default backfills existing rows as approved
+		ALTER TABLE guest_book_messages
+			ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'approved'
+			CHECK (status IN ('pending', 'approved', 'rejected'));
+
+		CREATE INDEX IF NOT EXISTS idx_guest_book_status ON guest_book_messages(status);
+
+		-- Client-supplied key making creates safe to retry; NULLs never conflict
+		ALTER TABLE guest_book_messages
+			ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+		-- Hash of the request body a key was first used with
+		ALTER TABLE guest_book_messages
+			ADD COLUMN IF NOT EXISTS idempotency_fingerprint VARCHAR(64);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_guest_book_idempotency_key ON guest_book_messages(idempotency_key);
+
+		-- Optional abuse-investigation metadata (CAPTURE_METADATA)
+		ALTER TABLE guest_book_messages
+			ADD COLUMN IF NOT EXISTS ip_hash VARCHAR(64),
+			ADD COLUMN IF NOT EXISTS user_agent TEXT;
+
+		-- Full-text search; Search must use the identical expression to hit it
+		CREATE INDEX IF NOT EXISTS idx_guest_book_message_fts ON guest_book_messages
+			USING GIN (to_tsvector('english', message));
+
+		-- Optional categories, filtered with @> so the GIN index applies
+		ALTER TABLE guest_book_messages
+			ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+		CREATE INDEX IF NOT EXISTS idx_guest_book_tags ON guest_book_messages USING GIN (tags);
+
+		-- Per-author listing (GetByEmail), newest first
+		CREATE INDEX IF NOT EXISTS idx_guest_book_email ON guest_book_messages(email, created_at DESC);
+
+		-- SHA-256 of the token authorizing public edits; NULL can't be edited
+		ALTER TABLE guest_book_messages
+			ADD COLUMN IF NOT EXISTS edit_token_hash VARCHAR(64);
+
+		-- Guest-book-wide state in a single row. Deletes leave no updated_at
+		-- behind, so they are recorded here for LastChangedAt.
+		CREATE TABLE IF NOT EXISTS guest_book_state (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+			last_deleted_at TIMESTAMP WITH TIME ZONE
+		);
+
+		INSERT INTO guest_book_state (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query)
+	_, err := r.db.WritePool().Exec(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to create guest_book_messages table: %w", err)
 	}
@@ -39,23 +114,85 @@ func (r *GuestBookRepository) CreateTable(ctx context.Context) error {
 	return nil
 }
 
-func (r *GuestBookRepository) Create(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.GuestBookMessage, error) {
+// scanMessage scans a row selected with messageColumns, followed by any
+// extra selected columns into extra
+func scanMessage(row pgx.Row, msg *models.GuestBookMessage, extra ...any) error {
+	var ipHash, userAgent, editTokenHash *string
+	dest := []any{
+		&msg.ID,
+		&msg.Name,
+		&msg.Email,
+		&msg.Message,
+		&msg.Status,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+		&ipHash,
+		&userAgent,
+		&msg.Tags,
+		&editTokenHash,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	if editTokenHash != nil {
+		msg.EditTokenHash = *editTokenHash
+	}
+
+	if ipHash != nil || userAgent != nil {
+		msg.Metadata = &models.MessageMetadata{}
+		if ipHash != nil {
+			msg.Metadata.IPHash = *ipHash
+		}
+		if userAgent != nil {
+			msg.Metadata.UserAgent = *userAgent
+		}
+	}
+
+	return nil
+}
+
+// nullIfEmpty maps empty strings to NULL
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// Create inserts a message. When msg carries an idempotency key that was
+// already used, nothing is inserted and the original message is returned, so
+// retried requests never create duplicates. Inserts aborted by a conflicting
+// transaction are retried under the DB's RetryPolicy.
+func (r *GuestBookRepository) Create(ctx context.Context, msg *models.CreateGuestBookMessage, status string) (*models.GuestBookMessage, error) {
 	query := `
-		INSERT INTO guest_book_messages (name, email, message)
-		VALUES ($1, $2, $3)
-		RETURNING id, name, email, message, created_at, updated_at
-	`
+		INSERT INTO guest_book_messages (name, email, message, status, idempotency_key, ip_hash, user_agent, tags, edit_token_hash, idempotency_fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (idempotency_key) DO NOTHING
+		RETURNING ` + messageColumns
 
-	var result models.GuestBookMessage
-	err := r.db.Pool.QueryRow(ctx, query, msg.Name, msg.Email, msg.Message).Scan(
-		&result.ID,
-		&result.Name,
-		&result.Email,
-		&result.Message,
-		&result.CreatedAt,
-		&result.UpdatedAt,
-	)
+	// An empty key is stored as NULL, which never conflicts
+	key := nullIfEmpty(msg.IdempotencyKey)
 
+	var ipHash, userAgent *string
+	if msg.Metadata != nil {
+		ipHash = nullIfEmpty(msg.Metadata.IPHash)
+		userAgent = nullIfEmpty(msg.Metadata.UserAgent)
+	}
+
+	// The column is NOT NULL, so untagged messages store an empty array
+	tags := msg.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var result models.GuestBookMessage
+	err := r.db.WithRetry(ctx, func(ctx context.Context) error {
+		return scanMessage(r.db.WritePool().QueryRow(ctx, query, msg.Name, msg.Email, msg.Message, status, key, ipHash, userAgent, tags, nullIfEmpty(msg.EditTokenHash), nullIfEmpty(msg.IdempotencyFingerprint)), &result)
+	})
+	if errors.Is(err, pgx.ErrNoRows) && key != nil {
+		return r.GetByIdempotencyKey(ctx, *key)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create guest book message: %w", err)
 	}
@@ -63,32 +200,160 @@ func (r *GuestBookRepository) Create(ctx context.Context, msg *models.CreateGues
 	return &result, nil
 }
 
+// GetByIdempotencyKey returns the message created with key, with the
+// fingerprint of the request that created it. It reads from the primary
+// since the row may have only just been written.
+func (r *GuestBookRepository) GetByIdempotencyKey(ctx context.Context, key string) (*models.GuestBookMessage, error) {
+	query := `
+		SELECT ` + messageColumns + `, idempotency_fingerprint
+		FROM guest_book_messages
+		WHERE idempotency_key = $1
+	`
+
+	var msg models.GuestBookMessage
+	var fingerprint *string
+	if err := scanMessage(r.db.WritePool().QueryRow(ctx, query, key), &msg, &fingerprint); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get message by idempotency key: %w", err)
+	}
+	if fingerprint != nil {
+		msg.IdempotencyFingerprint = *fingerprint
+	}
+
+	return &msg, nil
+}
+
+// ReleaseIdempotencyKey clears the idempotency key of the message with id,
+// so the key can create a new message. Matching on the ID leaves alone a
+// message that has since been created with the same key.
+func (r *GuestBookRepository) ReleaseIdempotencyKey(ctx context.Context, id int) error {
+	query := `UPDATE guest_book_messages SET idempotency_key = NULL WHERE id = $1`
+
+	if _, err := r.db.WritePool().Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// BeginSnapshot starts a read-only view of the guest book for GetAllInTx
+// and CountInTx. The caller must roll it back.
+func (r *GuestBookRepository) BeginSnapshot(ctx context.Context) (database.Snapshot, error) {
+	return r.db.BeginSnapshot(ctx)
+}
+
+// GetAll returns a page of approved messages, newest first
 func (r *GuestBookRepository) GetAll(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+	return r.GetAllInTx(ctx, r.db.ReadPool(), limit, offset)
+}
+
+// GetAllInTx is GetAll run through q, such as a snapshot from BeginSnapshot,
+// so consecutive pages can be read from one consistent view
+func (r *GuestBookRepository) GetAllInTx(ctx context.Context, q database.Querier, limit, offset int) ([]models.GuestBookMessage, error) {
+	if err := r.checkOffset(offset); err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, name, email, message, created_at, updated_at
+		SELECT ` + messageColumns + `
 		FROM guest_book_messages
+		WHERE status = 'approved'
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, limit, offset)
+	rows, err := q.Query(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get guest book messages: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []models.GuestBookMessage
+	// Initialize as empty (not nil) so it encodes as [] rather than null
+	messages := make([]models.GuestBookMessage, 0)
 	for rows.Next() {
 		var msg models.GuestBookMessage
-		err := rows.Scan(
-			&msg.ID,
-			&msg.Name,
-			&msg.Email,
-			&msg.Message,
-			&msg.CreatedAt,
-			&msg.UpdatedAt,
-		)
+		if err := scanMessage(rows, &msg); err != nil {
+			return nil, fmt.Errorf("failed to scan guest book message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating guest book messages: %w", rows.Err())
+	}
+
+	return messages, nil
+}
+
+// StreamAll is GetAll as an iterator: each message is yielded as its row is
+// read, so a page is never held in memory at once. The query runs when the
+// iterator is ranged over; an error ends the iteration.
+func (r *GuestBookRepository) StreamAll(ctx context.Context, limit, offset int) iter.Seq2[models.GuestBookMessage, error] {
+	return func(yield func(models.GuestBookMessage, error) bool) {
+		if err := r.checkOffset(offset); err != nil {
+			yield(models.GuestBookMessage{}, err)
+			return
+		}
+
+		query := `
+			SELECT ` + messageColumns + `
+			FROM guest_book_messages
+			WHERE status = 'approved'
+			ORDER BY created_at DESC
+			LIMIT $1 OFFSET $2
+		`
+
+		rows, err := r.db.ReadPool().Query(ctx, query, limit, offset)
 		if err != nil {
+			yield(models.GuestBookMessage{}, fmt.Errorf("failed to get guest book messages: %w", err))
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var msg models.GuestBookMessage
+			if err := scanMessage(rows, &msg); err != nil {
+				yield(models.GuestBookMessage{}, fmt.Errorf("failed to scan guest book message: %w", err))
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+
+		if rows.Err() != nil {
+			yield(models.GuestBookMessage{}, fmt.Errorf("error iterating guest book messages: %w", rows.Err()))
+		}
+	}
+}
+
+// GetByEmail returns a page of approved messages written with exactly the
+// given email address, newest first
+func (r *GuestBookRepository) GetByEmail(ctx context.Context, email string, limit, offset int) ([]models.GuestBookMessage, error) {
+	if err := r.checkOffset(offset); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM guest_book_messages
+		WHERE status = 'approved' AND email = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.ReadPool().Query(ctx, query, email, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guest book messages by email: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.GuestBookMessage, 0)
+	for rows.Next() {
+		var msg models.GuestBookMessage
+		if err := scanMessage(rows, &msg); err != nil {
 			return nil, fmt.Errorf("failed to scan guest book message: %w", err)
 		}
 		messages = append(messages, msg)
@@ -101,26 +366,138 @@ func (r *GuestBookRepository) GetAll(ctx context.Context, limit, offset int) ([]
 	return messages, nil
 }
 
+// GetByTag returns a page of approved messages carrying tag, newest first
+func (r *GuestBookRepository) GetByTag(ctx context.Context, tag string, limit, offset int) ([]models.GuestBookMessage, error) {
+	if err := r.checkOffset(offset); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM guest_book_messages
+		WHERE status = 'approved' AND tags @> ARRAY[$1]::text[]
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.ReadPool().Query(ctx, query, tag, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guest book messages by tag: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.GuestBookMessage, 0)
+	for rows.Next() {
+		var msg models.GuestBookMessage
+		if err := scanMessage(rows, &msg); err != nil {
+			return nil, fmt.Errorf("failed to scan guest book message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating guest book messages: %w", rows.Err())
+	}
+
+	return messages, nil
+}
+
+// GetByStatus returns a page of messages in the given moderation status,
+// oldest first, so a moderation queue is worked through in arrival order
+func (r *GuestBookRepository) GetByStatus(ctx context.Context, status string, limit, offset int) ([]models.GuestBookMessage, error) {
+	if err := r.checkOffset(offset); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM guest_book_messages
+		WHERE status = $1
+		ORDER BY created_at ASC, id ASC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.ReadPool().Query(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guest book messages by status: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.GuestBookMessage, 0)
+	for rows.Next() {
+		var msg models.GuestBookMessage
+		if err := scanMessage(rows, &msg); err != nil {
+			return nil, fmt.Errorf("failed to scan guest book message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating guest book messages: %w", rows.Err())
+	}
+
+	return messages, nil
+}
+
+// Search returns up to limit approved messages matching the full-text query,
+// most relevant first. plainto_tsquery treats the query as plain words, so
+// tsquery operators and punctuation in user input are ignored rather than
+// parsed.
+func (r *GuestBookRepository) Search(ctx context.Context, q string, limit int) ([]models.SearchResult, error) {
+	query := `
+		SELECT ` + messageColumns + `, ts_rank(to_tsvector('english', message), tsq) AS rank
+		FROM guest_book_messages, plainto_tsquery('english', $1) AS tsq
+		WHERE status = 'approved' AND to_tsvector('english', message) @@ tsq
+		ORDER BY rank DESC, created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.ReadPool().Query(ctx, query, q, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search guest book messages: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]models.SearchResult, 0)
+	for rows.Next() {
+		var result models.SearchResult
+		if err := scanMessage(rows, &result.GuestBookMessage, &result.Rank); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating search results: %w", rows.Err())
+	}
+
+	return results, nil
+}
+
+// GetByID returns a message regardless of its moderation status
 func (r *GuestBookRepository) GetByID(ctx context.Context, id int) (*models.GuestBookMessage, error) {
+	return r.getByID(ctx, r.db.ReadPool(), id)
+}
+
+// GetByIDFromPrimary is GetByID reading from the primary, for mutations
+// that check the row first: a replica may not have a message created
+// moments ago, or its latest edit, yet.
+func (r *GuestBookRepository) GetByIDFromPrimary(ctx context.Context, id int) (*models.GuestBookMessage, error) {
+	return r.getByID(ctx, r.db.WritePool(), id)
+}
+
+func (r *GuestBookRepository) getByID(ctx context.Context, q database.Querier, id int) (*models.GuestBookMessage, error) {
 	query := `
-		SELECT id, name, email, message, created_at, updated_at
+		SELECT ` + messageColumns + `
 		FROM guest_book_messages
 		WHERE id = $1
 	`
 
 	var msg models.GuestBookMessage
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
-		&msg.ID,
-		&msg.Name,
-		&msg.Email,
-		&msg.Message,
-		&msg.CreatedAt,
-		&msg.UpdatedAt,
-	)
-
+	err := scanMessage(q.QueryRow(ctx, query, id), &msg)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("guest book message not found")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get guest book message: %w", err)
 	}
@@ -128,14 +505,321 @@ func (r *GuestBookRepository) GetByID(ctx context.Context, id int) (*models.Gues
 	return &msg, nil
 }
 
+// Neighbors returns the approved messages created just before and just after
+// the message identified by createdAt and id. The id breaks ties between
+// messages created at the same instant.
+func (r *GuestBookRepository) Neighbors(ctx context.Context, createdAt time.Time, id int) (*models.MessageNeighbors, error) {
+	previousQuery := `
+		SELECT ` + messageColumns + `
+		FROM guest_book_messages
+		WHERE status = 'approved' AND (created_at, id) < ($1, $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`
+	nextQuery := `
+		SELECT ` + messageColumns + `
+		FROM guest_book_messages
+		WHERE status = 'approved' AND (created_at, id) > ($1, $2)
+		ORDER BY created_at ASC, id ASC
+		LIMIT 1
+	`
+
+	previous, err := r.neighbor(ctx, previousQuery, createdAt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := r.neighbor(ctx, nextQuery, createdAt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MessageNeighbors{Previous: previous, Next: next}, nil
+}
+
+// neighbor runs one Neighbors query, returning nil when there is no row
+func (r *GuestBookRepository) neighbor(ctx context.Context, query string, createdAt time.Time, id int) (*models.GuestBookMessage, error) {
+	var msg models.GuestBookMessage
+	err := scanMessage(r.db.ReadPool().QueryRow(ctx, query, createdAt, id), &msg)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get neighboring guest book message: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// SetStatus changes a message's moderation status and returns the updated row
+func (r *GuestBookRepository) SetStatus(ctx context.Context, id int, status string) (*models.GuestBookMessage, error) {
+	query := `
+		UPDATE guest_book_messages
+		SET status = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + messageColumns
+
+	var msg models.GuestBookMessage
+	err := scanMessage(r.db.WritePool().QueryRow(ctx, query, id, status), &msg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to update guest book message status: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// Update changes only the fields present in patch, and the status unless it
+// is empty, and returns the updated row
+func (r *GuestBookRepository) Update(ctx context.Context, id int, patch *models.PatchGuestBookMessage, status string) (*models.GuestBookMessage, error) {
+	args := []any{id}
+	set := []string{"updated_at = NOW()"}
+	column := func(name string, value any) {
+		args = append(args, value)
+		set = append(set, fmt.Sprintf("%s = $%d", name, len(args)))
+	}
+
+	if patch.Name != nil {
+		column("name", *patch.Name)
+	}
+	if patch.Email != nil {
+		column("email", *patch.Email)
+	}
+	if patch.Message != nil {
+		column("message", *patch.Message)
+	}
+	if patch.Tags != nil {
+		column("tags", *patch.Tags)
+	}
+	if status != "" {
+		column("status", status)
+	}
+
+	query := `
+		UPDATE guest_book_messages
+		SET ` + strings.Join(set, ", ") + `
+		WHERE id = $1
+		RETURNING ` + messageColumns
+
+	var msg models.GuestBookMessage
+	err := scanMessage(r.db.WritePool().QueryRow(ctx, query, args...), &msg)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to update guest book message: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// DeleteByIDs deletes the messages with the given IDs in one statement and
+// returns how many rows were removed. The same statement records the time
+// of the delete, when it removed anything, for LastChangedAt. A delete
+// aborted by a conflicting transaction is retried under the DB's
+// RetryPolicy.
+func (r *GuestBookRepository) DeleteByIDs(ctx context.Context, ids []int) (int, error) {
+	query := `
+		WITH deleted AS (
+			DELETE FROM guest_book_messages WHERE id = ANY($1) RETURNING id
+		), recorded AS (
+			UPDATE guest_book_state SET last_deleted_at = NOW()
+			WHERE EXISTS (SELECT 1 FROM deleted)
+		)
+		SELECT COUNT(*) FROM deleted
+	`
+
+	var deleted int
+	err := r.db.WithRetry(ctx, func(ctx context.Context) error {
+		return r.db.WritePool().QueryRow(ctx, query, ids).Scan(&deleted)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete guest book messages: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// Exists reports whether a message with the given ID exists without fetching
+// the row. It reads from the primary because it guards mutations, which must
+// not be misled by replication lag.
+func (r *GuestBookRepository) Exists(ctx context.Context, id int) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM guest_book_messages WHERE id = $1)`
+
+	var exists bool
+	err := r.db.WritePool().QueryRow(ctx, query, id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check guest book message existence: %w", err)
+	}
+
+	return exists, nil
+}
+
+// Count returns the number of approved messages
 func (r *GuestBookRepository) Count(ctx context.Context) (int, error) {
-	query := `SELECT COUNT(*) FROM guest_book_messages`
+	return r.CountInTx(ctx, r.db.ReadPool())
+}
+
+// CountInTx is Count run through q, such as a snapshot from BeginSnapshot
+func (r *GuestBookRepository) CountInTx(ctx context.Context, q database.Querier) (int, error) {
+	query := `SELECT COUNT(*) FROM guest_book_messages WHERE status = 'approved'`
 
 	var count int
-	err := r.db.Pool.QueryRow(ctx, query).Scan(&count)
+	err := q.QueryRow(ctx, query).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count guest book messages: %w", err)
 	}
 
 	return count, nil
 }
+
+// CountByEmail returns the number of approved messages written with exactly
+// the given email address
+func (r *GuestBookRepository) CountByEmail(ctx context.Context, email string) (int, error) {
+	query := `SELECT COUNT(*) FROM guest_book_messages WHERE status = 'approved' AND email = $1`
+
+	var count int
+	err := r.db.ReadPool().QueryRow(ctx, query, email).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count guest book messages by email: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountAllByEmail returns the number of messages written with exactly the
+// given email address in any moderation status. It reads from the primary,
+// since it guards writes and must see the author's latest messages.
+func (r *GuestBookRepository) CountAllByEmail(ctx context.Context, email string) (int, error) {
+	query := `SELECT COUNT(*) FROM guest_book_messages WHERE email = $1`
+
+	var count int
+	err := r.db.WritePool().QueryRow(ctx, query, email).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count all guest book messages by email: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountByTag returns the number of approved messages carrying tag
+func (r *GuestBookRepository) CountByTag(ctx context.Context, tag string) (int, error) {
+	query := `SELECT COUNT(*) FROM guest_book_messages WHERE status = 'approved' AND tags @> ARRAY[$1]::text[]`
+
+	var count int
+	err := r.db.ReadPool().QueryRow(ctx, query, tag).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count guest book messages by tag: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountByStatus returns how many messages are in each moderation status,
+// in a single scan of the table
+func (r *GuestBookRepository) CountByStatus(ctx context.Context) (models.ModerationCounts, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE status = 'pending'),
+			COUNT(*) FILTER (WHERE status = 'approved'),
+			COUNT(*) FILTER (WHERE status = 'rejected')
+		FROM guest_book_messages
+	`
+
+	var counts models.ModerationCounts
+	err := r.db.ReadPool().QueryRow(ctx, query).Scan(&counts.Pending, &counts.Approved, &counts.Rejected)
+	if err != nil {
+		return models.ModerationCounts{}, fmt.Errorf("failed to count guest book messages by status: %w", err)
+	}
+
+	return counts, nil
+}
+
+// MessageLengthStats returns the minimum, average, maximum and median
+// length in characters of the approved messages, computed in one scan.
+// Every figure is zero when there are none.
+func (r *GuestBookRepository) MessageLengthStats(ctx context.Context) (models.MessageLengthStats, error) {
+	query := `
+		SELECT
+			COALESCE(MIN(length(message)), 0),
+			COALESCE(ROUND(AVG(length(message)), 2), 0)::float8,
+			COALESCE(MAX(length(message)), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY length(message)), 0)
+		FROM guest_book_messages
+		WHERE status = 'approved'
+	`
+
+	var stats models.MessageLengthStats
+	err := r.db.ReadPool().QueryRow(ctx, query).Scan(&stats.Min, &stats.Avg, &stats.Max, &stats.Median)
+	if err != nil {
+		return models.MessageLengthStats{}, fmt.Errorf("failed to compute message length stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// LastChangedAt returns the time of the most recent change to the guest
+// book: the latest updated_at across all messages, or the last delete when
+// that came later, since a deleted row leaves no updated_at behind. The
+// zero time is returned when nothing has been stored or deleted. Every
+// status is included so that rejecting a visible message still changes
+// the result.
+func (r *GuestBookRepository) LastChangedAt(ctx context.Context) (time.Time, error) {
+	query := `
+		SELECT GREATEST(
+			(SELECT MAX(updated_at) FROM guest_book_messages),
+			(SELECT last_deleted_at FROM guest_book_state)
+		)
+	`
+
+	var lastChangedAt *time.Time
+	err := r.db.ReadPool().QueryRow(ctx, query).Scan(&lastChangedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get latest guest book change: %w", err)
+	}
+
+	if lastChangedAt == nil {
+		return time.Time{}, nil
+	}
+
+	return *lastChangedAt, nil
+}
+
+// CountByDay returns per-day approved message counts for days (UTC) on or
+// after since. Days without messages are not included.
+func (r *GuestBookRepository) CountByDay(ctx context.Context, since time.Time) ([]models.DailyCount, error) {
+	query := `
+		SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AS day, COUNT(*)
+		FROM guest_book_messages
+		WHERE created_at >= $1 AND status = 'approved'
+		GROUP BY day
+		ORDER BY day
+	`
+
+	rows, err := r.db.ReadPool().Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count guest book messages by day: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]models.DailyCount, 0)
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan daily count: %w", err)
+		}
+		counts = append(counts, models.DailyCount{
+			Date:  day.Format(models.DateFormat),
+			Count: count,
+		})
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating daily counts: %w", rows.Err())
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,334 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/database"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// fakePool records the queries it receives. QueryRow returns the queued
+// rows in order, then rows that scan without populating their destinations.
+type fakePool struct {
+	queries int
+	sql     []string
+	rows    []pgx.Row
+}
+
+func (p *fakePool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	p.queries++
+	return pgconn.CommandTag{}, nil
+}
+
+func (p *fakePool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	p.queries++
+	return nil, pgx.ErrNoRows
+}
+
+func (p *fakePool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	p.queries++
+	p.sql = append(p.sql, sql)
+	if len(p.rows) > 0 {
+		row := p.rows[0]
+		p.rows = p.rows[1:]
+		return row
+	}
+	return fakeRow{}
+}
+
+// fakeRow scans err, or succeeds without populating anything when nil
+type fakeRow struct {
+	err error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	return r.err
+}
+
+// idRow scans id into the first destination
+type idRow struct {
+	id int
+}
+
+func (r idRow) Scan(dest ...any) error {
+	*dest[0].(*int) = r.id
+	return nil
+}
+
+func TestGuestBookRepository_ReadWriteSplit(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakePool{}
+	repo := NewGuestBookRepository(database.NewWithPools(primary, replica))
+	ctx := context.Background()
+
+	if _, err := repo.Count(ctx); err != nil {
+		t.Fatalf("Count returned error: %v", err)
+	}
+	if _, err := repo.GetByID(ctx, 1); err != nil {
+		t.Fatalf("GetByID returned error: %v", err)
+	}
+	repo.GetAll(ctx, 10, 0)
+	if _, err := repo.CountByEmail(ctx, "ada@example.com"); err != nil {
+		t.Fatalf("CountByEmail returned error: %v", err)
+	}
+	repo.GetByEmail(ctx, "ada@example.com", 10, 0)
+	if _, err := repo.CountByStatus(ctx); err != nil {
+		t.Fatalf("CountByStatus returned error: %v", err)
+	}
+	if _, err := repo.MessageLengthStats(ctx); err != nil {
+		t.Fatalf("MessageLengthStats returned error: %v", err)
+	}
+
+	if replica.queries != 7 {
+		t.Errorf("Expected 7 reads on replica, got %d", replica.queries)
+	}
+	if primary.queries != 0 {
+		t.Errorf("Expected no reads on primary, got %d", primary.queries)
+	}
+
+	msg := &models.CreateGuestBookMessage{Name: "Ada", Email: "ada@example.com", Message: "Hello there"}
+	if _, err := repo.Create(ctx, msg, models.StatusApproved); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if _, err := repo.SetStatus(ctx, 1, models.StatusRejected); err != nil {
+		t.Fatalf("SetStatus returned error: %v", err)
+	}
+	if _, err := repo.CountAllByEmail(ctx, "ada@example.com"); err != nil {
+		t.Fatalf("CountAllByEmail returned error: %v", err)
+	}
+	if _, err := repo.GetByIDFromPrimary(ctx, 1); err != nil {
+		t.Fatalf("GetByIDFromPrimary returned error: %v", err)
+	}
+
+	if primary.queries != 4 {
+		t.Errorf("Expected 2 writes and the write-guarding reads on primary, got %d", primary.queries)
+	}
+	if replica.queries != 7 {
+		t.Errorf("Expected writes to skip replica, got %d replica queries", replica.queries)
+	}
+}
+
+func TestGuestBookRepository_DeleteByIDs_RecordsLastChange(t *testing.T) {
+	primary := &fakePool{rows: []pgx.Row{idRow{id: 2}}}
+	replica := &fakePool{}
+	repo := NewGuestBookRepository(database.NewWithPools(primary, replica))
+	ctx := context.Background()
+
+	deleted, err := repo.DeleteByIDs(ctx, []int{1, 2})
+	if err != nil {
+		t.Fatalf("DeleteByIDs returned error: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted, got %d", deleted)
+	}
+	// The time must be recorded by the delete itself, or a crash between
+	// two statements could lose it
+	if len(primary.sql) != 1 || !strings.Contains(primary.sql[0], "UPDATE guest_book_state SET last_deleted_at") {
+		t.Errorf("Expected the delete to record its time in the same statement, got %q", primary.sql)
+	}
+
+	if _, err := repo.LastChangedAt(ctx); err != nil {
+		t.Fatalf("LastChangedAt returned error: %v", err)
+	}
+	if len(replica.sql) != 1 || !strings.Contains(replica.sql[0], "last_deleted_at") {
+		t.Errorf("Expected LastChangedAt to include the last delete, got %q", replica.sql)
+	}
+}
+
+func TestGuestBookRepository_MutationsOfMissingMessage(t *testing.T) {
+	// Updates return the row they changed, so a missing message is told
+	// apart by the absent row, without a separate existence check
+	primary := &fakePool{rows: []pgx.Row{fakeRow{err: pgx.ErrNoRows}, fakeRow{err: pgx.ErrNoRows}}}
+	repo := NewGuestBookRepository(database.NewWithPools(primary))
+	ctx := context.Background()
+
+	if _, err := repo.SetStatus(ctx, 99, models.StatusRejected); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected SetStatus to return ErrNotFound, got %v", err)
+	}
+	name := "Renamed"
+	if _, err := repo.Update(ctx, 99, &models.PatchGuestBookMessage{Name: &name}, ""); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected Update to return ErrNotFound, got %v", err)
+	}
+	if len(primary.sql) != 2 {
+		t.Errorf("Expected one statement per mutation, got %d", len(primary.sql))
+	}
+}
+
+func TestGuestBookRepository_Create_RetryReturnsOriginal(t *testing.T) {
+	// The insert hits the idempotency key conflict and returns no row, so the
+	// repository must fall back to the message created by the first attempt
+	primary := &fakePool{rows: []pgx.Row{fakeRow{err: pgx.ErrNoRows}, idRow{id: 7}}}
+	repo := NewGuestBookRepository(database.NewWithPools(primary))
+
+	msg := &models.CreateGuestBookMessage{
+		Name:           "Ada",
+		Email:          "ada@example.com",
+		Message:        "Hello there",
+		IdempotencyKey: "retry-1",
+	}
+
+	result, err := repo.Create(context.Background(), msg, models.StatusApproved)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if result.ID != 7 {
+		t.Errorf("Expected original message 7, got %d", result.ID)
+	}
+
+	if len(primary.sql) != 2 {
+		t.Fatalf("Expected insert then lookup, got %d queries", len(primary.sql))
+	}
+	if !strings.Contains(primary.sql[0], "ON CONFLICT (idempotency_key) DO NOTHING") {
+		t.Errorf("Expected insert to skip conflicting keys, got %q", primary.sql[0])
+	}
+	if !strings.Contains(primary.sql[1], "WHERE idempotency_key = $1") {
+		t.Errorf("Expected lookup by idempotency key, got %q", primary.sql[1])
+	}
+	// The service refuses replays whose body doesn't match the fingerprint
+	if !strings.Contains(primary.sql[1], "idempotency_fingerprint") {
+		t.Errorf("Expected the lookup to return the request fingerprint, got %q", primary.sql[1])
+	}
+}
+
+func TestGuestBookRepository_InTx(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakePool{}
+	snapshot := &fakePool{}
+	repo := NewGuestBookRepository(database.NewWithPools(primary, replica))
+	ctx := context.Background()
+
+	repo.GetAllInTx(ctx, snapshot, 10, 0)
+	if _, err := repo.CountInTx(ctx, snapshot); err != nil {
+		t.Fatalf("CountInTx returned error: %v", err)
+	}
+
+	if snapshot.queries != 2 {
+		t.Errorf("Expected both queries to run in the given querier, got %d", snapshot.queries)
+	}
+	if primary.queries != 0 || replica.queries != 0 {
+		t.Errorf("Expected the pools not to be queried, got %d on the primary and %d on the replica", primary.queries, replica.queries)
+	}
+}
+
+func TestGuestBookRepository_Create_RetriesSerializationFailure(t *testing.T) {
+	primary := &fakePool{rows: []pgx.Row{
+		fakeRow{err: &pgconn.PgError{Code: "40001"}},
+		idRow{id: 7},
+	}}
+	db := database.NewWithPools(primary)
+	db.SetRetryPolicy(database.RetryPolicy{Attempts: 3})
+	repo := NewGuestBookRepository(db)
+
+	msg, err := repo.Create(context.Background(), &models.CreateGuestBookMessage{Name: "Ada"}, models.StatusApproved)
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if msg.ID != 7 {
+		t.Errorf("Expected message 7, got %d", msg.ID)
+	}
+	if primary.queries != 2 {
+		t.Errorf("Expected 2 inserts, got %d", primary.queries)
+	}
+}
+
+func TestGuestBookRepository_Create_NoKeyDoesNotRetryLookup(t *testing.T) {
+	primary := &fakePool{rows: []pgx.Row{fakeRow{err: pgx.ErrNoRows}}}
+	repo := NewGuestBookRepository(database.NewWithPools(primary))
+
+	msg := &models.CreateGuestBookMessage{Name: "Ada", Email: "ada@example.com", Message: "Hello there"}
+
+	if _, err := repo.Create(context.Background(), msg, models.StatusApproved); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows without an idempotency key, got %v", err)
+	}
+	if primary.queries != 1 {
+		t.Errorf("Expected a single query, got %d", primary.queries)
+	}
+}
+
+func TestGuestBookRepository_Neighbors_Boundaries(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakePool{rows: []pgx.Row{idRow{id: 4}, fakeRow{err: pgx.ErrNoRows}}}
+	repo := NewGuestBookRepository(database.NewWithPools(primary, replica))
+
+	neighbors, err := repo.Neighbors(context.Background(), time.Now(), 5)
+	if err != nil {
+		t.Fatalf("Neighbors returned error: %v", err)
+	}
+
+	if neighbors.Previous == nil || neighbors.Previous.ID != 4 {
+		t.Errorf("Expected previous message 4, got %+v", neighbors.Previous)
+	}
+	if neighbors.Next != nil {
+		t.Errorf("Expected no next message at the boundary, got %+v", neighbors.Next)
+	}
+	if replica.queries != 2 || primary.queries != 0 {
+		t.Errorf("Expected 2 replica queries and none on the primary, got %d and %d", replica.queries, primary.queries)
+	}
+}
+
+func TestGuestBookRepository_MaxOffset(t *testing.T) {
+	pool := &fakePool{}
+	repo := NewGuestBookRepository(database.NewWithPools(pool))
+	repo.SetMaxOffset(1000)
+	ctx := context.Background()
+
+	lists := map[string]func(offset int) error{
+		"GetAll": func(offset int) error {
+			_, err := repo.GetAll(ctx, 10, offset)
+			return err
+		},
+		"StreamAll": func(offset int) error {
+			for _, err := range repo.StreamAll(ctx, 10, offset) {
+				return err
+			}
+			return nil
+		},
+		"GetByEmail": func(offset int) error {
+			_, err := repo.GetByEmail(ctx, "ada@example.com", 10, offset)
+			return err
+		},
+		"GetByTag": func(offset int) error {
+			_, err := repo.GetByTag(ctx, "greeting", 10, offset)
+			return err
+		},
+		"GetByStatus": func(offset int) error {
+			_, err := repo.GetByStatus(ctx, models.StatusPending, 10, offset)
+			return err
+		},
+	}
+
+	for name, list := range lists {
+		t.Run(name, func(t *testing.T) {
+			// At the cap the query runs; the fake pool fails it
+			pool.queries = 0
+			if err := list(1000); errors.Is(err, apperrors.ErrInvalidInput) || pool.queries != 1 {
+				t.Errorf("Expected offset 1000 to be queried, got %v after %d queries", err, pool.queries)
+			}
+
+			pool.queries = 0
+			err := list(1001)
+			if !errors.Is(err, apperrors.ErrInvalidInput) || !strings.Contains(err.Error(), "pagination too deep") {
+				t.Errorf("Expected offset 1001 to be rejected as too deep, got %v", err)
+			}
+			if pool.queries != 0 {
+				t.Errorf("Expected no query beyond the cap, got %d", pool.queries)
+			}
+		})
+	}
+
+	// Without a cap any offset is queried
+	repo.SetMaxOffset(0)
+	pool.queries = 0
+	repo.GetAll(ctx, 10, 1_000_000)
+	if pool.queries != 1 {
+		t.Errorf("Expected an uncapped offset to be queried, got %d queries", pool.queries)
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+
+	// accessLogTimeFormat is the Apache %t timestamp layout
+	accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// accessLogStream returns the standard stream named by output, "stdout" or
+// "stderr" (the default when empty), or nil when output is a file path to be
+// opened by openAccessLog
+func accessLogStream(output string) io.Writer {
+	switch output {
+	case "", "stderr":
+		return os.Stderr
+	case "stdout":
+		return os.Stdout
+	}
+	return nil
+}
+
+// openAccessLog opens the LOG_ACCESS_OUTPUT file for appending when access
+// logs are enabled and no other writer was chosen. The file is closed on
+// Shutdown.
+func (s *Server) openAccessLog() error {
+	if s.accessLog != nil || s.config.Log.AccessFormat == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(s.config.Log.AccessOutput, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	s.accessLog = file
+	s.accessLogFile = file
+	return nil
+}
+
+// writeAccessLog writes a single request line in Apache Common or Combined
+// Log Format to w. Nothing is written while w is nil, before an access log
+// file has been opened.
+func writeAccessLog(w io.Writer, format string, r *http.Request, rw *responseWriter, start time.Time) {
+	if w == nil {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	user := "-"
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		user = username
+	}
+
+	size := "-"
+	if rw.size > 0 {
+		size = strconv.Itoa(rw.size)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		dashIfEmpty(host),
+		user,
+		start.Format(accessLogTimeFormat),
+		r.Method,
+		r.URL.RequestURI(),
+		r.Proto,
+		rw.Status(),
+		size,
+	)
+
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(" %q %q", dashIfEmpty(r.Referer()), dashIfEmpty(r.UserAgent()))
+	}
+
+	fmt.Fprintln(w, line)
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/app/internal/handlers"
+)
+
+// apiResource is a path in the API index with the methods it serves
+type apiResource struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+// apiIndex is the body of OPTIONS / and OPTIONS /api/v1
+type apiIndex struct {
+	Resources []apiResource `json:"resources"`
+}
+
+// apiIndexHandler answers OPTIONS on the root and API paths with the
+// resources under that path, read from the router so the index can't drift
+// from the registered routes. CORS preflights are answered by the CORS
+// middleware before this runs.
+func (s *Server) apiIndexHandler(w http.ResponseWriter, r *http.Request) {
+	resources := s.apiResources(r.URL.Path)
+
+	w.Header().Set("Allow", strings.Join(append(s.allowedMethods(r), http.MethodOptions), ", "))
+	handlers.RespondJSON(w, http.StatusOK, apiIndex{Resources: resources})
+}
+
+// apiResources lists the routes whose path starts with prefix, sorted by
+// path. Routes without a path or methods, such as subrouter prefixes and
+// the OPTIONS catch-all, aren't resources; OPTIONS itself is left out of
+// each resource's methods since every resource answers it.
+func (s *Server) apiResources(prefix string) []apiResource {
+	byPath := make(map[string][]string)
+	// The walk function never fails, so neither does Walk
+	s.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			if method != http.MethodOptions && !slices.Contains(byPath[path], method) {
+				byPath[path] = append(byPath[path], method)
+			}
+		}
+		return nil
+	})
+
+	resources := make([]apiResource, 0, len(byPath))
+	for path, methods := range byPath {
+		if len(methods) == 0 {
+			continue
+		}
+		slices.Sort(methods)
+		resources = append(resources, apiResource{Path: path, Methods: methods})
+	}
+	slices.SortFunc(resources, func(a, b apiResource) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return resources
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// maxLoggedBodyBytes caps how much of a request body is read for logging
+const maxLoggedBodyBytes = 4096
+
+// secretFieldMarkers are substrings of JSON field names whose values are
+// redacted from logged bodies
+var secretFieldMarkers = []string{"password", "secret", "token", "authorization", "api_key", "apikey", "salt"}
+
+// requestBodyLogMiddleware logs the JSON bodies of write requests when both
+// DEBUG and LOG_REQUEST_BODIES are on. Bodies larger than maxLoggedBodyBytes
+// or that aren't valid JSON are not logged, since they can't be redacted.
+func (s *Server) requestBodyLogMiddleware(next http.Handler) http.Handler {
+	if !s.config.Debug || !s.config.LogRequestBodies {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBodyBytes+1))
+
+		// Hand the handler the bytes already read followed by the rest
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+
+		if err != nil {
+			slog.Debug("Failed to read request body for logging", "path", r.URL.Path, "error", err)
+		} else {
+			logRequestBody(r, buf)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logRequestBody logs body with secret-looking fields redacted
+func logRequestBody(r *http.Request, body []byte) {
+	attrs := []any{"method", r.Method, "path", r.URL.Path}
+
+	var payload interface{}
+	switch {
+	case len(body) > maxLoggedBodyBytes:
+		attrs = append(attrs, "body_omitted", "larger than limit")
+	case json.Unmarshal(body, &payload) != nil:
+		attrs = append(attrs, "body_omitted", "not valid JSON", "bytes", len(body))
+	default:
+		redacted, _ := json.Marshal(redactSecrets(payload))
+		attrs = append(attrs, "body", string(redacted))
+	}
+
+	slog.Debug("Request body", attrs...)
+}
+
+// redactSecrets replaces the values of secret-looking fields, at any depth
+func redactSecrets(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isSecretField(key) {
+				v[key] = "***"
+			} else {
+				v[key] = redactSecrets(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactSecrets(value)
+		}
+	}
+	return v
+}
+
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, marker := range secretFieldMarkers {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// cacheable wraps a public read handler so shared caches and browsers may
+// reuse successful responses for CACHE_CONTROL_MAX_AGE. Error responses
+// get no-cache so a transient failure is never served from a cache. With
+// no max age configured, responses are left alone.
+func (s *Server) cacheable(next http.HandlerFunc) http.HandlerFunc {
+	maxAge := int(s.config.CacheControlMaxAge.Seconds())
+	if maxAge <= 0 {
+		return next
+	}
+
+	policy := fmt.Sprintf("public, max-age=%d", maxAge)
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&cacheControlWriter{ResponseWriter: w, policy: policy}, r)
+	}
+}
+
+// cacheControlWriter sets Cache-Control from the status code as the header
+// is written, unless the handler set one itself
+type cacheControlWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.Header().Get("Cache-Control") == "" {
+			// 304s carry the same policy as the 200 they stand in for
+			if status < http.StatusBadRequest {
+				w.Header().Set("Cache-Control", w.policy)
+			} else {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
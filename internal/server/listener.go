@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor systemd passes with socket
+// activation; a variable so tests can pass one of their own
+var listenFDsStart = 3
+
+// systemdListener returns the first socket passed by systemd socket
+// activation, or nil when none was passed to this process. The LISTEN_*
+// variables are unset, as sd_listen_fds does, so child processes don't
+// try to use the socket too.
+func systemdListener() (net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if fds == "" {
+		return nil, nil
+	}
+	// The sockets are meant for the process systemd started, not for
+	// another that inherited its environment
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q: must be a positive number", fds)
+	}
+	if n > 1 {
+		slog.Warn("systemd passed more than one socket; serving on the first", "count", n)
+	}
+
+	file := os.NewFile(uintptr(listenFDsStart), "systemd-socket")
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use the systemd socket: %w", err)
+	}
+	return listener, nil
+}
+
+// listen returns the listener the API is served on: the systemd socket
+// when SYSTEMD_SOCKET is set and one was passed, otherwise a new one bound
+// to the configured address
+func (s *Server) listen() (net.Listener, error) {
+	if s.config.SystemdSocket {
+		listener, err := systemdListener()
+		if err != nil {
+			return nil, err
+		}
+		if listener != nil {
+			slog.Info("Using the socket passed by systemd", "address", listener.Addr().String())
+			return listener, nil
+		}
+		slog.Warn("SYSTEMD_SOCKET is set but systemd passed no socket; binding the address instead", "address", s.server.Addr)
+	}
+
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	return listener, nil
+}
+
+// serve serves the API on listener in the background until Shutdown
+func (s *Server) serve(listener net.Listener) {
+	s.runBackground("http server", func(ctx context.Context) {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Failed to start server", "error", err)
+		}
+	})
+}
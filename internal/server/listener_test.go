@@ -0,0 +1,108 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/config"
+)
+
+// passSocket stands in for systemd: it opens a socket and sets up the
+// environment and descriptor systemdListener reads, as if for pid. It
+// returns the socket's address and descriptor, which systemdListener
+// closes when it uses it.
+func passSocket(t *testing.T, pid int) (net.Addr, int) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get the socket's file: %v", err)
+	}
+	defer file.Close()
+
+	// A descriptor of its own, since systemdListener closes the one passed
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to dup the socket: %v", err)
+	}
+
+	previous := listenFDsStart
+	listenFDsStart = fd
+	t.Cleanup(func() { listenFDsStart = previous })
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(pid))
+	t.Setenv("LISTEN_FDS", "1")
+	return listener.Addr(), fd
+}
+
+func TestServer_Listen_SystemdSocket(t *testing.T) {
+	addr, _ := passSocket(t, os.Getpid())
+	server := NewServer(config.Config{Port: "0", SystemdSocket: true})
+
+	listener, err := server.listen()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer listener.Close()
+
+	if listener.Addr().String() != addr.String() {
+		t.Errorf("Expected the systemd socket %s, got %s", addr, listener.Addr())
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("Expected LISTEN_FDS to be unset")
+	}
+}
+
+func TestServer_Listen_BindsWithoutSystemdSocket(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		// pid is the process a socket is passed for; 0 passes none
+		pid int
+	}{
+		{name: "Not enabled", cfg: config.Config{Port: "0"}, pid: os.Getpid()},
+		{name: "No socket passed", cfg: config.Config{Port: "0", SystemdSocket: true}},
+		{name: "Socket for another process", cfg: config.Config{Port: "0", SystemdSocket: true}, pid: os.Getpid() + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var passed net.Addr
+			if tt.pid != 0 {
+				var fd int
+				passed, fd = passSocket(t, tt.pid)
+				defer syscall.Close(fd)
+			}
+			server := NewServer(tt.cfg)
+
+			listener, err := server.listen()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer listener.Close()
+
+			if passed != nil && listener.Addr().String() == passed.String() {
+				t.Errorf("Expected a new socket, got the passed one at %s", passed)
+			}
+		})
+	}
+}
+
+func TestSystemdListener_InvalidFDs(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "none")
+
+	if _, err := systemdListener(); err == nil {
+		t.Error("Expected an error for an invalid LISTEN_FDS")
+	}
+}
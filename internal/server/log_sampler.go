@@ -0,0 +1,31 @@
+package server
+
+import "sync/atomic"
+
+// samplerScale is the resolution of a sample rate: rates are kept in
+// millionths so that counting stays exact
+const samplerScale = 1_000_000
+
+// logSampler deterministically picks a fraction of events to log. Each
+// event adds the rate to a running total, and an event is sampled whenever
+// the total crosses a whole number, so a rate of 0.25 logs exactly every
+// fourth event rather than roughly a quarter of them.
+type logSampler struct {
+	step  uint64
+	total atomic.Uint64
+}
+
+// newLogSampler creates a sampler for rate, which is clamped to [0, 1]
+func newLogSampler(rate float64) *logSampler {
+	rate = min(max(rate, 0), 1)
+	return &logSampler{step: uint64(rate * samplerScale)}
+}
+
+// Sample reports whether the next event should be logged
+func (s *logSampler) Sample() bool {
+	if s.step == samplerScale {
+		return true
+	}
+	total := s.total.Add(s.step)
+	return total/samplerScale != (total-s.step)/samplerScale
+}
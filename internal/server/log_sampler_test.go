@@ -0,0 +1,72 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLogSampler_Rate(t *testing.T) {
+	tests := []struct {
+		rate     float64
+		events   int
+		expected int
+	}{
+		{rate: 1, events: 1000, expected: 1000},
+		{rate: 0, events: 1000, expected: 0},
+		{rate: 0.5, events: 1000, expected: 500},
+		{rate: 0.25, events: 1000, expected: 250},
+		{rate: 0.1, events: 1000, expected: 100},
+		{rate: 0.001, events: 10000, expected: 10},
+		{rate: 1.5, events: 10, expected: 10},
+		{rate: -1, events: 10, expected: 0},
+	}
+
+	for _, tt := range tests {
+		sampler := newLogSampler(tt.rate)
+		sampled := 0
+		for i := 0; i < tt.events; i++ {
+			if sampler.Sample() {
+				sampled++
+			}
+		}
+		if sampled != tt.expected {
+			t.Errorf("Rate %g: expected %d of %d events sampled, got %d", tt.rate, tt.expected, tt.events, sampled)
+		}
+	}
+}
+
+func TestLogSampler_Spacing(t *testing.T) {
+	sampler := newLogSampler(0.25)
+
+	for i := 1; i <= 12; i++ {
+		if got, expected := sampler.Sample(), i%4 == 0; got != expected {
+			t.Errorf("Event %d: expected sampled=%v, got %v", i, expected, got)
+		}
+	}
+}
+
+func TestLogSampler_Concurrent(t *testing.T) {
+	sampler := newLogSampler(0.1)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sampled := 0
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if sampler.Sample() {
+					mu.Lock()
+					sampled++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sampled != 100 {
+		t.Errorf("Expected 100 of 1000 concurrent events sampled, got %d", sampled)
+	}
+}
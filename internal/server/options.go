@@ -0,0 +1,50 @@
+package server
+
+import (
+	"io"
+
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/app/internal/database"
+)
+
+// Option customizes a Server created by NewServer
+type Option func(*Server)
+
+// WithDB uses db instead of connecting on Start. The server takes ownership
+// and closes db on Shutdown.
+func WithDB(db *database.DB) Option {
+	return func(s *Server) {
+		s.db = db
+	}
+}
+
+// WithRouter serves routes from r instead of a new router
+func WithRouter(r *mux.Router) Option {
+	return func(s *Server) {
+		s.router = r
+	}
+}
+
+// WithoutCORS leaves out the CORS middleware, for deployments where a
+// proxy in front of the server handles CORS. CORS_ENABLED=false does the
+// same.
+func WithoutCORS() Option {
+	return func(s *Server) {
+		s.corsDisabled = true
+	}
+}
+
+// WithMiddleware adds middleware as if passed to Server.Use
+func WithMiddleware(mw ...mux.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.Use(mw...)
+	}
+}
+
+// WithAccessLog writes Apache-style access logs to w instead of
+// LOG_ACCESS_OUTPUT
+func WithAccessLog(w io.Writer) Option {
+	return func(s *Server) {
+		s.accessLog = w
+	}
+}
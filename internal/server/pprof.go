@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// newPprofHandler serves the net/http/pprof endpoints under /debug/pprof.
+// It is mounted on its own listener so profiles are never reachable through
+// the public API port.
+func newPprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -2,14 +2,27 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/moabdelazem/app/internal/apperrors"
 	"github.com/moabdelazem/app/internal/config"
 	"github.com/moabdelazem/app/internal/database"
 	"github.com/moabdelazem/app/internal/handlers"
+	"github.com/moabdelazem/app/internal/models"
 	"github.com/moabdelazem/app/internal/repository"
 	"github.com/moabdelazem/app/internal/service"
 )
@@ -20,26 +33,110 @@ type Server struct {
 	server           *http.Server
 	db               *database.DB
 	guestBookHandler *handlers.GuestBookHandler
+	accessLog        io.Writer
+	// accessLogFile is the LOG_ACCESS_OUTPUT file accessLog writes to, if
+	// any; see openAccessLog
+	accessLogFile *os.File
+	// logSampler picks which successful requests get a "Request completed" log
+	logSampler *logSampler
+	// tasks runs background work such as audit writes; drained on Shutdown
+	tasks *taskPool
+	// inflight is a semaphore bounding concurrent requests; nil when unlimited
+	inflight chan struct{}
+	// pprofServer serves profiling endpoints on a separate address; nil
+	// unless ENABLE_PPROF is set
+	pprofServer *http.Server
+	// corsDisabled leaves out the CORS middleware; see WithoutCORS and
+	// CORS_ENABLED
+	corsDisabled bool
+	// middleware is added with Use and applied after the built-in middleware
+	middleware []mux.MiddlewareFunc
+	// startedAt is when the server was created, for the runtime endpoint
+	startedAt time.Time
+	// shuttingDown is set when Shutdown starts so /readyz fails while
+	// in-flight requests drain
+	shuttingDown atomic.Bool
+
+	// ctx is cancelled on shutdown to stop background goroutines, which
+	// are tracked by wg
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-func NewServer(cfg config.Config) *Server {
-	r := mux.NewRouter()
-	return &Server{
-		router: r,
-		config: cfg,
+// NewServer creates a server for cfg. With no options it builds its own
+// router and connects to the database on Start.
+func NewServer(cfg config.Config, opts ...Option) *Server {
+	// Indented responses are easier to read by hand but cost bytes in production
+	handlers.SetPrettyJSON(cfg.Debug)
+	handlers.SetJSONCharset(cfg.JSONCharset)
+	models.SetStringIDs(cfg.StringIDs)
+
+	var inflight chan struct{}
+	if cfg.MaxInflight > 0 {
+		inflight = make(chan struct{}, cfg.MaxInflight)
+	}
+
+	var pprofServer *http.Server
+	if cfg.PprofEnabled {
+		// No write timeout: CPU profiles and traces stream for as long as requested
+		pprofServer = &http.Server{
+			Addr:        cfg.PprofAddress,
+			Handler:     newPprofHandler(),
+			ReadTimeout: 15 * time.Second,
+			IdleTimeout: 60 * time.Second,
+		}
+	}
+
+	// h2c serves HTTP/2 without TLS for proxies that terminate TLS and
+	// speak HTTP/2 to the backend. HTTP/1.1 stays available either way, and
+	// the server timeouts apply to both.
+	var protocols *http.Protocols
+	if cfg.H2C {
+		protocols = new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		router:       mux.NewRouter(),
+		config:       cfg,
+		corsDisabled: cfg.CORS.Disabled,
 		server: &http.Server{
-			Addr:         ":" + cfg.Port,
-			Handler:      r,
+			Addr:         cfg.Address(),
 			ReadTimeout:  15 * time.Second,
 			WriteTimeout: 15 * time.Second,
 			IdleTimeout:  60 * time.Second,
+			Protocols:    protocols,
 		},
+		accessLog:   accessLogStream(cfg.Log.AccessOutput),
+		tasks:       newTaskPool(cfg.AsyncWorkers, cfg.AsyncQueueSize),
+		logSampler:  newLogSampler(cfg.Log.SampleRate),
+		inflight:    inflight,
+		pprofServer: pprofServer,
+		startedAt:   time.Now(),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.server.Handler = s.router
+	if s.db != nil {
+		s.guestBookHandler = handlers.NewGuestBookHandler(s.db, cfg, s.tasks)
 	}
+
+	return s
 }
 
 func (s *Server) RegisterRoutes() {
 	// API v1 routes
 	api := s.router.PathPrefix("/api/v1").Subrouter()
+	api.Use(s.responseVersionMiddleware)
 
 	// Root endpoint - API information
 	s.router.HandleFunc("/", handlers.APIInfoHandler).Methods("GET")
@@ -47,61 +144,580 @@ func (s *Server) RegisterRoutes() {
 	// Health endpoint (basic)
 	s.router.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
 
-	// Health endpoint with database check
-	api.HandleFunc("/health", handlers.HealthHandlerWithDB(s.db)).Methods("GET")
+	// Health endpoint reporting each dependency
+	api.HandleFunc("/health", handlers.ComponentHealthHandler(s.healthCheckTimeout(), s.healthCheckers()...)).Methods("GET")
+
+	// GET /api/v1/runtime - Uptime, goroutines and memory; internals, so
+	// only for admins
+	api.Handle("/runtime", s.adminAuthMiddleware(handlers.RuntimeHandler(s.startedAt))).Methods("GET")
+
+	// Readiness endpoint for load balancers
+	s.router.HandleFunc("/readyz", handlers.ReadinessHandler(s.readinessChecks()...)).Methods("GET")
+
+	// OpenAPI specification for client code generation
+	s.router.HandleFunc("/openapi.json", handlers.OpenAPIHandler).Methods("GET")
 
-	// Guest book endpoints
+	// Browsers and crawlers ask for these; answering keeps them out of the
+	// not-found logs
+	s.router.HandleFunc("/favicon.ico", handlers.FaviconHandler).Methods("GET")
+	s.router.HandleFunc("/robots.txt", handlers.RobotsHandler(s.robotsTxt())).Methods("GET")
+
+	// Guest book endpoints. Public reads may be cached; see cacheable.
 	// GET /api/v1/guestbook - Get all messages with pagination
-	api.HandleFunc("/guestbook", s.guestBookHandler.GetGuestBookMessages).Methods("GET")
+	api.HandleFunc("/guestbook", s.cacheable(s.guestBookHandler.GetGuestBookMessages)).Methods("GET").Name(streamingRoute)
 
 	// POST /api/v1/guestbook - Create a new message
 	api.HandleFunc("/guestbook", s.guestBookHandler.CreateGuestBookMessage).Methods("POST")
 
+	// Optional endpoints are only registered when their feature is enabled
+	if s.config.Features.EnableStats {
+		// GET /api/v1/guestbook/count - Get the total number of messages
+		api.HandleFunc("/guestbook/count", s.cacheable(s.guestBookHandler.GetGuestBookCount)).Methods("GET")
+
+		// GET /api/v1/guestbook/timeline - Get daily message counts
+		api.HandleFunc("/guestbook/timeline", s.cacheable(s.guestBookHandler.GetGuestBookTimeline)).Methods("GET")
+
+		// GET /api/v1/stats/message-lengths - Get message length statistics
+		api.HandleFunc("/stats/message-lengths", s.cacheable(s.guestBookHandler.GetMessageLengthStats)).Methods("GET")
+	}
+
+	if s.config.Features.EnableSearch {
+		// GET /api/v1/guestbook/search - Full-text search ranked by relevance
+		api.HandleFunc("/guestbook/search", s.cacheable(s.guestBookHandler.SearchGuestBookMessages)).Methods("GET")
+	}
+
 	// GET /api/v1/guestbook/{id} - Get specific message (only numeric IDs)
-	api.HandleFunc("/guestbook/{id:[0-9]+}", s.guestBookHandler.GetGuestBookMessage).Methods("GET")
+	api.HandleFunc("/guestbook/{id:[0-9]+}", s.cacheable(s.guestBookHandler.GetGuestBookMessage)).Methods("GET")
+
+	// GET /api/v1/guestbook/{id}/raw - Get just the message text as text/plain
+	api.HandleFunc("/guestbook/{id:[0-9]+}/raw", s.cacheable(s.guestBookHandler.GetGuestBookMessageRaw)).Methods("GET")
+
+	// PATCH /api/v1/guestbook/{id} - Update only the fields in the body
+	api.HandleFunc("/guestbook/{id:[0-9]+}", s.guestBookHandler.PatchGuestBookMessage).Methods("PATCH")
+
+	if s.config.Features.EnableNeighbors {
+		// GET /api/v1/guestbook/{id}/neighbors - Get the previous and next messages
+		api.HandleFunc("/guestbook/{id:[0-9]+}/neighbors", s.cacheable(s.guestBookHandler.GetGuestBookMessageNeighbors)).Methods("GET")
+	}
+
+	// Admin endpoints, protected by the admin bearer token
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(s.adminAuthMiddleware)
+
+	// DELETE /api/v1/admin/guestbook - Delete messages by ID in a batch
+	admin.HandleFunc("/guestbook", s.guestBookHandler.DeleteGuestBookMessages).Methods("DELETE")
+
+	// GET /api/v1/admin/guestbook/pending - Messages awaiting moderation
+	admin.HandleFunc("/guestbook/pending", s.guestBookHandler.GetPendingGuestBookMessages).Methods("GET")
+
+	// GET /api/v1/admin/guestbook/{id} - Get any message with its metadata
+	admin.HandleFunc("/guestbook/{id:[0-9]+}", s.guestBookHandler.GetAdminGuestBookMessage).Methods("GET")
+
+	// PATCH /api/v1/admin/guestbook/{id}/status - Moderate a message
+	admin.HandleFunc("/guestbook/{id:[0-9]+}/status", s.guestBookHandler.UpdateGuestBookMessageStatus).Methods("PATCH")
+
+	if s.config.Features.EnableAPIIndex {
+		// OPTIONS / and /api/v1 - Index of the resources and their methods
+		s.router.HandleFunc("/", s.apiIndexHandler).Methods(http.MethodOptions)
+		s.router.HandleFunc("/api/v1", s.apiIndexHandler).Methods(http.MethodOptions)
+	}
+
+	// OPTIONS /{path} - CORS preflight, only for paths that have a route.
+	// Registered last so it never shadows an explicit route.
+	s.router.Methods(http.MethodOptions).MatcherFunc(s.preflightMatcher).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The CORS middleware answers preflight requests before this runs
+		w.Header().Set("Allow", strings.Join(append(s.allowedMethods(r), http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusOK)
+	})
 
 	// Set custom 404 and 405 handlers
-	s.router.NotFoundHandler = http.HandlerFunc(handlers.NotFoundHandler)
-	s.router.MethodNotAllowedHandler = http.HandlerFunc(handlers.MethodNotAllowedHandler)
+	s.router.NotFoundHandler = http.HandlerFunc(s.notFoundHandler)
+	s.router.MethodNotAllowedHandler = http.HandlerFunc(s.methodNotAllowedHandler)
 
 	// Add middleware for logging
 	s.router.Use(s.loggingMiddleware)
 
+	// Harden every response, before anything can answer early
+	if s.config.Security.Enabled {
+		s.router.Use(s.securityHeadersMiddleware)
+	}
+
+	// Cap handler run time
+	s.router.Use(s.timeoutMiddleware)
+
+	// Honor the client's own, shorter timeout
+	s.router.Use(s.clientTimeoutMiddleware)
+
+	// Shed load beyond the in-flight request limit
+	s.router.Use(s.inflightLimitMiddleware)
+
 	// Add CORS middleware
-	s.router.Use(s.corsMiddleware)
+	if !s.corsDisabled {
+		s.router.Use(s.corsMiddleware)
+	}
+
+	// Block writes during maintenance windows
+	s.router.Use(s.readOnlyMiddleware)
+
+	// Require JSON bodies on writes
+	s.router.Use(s.requireJSONMiddleware)
+
+	// Log write request bodies in debug mode, when enabled
+	s.router.Use(s.requestBodyLogMiddleware)
+
+	// Caller-supplied middleware runs innermost, in registration order
+	s.router.Use(s.middleware...)
+}
+
+// Use adds middleware, such as auth or tracing, to every route. It must be
+// called before Start; middleware runs after the built-in middleware, in
+// the order it was added.
+func (s *Server) Use(mw ...mux.MiddlewareFunc) {
+	s.middleware = append(s.middleware, mw...)
+}
+
+// routeMethods are the methods probed when working out which methods a
+// path supports
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods returns the methods that have a route for r's path
+func (s *Server) allowedMethods(r *http.Request) []string {
+	var allowed []string
+	for _, method := range routeMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		// The router reports unmatched requests as matched by the 404/405
+		// handlers, so only a match without an error counts
+		var match mux.RouteMatch
+		if s.router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// preflightMatcher matches an OPTIONS request when a route serves the
+// requested method (or any method, outside a CORS preflight) on the same
+// path. Unknown paths then fall through to the 404 handler and disallowed
+// methods to the 405 handler.
+func (s *Server) preflightMatcher(r *http.Request, _ *mux.RouteMatch) bool {
+	// mux keeps evaluating matchers after a method mismatch, so probes with
+	// other methods would otherwise recurse back into this matcher
+	if r.Method != http.MethodOptions {
+		return false
+	}
+
+	allowed := s.allowedMethods(r)
+	if requested := r.Header.Get("Access-Control-Request-Method"); requested != "" {
+		return slices.Contains(allowed, requested)
+	}
+	return len(allowed) > 0
+}
+
+// notFoundHandler serves 405 instead when the path exists
+// under other methods. mux reports method mismatches under a subrouter as
+// not found whenever a later route shares the subrouter's prefix.
+func (s *Server) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	if len(s.allowedMethods(r)) > 0 {
+		s.methodNotAllowedHandler(w, r)
+		return
+	}
+
+	if target, ok := s.trailingSlashTarget(r); ok {
+		// 308 rather than 301 so clients repeat POSTs instead of turning
+		// them into GETs
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+		return
+	}
+
+	handlers.NotFoundHandler(w, r)
+}
+
+// trailingSlashTarget returns r's URL without its trailing slash when
+// TRAILING_SLASH=redirect and a route exists for that path
+func (s *Server) trailingSlashTarget(r *http.Request) (string, bool) {
+	if s.config.TrailingSlash == "strict" || r.URL.Path == "/" || !strings.HasSuffix(r.URL.Path, "/") {
+		return "", false
+	}
+
+	u := *r.URL
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	if u.Path == "" {
+		return "", false
+	}
+
+	probe := r.Clone(r.Context())
+	probe.URL = &u
+	if len(s.allowedMethods(probe)) == 0 {
+		return "", false
+	}
+
+	return u.RequestURI(), true
+}
+
+// methodNotAllowedHandler serves 405 listing the path's methods in Allow
+func (s *Server) methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", strings.Join(s.allowedMethods(r), ", "))
+	handlers.MethodNotAllowedHandler(w, r)
+}
+
+// breakerCheck fails while the database circuit breaker is open, so the
+// instance leaves the load balancer until the breaker lets queries through
+func (s *Server) breakerCheck(ctx context.Context) error {
+	if state := s.db.BreakerState(); state == database.BreakerOpen {
+		return fmt.Errorf("database circuit breaker is %s", state)
+	}
+	return nil
+}
+
+// defaultHealthCheckTimeout bounds how long /api/v1/health waits for its
+// checkers when HEALTH_CHECK_TIMEOUT isn't set
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// healthCheckTimeout returns the configured health check timeout
+func (s *Server) healthCheckTimeout() time.Duration {
+	if s.config.HealthCheckTimeout <= 0 {
+		return defaultHealthCheckTimeout
+	}
+	return s.config.HealthCheckTimeout
+}
+
+// healthCheckers returns the components /api/v1/health reports on. Register
+// new dependencies here.
+func (s *Server) healthCheckers() []handlers.HealthChecker {
+	return []handlers.HealthChecker{
+		handlers.NewHealthChecker("database", s.db.Health),
+	}
+}
+
+// readinessChecks returns the dependency checks /readyz runs, in order
+func (s *Server) readinessChecks() []handlers.ReadinessCheck {
+	checks := []handlers.ReadinessCheck{
+		{Name: "shutdown", Check: s.shutdownCheck},
+		{Name: "database_breaker", Check: s.breakerCheck},
+		{Name: "database", Check: s.db.Health},
+	}
+
+	if s.config.DB.WarmupQuery {
+		checks = append(checks, handlers.WarmQueryCheck(s.config.DB.WarmupQueryThreshold, func(ctx context.Context) error {
+			_, err := repository.NewGuestBookRepository(s.db).Count(ctx)
+			return err
+		}))
+	}
+
+	if s.config.TempDir != "" {
+		checks = append(checks, handlers.TempDirWritableCheck(s.config.TempDir))
+	}
+
+	return checks
+}
+
+// shutdownCheck fails once Shutdown has started
+func (s *Server) shutdownCheck(ctx context.Context) error {
+	if s.shuttingDown.Load() {
+		return errors.New("server is shutting down")
+	}
+	return nil
 }
 
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+
+		// Slow requests are always logged, whatever the sampling
+		duration := time.Since(start)
+		slow := s.config.Log.SlowThreshold > 0 && duration >= s.config.Log.SlowThreshold
+		if slow {
+			slog.Warn("Slow request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"query", r.URL.RawQuery,
+				"status", rw.Status(),
+				"duration", duration,
+				"threshold", s.config.Log.SlowThreshold,
+				"bytes", rw.size,
+				"remote_addr", r.RemoteAddr,
+				"user_agent", r.UserAgent(),
+			)
+		}
+
+		// Apache-style access logs go to their own writer, separate from app logs
+		switch s.config.Log.AccessFormat {
+		case AccessLogCommon, AccessLogCombined:
+			writeAccessLog(s.accessLog, s.config.Log.AccessFormat, r, rw, start)
+			return
+		}
+		if slow {
+			return
+		}
+
+		// Errors are always logged; successes only at LOG_SAMPLE_RATE
+		status := rw.Status()
+		if status >= 200 && status < 300 && !s.logSampler.Sample() {
+			return
+		}
+
 		slog.Info("Request completed",
 			"method", r.Method,
 			"path", r.URL.Path,
-			"duration", time.Since(start),
+			"status", status,
+			"duration", duration,
 		)
 	})
 }
 
+// robotsTxt returns the configured robots.txt, or one disallowing everything
+func (s *Server) robotsTxt() string {
+	if s.config.RobotsTxt == "" {
+		return handlers.DefaultRobotsTxt
+	}
+	return s.config.RobotsTxt
+}
+
+// defaultCORSHeaders is advertised when a preflight doesn't name the
+// headers it needs
+const defaultCORSHeaders = "Content-Type, Authorization, Idempotency-Key, Edit-Token"
+
+// exposedCORSHeaders are the response headers browser scripts may read
+// beyond the safelisted ones
+const exposedCORSHeaders = "Location, Edit-Token"
+
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	cors := s.config.CORS
+	anyOrigin := cors.AllowsAnyOrigin()
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		header := w.Header()
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
+		// A wildcard can't be combined with credentials, so credentialed
+		// responses echo the request's origin when it is allowed
+		if anyOrigin && !cors.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(cors.AllowedOrigins, origin) {
+				header.Set("Access-Control-Allow-Origin", origin)
+				if cors.AllowCredentials {
+					header.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+		}
+		header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+
+		// Handle preflight requests. Only OPTIONS requests for existing
+		// routes reach here, since middleware runs after route matching.
+		// Other OPTIONS requests, such as for the API index, go through.
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				header.Add("Vary", "Access-Control-Request-Headers")
+				header.Set("Access-Control-Allow-Headers", requested)
+			} else {
+				header.Set("Access-Control-Allow-Headers", defaultCORSHeaders)
+			}
+			if cors.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
+		header.Set("Access-Control-Allow-Headers", defaultCORSHeaders)
+		header.Set("Access-Control-Expose-Headers", exposedCORSHeaders)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timeoutBody is the JSON error written when a handler exceeds REQUEST_TIMEOUT
+const timeoutBody = `{"error":"request timed out","code":"TIMEOUT"}`
+
+// streamingRoute names the route that streams its response, which
+// timeoutMiddleware must not buffer
+const streamingRoute = "guestbook-list"
+
+// timeoutMiddleware wraps handlers in http.TimeoutHandler so a request
+// running longer than REQUEST_TIMEOUT gets a 503 and its context is
+// cancelled. The handler's response is buffered until it finishes, except
+// on the streaming route, which only gets a context deadline so messages
+// still reach the client as they are read.
+func (s *Server) timeoutMiddleware(next http.Handler) http.Handler {
+	if s.config.RequestTimeout <= 0 {
+		return next
+	}
+
+	timeout := http.TimeoutHandler(next, s.config.RequestTimeout, timeoutBody)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == streamingRoute {
+			ctx, cancel := context.WithTimeout(r.Context(), s.config.RequestTimeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		timeout.ServeHTTP(timeoutResponseWriter{w}, r)
+	})
+}
+
+// timeoutResponseWriter labels http.TimeoutHandler's timeout reply as JSON,
+// since it writes timeoutBody without a Content-Type. Responses from
+// completed handlers keep the headers their handler set.
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w timeoutResponseWriter) WriteHeader(code int) {
+	// A completed handler's headers are copied in before this, so a 503
+	// without a Content-Type is the timeout reply
+	if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", handlers.JSONContentType("application/json"))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// requestTimeoutHeader lets a client say how long it will wait, as a Go
+// duration such as "3s"
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// clientTimeoutMiddleware gives the request context the deadline a client
+// asked for with X-Request-Timeout, capped at CLIENT_TIMEOUT_MAX, so work
+// for a client that has stopped waiting is cancelled. Missing, invalid and
+// non-positive values are ignored.
+func (s *Server) clientTimeoutMiddleware(next http.Handler) http.Handler {
+	limit := s.config.ClientTimeoutMax
+	if limit <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(requestTimeoutHeader)
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timeout, err := time.ParseDuration(header)
+		if err != nil || timeout <= 0 {
+			slog.Debug("Ignoring invalid request timeout", "value", header)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := database.WithClientDeadline(r.Context(), min(timeout, limit))
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// inflightLimitMiddleware rejects requests with 503 once MAX_INFLIGHT
+// requests are already being served, rather than queueing them unboundedly
+func (s *Server) inflightLimitMiddleware(next http.Handler) http.Handler {
+	if s.inflight == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case s.inflight <- struct{}{}:
+			defer func() { <-s.inflight }()
+			next.ServeHTTP(w, r)
+		default:
+			slog.Warn("Rejected request: too many in-flight requests", "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("Retry-After", "1")
+			handlers.RespondError(w, http.StatusServiceUnavailable, apperrors.CodeUnavailable, "server is busy, please retry")
+		}
+	})
+}
+
+// responseVersionMiddleware selects the response format from the Accept
+// header, answering 406 when the client only accepts versions this server
+// doesn't have
+func (s *Server) responseVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		mediaType, err := handlers.NegotiateVersion(r.Header.Values("Accept"))
+		if err != nil {
+			handlers.RespondError(w, http.StatusNotAcceptable, apperrors.CodeNotAcceptable,
+				fmt.Sprintf("%v; supported media types: application/json, %s", err, strings.Join(handlers.SupportedMediaTypes(), ", ")))
+			return
+		}
+
+		next.ServeHTTP(handlers.WithResponseVersion(w, mediaType), r)
+	})
+}
+
+// readOnlyMiddleware rejects write requests with 503 when READ_ONLY is set,
+// while safe methods continue to work
+func (s *Server) readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.ReadOnly {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				handlers.RespondError(w, http.StatusServiceUnavailable, apperrors.CodeReadOnly, "service is in read-only mode")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireJSONMiddleware rejects POST, PUT and PATCH requests whose
+// Content-Type isn't application/json with 415. Parameters such as charset
+// are allowed.
+func (s *Server) requireJSONMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				handlers.RespondError(w, http.StatusUnsupportedMediaType, apperrors.CodeUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// adminAuthMiddleware requires "Authorization: Bearer <ADMIN_TOKEN>". The
+// admin API is disabled entirely when no token is configured.
+func (s *Server) adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.AdminToken == "" {
+			handlers.RespondError(w, http.StatusForbidden, apperrors.CodeForbidden, "admin API is disabled")
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			slog.Warn("Rejected admin request", "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			handlers.RespondError(w, http.StatusUnauthorized, apperrors.CodeUnauthorized, "Unauthorized")
+			return
+		}
+
+		// Audit entries for admin writes name the admin as the actor
+		next.ServeHTTP(w, r.WithContext(service.WithActor(r.Context(), "admin")))
+	})
+}
+
 func (s *Server) Start() error {
-	slog.Info("Starting server", "port", s.config.Port)
+	slog.Info("Starting server", "address", s.config.Address())
+
+	if s.config.ReadOnly {
+		slog.Warn("Read-only mode is active: write requests will be rejected")
+	}
+
+	if err := s.openAccessLog(); err != nil {
+		slog.Error("Failed to open access log", "error", err)
+		return err
+	}
 
 	// Connect to database
 	if err := s.initializeDatabase(); err != nil {
@@ -112,45 +728,142 @@ func (s *Server) Start() error {
 	// Register routes after database is initialized
 	s.RegisterRoutes()
 
-	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			slog.Error("Failed to start server", "error", err)
-		}
-	}()
+	listener, err := s.listen()
+	if err != nil {
+		slog.Error("Failed to start server", "error", err)
+		return err
+	}
+	s.serve(listener)
+
+	if s.pprofServer != nil {
+		slog.Warn("Profiling endpoints enabled", "address", s.pprofServer.Addr)
+		s.runBackground("pprof server", func(ctx context.Context) {
+			if err := s.pprofServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("Failed to start pprof server", "error", err)
+			}
+		})
+	}
 
 	return nil
 }
 
+// runBackground starts fn in a goroutine tracked by the server. fn must
+// return promptly once ctx is cancelled during Shutdown.
+func (s *Server) runBackground(name string, fn func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn(s.ctx)
+		slog.Debug("Background goroutine stopped", "name", name)
+	}()
+}
+
 func (s *Server) initializeDatabase() error {
 	ctx := context.Background()
 
-	// Create database connection
-	db, err := database.NewConnection(ctx, &s.config)
-	if err != nil {
-		return err
-	}
-	s.db = db
+	// Create database connection, unless one was supplied with WithDB
+	if s.db == nil {
+		db, err := database.NewConnection(ctx, &s.config)
+		if err != nil {
+			return err
+		}
+		s.db = db
 
-	// Create guest book handler
-	s.guestBookHandler = handlers.NewGuestBookHandler(db)
+		// Create guest book handler
+		s.guestBookHandler = handlers.NewGuestBookHandler(db, s.config, s.tasks)
+	}
 
 	// Initialize database tables
-	guestBookService := service.NewGuestBookService(repository.NewGuestBookRepository(db))
+	guestBookService := service.NewGuestBookService(repository.NewGuestBookRepository(s.db), s.config)
 	if err := guestBookService.InitializeDatabase(ctx); err != nil {
 		return err
 	}
 
+	if s.config.DB.Warmup {
+		s.warmupDatabase(ctx)
+	}
+
 	slog.Info("Database initialized successfully")
 	return nil
 }
 
+// warmupDatabase pre-fills the connection pools up to DB_MIN_CONNS. A
+// failed or slow warmup only costs the first requests some latency, so it
+// is logged rather than failing startup.
+func (s *Server) warmupDatabase(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.DB.WarmupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	warmed, err := s.db.Warmup(ctx, s.config.DB.MinConns)
+	if err != nil {
+		slog.Warn("Database pool warmup incomplete", "warmed", warmed, "duration", time.Since(start), "error", err)
+		return
+	}
+	slog.Info("Warmed database connections", "warmed", warmed, "duration", time.Since(start))
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
 	slog.Info("Shutting down server...")
 
+	// Fail readiness first, then keep serving for PRE_SHUTDOWN_DELAY so load
+	// balancers stop routing new traffic here before connections drain
+	s.shuttingDown.Store(true)
+	if delay := s.config.PreShutdownDelay; delay > 0 {
+		slog.Info("Waiting before draining connections", "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	// Drain in-flight requests first so they can still use the database
+	err := s.server.Shutdown(ctx)
+
+	if s.pprofServer != nil {
+		if pprofErr := s.pprofServer.Shutdown(ctx); pprofErr != nil && err == nil {
+			err = pprofErr
+		}
+	}
+
+	// Finish queued background tasks while the database is still open
+	if tasksErr := s.tasks.Shutdown(ctx); tasksErr != nil {
+		slog.Warn("Timed out waiting for background tasks to finish")
+		if err == nil {
+			err = tasksErr
+		}
+	}
+
+	// Stop background goroutines and wait for them, bounded by ctx
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Timed out waiting for background goroutines to stop")
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	// Open snapshots hold connections the pool would wait for
+	if s.guestBookHandler != nil {
+		s.guestBookHandler.CloseSnapshots(ctx)
+	}
+
 	// Close database connection
 	if s.db != nil {
 		s.db.Close()
 	}
 
-	return s.server.Shutdown(ctx)
+	if s.accessLogFile != nil {
+		s.accessLogFile.Close()
+	}
+
+	return err
 }
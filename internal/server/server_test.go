@@ -1,14 +1,32 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/moabdelazem/app/internal/config"
+	"github.com/moabdelazem/app/internal/database"
+	"github.com/moabdelazem/app/internal/handlers"
+	"github.com/moabdelazem/app/internal/models"
+	"github.com/moabdelazem/app/internal/service"
+	"go.uber.org/goleak"
 )
 
 func TestServer_Routes(t *testing.T) {
@@ -161,9 +179,10 @@ func TestServer_CORSMiddleware(t *testing.T) {
 
 			if tt.checkHeaders {
 				expectedHeaders := map[string]string{
-					"Access-Control-Allow-Origin":  "*",
-					"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
-					"Access-Control-Allow-Headers": "Content-Type, Authorization",
+					"Access-Control-Allow-Origin":   "*",
+					"Access-Control-Allow-Methods":  "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+					"Access-Control-Allow-Headers":  "Content-Type, Authorization, Idempotency-Key, Edit-Token",
+					"Access-Control-Expose-Headers": "Location, Edit-Token",
 				}
 
 				for header, expectedValue := range expectedHeaders {
@@ -176,6 +195,109 @@ func TestServer_CORSMiddleware(t *testing.T) {
 	}
 }
 
+func TestServer_CORSDisabled(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080", CORS: config.CORSConfig{Disabled: true, MaxAge: 10 * time.Minute}})
+	server.RegisterRoutes()
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+	}{
+		{name: "GET", method: http.MethodGet, url: "/health", status: http.StatusOK},
+		{name: "Preflight", method: http.MethodOptions, url: "/health", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			for header := range w.Header() {
+				if strings.HasPrefix(header, "Access-Control-") {
+					t.Errorf("Expected no CORS headers, got %s: %q", header, w.Header().Get(header))
+				}
+			}
+			if slices.Contains(w.Header().Values("Vary"), "Origin") {
+				t.Error("Expected no Vary: Origin without CORS")
+			}
+		})
+	}
+}
+
+func TestServer_CORSPreflight(t *testing.T) {
+	tests := []struct {
+		name                string
+		cors                config.CORSConfig
+		origin              string
+		expectedOrigin      string
+		expectedCredentials string
+	}{
+		{
+			name:           "Wildcard without credentials",
+			cors:           config.CORSConfig{MaxAge: 10 * time.Minute},
+			origin:         "https://app.example.com",
+			expectedOrigin: "*",
+		},
+		{
+			name:                "Credentials with allowed origin",
+			cors:                config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true, MaxAge: 10 * time.Minute},
+			origin:              "https://app.example.com",
+			expectedOrigin:      "https://app.example.com",
+			expectedCredentials: "true",
+		},
+		{
+			name:   "Credentials with unlisted origin",
+			cors:   config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true, MaxAge: 10 * time.Minute},
+			origin: "https://evil.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", CORS: tt.cors})
+			server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET", "OPTIONS")
+			server.router.Use(server.corsMiddleware)
+
+			req := httptest.NewRequest(http.MethodOptions, "/test", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			req.Header.Set("Access-Control-Request-Headers", "X-Custom-Header, Content-Type")
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			expectedHeaders := map[string]string{
+				"Access-Control-Allow-Origin":      tt.expectedOrigin,
+				"Access-Control-Allow-Credentials": tt.expectedCredentials,
+				"Access-Control-Allow-Headers":     "X-Custom-Header, Content-Type",
+				"Access-Control-Max-Age":           "600",
+			}
+			for header, expectedValue := range expectedHeaders {
+				if got := w.Header().Get(header); got != expectedValue {
+					t.Errorf("Expected %s header to be %q, got %q", header, expectedValue, got)
+				}
+			}
+
+			if tt.cors.AllowCredentials && !slices.Contains(w.Header().Values("Vary"), "Origin") {
+				t.Errorf("Expected Vary: Origin on a reflected-origin response, got %v", w.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
 func TestServer_LoggingMiddleware(t *testing.T) {
 	cfg := config.Config{
 		Port:  "8080",
@@ -205,6 +327,60 @@ func TestServer_LoggingMiddleware(t *testing.T) {
 	// In a real test, you might want to capture the log output
 }
 
+func TestServer_LoggingMiddleware_SlowRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		sampleRate   float64
+		threshold    time.Duration
+		delay        time.Duration
+		expectSlow   bool
+		expectNormal bool
+	}{
+		{name: "Slow request logged despite sampling", sampleRate: 0, threshold: 5 * time.Millisecond, delay: 10 * time.Millisecond, expectSlow: true},
+		{name: "Slow request replaces normal log", sampleRate: 1, threshold: 5 * time.Millisecond, delay: 10 * time.Millisecond, expectSlow: true},
+		{name: "Fast request logged normally", sampleRate: 1, threshold: time.Hour, expectNormal: true},
+		{name: "Fast request sampled out", sampleRate: 0, threshold: time.Hour},
+		{name: "Threshold disabled", sampleRate: 1, threshold: 0, delay: 10 * time.Millisecond, expectNormal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			defer slog.SetDefault(previous)
+
+			server := NewServer(config.Config{Port: "8080", Log: config.LogConfig{SampleRate: tt.sampleRate, SlowThreshold: tt.threshold}})
+			server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.delay)
+				w.Write([]byte("ok"))
+			})
+			server.router.Use(server.loggingMiddleware)
+
+			req := httptest.NewRequest(http.MethodGet, "/test?page=2", nil)
+			req.Header.Set("User-Agent", "slow-test")
+			server.router.ServeHTTP(httptest.NewRecorder(), req)
+
+			output := logs.String()
+			slowLogged := strings.Contains(output, `level=WARN msg="Slow request"`)
+			if slowLogged != tt.expectSlow {
+				t.Errorf("Expected slow request warning: %v, got %q", tt.expectSlow, output)
+			}
+			if normal := strings.Contains(output, `msg="Request completed"`); normal != tt.expectNormal {
+				t.Errorf("Expected normal request log: %v, got %q", tt.expectNormal, output)
+			}
+
+			if slowLogged {
+				for _, detail := range []string{`query="page=2"`, "threshold=5ms", "bytes=2", "user_agent=slow-test"} {
+					if !strings.Contains(output, detail) {
+						t.Errorf("Expected slow request log to contain %q, got %q", detail, output)
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestServer_Shutdown(t *testing.T) {
 	cfg := config.Config{
 		Port:  "0", // Use random port
@@ -222,3 +398,1561 @@ func TestServer_Shutdown(t *testing.T) {
 		t.Errorf("Shutdown should not return error: %v", err)
 	}
 }
+
+func TestServer_Serve_InjectedListener(t *testing.T) {
+	server := NewServer(config.Config{Port: "0"})
+	server.RegisterRoutes()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server.serve(listener)
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/robots.txt")
+	if err != nil {
+		t.Fatalf("Expected the server to answer on the injected listener, got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Errorf("Expected robots.txt, got %d %q", resp.StatusCode, body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown should not return error: %v", err)
+	}
+}
+
+func TestServer_LoggingMiddleware_AccessLogFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			name:     "Common Log Format",
+			format:   AccessLogCommon,
+			expected: `192.0.2.1 - - [` + "TIME" + `] "GET /test?x=1 HTTP/1.1" 201 5` + "\n",
+		},
+		{
+			name:     "Combined Log Format",
+			format:   AccessLogCombined,
+			expected: `192.0.2.1 - - [` + "TIME" + `] "GET /test?x=1 HTTP/1.1" 201 5 "http://example.com/" "test-agent"` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				Port: "8080",
+				Log:  config.LogConfig{AccessFormat: tt.format},
+			}
+
+			server := NewServer(cfg)
+			var buf bytes.Buffer
+			server.accessLog = &buf
+
+			server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("hello"))
+			}).Methods("GET")
+			server.router.Use(server.loggingMiddleware)
+
+			req := httptest.NewRequest(http.MethodGet, "/test?x=1", nil)
+			req.Header.Set("Referer", "http://example.com/")
+			req.Header.Set("User-Agent", "test-agent")
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			line := buf.String()
+			start := strings.Index(line, "[")
+			end := strings.Index(line, "]")
+			if start < 0 || end < start {
+				t.Fatalf("Expected bracketed timestamp in %q", line)
+			}
+
+			if _, err := time.Parse(accessLogTimeFormat, line[start+1:end]); err != nil {
+				t.Errorf("Failed to parse access log timestamp: %v", err)
+			}
+
+			got := line[:start+1] + "TIME" + line[end:]
+			if got != tt.expected {
+				t.Errorf("Expected access log line %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestServer_LoggingMiddleware_DefaultSkipsAccessLog(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080"})
+	var buf bytes.Buffer
+	server.accessLog = &buf
+
+	server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	server.router.Use(server.loggingMiddleware)
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected no access log output by default, got %q", buf.String())
+	}
+}
+
+func TestServer_AccessLogOutput(t *testing.T) {
+	t.Run("Defaults to a stream apart from app logs", func(t *testing.T) {
+		server := NewServer(config.Config{Port: "8080", Log: config.LogConfig{AccessFormat: AccessLogCommon}})
+		// The app logger writes to stdout; see logger.Initialize
+		if server.accessLog == io.Writer(os.Stdout) {
+			t.Error("Expected access logs not to share stdout with app logs by default")
+		}
+		if server.accessLog != io.Writer(os.Stderr) {
+			t.Errorf("Expected access logs to go to stderr by default, got %v", server.accessLog)
+		}
+	})
+
+	t.Run("File", func(t *testing.T) {
+		var logs bytes.Buffer
+		previous := slog.Default()
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+		defer slog.SetDefault(previous)
+
+		path := filepath.Join(t.TempDir(), "access.log")
+		server := NewServer(config.Config{Port: "8080", Log: config.LogConfig{AccessFormat: AccessLogCommon, AccessOutput: path}})
+		if err := server.openAccessLog(); err != nil {
+			t.Fatalf("Expected the access log to open, got %v", err)
+		}
+		defer server.accessLogFile.Close()
+
+		server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+			slog.Info("Handled test request")
+			w.WriteHeader(http.StatusOK)
+		}).Methods("GET")
+		server.router.Use(server.loggingMiddleware)
+
+		server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		accessLog, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read the access log: %v", err)
+		}
+		if !strings.Contains(string(accessLog), `"GET /test HTTP/1.1" 200`) || strings.Contains(string(accessLog), "Handled test request") {
+			t.Errorf("Expected only the access line in the access log, got %q", accessLog)
+		}
+		if !strings.Contains(logs.String(), "Handled test request") || strings.Contains(logs.String(), "GET /test HTTP/1.1") {
+			t.Errorf("Expected only app logs in the app log, got %q", logs.String())
+		}
+	})
+
+	t.Run("Unopenable file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "access.log")
+		server := NewServer(config.Config{Port: "8080", Log: config.LogConfig{AccessFormat: AccessLogCommon, AccessOutput: path}})
+		if err := server.openAccessLog(); err == nil {
+			t.Error("Expected an error for an access log that can't be created")
+		}
+	})
+}
+
+func TestServer_AdminAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		adminToken     string
+		authorization  string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Admin API disabled without token",
+			adminToken:     "",
+			authorization:  "Bearer anything",
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   "FORBIDDEN",
+		},
+		{
+			name:           "Missing authorization header",
+			adminToken:     "secret",
+			authorization:  "",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "UNAUTHORIZED",
+		},
+		{
+			name:           "Wrong token",
+			adminToken:     "secret",
+			authorization:  "Bearer wrong",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "UNAUTHORIZED",
+		},
+		{
+			name:           "Non-bearer scheme",
+			adminToken:     "secret",
+			authorization:  "Basic secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "UNAUTHORIZED",
+		},
+		{
+			name:           "Valid token",
+			adminToken:     "secret",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", AdminToken: tt.adminToken})
+
+			admin := server.router.PathPrefix("/api/v1/admin").Subrouter()
+			admin.Use(server.adminAuthMiddleware)
+			admin.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}).Methods("PATCH")
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/test", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedCode != "" {
+				var response map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if response["code"] != tt.expectedCode {
+					t.Errorf("Expected code %s, got %q", tt.expectedCode, response["code"])
+				}
+			}
+		})
+	}
+}
+
+func TestServer_ReadOnlyMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		readOnly       bool
+		method         string
+		expectedStatus int
+	}{
+		{name: "GET allowed in read-only mode", readOnly: true, method: http.MethodGet, expectedStatus: http.StatusOK},
+		{name: "HEAD allowed in read-only mode", readOnly: true, method: http.MethodHead, expectedStatus: http.StatusOK},
+		{name: "POST blocked in read-only mode", readOnly: true, method: http.MethodPost, expectedStatus: http.StatusServiceUnavailable},
+		{name: "PUT blocked in read-only mode", readOnly: true, method: http.MethodPut, expectedStatus: http.StatusServiceUnavailable},
+		{name: "PATCH blocked in read-only mode", readOnly: true, method: http.MethodPatch, expectedStatus: http.StatusServiceUnavailable},
+		{name: "DELETE blocked in read-only mode", readOnly: true, method: http.MethodDelete, expectedStatus: http.StatusServiceUnavailable},
+		{name: "POST allowed normally", readOnly: false, method: http.MethodPost, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", ReadOnly: tt.readOnly})
+
+			server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			server.router.Use(server.readOnlyMiddleware)
+
+			req := httptest.NewRequest(tt.method, "/test", nil)
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusServiceUnavailable {
+				var response map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if response["error"] != "service is in read-only mode" {
+					t.Errorf("Expected read-only error, got %q", response["error"])
+				}
+				if response["code"] != "READ_ONLY" {
+					t.Errorf("Expected code READ_ONLY, got %q", response["code"])
+				}
+			}
+		})
+	}
+}
+
+func TestServer_InflightLimitMiddleware(t *testing.T) {
+	const limit = 3
+
+	server := NewServer(config.Config{Port: "8080", MaxInflight: limit})
+
+	started := make(chan struct{}, limit)
+	release := make(chan struct{})
+	server.router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	server.router.Use(server.inflightLimitMiddleware)
+
+	// Fill every slot with a blocked request
+	var wg sync.WaitGroup
+	codes := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+			codes <- w.Code
+		}()
+	}
+	for i := 0; i < limit; i++ {
+		<-started
+	}
+
+	// The next request is shed immediately
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d over the limit, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header when over the limit")
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Expected in-limit request to succeed, got %d", code)
+		}
+	}
+
+	// Slots are released once requests finish
+	if len(server.inflight) != 0 {
+		t.Errorf("Expected all slots released, %d still held", len(server.inflight))
+	}
+}
+
+func TestServer_InflightLimitMiddleware_Unlimited(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080"})
+
+	if server.inflight != nil {
+		t.Fatal("Expected no semaphore when MAX_INFLIGHT is unset")
+	}
+
+	server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	server.router.Use(server.inflightLimitMiddleware)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestServer_Shutdown_FailsReadinessBeforeDraining(t *testing.T) {
+	server := NewServer(config.Config{Port: "0", PreShutdownDelay: 100 * time.Millisecond}, WithDB(database.NewWithPools(nil)))
+	readyz := handlers.ReadinessHandler(server.readinessChecks()...)
+
+	failingCheck := func() string {
+		w := httptest.NewRecorder()
+		readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var response map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal readiness response: %v", err)
+		}
+		return response["check"]
+	}
+
+	// The unconnected database check fails, but not the shutdown one
+	if check := failingCheck(); check == "shutdown" {
+		t.Fatal("Expected the shutdown check to pass before Shutdown")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Shutdown(context.Background())
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !server.shuttingDown.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if check := failingCheck(); check != "shutdown" {
+		t.Errorf("Expected /readyz to fail the shutdown check during the delay, got %q", check)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected Shutdown to wait for PRE_SHUTDOWN_DELAY, returned early with %v", err)
+	default:
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown should not return error: %v", err)
+	}
+}
+
+func TestServer_Readiness_OpenBreaker(t *testing.T) {
+	db := database.NewWithPools(nil)
+	breaker := database.NewBreaker(1, time.Minute, time.Minute)
+	db.UseBreaker(breaker)
+	server := NewServer(config.Config{Port: "0"}, WithDB(db))
+	readyz := handlers.ReadinessHandler(server.readinessChecks()...)
+
+	ticket, _ := breaker.Allow()
+	breaker.Record(ticket, errors.New("connection refused"))
+
+	w := httptest.NewRecorder()
+	readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal readiness response: %v", err)
+	}
+	if response["check"] != "database_breaker" || !strings.Contains(response["error"], "open") {
+		t.Errorf("Expected the breaker check to report the open breaker, got %v", response)
+	}
+}
+
+func TestServer_Shutdown_StopsBackgroundGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	server := NewServer(config.Config{Port: "0"})
+
+	started := make(chan struct{}, 2)
+	for _, name := range []string{"worker-1", "worker-2"} {
+		server.runBackground(name, func(ctx context.Context) {
+			started <- struct{}{}
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		})
+	}
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown should not return error: %v", err)
+	}
+}
+
+func TestServer_Shutdown_TimesOutOnStuckGoroutine(t *testing.T) {
+	server := NewServer(config.Config{Port: "0"})
+
+	release := make(chan struct{})
+	defer close(release)
+	server.runBackground("stuck", func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err == nil {
+		t.Error("Expected Shutdown to report a timeout for a stuck goroutine")
+	}
+}
+
+func TestServer_Pprof(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "Disabled by default", enabled: false},
+		{name: "Enabled", enabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{
+				Port:         "8080",
+				PprofEnabled: tt.enabled,
+				PprofAddress: "localhost:6060",
+			})
+			server.RegisterRoutes()
+
+			// The public API never serves profiles
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected status %d on API router, got %d", http.StatusNotFound, w.Code)
+			}
+
+			if !tt.enabled {
+				if server.pprofServer != nil {
+					t.Error("Expected no pprof server when disabled")
+				}
+				return
+			}
+
+			if server.pprofServer == nil {
+				t.Fatal("Expected pprof server when enabled")
+			}
+			if server.pprofServer.Addr != "localhost:6060" {
+				t.Errorf("Expected pprof address localhost:6060, got %s", server.pprofServer.Addr)
+			}
+
+			for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/goroutine"} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				w := httptest.NewRecorder()
+				server.pprofServer.Handler.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Errorf("Expected status %d for %s, got %d", http.StatusOK, path, w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_RequireJSONMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		contentType    string
+		expectedStatus int
+	}{
+		{name: "POST with JSON", method: http.MethodPost, contentType: "application/json", expectedStatus: http.StatusOK},
+		{name: "POST with charset", method: http.MethodPost, contentType: "application/json; charset=utf-8", expectedStatus: http.StatusOK},
+		{name: "POST with mixed case", method: http.MethodPost, contentType: "Application/JSON", expectedStatus: http.StatusOK},
+		{name: "POST without Content-Type", method: http.MethodPost, contentType: "", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "POST with form", method: http.MethodPost, contentType: "application/x-www-form-urlencoded", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "POST with text", method: http.MethodPost, contentType: "text/plain", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "PATCH with text", method: http.MethodPatch, contentType: "text/plain", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "PUT without Content-Type", method: http.MethodPut, contentType: "", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "GET without Content-Type", method: http.MethodGet, contentType: "", expectedStatus: http.StatusOK},
+		{name: "DELETE without Content-Type", method: http.MethodDelete, contentType: "", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080"})
+
+			server.router.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			server.router.Use(server.requireJSONMiddleware)
+
+			req := httptest.NewRequest(tt.method, "/test", strings.NewReader(`{}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusUnsupportedMediaType {
+				var response map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if response["error"] != "Content-Type must be application/json" {
+					t.Errorf("Expected Content-Type error, got %q", response["error"])
+				}
+				if response["code"] != "UNSUPPORTED_MEDIA_TYPE" {
+					t.Errorf("Expected code UNSUPPORTED_MEDIA_TYPE, got %q", response["code"])
+				}
+			}
+		})
+	}
+}
+
+func TestServer_PatchMessage_RequiresEditToken(t *testing.T) {
+	// No pool behind the database: an edit that reached it would panic
+	server := NewServer(config.Config{Port: "8080", Features: config.DefaultFeatures()}, WithDB(database.NewWithPools(nil)))
+	server.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/guestbook/1", strings.NewReader(`{"name": "Mallory"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"UNAUTHORIZED"`) {
+		t.Errorf("Expected an UNAUTHORIZED error, got %s", w.Body.String())
+	}
+}
+
+func TestServer_RegisteredRoutes_MethodRestrictions(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080", Features: config.DefaultFeatures()})
+	server.RegisterRoutes()
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		requestMethod  string
+		expectedStatus int
+		expectCORS     bool
+	}{
+		{name: "Preflight for POST on list route", method: http.MethodOptions, url: "/api/v1/guestbook", requestMethod: http.MethodPost, expectedStatus: http.StatusOK, expectCORS: true},
+		{name: "Preflight for PATCH on admin route", method: http.MethodOptions, url: "/api/v1/admin/guestbook/1/status", requestMethod: http.MethodPatch, expectedStatus: http.StatusOK, expectCORS: true},
+		{name: "OPTIONS without requested method", method: http.MethodOptions, url: "/api/v1/guestbook/1", expectedStatus: http.StatusOK, expectCORS: true},
+		{name: "OPTIONS to unknown path", method: http.MethodOptions, url: "/api/v1/nonexistent", expectedStatus: http.StatusNotFound},
+		{name: "OPTIONS to non-numeric ID", method: http.MethodOptions, url: "/api/v1/guestbook/abc", expectedStatus: http.StatusNotFound},
+		{name: "Preflight for unsupported method", method: http.MethodOptions, url: "/api/v1/guestbook", requestMethod: http.MethodDelete, expectedStatus: http.StatusMethodNotAllowed},
+		{name: "Preflight for PATCH on message route", method: http.MethodOptions, url: "/api/v1/guestbook/1", requestMethod: http.MethodPatch, expectedStatus: http.StatusOK, expectCORS: true},
+		{name: "Preflight for PATCH on read-only route", method: http.MethodOptions, url: "/api/v1/guestbook/1/neighbors", requestMethod: http.MethodPatch, expectedStatus: http.StatusMethodNotAllowed},
+		{name: "DELETE on list route", method: http.MethodDelete, url: "/api/v1/guestbook", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "PUT on message route", method: http.MethodPut, url: "/api/v1/guestbook/1", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "Preflight for DELETE on admin list route", method: http.MethodOptions, url: "/api/v1/admin/guestbook", requestMethod: http.MethodDelete, expectedStatus: http.StatusOK, expectCORS: true},
+		{name: "GET on admin list route", method: http.MethodGet, url: "/api/v1/admin/guestbook", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "GET on admin status route", method: http.MethodGet, url: "/api/v1/admin/guestbook/1/status", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "POST on count route", method: http.MethodPost, url: "/api/v1/guestbook/count", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.requestMethod != "" {
+				req.Header.Set("Origin", "https://example.com")
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			hasCORS := w.Header().Get("Access-Control-Allow-Origin") != ""
+			if hasCORS != tt.expectCORS {
+				t.Errorf("Expected CORS headers: %v, got %v", tt.expectCORS, hasCORS)
+			}
+
+			if tt.expectedStatus == http.StatusMethodNotAllowed && w.Header().Get("Allow") == "" {
+				t.Error("Expected Allow header on 405 response")
+			}
+		})
+	}
+}
+
+func TestServer_TrailingSlash(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             string
+		method           string
+		url              string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "GET redirects", mode: "redirect", method: http.MethodGet, url: "/api/v1/guestbook/?page=2", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "/api/v1/guestbook?page=2"},
+		{name: "POST redirects keeping the method", mode: "redirect", method: http.MethodPost, url: "/api/v1/guestbook/", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "/api/v1/guestbook"},
+		{name: "Default mode redirects", mode: "", method: http.MethodGet, url: "/health/", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "/health"},
+		{name: "Unknown path is not redirected", mode: "redirect", method: http.MethodGet, url: "/api/v1/nonexistent/", expectedStatus: http.StatusNotFound},
+		{name: "Strict GET", mode: "strict", method: http.MethodGet, url: "/api/v1/guestbook/", expectedStatus: http.StatusNotFound},
+		{name: "Strict POST", mode: "strict", method: http.MethodPost, url: "/api/v1/guestbook/", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", TrailingSlash: tt.mode})
+			server.RegisterRoutes()
+
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", tt.expectedLocation, got)
+			}
+		})
+	}
+}
+
+func TestServer_TimeoutMiddleware(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080", RequestTimeout: 20 * time.Millisecond, JSONCharset: "utf-8"})
+	defer handlers.SetJSONCharset("")
+
+	server.router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+	server.router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	server.router.Use(server.timeoutMiddleware)
+
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected slow request to be cut off, took %s", elapsed)
+	}
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("Expected Content-Type application/json; charset=utf-8, got %q", contentType)
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Timeout body is not valid JSON: %v", err)
+	}
+	if response["code"] != "TIMEOUT" {
+		t.Errorf("Expected code TIMEOUT, got %q", response["code"])
+	}
+	if response["error"] != "request timed out" {
+		t.Errorf("Expected timeout error, got %q", response["error"])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/fast", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("Expected fast request to complete, got %d %q", w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain" {
+		t.Errorf("Expected the handler's Content-Type, got %q", contentType)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain" {
+		t.Errorf("Expected handler's Content-Type to win, got %q", contentType)
+	}
+}
+
+func TestServer_RequestBodyLogMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	server := NewServer(config.Config{Port: "8080", Debug: true, LogRequestBodies: true})
+
+	var decoded map[string]string
+	handler := server.requestBodyLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decoded = nil
+		if err := json.NewDecoder(r.Body).Decode(&decoded); err != nil {
+			t.Errorf("Handler failed to decode body after logging: %v", err)
+		}
+	}))
+
+	tests := []struct {
+		name       string
+		message    string
+		expectBody bool
+	}{
+		{name: "Small body is logged", message: "Hello there", expectBody: true},
+		{name: "Body over the cap is still readable", message: strings.Repeat("a", maxLoggedBodyBytes), expectBody: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			body, _ := json.Marshal(map[string]string{"message": tt.message, "password": "hunter2"})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", bytes.NewReader(body))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if decoded["message"] != tt.message || decoded["password"] != "hunter2" {
+				t.Errorf("Expected the handler to see the original body, got %v", decoded)
+			}
+
+			if strings.Contains(logs.String(), "hunter2") {
+				t.Errorf("Expected secrets to be redacted from logs, got %q", logs.String())
+			}
+			if logged := strings.Contains(logs.String(), "Hello there"); logged != tt.expectBody {
+				t.Errorf("Expected body logged %v, got logs %q", tt.expectBody, logs.String())
+			}
+		})
+	}
+}
+
+func TestServer_RequestBodyLogMiddleware_DisabledOutsideDebug(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	server := NewServer(config.Config{Port: "8080", LogRequestBodies: true})
+	handler := server.requestBodyLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/guestbook", strings.NewReader(`{"message":"Hello there"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Contains(logs.String(), "Hello there") {
+		t.Errorf("Expected no body logging outside debug mode, got %q", logs.String())
+	}
+}
+
+func TestServer_Use(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080"})
+
+	var calls []string
+	record := func(name string) mux.MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Built-in middleware has already run
+				if w.Header().Get("Access-Control-Allow-Origin") == "" {
+					t.Errorf("Expected %s to run after the CORS middleware", name)
+				}
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	server.Use(record("auth"))
+	server.Use(record("tracing"))
+	server.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !slices.Equal(calls, []string{"auth", "tracing"}) {
+		t.Errorf("Expected custom middleware to run in registration order, got %v", calls)
+	}
+}
+
+func TestNewServer_Options(t *testing.T) {
+	t.Run("No options", func(t *testing.T) {
+		server := NewServer(config.Config{Port: "8080"})
+
+		if server.server.Handler != server.router || server.router == nil {
+			t.Error("Expected the HTTP server to serve a new router")
+		}
+		if server.db != nil || server.guestBookHandler != nil {
+			t.Error("Expected the database to be connected on Start, not in NewServer")
+		}
+	})
+
+	t.Run("WithRouter", func(t *testing.T) {
+		router := mux.NewRouter()
+		server := NewServer(config.Config{Port: "8080"}, WithRouter(router))
+
+		if server.router != router || server.server.Handler != router {
+			t.Error("Expected the supplied router to be used")
+		}
+	})
+
+	t.Run("WithDB", func(t *testing.T) {
+		db := database.NewWithPools(nil)
+		server := NewServer(config.Config{Port: "8080"}, WithDB(db))
+
+		if server.db != db {
+			t.Error("Expected the supplied database to be used")
+		}
+		if server.guestBookHandler == nil {
+			t.Error("Expected the guest book handler to be built from the supplied database")
+		}
+	})
+
+	t.Run("WithoutCORS", func(t *testing.T) {
+		var accessLog bytes.Buffer
+		ran := false
+		server := NewServer(config.Config{Port: "8080", Log: config.LogConfig{AccessFormat: AccessLogCommon}},
+			WithoutCORS(),
+			WithAccessLog(&accessLog),
+			WithMiddleware(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ran = true
+					next.ServeHTTP(w, r)
+				})
+			}),
+		)
+		server.RegisterRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Expected no CORS headers, got Access-Control-Allow-Origin %q", got)
+		}
+		if !ran {
+			t.Error("Expected WithMiddleware middleware to run")
+		}
+		if !strings.Contains(accessLog.String(), "GET /health") {
+			t.Errorf("Expected the access log to go to the supplied writer, got %q", accessLog.String())
+		}
+	})
+}
+
+func TestServer_Cacheable(t *testing.T) {
+	respond := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			handlers.RespondJSON(w, status, map[string]string{"status": http.StatusText(status)})
+		}
+	}
+
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		handler  http.HandlerFunc
+		expected string
+	}{
+		{name: "OK", maxAge: time.Minute, handler: respond(http.StatusOK), expected: "public, max-age=60"},
+		{name: "Implicit OK", maxAge: time.Minute, handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }, expected: "public, max-age=60"},
+		{name: "Not modified", maxAge: time.Minute, handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotModified) }, expected: "public, max-age=60"},
+		{name: "Not found", maxAge: time.Minute, handler: respond(http.StatusNotFound), expected: "no-cache"},
+		{name: "Server error", maxAge: time.Minute, handler: respond(http.StatusInternalServerError), expected: "no-cache"},
+		{name: "Handler's own policy", maxAge: time.Minute, handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "private")
+			w.WriteHeader(http.StatusOK)
+		}, expected: "private"},
+		{name: "Disabled", maxAge: 0, handler: respond(http.StatusOK), expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", CacheControlMaxAge: tt.maxAge})
+
+			w := httptest.NewRecorder()
+			server.cacheable(tt.handler)(w, httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil))
+
+			if got := w.Header().Get("Cache-Control"); got != tt.expected {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestServer_Features(t *testing.T) {
+	paths := map[string]func(*config.FeaturesConfig){
+		"/api/v1/guestbook/search":      func(f *config.FeaturesConfig) { f.EnableSearch = false },
+		"/api/v1/guestbook/count":       func(f *config.FeaturesConfig) { f.EnableStats = false },
+		"/api/v1/guestbook/timeline":    func(f *config.FeaturesConfig) { f.EnableStats = false },
+		"/api/v1/stats/message-lengths": func(f *config.FeaturesConfig) { f.EnableStats = false },
+		"/api/v1/guestbook/1/neighbors": func(f *config.FeaturesConfig) { f.EnableNeighbors = false },
+	}
+
+	for path, disable := range paths {
+		t.Run(path, func(t *testing.T) {
+			enabled := NewServer(config.Config{Port: "8080", Features: config.DefaultFeatures()})
+			enabled.RegisterRoutes()
+
+			// POST reaches the router without calling the GET handler, so
+			// a registered route answers 405
+			w := httptest.NewRecorder()
+			enabled.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status %d with the feature enabled, got %d", http.StatusMethodNotAllowed, w.Code)
+			}
+
+			features := config.DefaultFeatures()
+			disable(&features)
+			disabled := NewServer(config.Config{Port: "8080", Features: features})
+			disabled.RegisterRoutes()
+
+			w = httptest.NewRecorder()
+			disabled.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected status %d with the feature disabled, got %d", http.StatusNotFound, w.Code)
+			}
+		})
+	}
+}
+
+func TestServer_H2C(t *testing.T) {
+	tests := []struct {
+		name          string
+		h2c           bool
+		expectedProto string
+	}{
+		{name: "Enabled", h2c: true, expectedProto: "HTTP/2.0"},
+		{name: "Disabled", h2c: false, expectedProto: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", H2C: tt.h2c})
+			server.router.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			})
+
+			if server.server.ReadTimeout == 0 || server.server.WriteTimeout == 0 || server.server.IdleTimeout == 0 {
+				t.Error("Expected server timeouts to be set")
+			}
+
+			ts := httptest.NewUnstartedServer(server.router)
+			ts.Config = server.server
+			ts.Start()
+			defer ts.Close()
+
+			// A client that only speaks h2c, with prior knowledge
+			protocols := new(http.Protocols)
+			protocols.SetUnencryptedHTTP2(true)
+			client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+			resp, err := client.Get(ts.URL + "/proto")
+			if tt.expectedProto == "" {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("Expected an h2c request to fail with h2c disabled")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("h2c request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.Proto != tt.expectedProto || string(body) != tt.expectedProto {
+				t.Errorf("Expected %s, got response %s for request %s", tt.expectedProto, resp.Proto, body)
+			}
+
+			// Plain HTTP/1.1 clients still work
+			resp1, err := http.Get(ts.URL + "/proto")
+			if err != nil {
+				t.Fatalf("HTTP/1.1 request failed: %v", err)
+			}
+			defer resp1.Body.Close()
+			if body, _ := io.ReadAll(resp1.Body); string(body) != "HTTP/1.1" {
+				t.Errorf("Expected HTTP/1.1 request, got %s", body)
+			}
+		})
+	}
+}
+
+func TestServer_FaviconAndRobots(t *testing.T) {
+	tests := []struct {
+		name                string
+		robotsTxt           string
+		path                string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{name: "Favicon", path: "/favicon.ico", expectedStatus: http.StatusNoContent},
+		{name: "Default robots.txt", path: "/robots.txt", expectedStatus: http.StatusOK, expectedContentType: "text/plain; charset=utf-8", expectedBody: "User-agent: *\nDisallow: /\n"},
+		{name: "Configured robots.txt", robotsTxt: "User-agent: *\nAllow: /\n", path: "/robots.txt", expectedStatus: http.StatusOK, expectedContentType: "text/plain; charset=utf-8", expectedBody: "User-agent: *\nAllow: /\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			defer slog.SetDefault(previous)
+
+			server := NewServer(config.Config{Port: "8080", RobotsTxt: tt.robotsTxt})
+			server.RegisterRoutes()
+
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, got)
+			}
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+			if strings.Contains(logs.String(), "Route not found") {
+				t.Errorf("Expected no not-found log, got:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+// blockingRepository blocks reads until their context ends, reporting the
+// context error. Methods it doesn't override panic via the nil interface.
+type blockingRepository struct {
+	service.GuestBookRepositoryInterface
+	started chan struct{}
+	ended   chan error
+}
+
+func (r *blockingRepository) block(ctx context.Context) error {
+	r.started <- struct{}{}
+	<-ctx.Done()
+	r.ended <- ctx.Err()
+	return ctx.Err()
+}
+
+func (r *blockingRepository) GetByID(ctx context.Context, id int) (*models.GuestBookMessage, error) {
+	return nil, r.block(ctx)
+}
+
+func (r *blockingRepository) LastChangedAt(ctx context.Context) (time.Time, error) {
+	return time.Time{}, r.block(ctx)
+}
+
+func TestServer_ClientDisconnectCancelsQuery(t *testing.T) {
+	for _, path := range []string{"/api/v1/guestbook", "/api/v1/guestbook/1"} {
+		t.Run(path, func(t *testing.T) {
+			repo := &blockingRepository{started: make(chan struct{}, 1), ended: make(chan error, 1)}
+			cfg := config.Config{Port: "8080", Validation: config.DefaultValidationConfig(), Features: config.DefaultFeatures()}
+
+			server := NewServer(cfg, WithAccessLog(io.Discard))
+			server.guestBookHandler = handlers.NewGuestBookHandlerWithService(service.NewGuestBookService(repo, cfg))
+			server.RegisterRoutes()
+
+			// A real listener, so the request context is tied to the connection
+			ts := httptest.NewServer(server.router)
+			defer ts.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+			errs := make(chan error, 1)
+			go func() {
+				resp, err := http.DefaultClient.Do(req)
+				if err == nil {
+					resp.Body.Close()
+				}
+				errs <- err
+			}()
+
+			select {
+			case <-repo.started:
+			case <-time.After(time.Second):
+				t.Fatal("Expected the request to reach the repository")
+			}
+
+			// The client hangs up mid-query
+			cancel()
+
+			select {
+			case err := <-repo.ended:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("Expected the query context to be cancelled, got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected the query to be cancelled when the client disconnected")
+			}
+
+			if err := <-errs; !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected the client request to be cancelled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_ResponseVersion(t *testing.T) {
+	cfg := config.Config{Port: "8080"}
+	server := NewServer(cfg, WithAccessLog(io.Discard))
+	// ID 0 is rejected before the repository is used, so none is needed
+	server.guestBookHandler = handlers.NewGuestBookHandlerWithService(service.NewGuestBookService(nil, cfg))
+	server.RegisterRoutes()
+
+	tests := []struct {
+		name                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{name: "No Accept header", expectedStatus: http.StatusBadRequest, expectedContentType: "application/json"},
+		{name: "Plain JSON", accept: "application/json", expectedStatus: http.StatusBadRequest, expectedContentType: "application/json"},
+		{name: "v1", accept: handlers.MediaTypeV1, expectedStatus: http.StatusBadRequest, expectedContentType: handlers.MediaTypeV1},
+		{name: "Unknown version", accept: "application/vnd.guestbook.v9+json", expectedStatus: http.StatusNotAcceptable, expectedContentType: "application/json"},
+		{name: "Unknown version with JSON fallback", accept: "application/vnd.guestbook.v9+json, application/json;q=0.5", expectedStatus: http.StatusBadRequest, expectedContentType: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook/0", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, contentType)
+			}
+			if vary := w.Header().Values("Vary"); !slices.Contains(vary, "Accept") {
+				t.Errorf("Expected Vary: Accept, got %v", vary)
+			}
+			if tt.expectedStatus == http.StatusNotAcceptable && !strings.Contains(w.Body.String(), handlers.MediaTypeV1) {
+				t.Errorf("Expected the 406 body to list the supported media types, got %s", w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusNotAcceptable && !strings.Contains(w.Body.String(), `"code":"NOT_ACCEPTABLE"`) {
+				t.Errorf("Expected the 406 body to have code NOT_ACCEPTABLE, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_SecurityHeaders(t *testing.T) {
+	secured := config.SecurityHeadersConfig{
+		Enabled:        true,
+		FrameOptions:   "DENY",
+		ReferrerPolicy: "no-referrer",
+		HSTSMaxAge:     365 * 24 * time.Hour,
+	}
+
+	tests := []struct {
+		name           string
+		security       config.SecurityHeadersConfig
+		tls            bool
+		forwardedProto string
+		expected       map[string]string
+	}{
+		{
+			name:     "Plain HTTP omits HSTS",
+			security: secured,
+			expected: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "no-referrer",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name:     "TLS adds HSTS",
+			security: secured,
+			tls:      true,
+			expected: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+			},
+		},
+		{
+			name:           "TLS terminated by a proxy adds HSTS",
+			security:       secured,
+			forwardedProto: "https",
+			expected: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+			},
+		},
+		{
+			name:     "TLS without an HSTS max age",
+			security: config.SecurityHeadersConfig{Enabled: true, FrameOptions: "SAMEORIGIN"},
+			tls:      true,
+			expected: map[string]string{
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Referrer-Policy":           "",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name:     "Disabled",
+			security: config.SecurityHeadersConfig{Enabled: false, FrameOptions: "DENY", HSTSMaxAge: time.Hour},
+			tls:      true,
+			expected: map[string]string{
+				"X-Content-Type-Options":    "",
+				"X-Frame-Options":           "",
+				"Strict-Transport-Security": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", Security: tt.security})
+			server.RegisterRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			for name, value := range tt.expected {
+				if got := w.Header().Get(name); got != value {
+					t.Errorf("Expected %s %q, got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_TimeoutMiddleware_NoContentType(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080", RequestTimeout: time.Second})
+	server.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "" {
+		t.Errorf("Expected no Content-Type, got %q", contentType)
+	}
+}
+
+func TestServer_TimeoutMiddleware_StreamingRoute(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080", RequestTimeout: time.Second})
+
+	var (
+		flushable   bool
+		hasDeadline bool
+	)
+	server.router.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		_, flushable = w.(http.Flusher)
+		_, hasDeadline = r.Context().Deadline()
+		w.WriteHeader(http.StatusOK)
+	}).Name(streamingRoute)
+	server.router.Use(server.timeoutMiddleware)
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if !flushable {
+		t.Error("Expected the streaming route to write to the connection unbuffered")
+	}
+	if !hasDeadline {
+		t.Error("Expected the streaming route to get a context deadline")
+	}
+}
+
+func TestServer_ClientTimeoutMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		limit        time.Duration
+		header       string
+		wantDeadline bool
+		maxTimeout   time.Duration
+	}{
+		{name: "No header", limit: 30 * time.Second},
+		{name: "Valid timeout", limit: 30 * time.Second, header: "3s", wantDeadline: true, maxTimeout: 3 * time.Second},
+		{name: "Over the cap", limit: 5 * time.Second, header: "1h", wantDeadline: true, maxTimeout: 5 * time.Second},
+		{name: "Invalid value", limit: 30 * time.Second, header: "soon"},
+		{name: "Bare number", limit: 30 * time.Second, header: "3"},
+		{name: "Negative value", limit: 30 * time.Second, header: "-3s"},
+		{name: "Disabled", limit: 0, header: "3s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", ClientTimeoutMax: tt.limit})
+
+			var (
+				deadline    time.Time
+				hasDeadline bool
+			)
+			handler := server.clientTimeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deadline, hasDeadline = r.Context().Deadline()
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-Timeout", tt.header)
+			}
+			before := time.Now()
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			after := time.Now()
+
+			if hasDeadline != tt.wantDeadline {
+				t.Fatalf("Expected deadline set=%v, got %v", tt.wantDeadline, hasDeadline)
+			}
+			if tt.wantDeadline && (deadline.Before(before.Add(tt.maxTimeout)) || deadline.After(after.Add(tt.maxTimeout))) {
+				t.Errorf("Expected a deadline %s away, got %s", tt.maxTimeout, deadline.Sub(before))
+			}
+		})
+	}
+}
+
+func TestServer_ClientTimeoutMiddleware_CancelsWork(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080", ClientTimeoutMax: time.Second})
+
+	var err error
+	handler := server.clientTimeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			err = r.Context().Err()
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/guestbook", nil)
+	req.Header.Set("X-Request-Timeout", "20ms")
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the request context to hit its deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected work to stop at the client's timeout, took %s", elapsed)
+	}
+}
+
+func TestServer_APIIndex(t *testing.T) {
+	server := NewServer(config.Config{Port: "8080", Features: config.DefaultFeatures()})
+	server.RegisterRoutes()
+
+	index := func(t *testing.T, path string) (apiIndex, http.Header) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var response apiIndex
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal index: %v", err)
+		}
+		return response, w.Header()
+	}
+
+	root, header := index(t, "/")
+	if allow := header.Get("Allow"); allow != "GET, OPTIONS" {
+		t.Errorf("Expected Allow: GET, OPTIONS on /, got %q", allow)
+	}
+
+	// Every listed method is routed, and every routed method is listed
+	idParam := regexp.MustCompile(`\{[^}]+\}`)
+	for _, resource := range root.Resources {
+		target := idParam.ReplaceAllString(resource.Path, "1")
+		probe := httptest.NewRequest(http.MethodOptions, target, nil)
+		if routed := server.allowedMethods(probe); !slices.Equal(resource.Methods, routed) {
+			t.Errorf("Expected %s to list methods %v, got %v", resource.Path, routed, resource.Methods)
+		}
+	}
+
+	expected := map[string][]string{
+		"/":                                   {"GET"},
+		"/openapi.json":                       {"GET"},
+		"/api/v1/guestbook":                   {"GET", "POST"},
+		"/api/v1/guestbook/{id:[0-9]+}":       {"GET", "PATCH"},
+		"/api/v1/admin/guestbook":             {"DELETE"},
+		"/api/v1/admin/guestbook/{id:[0-9]+}": {"GET"},
+	}
+	listed := make(map[string][]string)
+	for _, resource := range root.Resources {
+		listed[resource.Path] = resource.Methods
+	}
+	for path, methods := range expected {
+		if !slices.Equal(listed[path], methods) {
+			t.Errorf("Expected %s with methods %v, got %v", path, methods, listed[path])
+		}
+	}
+
+	api, header := index(t, "/api/v1")
+	if allow := header.Get("Allow"); allow != "OPTIONS" {
+		t.Errorf("Expected Allow: OPTIONS on /api/v1, got %q", allow)
+	}
+	if len(api.Resources) == 0 || len(api.Resources) >= len(root.Resources) {
+		t.Errorf("Expected /api/v1 to list only the API's resources, got %d of %d", len(api.Resources), len(root.Resources))
+	}
+	for _, resource := range api.Resources {
+		if !strings.HasPrefix(resource.Path, "/api/v1/") {
+			t.Errorf("Expected only /api/v1 resources, got %s", resource.Path)
+		}
+	}
+
+	// A CORS preflight for the root still gets the preflight answer
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Errorf("Expected an empty CORS preflight response, got %d with %q", w.Code, w.Body.String())
+	}
+}
+
+func TestServer_APIIndex_Disabled(t *testing.T) {
+	features := config.DefaultFeatures()
+	features.EnableAPIIndex = false
+	server := NewServer(config.Config{Port: "8080", Features: features})
+	server.RegisterRoutes()
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/v1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d without the index, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("Expected an empty 200 for OPTIONS / without the index, got %d with %q", w.Code, w.Body.String())
+	}
+}
+
+func TestServer_RuntimeRequiresAdmin(t *testing.T) {
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "No token", expectedStatus: http.StatusUnauthorized},
+		{name: "Admin token", authorization: "Bearer secret", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(config.Config{Port: "8080", AdminToken: "secret"})
+			server.RegisterRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/runtime", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
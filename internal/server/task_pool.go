@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// taskPool runs background tasks, such as storing audit entries, on a fixed
+// number of workers fed by a bounded queue. When the queue is full new
+// tasks are dropped with a warning, so a slow dependency sheds work instead
+// of piling up goroutines or stalling requests.
+type taskPool struct {
+	workers int
+	queue   chan func(ctx context.Context)
+
+	// ctx is passed to tasks and cancelled if Shutdown gives up on them
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Workers start with the first submitted task, so unused pools cost
+	// nothing
+	start sync.Once
+	wg    sync.WaitGroup
+
+	// mu guards closed; Submit holds it for reading while queueing so
+	// Shutdown never closes the queue under a sender
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newTaskPool creates a pool of workers (at least one) with room for
+// queueSize waiting tasks
+func newTaskPool(workers, queueSize int) *taskPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &taskPool{
+		workers: max(workers, 1),
+		queue:   make(chan func(ctx context.Context), max(queueSize, 0)),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Submit queues task without blocking. It reports false, dropping the
+// task, when the queue is full or the pool is shutting down.
+func (p *taskPool) Submit(task func(ctx context.Context)) bool {
+	p.start.Do(func() {
+		for range p.workers {
+			p.wg.Add(1)
+			go p.work()
+		}
+	})
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		slog.Warn("Dropped background task, task pool is shut down")
+		return false
+	}
+
+	select {
+	case p.queue <- task:
+		return true
+	default:
+		slog.Warn("Dropped background task, task queue is full", "queue_size", cap(p.queue))
+		return false
+	}
+}
+
+func (p *taskPool) work() {
+	defer p.wg.Done()
+	for task := range p.queue {
+		task(p.ctx)
+	}
+}
+
+// Shutdown stops accepting tasks and waits for the queued ones to finish.
+// If ctx ends first, running tasks see their context cancelled and
+// Shutdown returns ctx's error without waiting further.
+func (p *taskPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTaskPool_DropsWhenQueueIsFull(t *testing.T) {
+	pool := newTaskPool(1, 1)
+	defer pool.Shutdown(context.Background())
+
+	release := make(chan struct{})
+	running := make(chan struct{})
+	if !pool.Submit(func(ctx context.Context) {
+		close(running)
+		<-release
+	}) {
+		t.Fatal("Expected the first task to be accepted")
+	}
+	<-running
+
+	// The worker is busy, so one task fits in the queue and the next is dropped
+	if !pool.Submit(func(ctx context.Context) {}) {
+		t.Error("Expected a queued task to be accepted")
+	}
+	if pool.Submit(func(ctx context.Context) {}) {
+		t.Error("Expected a task to be dropped when the queue is full")
+	}
+
+	close(release)
+}
+
+func TestTaskPool_ShutdownDrainsQueue(t *testing.T) {
+	pool := newTaskPool(2, 10)
+
+	var ran atomic.Int32
+	for range 10 {
+		if !pool.Submit(func(ctx context.Context) {
+			time.Sleep(time.Millisecond)
+			ran.Add(1)
+		}) {
+			t.Fatal("Expected task to be accepted")
+		}
+	}
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+	if got := ran.Load(); got != 10 {
+		t.Errorf("Expected all 10 queued tasks to run before Shutdown returned, got %d", got)
+	}
+
+	if pool.Submit(func(ctx context.Context) {}) {
+		t.Error("Expected tasks submitted after Shutdown to be dropped")
+	}
+}
+
+func TestTaskPool_ShutdownTimeoutCancelsTasks(t *testing.T) {
+	pool := newTaskPool(1, 0)
+
+	cancelled := make(chan struct{})
+	running := make(chan struct{})
+	pool.start.Do(func() {
+		pool.wg.Add(1)
+		go pool.work()
+	})
+	// With an unbuffered queue Submit only succeeds once the worker is waiting
+	deadline := time.Now().Add(time.Second)
+	for !pool.Submit(func(ctx context.Context) {
+		close(running)
+		<-ctx.Done()
+		close(cancelled)
+	}) {
+		if time.Now().After(deadline) {
+			t.Fatal("Worker never became ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-running
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected Shutdown to give up with %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the running task's context to be cancelled")
+	}
+}
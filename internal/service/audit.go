@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// Audit actions recorded for write operations
+const (
+	AuditActionCreate       = "create"
+	AuditActionUpdate       = "update"
+	AuditActionUpdateStatus = "update_status"
+	AuditActionDelete       = "delete"
+)
+
+// anonymousActor is recorded for writes without an authenticated actor
+const anonymousActor = "anonymous"
+
+// AuditSink stores audit entries somewhere durable, in addition to the log
+type AuditSink interface {
+	CreateTable(ctx context.Context) error
+	Record(ctx context.Context, entry models.AuditEntry) error
+}
+
+// TaskRunner runs work in the background. Submit must not block; it reports
+// false when the task was dropped.
+type TaskRunner interface {
+	Submit(task func(ctx context.Context)) bool
+}
+
+type actorKey struct{}
+
+type clientIPKey struct{}
+
+// WithActor returns a context recording who is making the request, for
+// audit entries
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// WithClientIP returns a context recording the client's IP, for audit entries
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// UseAuditSink makes the service store audit entries in sink as well as
+// logging them. It must be called before the service is used.
+func (s *GuestBookService) UseAuditSink(sink AuditSink) {
+	s.auditSink = sink
+}
+
+// UseTasks makes the service store audit entries in the background on
+// tasks instead of while the request waits. It must be called before the
+// service is used.
+func (s *GuestBookService) UseTasks(tasks TaskRunner) {
+	s.tasks = tasks
+}
+
+// audit records a successful write. Every entry is logged; failing to store
+// it in the sink is logged too but doesn't fail the write, which has
+// already happened.
+func (s *GuestBookService) audit(ctx context.Context, action string, messageIDs []int, detail string) {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	if actor == "" {
+		actor = anonymousActor
+	}
+	clientIP, _ := ctx.Value(clientIPKey{}).(string)
+
+	entry := models.AuditEntry{
+		Action:     action,
+		MessageIDs: messageIDs,
+		Actor:      actor,
+		ClientIP:   clientIP,
+		Detail:     detail,
+		Time:       s.clock.Now(),
+	}
+
+	slog.Info("Audit",
+		"action", entry.Action,
+		"message_ids", entry.MessageIDs,
+		"actor", entry.Actor,
+		"client_ip", entry.ClientIP,
+		"detail", entry.Detail,
+		"time", entry.Time,
+	)
+
+	if s.auditSink == nil {
+		return
+	}
+
+	record := func(ctx context.Context) {
+		if err := s.auditSink.Record(ctx, entry); err != nil {
+			slog.Error("Failed to store audit entry", "action", action, "message_ids", messageIDs, "error", err)
+		}
+	}
+
+	if s.tasks != nil {
+		if !s.tasks.Submit(record) {
+			slog.Error("Failed to store audit entry, background tasks are saturated", "action", action, "message_ids", messageIDs)
+		}
+		return
+	}
+
+	// The request may be cancelled right after the write; the entry should
+	// still be stored
+	record(context.WithoutCancel(ctx))
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// recordingSink collects audit entries, optionally failing to store them
+type recordingSink struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry
+	err     error
+}
+
+func (s *recordingSink) CreateTable(ctx context.Context) error {
+	return nil
+}
+
+func (s *recordingSink) Record(ctx context.Context, entry models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestGuestBookService_Audit_WriteOperations(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewMockGuestBookRepository()
+	svc := NewGuestBookServiceWithClock(repo, newTestService(repo).config, newFakeClock(now))
+	sink := &recordingSink{}
+	svc.UseAuditSink(sink)
+
+	publicCtx := WithClientIP(context.Background(), "203.0.113.7")
+	adminCtx := WithActor(WithClientIP(context.Background(), "198.51.100.1"), "admin")
+
+	created, err := svc.CreateMessage(publicCtx, &models.CreateGuestBookMessage{
+		Name:    "Ada Lovelace",
+		Email:   "ada@example.com",
+		Message: "Hello from the audit test",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+	if _, err := svc.UpdateMessageStatus(adminCtx, "1", models.StatusRejected); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+	if _, err := svc.DeleteMessages(adminCtx, []int{1, 99}); err != nil {
+		t.Fatalf("Failed to delete messages: %v", err)
+	}
+
+	expected := []models.AuditEntry{
+		{Action: AuditActionCreate, MessageIDs: []int{created.ID}, Actor: "anonymous", ClientIP: "203.0.113.7", Time: now},
+		{Action: AuditActionUpdateStatus, MessageIDs: []int{1}, Actor: "admin", ClientIP: "198.51.100.1", Detail: "status=rejected", Time: now},
+		{Action: AuditActionDelete, MessageIDs: []int{1, 99}, Actor: "admin", ClientIP: "198.51.100.1", Detail: "deleted=1", Time: now},
+	}
+	if !reflect.DeepEqual(sink.entries, expected) {
+		t.Errorf("Expected audit entries %+v, got %+v", expected, sink.entries)
+	}
+
+	for _, action := range []string{"action=create", "action=update_status", "action=delete"} {
+		if !strings.Contains(logs.String(), action) {
+			t.Errorf("Expected an audit log line with %s, got:\n%s", action, logs.String())
+		}
+	}
+}
+
+func TestGuestBookService_Audit_FailedWritesAreNotAudited(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+	sink := &recordingSink{}
+	svc.UseAuditSink(sink)
+
+	// Invalid input never reaches the repository
+	svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{Name: "A"})
+	svc.UpdateMessageStatus(context.Background(), "42", models.StatusApproved)
+	svc.DeleteMessages(context.Background(), nil)
+
+	if len(sink.entries) != 0 {
+		t.Errorf("Expected no audit entries for failed writes, got %+v", sink.entries)
+	}
+}
+
+func TestGuestBookService_Audit_SinkErrorDoesNotFailWrite(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(1)
+	svc := newTestService(repo)
+	svc.UseAuditSink(&recordingSink{err: errors.New("audit table unavailable")})
+
+	deleted, err := svc.DeleteMessages(context.Background(), []int{1})
+	if err != nil || deleted != 1 {
+		t.Errorf("Expected the delete to succeed, got %d, %v", deleted, err)
+	}
+}
+
+// queuedTasks holds submitted tasks until run, or drops them all
+type queuedTasks struct {
+	tasks []func(ctx context.Context)
+	full  bool
+}
+
+func (q *queuedTasks) Submit(task func(ctx context.Context)) bool {
+	if q.full {
+		return false
+	}
+	q.tasks = append(q.tasks, task)
+	return true
+}
+
+func TestGuestBookService_Audit_RecordsOnTasks(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(2)
+	svc := newTestService(repo)
+	sink := &recordingSink{}
+	svc.UseAuditSink(sink)
+	tasks := &queuedTasks{}
+	svc.UseTasks(tasks)
+
+	if _, err := svc.DeleteMessages(context.Background(), []int{1}); err != nil {
+		t.Fatalf("DeleteMessages returned %v", err)
+	}
+	if len(sink.entries) != 0 || len(tasks.tasks) != 1 {
+		t.Fatalf("Expected the audit entry to be queued, not stored, got %d stored and %d queued", len(sink.entries), len(tasks.tasks))
+	}
+
+	tasks.tasks[0](context.Background())
+	if len(sink.entries) != 1 || sink.entries[0].Action != AuditActionDelete {
+		t.Errorf("Expected the queued task to store the delete entry, got %+v", sink.entries)
+	}
+
+	// A saturated pool drops the entry but never fails the write
+	tasks.full = true
+	if _, err := svc.DeleteMessages(context.Background(), []int{2}); err != nil {
+		t.Errorf("Expected the delete to succeed with a full task queue, got %v", err)
+	}
+	if len(sink.entries) != 1 {
+		t.Errorf("Expected the dropped entry not to be stored, got %+v", sink.entries)
+	}
+}
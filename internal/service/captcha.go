@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// CaptchaVerifier checks a CAPTCHA token solved by a client. Verify returns
+// an apperrors.ErrInvalidInput when the token is rejected, and any other
+// error when it couldn't be checked.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// ErrCaptchaRequired is returned for creates without a captcha_token while
+// CAPTCHA verification is on
+var ErrCaptchaRequired = apperrors.Newf(apperrors.ErrInvalidInput, "captcha_token is required")
+
+// UseCaptcha makes CreateMessage require a token that verifier accepts. It
+// must be called before the service is used.
+func (s *GuestBookService) UseCaptcha(verifier CaptchaVerifier) {
+	s.captcha = verifier
+}
+
+// verifyCaptcha checks msg's token when CAPTCHA verification is on
+func (s *GuestBookService) verifyCaptcha(ctx context.Context, msg *models.CreateGuestBookMessage) error {
+	if s.captcha == nil {
+		return nil
+	}
+	if msg.CaptchaToken == "" {
+		return ErrCaptchaRequired
+	}
+	return s.captcha.Verify(ctx, msg.CaptchaToken, msg.ClientIP)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// fakeCaptcha accepts one token, recording what it was asked to verify
+type fakeCaptcha struct {
+	valid    string
+	calls    int
+	remoteIP string
+}
+
+func (c *fakeCaptcha) Verify(ctx context.Context, token, remoteIP string) error {
+	c.calls++
+	c.remoteIP = remoteIP
+	if token != c.valid {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "captcha verification failed")
+	}
+	return nil
+}
+
+func TestGuestBookService_CreateMessage_Captcha(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		message       string
+		expectedError error
+		expectedCalls int
+	}{
+		{name: "Valid token", token: "solved", message: "Hello from a human", expectedCalls: 1},
+		{name: "Rejected token", token: "forged", message: "Hello from a bot", expectedError: apperrors.ErrInvalidInput, expectedCalls: 1},
+		{name: "Missing token", token: "", message: "Hello from a bot", expectedError: ErrCaptchaRequired, expectedCalls: 0},
+		// The token is kept for the corrected resubmission
+		{name: "Invalid message is not verified", token: "solved", message: "Hi", expectedError: apperrors.ErrInvalidInput, expectedCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockGuestBookRepository()
+			svc := newTestService(repo)
+			verifier := &fakeCaptcha{valid: "solved"}
+			svc.UseCaptcha(verifier)
+
+			_, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+				Name:         "Test User",
+				Email:        "test@example.com",
+				Message:      tt.message,
+				CaptchaToken: tt.token,
+				ClientIP:     "203.0.113.7",
+			})
+
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+			if verifier.calls != tt.expectedCalls {
+				t.Errorf("Expected %d verifications, got %d", tt.expectedCalls, verifier.calls)
+			}
+			if verifier.calls > 0 && verifier.remoteIP != "203.0.113.7" {
+				t.Errorf("Expected the client IP to be passed to the verifier, got %q", verifier.remoteIP)
+			}
+
+			created := 0
+			if tt.expectedError == nil {
+				created = 1
+			}
+			if len(repo.messages) != created {
+				t.Errorf("Expected %d stored messages, got %d", created, len(repo.messages))
+			}
+		})
+	}
+}
+
+func TestGuestBookService_CreateMessage_CaptchaDisabled(t *testing.T) {
+	svc := newTestService(NewMockGuestBookRepository())
+
+	_, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+		Name:    "Test User",
+		Email:   "test@example.com",
+		Message: "No captcha needed here",
+	})
+	if err != nil {
+		t.Errorf("Expected creates without a token to succeed when CAPTCHA is off, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package service
+
+import "time"
+
+// Clock tells the service the current time. Tests substitute a fake one to
+// control time-dependent behaviour such as the timeline's date range.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock reads the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
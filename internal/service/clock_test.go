@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/config"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// fakeClock is a Clock that only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestGuestBookService_GetTimeline_FakeClock(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, time.February, 28, 23, 30, 0, 0, time.UTC))
+	repo := NewMockGuestBookRepository()
+	repo.clock = clock
+	svc := NewGuestBookServiceWithClock(repo, config.Config{Validation: config.DefaultValidationConfig()}, clock)
+	ctx := context.Background()
+
+	if _, err := svc.CreateMessage(ctx, &models.CreateGuestBookMessage{
+		Name:    "Ada",
+		Email:   "ada@example.com",
+		Message: "Just before midnight",
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	timeline, err := svc.GetTimeline(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []models.DailyCount{{Date: "2026-02-27", Count: 0}, {Date: "2026-02-28", Count: 1}}
+	if len(timeline) != 2 || timeline[0] != expected[0] || timeline[1] != expected[1] {
+		t.Errorf("Expected %+v, got %+v", expected, timeline)
+	}
+
+	// An hour later it's a new day, and the message moves back one slot
+	clock.Advance(time.Hour)
+
+	timeline, err = svc.GetTimeline(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected = []models.DailyCount{{Date: "2026-02-28", Count: 1}, {Date: "2026-03-01", Count: 0}}
+	if len(timeline) != 2 || timeline[0] != expected[0] || timeline[1] != expected[1] {
+		t.Errorf("Expected %+v after midnight, got %+v", expected, timeline)
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+)
+
+var (
+	// ErrEditTokenRequired is returned for public edits without an edit
+	// token. It is an apperrors.ErrUnauthorized, so handlers answer 401.
+	ErrEditTokenRequired = apperrors.Newf(apperrors.ErrUnauthorized, "edit token required")
+	// ErrEditTokenInvalid is returned for public edits whose token isn't the
+	// one the message was created with, including messages created without
+	// one. It is an apperrors.ErrForbidden, so handlers answer 403.
+	ErrEditTokenInvalid = apperrors.Newf(apperrors.ErrForbidden, "invalid edit token")
+)
+
+// newEditToken returns a random token that can't be guessed, proving its
+// holder wrote the message it was issued for
+func newEditToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// hashEditToken returns the hash stored in place of token, so a leaked
+// database doesn't leak working tokens
+func hashEditToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkEditToken reports whether token is the one hashed as hash, in
+// constant time
+func checkEditToken(token, hash string) error {
+	if hash == "" {
+		return ErrEditTokenInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(hashEditToken(token)), []byte(hash)) != 1 {
+		return ErrEditTokenInvalid
+	}
+	return nil
+}
@@ -2,45 +2,351 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
+	"log/slog"
+	"net/mail"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/config"
+	"github.com/moabdelazem/app/internal/database"
 	"github.com/moabdelazem/app/internal/models"
-	"github.com/moabdelazem/app/internal/repository"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+)
+
+// GuestBookRepositoryInterface defines the data access operations the service depends on
+type GuestBookRepositoryInterface interface {
+	CreateTable(ctx context.Context) error
+	Create(ctx context.Context, msg *models.CreateGuestBookMessage, status string) (*models.GuestBookMessage, error)
+	GetByIdempotencyKey(ctx context.Context, key string) (*models.GuestBookMessage, error)
+	ReleaseIdempotencyKey(ctx context.Context, id int) error
+	GetAll(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error)
+	BeginSnapshot(ctx context.Context) (database.Snapshot, error)
+	GetAllInTx(ctx context.Context, q database.Querier, limit, offset int) ([]models.GuestBookMessage, error)
+	CountInTx(ctx context.Context, q database.Querier) (int, error)
+	StreamAll(ctx context.Context, limit, offset int) iter.Seq2[models.GuestBookMessage, error]
+	GetByEmail(ctx context.Context, email string, limit, offset int) ([]models.GuestBookMessage, error)
+	GetByTag(ctx context.Context, tag string, limit, offset int) ([]models.GuestBookMessage, error)
+	GetByStatus(ctx context.Context, status string, limit, offset int) ([]models.GuestBookMessage, error)
+	GetByID(ctx context.Context, id int) (*models.GuestBookMessage, error)
+	GetByIDFromPrimary(ctx context.Context, id int) (*models.GuestBookMessage, error)
+	SetStatus(ctx context.Context, id int, status string) (*models.GuestBookMessage, error)
+	Update(ctx context.Context, id int, patch *models.PatchGuestBookMessage, status string) (*models.GuestBookMessage, error)
+	DeleteByIDs(ctx context.Context, ids []int) (int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	Count(ctx context.Context) (int, error)
+	CountByEmail(ctx context.Context, email string) (int, error)
+	CountAllByEmail(ctx context.Context, email string) (int, error)
+	CountByTag(ctx context.Context, tag string) (int, error)
+	CountByStatus(ctx context.Context) (models.ModerationCounts, error)
+	LastChangedAt(ctx context.Context) (time.Time, error)
+	CountByDay(ctx context.Context, since time.Time) ([]models.DailyCount, error)
+	MessageLengthStats(ctx context.Context) (models.MessageLengthStats, error)
+	Search(ctx context.Context, q string, limit int) ([]models.SearchResult, error)
+	Neighbors(ctx context.Context, createdAt time.Time, id int) (*models.MessageNeighbors, error)
+}
+
+const (
+	// DefaultTimelineDays is the timeline range used when none is requested
+	DefaultTimelineDays = 30
+	// MaxTimelineDays caps the timeline range to keep the response small
+	MaxTimelineDays = 365
+
+	// MaxPage bounds page numbers. Later pages are empty and are answered
+	// without querying for rows.
+	MaxPage = 1_000_000
+
+	// MaxRangeLimit caps how many messages one Range request returns,
+	// matching the largest page size
+	MaxRangeLimit = 100
+
+	// DefaultSearchLimit is the number of search results returned when no
+	// limit is requested
+	DefaultSearchLimit = 20
+	// MaxSearchLimit caps the number of search results
+	MaxSearchLimit = 100
+	// MaxSearchQueryLength bounds the search text, in characters
+	MaxSearchQueryLength = 200
 )
 
 type GuestBookService struct {
-	repo *repository.GuestBookRepository
+	repo   GuestBookRepositoryInterface
+	config config.Config
+	clock  Clock
+	// auditSink stores audit entries durably; nil when they are only logged
+	auditSink AuditSink
+	// tasks, when set, runs audit sink writes in the background
+	tasks TaskRunner
+	// captcha, when set, must accept a token before a message is created
+	captcha CaptchaVerifier
+	// lookups coalesces concurrent GetMessageByID calls for the same ID
+	lookups singleflight.Group
+	// lookupMu guards lookupWaiters, which tracks who is waiting on each
+	// shared lookup so it can be cancelled once nobody is
+	lookupMu      sync.Mutex
+	lookupWaiters map[string]*sharedLookup
+	// snapshotMu guards snapshots, the open pagination snapshots by token,
+	// and snapshotsOpening, how many are being begun
+	snapshotMu       sync.Mutex
+	snapshots        map[string]*snapshotSession
+	snapshotsOpening int
+}
+
+// sharedLookup is the context of a coalesced GetByID query and how many
+// callers are waiting on it
+type sharedLookup struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
 }
 
-func NewGuestBookService(repo *repository.GuestBookRepository) *GuestBookService {
-	return &GuestBookService{repo: repo}
+func NewGuestBookService(repo GuestBookRepositoryInterface, cfg config.Config) *GuestBookService {
+	return NewGuestBookServiceWithClock(repo, cfg, realClock{})
 }
 
+// NewGuestBookServiceWithClock creates a service that reads the time from clock
+func NewGuestBookServiceWithClock(repo GuestBookRepositoryInterface, cfg config.Config, clock Clock) *GuestBookService {
+	return &GuestBookService{
+		repo:          repo,
+		config:        cfg,
+		clock:         clock,
+		lookupWaiters: make(map[string]*sharedLookup),
+		snapshots:     make(map[string]*snapshotSession),
+	}
+}
+
+// seedIdempotencyKey marks the welcome message so concurrent or repeated
+// startups never insert it twice. Keys from requests are stored scoped to
+// their client (see scopeIdempotencyKey), so no request can replay it.
+const seedIdempotencyKey = "seed-welcome-message"
+
 func (s *GuestBookService) InitializeDatabase(ctx context.Context) error {
-	return s.repo.CreateTable(ctx)
+	if err := s.repo.CreateTable(ctx); err != nil {
+		return err
+	}
+
+	if s.auditSink != nil {
+		if err := s.auditSink.CreateTable(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Imported messages come first, so the welcome message is only added
+	// to a guest book that is still empty
+	if s.config.Seed.File != "" {
+		if err := s.importSeedFile(ctx); err != nil {
+			return err
+		}
+	}
+
+	if s.config.Seed.Enabled {
+		return s.seedWelcomeMessage(ctx)
+	}
+
+	return nil
+}
+
+// seedWelcomeMessage inserts the configured welcome message when the guest
+// book is empty, so demos don't start with a blank page
+func (s *GuestBookService) seedWelcomeMessage(ctx context.Context) error {
+	count, err := s.repo.Count(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	msg := &models.CreateGuestBookMessage{
+		Name:           s.config.Seed.Name,
+		Email:          s.config.Seed.Email,
+		Message:        s.config.Seed.Message,
+		IdempotencyKey: seedIdempotencyKey,
+	}
+	if err := ValidateCreateMessage(msg, s.config.Validation); err != nil {
+		return fmt.Errorf("invalid seed message: %w", err)
+	}
+
+	// The welcome message is published directly, bypassing moderation
+	seeded, err := s.repo.Create(ctx, msg, models.StatusApproved)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Seeded welcome message", "id", seeded.ID)
+	return nil
 }
 
 func (s *GuestBookService) CreateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.GuestBookMessage, error) {
-	if err := s.validateCreateMessage(msg); err != nil {
+	prepared, err := s.prepareMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	prepared.IdempotencyKey = scopeIdempotencyKey(s.config.MetadataSalt, msg.ClientIP, prepared.IdempotencyKey)
+	prepared.IdempotencyFingerprint = fingerprintMessage(prepared)
+
+	// A retry under a live idempotency key stores nothing new, so it isn't
+	// held to the quota: the original may have been the message that
+	// reached it
+	replay, err := s.hasLiveIdempotencyKey(ctx, prepared.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if !replay {
+		if err := s.checkEmailQuota(ctx, prepared.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	// Verified after validation, since tokens are single use: a client
+	// fixing a validation error can resubmit the same token
+	if err := s.verifyCaptcha(ctx, msg); err != nil {
 		return nil, err
 	}
+	msg = prepared
+
+	status := models.StatusApproved
+	if s.config.ModerationEnabled {
+		status = models.StatusPending
+	}
+
+	editToken := newEditToken()
+	msg.EditTokenHash = hashEditToken(editToken)
 
-	return s.repo.Create(ctx, msg)
+	created, err := s.createIdempotent(ctx, msg, status)
+	if err != nil {
+		return nil, err
+	}
+	// A replayed idempotency key returns the original message, whose token
+	// was already handed out and can't be recovered
+	if created.EditTokenHash == msg.EditTokenHash {
+		created.EditToken = editToken
+	}
+
+	s.audit(ctx, AuditActionCreate, []int{created.ID}, "")
+	return created, nil
 }
 
-func (s *GuestBookService) GetMessages(ctx context.Context, page, pageSize int) ([]models.GuestBookMessage, int, error) {
-	if page < 1 {
-		page = 1
+// createIdempotent stores msg, unless its idempotency key already created a
+// message within IDEMPOTENCY_KEY_TTL: then that message is returned if the
+// request is the same, and ErrIdempotencyKeyReused if it isn't. A replay is
+// told apart by its edit token hash, which is new for every request.
+func (s *GuestBookService) createIdempotent(ctx context.Context, msg *models.CreateGuestBookMessage, status string) (*models.GuestBookMessage, error) {
+	created, err := s.repo.Create(ctx, msg, status)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := func() bool { return created.EditTokenHash != msg.EditTokenHash }
+	if ttl := s.config.IdempotencyKeyTTL; replayed() && ttl > 0 && s.clock.Now().Sub(created.CreatedAt) > ttl {
+		if err := s.repo.ReleaseIdempotencyKey(ctx, created.ID); err != nil {
+			return nil, err
+		}
+		if created, err = s.repo.Create(ctx, msg, status); err != nil {
+			return nil, err
+		}
+	}
+
+	if replayed() && created.IdempotencyFingerprint != msg.IdempotencyFingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return created, nil
+}
+
+// hasLiveIdempotencyKey reports whether key already created a message within
+// IDEMPOTENCY_KEY_TTL, so creating with it returns that message or
+// ErrIdempotencyKeyReused rather than storing a new one
+func (s *GuestBookService) hasLiveIdempotencyKey(ctx context.Context, key string) (bool, error) {
+	if key == "" {
+		return false, nil
+	}
+
+	existing, err := s.repo.GetByIdempotencyKey(ctx, key)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return false, nil
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
+	if err != nil {
+		return false, err
 	}
 
-	offset := (page - 1) * pageSize
+	ttl := s.config.IdempotencyKeyTTL
+	return ttl <= 0 || s.clock.Now().Sub(existing.CreatedAt) <= ttl, nil
+}
+
+// ErrTooManyMessages is returned when creating a message would take its
+// email address past MAX_MESSAGES_PER_EMAIL. It is an
+// apperrors.ErrTooManyRequests, so handlers answer 429.
+var ErrTooManyMessages = apperrors.Newf(apperrors.ErrTooManyRequests, "too many messages from this email address")
+
+// checkEmailQuota rejects a new message from email once that address has
+// MAX_MESSAGES_PER_EMAIL messages in any moderation status, so rejected
+// and pending messages count against a flooding author too
+func (s *GuestBookService) checkEmailQuota(ctx context.Context, email string) error {
+	limit := s.config.MaxMessagesPerEmail
+	if limit <= 0 {
+		return nil
+	}
 
-	messages, err := s.repo.GetAll(ctx, pageSize, offset)
+	count, err := s.repo.CountAllByEmail(ctx, email)
 	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrTooManyMessages
+	}
+	return nil
+}
+
+// ValidateMessage runs CreateMessage's sanitization and validation without
+// storing anything, returning the message as it would be saved
+func (s *GuestBookService) ValidateMessage(ctx context.Context, msg *models.CreateGuestBookMessage) (*models.CreateGuestBookMessage, error) {
+	return s.prepareMessage(msg)
+}
+
+// prepareMessage returns a sanitized, validated copy of msg ready to store
+func (s *GuestBookService) prepareMessage(msg *models.CreateGuestBookMessage) (*models.CreateGuestBookMessage, error) {
+	// Request metadata is dropped unless capture is explicitly enabled
+	var metadata *models.MessageMetadata
+	if s.config.CaptureMetadata {
+		metadata = buildMetadata(s.config.MetadataSalt, msg)
+	}
+
+	// Sanitize before validating so the stored text is what gets length-checked
+	msg = &models.CreateGuestBookMessage{
+		Name:           sanitizeText(s.config.SanitizeInput, msg.Name),
+		Email:          msg.Email,
+		Message:        sanitizeText(s.config.SanitizeInput, msg.Message),
+		Tags:           normalizeTags(msg.Tags),
+		IdempotencyKey: msg.IdempotencyKey,
+		Metadata:       metadata,
+	}
+
+	if err := ValidateCreateMessage(msg, s.config.Validation); err != nil {
+		recordValidationFailure(err)
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *GuestBookService) GetMessages(ctx context.Context, page, pageSize int) ([]models.GuestBookMessage, int, error) {
+	return listPage(ctx, page, pageSize, s.repo.GetAll, s.repo.Count)
+}
+
+// StreamMessages is GetMessages for large responses: it counts first, then
+// returns an iterator that reads the page one message at a time
+func (s *GuestBookService) StreamMessages(ctx context.Context, page, pageSize int) (iter.Seq2[models.GuestBookMessage, error], int, error) {
+	page, pageSize = NormalizePage(page, pageSize)
+
+	if err := ctx.Err(); err != nil {
 		return nil, 0, err
 	}
 
@@ -49,30 +355,709 @@ func (s *GuestBookService) GetMessages(ctx context.Context, page, pageSize int)
 		return nil, 0, err
 	}
 
+	// Pages past the end are known to be empty without querying for rows
+	offset, ok := pageOffset(page, pageSize)
+	if !ok || offset >= total {
+		return noMessages, total, nil
+	}
+
+	return s.repo.StreamAll(ctx, pageSize, offset), total, nil
+}
+
+// noMessages is an empty message iterator
+func noMessages(yield func(models.GuestBookMessage, error) bool) {}
+
+// GetMessagesRange returns up to limit approved messages starting offset
+// messages from the newest, and the total. limit is capped at MaxRangeLimit.
+func (s *GuestBookService) GetMessagesRange(ctx context.Context, offset, limit int) ([]models.GuestBookMessage, int, error) {
+	return listMessageRange(ctx, offset, limit, s.repo.GetAll, s.repo.Count)
+}
+
+// GetMessagesByEmailRange is GetMessagesRange for the messages
+// GetMessagesByEmail lists
+func (s *GuestBookService) GetMessagesByEmailRange(ctx context.Context, email string, offset, limit int) ([]models.GuestBookMessage, int, error) {
+	if err := validateEmail(email); err != nil {
+		return nil, 0, err
+	}
+
+	return listMessageRange(ctx, offset, limit,
+		func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+			return s.repo.GetByEmail(ctx, email, limit, offset)
+		},
+		func(ctx context.Context) (int, error) {
+			return s.repo.CountByEmail(ctx, email)
+		},
+	)
+}
+
+// GetMessagesByTagRange is GetMessagesRange for the messages
+// GetMessagesByTag lists
+func (s *GuestBookService) GetMessagesByTagRange(ctx context.Context, tag string, offset, limit int) ([]models.GuestBookMessage, int, error) {
+	tag = normalizeTag(tag)
+	if err := validateTag(tag); err != nil {
+		return nil, 0, err
+	}
+
+	return listMessageRange(ctx, offset, limit,
+		func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+			return s.repo.GetByTag(ctx, tag, limit, offset)
+		},
+		func(ctx context.Context) (int, error) {
+			return s.repo.CountByTag(ctx, tag)
+		},
+	)
+}
+
+// listMessageRange validates a Range request and caps limit at
+// MaxRangeLimit, then fetches it with listRange
+func listMessageRange(
+	ctx context.Context,
+	offset, limit int,
+	list func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error),
+	count func(ctx context.Context) (int, error),
+) ([]models.GuestBookMessage, int, error) {
+	if offset < 0 || limit < 1 {
+		return nil, 0, apperrors.Newf(apperrors.ErrInvalidInput, "invalid message range")
+	}
+	if limit > MaxRangeLimit {
+		limit = MaxRangeLimit
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return listRange(ctx, offset, limit, list, count)
+}
+
+// GetMessagesByEmail returns a page of approved messages written with
+// exactly the given email address, and how many such messages there are
+func (s *GuestBookService) GetMessagesByEmail(ctx context.Context, email string, page, pageSize int) ([]models.GuestBookMessage, int, error) {
+	if err := validateEmail(email); err != nil {
+		return nil, 0, err
+	}
+
+	return listPage(ctx, page, pageSize,
+		func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+			return s.repo.GetByEmail(ctx, email, limit, offset)
+		},
+		func(ctx context.Context) (int, error) {
+			return s.repo.CountByEmail(ctx, email)
+		},
+	)
+}
+
+// GetMessagesByTag returns a page of approved messages carrying tag, and
+// how many such messages there are. The tag is matched case-insensitively.
+func (s *GuestBookService) GetMessagesByTag(ctx context.Context, tag string, page, pageSize int) ([]models.GuestBookMessage, int, error) {
+	tag = normalizeTag(tag)
+	if err := validateTag(tag); err != nil {
+		return nil, 0, err
+	}
+
+	return listPage(ctx, page, pageSize,
+		func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+			return s.repo.GetByTag(ctx, tag, limit, offset)
+		},
+		func(ctx context.Context) (int, error) {
+			return s.repo.CountByTag(ctx, tag)
+		},
+	)
+}
+
+// listPage normalizes page and pageSize, then fetches that page with list
+// and the total with count
+func listPage(
+	ctx context.Context,
+	page, pageSize int,
+	list func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error),
+	count func(ctx context.Context) (int, error),
+) ([]models.GuestBookMessage, int, error) {
+	page, pageSize = NormalizePage(page, pageSize)
+
+	// Don't query at all if the client has already gone away
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// No page this deep can have rows, so only the total is needed
+	offset, ok := pageOffset(page, pageSize)
+	if !ok {
+		total, err := count(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []models.GuestBookMessage{}, total, nil
+	}
+
+	return listRange(ctx, offset, pageSize, list, count)
+}
+
+// listPageInTx is listPage for list and count running in one transaction,
+// such as a snapshot. A transaction has a single connection, which can't
+// run two queries at once, so they run one after the other.
+func listPageInTx(
+	ctx context.Context,
+	page, pageSize int,
+	list func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error),
+	count func(ctx context.Context) (int, error),
+) ([]models.GuestBookMessage, int, error) {
+	page, pageSize = NormalizePage(page, pageSize)
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	messages := []models.GuestBookMessage{}
+	if offset, ok := pageOffset(page, pageSize); ok {
+		var err error
+		if messages, err = list(ctx, pageSize, offset); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	total, err := count(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	return messages, total, nil
 }
 
-func (s *GuestBookService) GetMessageByID(ctx context.Context, idStr string) (*models.GuestBookMessage, error) {
+// listRange fetches limit messages from offset with list and the total
+// with count, concurrently. list and count must run on the pool, each with
+// a connection of its own; see listPageInTx for transactions.
+func listRange(
+	ctx context.Context,
+	offset, limit int,
+	list func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error),
+	count func(ctx context.Context) (int, error),
+) ([]models.GuestBookMessage, int, error) {
+	// The page and the count are independent, so run them concurrently. Each
+	// list request holds two pooled connections at once; the first error
+	// cancels the sibling query.
+	var (
+		messages []models.GuestBookMessage
+		total    int
+	)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		var err error
+		messages, err = list(gctx, limit, offset)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		total, err = count(gctx)
+		return err
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, 0, err
+	}
+
+	return messages, total, nil
+}
+
+// ErrInvalidID is returned for message IDs that aren't positive integers.
+// It is an apperrors.ErrInvalidInput, so handlers answer 400.
+var ErrInvalidID = apperrors.Newf(apperrors.ErrInvalidInput, "message ID must be a positive integer")
+
+// ParseMessageID parses a message ID from a path. IDs are SERIAL, so zero,
+// negative numbers and anything too large for an int can never exist; they
+// are rejected with ErrInvalidID rather than looked up.
+func ParseMessageID(idStr string) (int, error) {
 	id, err := strconv.Atoi(idStr)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, apperrors.Newf(ErrInvalidID, "message ID %s is out of range", idStr)
+	}
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidID
+	}
+	return id, nil
+}
+
+func (s *GuestBookService) GetMessageByID(ctx context.Context, idStr string) (*models.GuestBookMessage, error) {
+	id, err := ParseMessageID(idStr)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := s.getByIDShared(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages awaiting or failing moderation are hidden from the public API
+	if msg.Status != models.StatusApproved {
+		return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+	}
+
+	return msg, nil
+}
+
+// GetMessageNeighbors returns the approved messages created just before and
+// after an approved message, for prev/next navigation
+func (s *GuestBookService) GetMessageNeighbors(ctx context.Context, idStr string) (*models.MessageNeighbors, error) {
+	msg, err := s.GetMessageByID(ctx, idStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.Neighbors(ctx, msg.CreatedAt, msg.ID)
+}
+
+// getByIDShared fetches a message, sharing one query between concurrent
+// callers for the same ID. Nothing is cached once the query returns, so
+// errors and stale rows never outlive it.
+func (s *GuestBookService) getByIDShared(ctx context.Context, id int) (*models.GuestBookMessage, error) {
+	key := strconv.Itoa(id)
+	lookup := s.joinLookup(ctx, key)
+	defer s.leaveLookup(key, lookup)
+
+	// The shared query must not fail for everyone when the caller that
+	// started it goes away, so it runs under its own context, cancelled
+	// only when the last waiting caller has gone
+	ch := s.lookups.DoChan(key, func() (interface{}, error) {
+		return s.repo.GetByID(lookup.ctx, id)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		// Give each caller its own copy of the shared message
+		msg := *result.Val.(*models.GuestBookMessage)
+		return &msg, nil
+	}
+}
+
+// joinLookup registers a caller waiting on the shared lookup for key,
+// starting a new one if nobody else is waiting
+func (s *GuestBookService) joinLookup(ctx context.Context, key string) *sharedLookup {
+	s.lookupMu.Lock()
+	defer s.lookupMu.Unlock()
+
+	lookup, ok := s.lookupWaiters[key]
+	if !ok {
+		lookupCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		lookup = &sharedLookup{ctx: lookupCtx, cancel: cancel}
+		s.lookupWaiters[key] = lookup
+	}
+	lookup.waiters++
+	return lookup
+}
+
+// leaveLookup unregisters a caller. The last one out cancels the query, so
+// an abandoned lookup frees its pooled connection instead of running on.
+func (s *GuestBookService) leaveLookup(key string, lookup *sharedLookup) {
+	s.lookupMu.Lock()
+	defer s.lookupMu.Unlock()
+
+	lookup.waiters--
+	if lookup.waiters > 0 {
+		return
+	}
+
+	lookup.cancel()
+	delete(s.lookupWaiters, key)
+	// Later callers must start a fresh query rather than join the
+	// cancelled one
+	s.lookups.Forget(key)
+}
+
+// UpdateMessageStatus sets the moderation status of a message. A missing
+// message is reported as not found before the update is attempted.
+func (s *GuestBookService) UpdateMessageStatus(ctx context.Context, idStr, status string) (*models.GuestBookMessage, error) {
+	id, err := ParseMessageID(idStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !models.IsValidStatus(status) {
+		return nil, apperrors.Newf(apperrors.ErrInvalidInput, "status must be one of %s, %s, %s",
+			models.StatusPending, models.StatusApproved, models.StatusRejected)
+	}
+
+	exists, err := s.MessageExists(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+	}
+
+	message, err := s.repo.SetStatus(ctx, id, status)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, AuditActionUpdateStatus, []int{id}, "status="+status)
+	return message, nil
+}
+
+// ErrEditWindowExpired is returned for edits to messages created longer
+// than EDIT_WINDOW ago. It is an apperrors.ErrForbidden, so handlers
+// answer 403.
+var ErrEditWindowExpired = apperrors.Newf(apperrors.ErrForbidden, "edit window expired")
+
+// PatchMessage applies a partial update to an approved message, changing
+// only the fields present in patch. Text fields are sanitized like new
+// messages. With moderation enabled the edited message goes back to pending,
+// so edits can't slip past review. Messages older than the configured edit
+// window can't be edited. Only the author may edit: editToken must be the
+// token issued when the message was created.
+func (s *GuestBookService) PatchMessage(ctx context.Context, idStr, editToken string, patch *models.PatchGuestBookMessage) (*models.GuestBookMessage, error) {
+	id, err := ParseMessageID(idStr)
+	if err != nil {
+		return nil, err
+	}
+	if editToken == "" {
+		return nil, ErrEditTokenRequired
+	}
+
+	patch = s.preparePatch(patch)
+	if err := ValidatePatchMessage(patch, s.config.Validation); err != nil {
+		return nil, err
+	}
+
+	// Read from the primary: the author may edit right after creating
+	existing, err := s.repo.GetByIDFromPrimary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Only messages the public can see can be edited through the public
+	// API. Checking this before the token keeps hidden messages from being
+	// told apart from missing ones.
+	if existing.Status != models.StatusApproved {
+		return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+	}
+	if err := checkEditToken(editToken, existing.EditTokenHash); err != nil {
+		return nil, err
+	}
+	if window := s.config.EditWindow; window > 0 && s.clock.Now().Sub(existing.CreatedAt) > window {
+		return nil, ErrEditWindowExpired
+	}
+
+	status := ""
+	if s.config.ModerationEnabled {
+		status = models.StatusPending
+	}
+
+	updated, err := s.repo.Update(ctx, id, patch, status)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, AuditActionUpdate, []int{id}, "fields="+strings.Join(patch.Fields(), ","))
+	return updated, nil
+}
+
+// preparePatch returns a copy of patch with its present fields sanitized
+// and normalized the way prepareMessage treats new messages
+func (s *GuestBookService) preparePatch(patch *models.PatchGuestBookMessage) *models.PatchGuestBookMessage {
+	prepared := &models.PatchGuestBookMessage{Email: patch.Email}
+	if patch.Name != nil {
+		name := sanitizeText(s.config.SanitizeInput, *patch.Name)
+		prepared.Name = &name
+	}
+	if patch.Message != nil {
+		message := sanitizeText(s.config.SanitizeInput, *patch.Message)
+		prepared.Message = &message
+	}
+	if patch.Tags != nil {
+		// An empty array clears the tags, so keep it non-nil
+		tags := append([]string{}, normalizeTags(*patch.Tags)...)
+		prepared.Tags = &tags
+	}
+	return prepared
+}
+
+// ValidateDeleteIDs checks a batch delete request: between one and
+// models.MaxDeleteIDs positive IDs
+func ValidateDeleteIDs(ids []int) error {
+	if len(ids) == 0 {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "ids must not be empty")
+	}
+	if len(ids) > models.MaxDeleteIDs {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "at most %d ids may be deleted at once, got %d", models.MaxDeleteIDs, len(ids))
+	}
+	for _, id := range ids {
+		if id <= 0 {
+			return ErrInvalidID
+		}
+	}
+	return nil
+}
+
+// DeleteMessages deletes the messages with the given IDs and returns how
+// many existed
+func (s *GuestBookService) DeleteMessages(ctx context.Context, ids []int) (int, error) {
+	if err := ValidateDeleteIDs(ids); err != nil {
+		return 0, err
+	}
+
+	deleted, err := s.repo.DeleteByIDs(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	s.audit(ctx, AuditActionDelete, ids, fmt.Sprintf("deleted=%d", deleted))
+	return deleted, nil
+}
+
+// GetMessageForAdmin returns a message regardless of its moderation status
+func (s *GuestBookService) GetMessageForAdmin(ctx context.Context, idStr string) (*models.GuestBookMessage, error) {
+	id, err := ParseMessageID(idStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid message ID")
+		return nil, err
 	}
 
 	return s.repo.GetByID(ctx, id)
 }
 
-func (s *GuestBookService) validateCreateMessage(msg *models.CreateGuestBookMessage) error {
-	if len(msg.Name) < 2 || len(msg.Name) > 100 {
-		return fmt.Errorf("name must be between 2 and 100 characters")
+// GetPendingMessages returns a page of the messages waiting for moderation,
+// oldest first, with how many messages are in each status. The pending
+// count is the total the page belongs to.
+func (s *GuestBookService) GetPendingMessages(ctx context.Context, page, pageSize int) ([]models.GuestBookMessage, models.ModerationCounts, error) {
+	var counts models.ModerationCounts
+	messages, _, err := listPage(ctx, page, pageSize,
+		func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+			return s.repo.GetByStatus(ctx, models.StatusPending, limit, offset)
+		},
+		func(ctx context.Context) (int, error) {
+			var err error
+			counts, err = s.repo.CountByStatus(ctx)
+			return counts.Pending, err
+		},
+	)
+	if err != nil {
+		return nil, models.ModerationCounts{}, err
 	}
 
-	if len(msg.Email) == 0 || len(msg.Email) > 255 {
-		return fmt.Errorf("email must be between 1 and 255 characters")
+	return messages, counts, nil
+}
+
+// MessageExists reports whether a message with the given ID exists, for
+// mutations that should 404 before doing any work
+func (s *GuestBookService) MessageExists(ctx context.Context, id int) (bool, error) {
+	return s.repo.Exists(ctx, id)
+}
+
+// CountMessages returns the number of publicly visible messages without
+// fetching any rows
+func (s *GuestBookService) CountMessages(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// CountMessagesByEmail returns the number of publicly visible messages from
+// email, as GetMessagesByEmail totals them
+func (s *GuestBookService) CountMessagesByEmail(ctx context.Context, email string) (int, error) {
+	if err := validateEmail(email); err != nil {
+		return 0, err
+	}
+
+	return s.repo.CountByEmail(ctx, email)
+}
+
+// CountMessagesByTag returns the number of publicly visible messages with
+// tag, as GetMessagesByTag totals them
+func (s *GuestBookService) CountMessagesByTag(ctx context.Context, tag string) (int, error) {
+	tag = normalizeTag(tag)
+	if err := validateTag(tag); err != nil {
+		return 0, err
+	}
+
+	return s.repo.CountByTag(ctx, tag)
+}
+
+// GetLastModified returns the time of the most recent change to the guest
+// book, deletes included, or the zero time when nothing has changed.
+func (s *GuestBookService) GetLastModified(ctx context.Context) (time.Time, error) {
+	return s.repo.LastChangedAt(ctx)
+}
+
+// GetMessageLengthStats returns the minimum, average, maximum and median
+// length of the publicly visible messages
+func (s *GuestBookService) GetMessageLengthStats(ctx context.Context) (models.MessageLengthStats, error) {
+	return s.repo.MessageLengthStats(ctx)
+}
+
+// GetTimeline returns message counts for each of the last days calendar days
+// (UTC, oldest first, including today), with zero counts for quiet days
+func (s *GuestBookService) GetTimeline(ctx context.Context, days int) ([]models.DailyCount, error) {
+	if days < 1 {
+		days = DefaultTimelineDays
+	}
+	if days > MaxTimelineDays {
+		days = MaxTimelineDays
+	}
+
+	now := s.clock.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, -(days - 1))
+
+	counts, err := s.repo.CountByDay(ctx, start)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(msg.Message) < 10 || len(msg.Message) > 1000 {
-		return fmt.Errorf("message must be between 10 and 1000 characters")
+	byDate := make(map[string]int, len(counts))
+	for _, c := range counts {
+		byDate[c.Date] = c.Count
+	}
+
+	timeline := make([]models.DailyCount, 0, days)
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format(models.DateFormat)
+		timeline = append(timeline, models.DailyCount{Date: date, Count: byDate[date]})
+	}
+
+	return timeline, nil
+}
+
+// SearchMessages returns approved messages matching q, most relevant first.
+// Out-of-range limits are clamped.
+func (s *GuestBookService) SearchMessages(ctx context.Context, q string, limit int) ([]models.SearchResult, error) {
+	// Control characters (including NUL, which Postgres rejects in text)
+	// never carry meaning in a search
+	q = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, q))
+
+	if q == "" {
+		return nil, apperrors.Newf(apperrors.ErrInvalidInput, "search query must not be empty")
+	}
+	if utf8.RuneCountInString(q) > MaxSearchQueryLength {
+		return nil, apperrors.Newf(apperrors.ErrInvalidInput, "search query must be at most %d characters", MaxSearchQueryLength)
 	}
 
+	if limit < 1 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	return s.repo.Search(ctx, q, limit)
+}
+
+// validateEmail checks that email is a single bare address such as
+// ada@example.com, without a display name or angle brackets
+func validateEmail(email string) error {
+	if len(email) == 0 || len(email) > 255 {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "email must be between 1 and 255 characters")
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "email must be a valid address")
+	}
+
+	return nil
+}
+
+// ValidateCreateMessage checks a new message against the configured length bounds
+func ValidateCreateMessage(msg *models.CreateGuestBookMessage, limits config.ValidationConfig) error {
+	if err := validateName(msg.Name, limits); err != nil {
+		return invalidField(ValidationFieldName, err)
+	}
+
+	if err := validateEmailLength(msg.Email); err != nil {
+		return invalidField(ValidationFieldEmail, err)
+	}
+
+	if err := validateMessageText(msg.Message, limits); err != nil {
+		return invalidField(ValidationFieldMessage, err)
+	}
+
+	if err := validateTags(msg.Tags); err != nil {
+		return invalidField(ValidationFieldTags, err)
+	}
+
+	if len(msg.IdempotencyKey) > models.MaxIdempotencyKeyLength {
+		return invalidField(ValidationFieldIdempotencyKey,
+			apperrors.Newf(apperrors.ErrInvalidInput, "idempotency key must be at most %d characters", models.MaxIdempotencyKeyLength))
+	}
+
+	return nil
+}
+
+// ValidatePatchMessage checks the fields present in a partial update against
+// the same bounds as ValidateCreateMessage. A patch must change something.
+func ValidatePatchMessage(patch *models.PatchGuestBookMessage, limits config.ValidationConfig) error {
+	if len(patch.Fields()) == 0 {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "patch must set at least one of name, email, message or tags")
+	}
+
+	if patch.Name != nil {
+		if err := validateName(*patch.Name, limits); err != nil {
+			return err
+		}
+	}
+
+	if patch.Email != nil {
+		if err := validateEmailLength(*patch.Email); err != nil {
+			return err
+		}
+	}
+
+	if patch.Message != nil {
+		if err := validateMessageText(*patch.Message, limits); err != nil {
+			return err
+		}
+	}
+
+	if patch.Tags != nil {
+		if err := validateTags(*patch.Tags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateName checks the name's length. Like the other limits here it
+// counts characters, as config.ValidationConfig documents, so multi-byte
+// text gets the same limits as ASCII.
+func validateName(name string, limits config.ValidationConfig) error {
+	if !utf8.ValidString(name) {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "name must be valid UTF-8")
+	}
+	if length := utf8.RuneCountInString(name); length < limits.NameMin || length > limits.NameMax {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "name must be between %d and %d characters", limits.NameMin, limits.NameMax)
+	}
+	return nil
+}
+
+func validateEmailLength(email string) error {
+	if !utf8.ValidString(email) {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "email must be valid UTF-8")
+	}
+	if length := utf8.RuneCountInString(email); length == 0 || length > 255 {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "email must be between 1 and 255 characters")
+	}
+	return nil
+}
+
+// validateMessageText checks the message's length in characters and, since
+// the TEXT column has no limit of its own, its size in bytes
+func validateMessageText(message string, limits config.ValidationConfig) error {
+	if !utf8.ValidString(message) {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "message must be valid UTF-8")
+	}
+	if length := utf8.RuneCountInString(message); length < limits.MessageMin || length > limits.MessageMax {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "message must be between %d and %d characters", limits.MessageMin, limits.MessageMax)
+	}
+	if maxBytes := limits.MessageByteLimit(); len(message) > maxBytes {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "message must be at most %d bytes when encoded as UTF-8", maxBytes)
+	}
 	return nil
 }
@@ -0,0 +1,1761 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/config"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+func TestGuestBookService_GetMessages(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(3)
+
+	messages, total, err := svc.GetMessages(context.Background(), 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if total != 3 {
+		t.Errorf("Expected total 3, got %d", total)
+	}
+	if len(messages) != 2 {
+		t.Errorf("Expected 2 messages, got %d", len(messages))
+	}
+}
+
+func TestGuestBookService_GetMessagesRange(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(5)
+
+	messages, total, err := svc.GetMessagesRange(context.Background(), 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if total != 5 {
+		t.Errorf("Expected total 5, got %d", total)
+	}
+	if len(messages) != 2 || messages[0].ID != 4 || messages[1].ID != 3 {
+		t.Errorf("Expected messages 4 and 3, got %+v", messages)
+	}
+
+	for _, bad := range [][2]int{{-1, 10}, {0, 0}} {
+		if _, _, err := svc.GetMessagesRange(context.Background(), bad[0], bad[1]); !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for offset %d limit %d, got %v", bad[0], bad[1], err)
+		}
+	}
+}
+
+func TestGuestBookService_GetMessagesRange_Filtered(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(5)
+	for i := range repo.messages {
+		if i%2 == 0 {
+			repo.messages[i].Email = "ada@example.com"
+			repo.messages[i].Tags = []string{"greeting"}
+		}
+	}
+
+	// Messages 1, 3 and 5 match, newest first
+	byEmail, total, err := svc.GetMessagesByEmailRange(context.Background(), "ada@example.com", 1, 5)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 3 || len(byEmail) != 2 || byEmail[0].ID != 3 || byEmail[1].ID != 1 {
+		t.Errorf("Expected messages 3 and 1 of 3, got %+v of %d", byEmail, total)
+	}
+
+	byTag, total, err := svc.GetMessagesByTagRange(context.Background(), " Greeting", 0, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 3 || len(byTag) != 1 || byTag[0].ID != 5 {
+		t.Errorf("Expected message 5 of 3, got %+v of %d", byTag, total)
+	}
+
+	if _, _, err := svc.GetMessagesByEmailRange(context.Background(), "not-an-email", 0, 5); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an invalid email, got %v", err)
+	}
+	if _, _, err := svc.GetMessagesByTagRange(context.Background(), "greeting", -1, 5); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a negative offset, got %v", err)
+	}
+}
+
+func TestGuestBookService_GetMessagesByEmail(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(5)
+	repo.messages[1].Email = "user1@example.com"
+	repo.messages[3].Email = "user1@example.com"
+	repo.messages[3].Status = models.StatusPending
+
+	messages, total, err := svc.GetMessagesByEmail(context.Background(), "user1@example.com", 1, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if total != 2 {
+		t.Errorf("Expected total 2, got %d", total)
+	}
+	if len(messages) != 2 || messages[0].ID != 2 || messages[1].ID != 1 {
+		t.Errorf("Expected approved messages 2 and 1, newest first, got %+v", messages)
+	}
+
+	// Matching is exact, unlike search
+	messages, total, err = svc.GetMessagesByEmail(context.Background(), "USER1@example.com", 1, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 0 || len(messages) != 0 {
+		t.Errorf("Expected no messages for a differently-cased address, got %d (total %d)", len(messages), total)
+	}
+}
+
+func TestGuestBookService_GetMessagesByEmail_InvalidEmail(t *testing.T) {
+	svc := newTestService(NewMockGuestBookRepository())
+
+	for _, email := range []string{"", "not-an-email", "Ada <ada@example.com>", "ada@example.com, bob@example.com", strings.Repeat("a", 250) + "@example.com"} {
+		if _, _, err := svc.GetMessagesByEmail(context.Background(), email, 1, 10); !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for %q, got %v", email, err)
+		}
+	}
+}
+
+func TestGuestBookService_GetMessagesByTag(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(4)
+	repo.messages[0].Tags = []string{"greeting"}
+	repo.messages[2].Tags = []string{"feedback", "greeting"}
+	repo.messages[3].Tags = []string{"greeting"}
+	repo.messages[3].Status = models.StatusRejected
+
+	messages, total, err := svc.GetMessagesByTag(context.Background(), " Greeting", 1, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if total != 2 {
+		t.Errorf("Expected total 2, got %d", total)
+	}
+	if len(messages) != 2 || messages[0].ID != 3 || messages[1].ID != 1 {
+		t.Errorf("Expected approved messages 3 and 1, newest first, got %+v", messages)
+	}
+
+	if _, _, err := svc.GetMessagesByTag(context.Background(), "not a tag", 1, 10); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an invalid tag, got %v", err)
+	}
+}
+
+func TestGuestBookService_GetPendingMessages(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(5)
+	repo.messages[1].Status = models.StatusPending
+	repo.messages[2].Status = models.StatusRejected
+	repo.messages[3].Status = models.StatusPending
+	repo.messages[4].Status = models.StatusPending
+
+	messages, counts, err := svc.GetPendingMessages(context.Background(), 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(messages) != 2 || messages[0].ID != 2 || messages[1].ID != 4 {
+		t.Errorf("Expected pending messages 2 and 4, oldest first, got %v", messageIDs(messages))
+	}
+	if want := (models.ModerationCounts{Pending: 3, Approved: 1, Rejected: 1}); counts != want {
+		t.Errorf("Expected counts %+v, got %+v", want, counts)
+	}
+
+	messages, _, err = svc.GetPendingMessages(context.Background(), 2, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != 5 {
+		t.Errorf("Expected pending message 5 on the second page, got %v", messageIDs(messages))
+	}
+
+	t.Run("Empty queue", func(t *testing.T) {
+		repo := NewMockGuestBookRepository()
+		repo.messages = seedMessages(2)
+		svc := newTestService(repo)
+
+		messages, counts, err := svc.GetPendingMessages(context.Background(), 1, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if messages == nil || len(messages) != 0 {
+			t.Errorf("Expected an empty, non-nil page, got %v", messages)
+		}
+		if want := (models.ModerationCounts{Approved: 2}); counts != want {
+			t.Errorf("Expected counts %+v, got %+v", want, counts)
+		}
+	})
+
+	t.Run("Count fails", func(t *testing.T) {
+		repo := NewMockGuestBookRepository()
+		repo.errCount = errors.New("connection reset")
+		svc := newTestService(repo)
+
+		if _, _, err := svc.GetPendingMessages(context.Background(), 1, 10); !errors.Is(err, repo.errCount) {
+			t.Errorf("Expected the count error, got %v", err)
+		}
+	})
+}
+
+func TestGuestBookService_GetMessages_CancelledContext(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := svc.GetMessages(ctx, 1, 10)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if calls := repo.getAllCalls.Load() + repo.countCalls.Load(); calls != 0 {
+		t.Errorf("Expected no queries after cancellation, got %d", calls)
+	}
+}
+
+func TestGuestBookService_GetMessages_CancelledMidRequest(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.delay = time.Second
+	svc := newTestService(repo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := svc.GetMessages(ctx, 1, 10)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected early return on cancellation, took %v", elapsed)
+	}
+}
+
+func TestGuestBookService_GetMessages_ErrorCancelsSibling(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.delay = time.Second
+	repo.errCount = errors.New("count failed")
+	svc := newTestService(repo)
+
+	start := time.Now()
+	_, _, err := svc.GetMessages(context.Background(), 1, 10)
+	if !errors.Is(err, repo.errCount) {
+		t.Fatalf("Expected count error, got %v", err)
+	}
+
+	// The slow GetAll must have been cancelled rather than run to completion
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected sibling query to be cancelled, took %v", elapsed)
+	}
+}
+
+// BenchmarkGuestBookService_GetMessages measures the list path against a
+// repository where every query takes 1ms. The concurrent service should take
+// roughly one query's latency rather than two.
+func BenchmarkGuestBookService_GetMessages(b *testing.B) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(20)
+	repo.delay = time.Millisecond
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	b.Run("concurrent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := svc.GetMessages(ctx, 1, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("sequential baseline", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetAll(ctx, 10, 0); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := repo.Count(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func newTestService(repo GuestBookRepositoryInterface) *GuestBookService {
+	return NewGuestBookService(repo, config.Config{Validation: config.DefaultValidationConfig()})
+}
+
+func TestGuestBookService_CreateMessage_ConfiguredLimits(t *testing.T) {
+	cfg := config.Config{Validation: config.ValidationConfig{
+		NameMin:    5,
+		NameMax:    20,
+		MessageMin: 3,
+		MessageMax: 15,
+	}}
+	svc := NewGuestBookService(NewMockGuestBookRepository(), cfg)
+
+	tests := []struct {
+		name          string
+		msg           models.CreateGuestBookMessage
+		expectedError string
+	}{
+		{
+			name:          "Valid under configured limits",
+			msg:           models.CreateGuestBookMessage{Name: "Alice", Email: "a@example.com", Message: "Hi!"},
+			expectedError: "",
+		},
+		{
+			name:          "Name below configured minimum",
+			msg:           models.CreateGuestBookMessage{Name: "Bob", Email: "b@example.com", Message: "Hi!"},
+			expectedError: "name must be between 5 and 20 characters",
+		},
+		{
+			name:          "Message above configured maximum",
+			msg:           models.CreateGuestBookMessage{Name: "Alice", Email: "a@example.com", Message: "This one is too long"},
+			expectedError: "message must be between 3 and 15 characters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateMessage(context.Background(), &tt.msg)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Expected error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestValidateCreateMessage_CountsCharacters(t *testing.T) {
+	limits := config.ValidationConfig{NameMin: 2, NameMax: 5, MessageMin: 3, MessageMax: 10}
+
+	tests := []struct {
+		name          string
+		msg           models.CreateGuestBookMessage
+		limits        config.ValidationConfig
+		expectedError string
+	}{
+		{
+			name: "Multi-byte name at the maximum",
+			// 5 characters, 7 bytes
+			msg: models.CreateGuestBookMessage{Name: "Zoë é", Email: "z@example.com", Message: "Hello"},
+		},
+		{
+			name:          "Multi-byte name over the maximum",
+			msg:           models.CreateGuestBookMessage{Name: "Zoë éé", Email: "z@example.com", Message: "Hello"},
+			expectedError: "name must be between 2 and 5 characters",
+		},
+		{
+			name: "Multi-byte message at the maximum",
+			// 10 characters, 20 bytes
+			msg: models.CreateGuestBookMessage{Name: "Zoë", Email: "z@example.com", Message: strings.Repeat("é", 10)},
+		},
+		{
+			name:          "Multi-byte message over the maximum",
+			msg:           models.CreateGuestBookMessage{Name: "Zoë", Email: "z@example.com", Message: strings.Repeat("é", 11)},
+			expectedError: "message must be between 3 and 10 characters",
+		},
+		{
+			name: "Four-byte characters within the default byte limit",
+			msg:  models.CreateGuestBookMessage{Name: "Zoë", Email: "z@example.com", Message: strings.Repeat("🙂", 10)},
+		},
+		{
+			name:          "Message over the byte limit",
+			msg:           models.CreateGuestBookMessage{Name: "Zoë", Email: "z@example.com", Message: strings.Repeat("🙂", 10)},
+			limits:        config.ValidationConfig{NameMin: 2, NameMax: 5, MessageMin: 3, MessageMax: 10, MessageMaxBytes: 32},
+			expectedError: "message must be at most 32 bytes when encoded as UTF-8",
+		},
+		{
+			name:          "Invalid UTF-8 message",
+			msg:           models.CreateGuestBookMessage{Name: "Zoë", Email: "z@example.com", Message: "Hello \xff there"},
+			expectedError: "message must be valid UTF-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testLimits := limits
+			if tt.limits != (config.ValidationConfig{}) {
+				testLimits = tt.limits
+			}
+
+			err := ValidateCreateMessage(&tt.msg, testLimits)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Expected error %q, got %v", tt.expectedError, err)
+			}
+			if !errors.Is(err, apperrors.ErrInvalidInput) {
+				t.Errorf("Expected an invalid input error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_GetTimeline(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	now := time.Now().UTC()
+	repo.messages = []models.GuestBookMessage{
+		{ID: 1, Status: models.StatusApproved, CreatedAt: now},
+		{ID: 2, Status: models.StatusApproved, CreatedAt: now},
+		{ID: 3, Status: models.StatusApproved, CreatedAt: now.AddDate(0, 0, -2)},
+		{ID: 4, Status: models.StatusApproved, CreatedAt: now.AddDate(0, 0, -10)}, // outside the range
+		{ID: 5, Status: models.StatusPending, CreatedAt: now},                     // not public
+	}
+
+	timeline, err := svc.GetTimeline(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []models.DailyCount{
+		{Date: now.AddDate(0, 0, -2).Format(models.DateFormat), Count: 1},
+		{Date: now.AddDate(0, 0, -1).Format(models.DateFormat), Count: 0},
+		{Date: now.Format(models.DateFormat), Count: 2},
+	}
+
+	if len(timeline) != len(expected) {
+		t.Fatalf("Expected %d days, got %d", len(expected), len(timeline))
+	}
+
+	for i := range expected {
+		if timeline[i] != expected[i] {
+			t.Errorf("Day %d: expected %+v, got %+v", i, expected[i], timeline[i])
+		}
+	}
+}
+
+func TestGuestBookService_GetMessageLengthStats(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	stats, err := svc.GetMessageLengthStats(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats != (models.MessageLengthStats{}) {
+		t.Errorf("Expected zeros with no messages, got %+v", stats)
+	}
+
+	repo.messages = []models.GuestBookMessage{
+		{ID: 1, Status: models.StatusApproved, Message: "Hi!"},
+		{ID: 2, Status: models.StatusApproved, Message: "Lovely place"},
+		{ID: 3, Status: models.StatusApproved, Message: "Très bien"}, // 9 characters, 10 bytes
+		{ID: 4, Status: models.StatusApproved, Message: "Thanks for having us over"},
+		{ID: 5, Status: models.StatusPending, Message: strings.Repeat("x", 500)}, // not public
+	}
+
+	stats, err = svc.GetMessageLengthStats(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := models.MessageLengthStats{Min: 3, Avg: 12.25, Max: 25, Median: 10.5}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestGuestBookService_GetTimeline_Range(t *testing.T) {
+	svc := newTestService(NewMockGuestBookRepository())
+
+	tests := []struct {
+		name         string
+		days         int
+		expectedDays int
+	}{
+		{name: "Default when zero", days: 0, expectedDays: DefaultTimelineDays},
+		{name: "Default when negative", days: -5, expectedDays: DefaultTimelineDays},
+		{name: "Requested range", days: 7, expectedDays: 7},
+		{name: "Capped at maximum", days: 10000, expectedDays: MaxTimelineDays},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeline, err := svc.GetTimeline(context.Background(), tt.days)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if len(timeline) != tt.expectedDays {
+				t.Errorf("Expected %d days, got %d", tt.expectedDays, len(timeline))
+			}
+
+			for _, day := range timeline {
+				if day.Count != 0 {
+					t.Errorf("Expected zero count for %s on empty dataset, got %d", day.Date, day.Count)
+				}
+			}
+		})
+	}
+}
+
+func TestGuestBookService_MessageExists(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(2)
+	svc := newTestService(repo)
+
+	tests := []struct {
+		name     string
+		id       int
+		expected bool
+	}{
+		{name: "Existing message", id: 1, expected: true},
+		{name: "Missing message", id: 999, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := svc.MessageExists(context.Background(), tt.id)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if exists != tt.expected {
+				t.Errorf("Expected exists=%v, got %v", tt.expected, exists)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_UpdateMessageStatus_MissingMessage(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(2)
+	svc := newTestService(repo)
+
+	_, err := svc.UpdateMessageStatus(context.Background(), "999", models.StatusRejected)
+	if !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if calls := repo.setStatusCalls.Load(); calls != 0 {
+		t.Errorf("Expected no update for a missing message, got %d", calls)
+	}
+}
+
+func TestGuestBookService_Moderation(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	cfg := config.Config{Validation: config.DefaultValidationConfig(), ModerationEnabled: true}
+	svc := NewGuestBookService(repo, cfg)
+	ctx := context.Background()
+
+	created, err := svc.CreateMessage(ctx, &models.CreateGuestBookMessage{
+		Name:    "Test User",
+		Email:   "test@example.com",
+		Message: "This message needs moderation.",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if created.Status != models.StatusPending {
+		t.Errorf("Expected status %q with moderation enabled, got %q", models.StatusPending, created.Status)
+	}
+
+	// Pending messages are hidden from the public API
+	messages, total, err := svc.GetMessages(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(messages) != 0 || total != 0 {
+		t.Errorf("Expected no public messages, got %d (total %d)", len(messages), total)
+	}
+	if _, err := svc.GetMessageByID(ctx, "1"); err == nil {
+		t.Error("Expected pending message to be hidden by ID")
+	}
+
+	// Approving makes it visible
+	if _, err := svc.UpdateMessageStatus(ctx, "1", models.StatusApproved); err != nil {
+		t.Fatalf("Expected no error approving message, got %v", err)
+	}
+	if _, err := svc.GetMessageByID(ctx, "1"); err != nil {
+		t.Errorf("Expected approved message to be visible, got %v", err)
+	}
+
+	if _, err := svc.UpdateMessageStatus(ctx, "1", "bogus"); err == nil {
+		t.Error("Expected error for invalid status")
+	}
+}
+
+func TestGuestBookService_CreateMessage_DefaultApproved(t *testing.T) {
+	svc := newTestService(NewMockGuestBookRepository())
+
+	created, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+		Name:    "Test User",
+		Email:   "test@example.com",
+		Message: "This message is visible immediately.",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if created.Status != models.StatusApproved {
+		t.Errorf("Expected status %q, got %q", models.StatusApproved, created.Status)
+	}
+}
+
+func TestGuestBookService_CreateMessage_Sanitization(t *testing.T) {
+	input := models.CreateGuestBookMessage{
+		Name:    "<b>Eve</b>",
+		Email:   "eve@example.com",
+		Message: `Hi there! <script>alert("xss")</script><img src=x onerror=alert(1)>Bye & thanks`,
+	}
+
+	tests := []struct {
+		name            string
+		mode            string
+		expectedName    string
+		expectedMessage string
+	}{
+		{
+			name:            "Raw text by default",
+			mode:            SanitizeNone,
+			expectedName:    input.Name,
+			expectedMessage: input.Message,
+		},
+		{
+			name:            "HTML escaping",
+			mode:            SanitizeEscape,
+			expectedName:    "&lt;b&gt;Eve&lt;/b&gt;",
+			expectedMessage: `Hi there! &lt;script&gt;alert(&#34;xss&#34;)&lt;/script&gt;&lt;img src=x onerror=alert(1)&gt;Bye &amp; thanks`,
+		},
+		{
+			name:            "Tag stripping",
+			mode:            SanitizeStrip,
+			expectedName:    "Eve",
+			expectedMessage: "Hi there! Bye & thanks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{Validation: config.DefaultValidationConfig(), SanitizeInput: tt.mode}
+			svc := NewGuestBookService(NewMockGuestBookRepository(), cfg)
+
+			msg := input
+			created, err := svc.CreateMessage(context.Background(), &msg)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if created.Name != tt.expectedName {
+				t.Errorf("Expected name %q, got %q", tt.expectedName, created.Name)
+			}
+			if created.Message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, created.Message)
+			}
+
+			// The caller's struct is left untouched
+			if !reflect.DeepEqual(msg, input) {
+				t.Errorf("Expected input to be unmodified, got %+v", msg)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_CreateMessage_StripThenValidate(t *testing.T) {
+	cfg := config.Config{Validation: config.DefaultValidationConfig(), SanitizeInput: SanitizeStrip}
+	svc := NewGuestBookService(NewMockGuestBookRepository(), cfg)
+
+	// Nothing but markup is left empty after stripping
+	_, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+		Name:    "Mallory",
+		Email:   "mallory@example.com",
+		Message: "<script>document.cookie</script>",
+	})
+	if err == nil {
+		t.Error("Expected message that is only markup to fail validation after stripping")
+	}
+}
+
+func TestGuestBookService_ValidateMessage(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	cfg := config.Config{Validation: config.DefaultValidationConfig(), SanitizeInput: SanitizeStrip}
+	svc := NewGuestBookService(repo, cfg)
+
+	validated, err := svc.ValidateMessage(context.Background(), &models.CreateGuestBookMessage{
+		Name:    "<b>Eve</b>",
+		Email:   "eve@example.com",
+		Message: "Checking before I submit",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if validated.Name != "Eve" {
+		t.Errorf("Expected the sanitized name, got %q", validated.Name)
+	}
+
+	_, err = svc.ValidateMessage(context.Background(), &models.CreateGuestBookMessage{
+		Name:    "Eve",
+		Email:   "eve@example.com",
+		Message: "Short",
+	})
+	if !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a short message, got %v", err)
+	}
+
+	if len(repo.messages) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d messages", len(repo.messages))
+	}
+}
+
+func TestGuestBookService_CreateMessage_Tags(t *testing.T) {
+	tests := []struct {
+		name      string
+		tags      []string
+		expected  []string
+		expectErr bool
+	}{
+		{name: "No tags", tags: nil, expected: nil},
+		{name: "Normalized and deduplicated", tags: []string{" Greeting", "greeting", "Feedback_2"}, expected: []string{"greeting", "feedback_2"}},
+		{name: "Unicode letters", tags: []string{"café"}, expected: []string{"café"}},
+		{name: "Too many", tags: []string{"a", "b", "c", "d", "e", "f"}, expectErr: true},
+		{name: "Too long", tags: []string{strings.Repeat("x", models.MaxTagLength+1)}, expectErr: true},
+		{name: "Empty", tags: []string{"  "}, expectErr: true},
+		{name: "Markup", tags: []string{"<b>"}, expectErr: true},
+		{name: "Spaces", tags: []string{"two words"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(NewMockGuestBookRepository())
+
+			created, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+				Name:    "Ada",
+				Email:   "ada@example.com",
+				Message: "A message with some tags",
+				Tags:    tt.tags,
+			})
+			if tt.expectErr {
+				if !errors.Is(err, apperrors.ErrInvalidInput) {
+					t.Errorf("Expected ErrInvalidInput, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if !reflect.DeepEqual(created.Tags, tt.expected) {
+				t.Errorf("Expected tags %q, got %q", tt.expected, created.Tags)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_CountMessages(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(3)
+
+	count, err := svc.CountMessages(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if count != 3 {
+		t.Errorf("Expected count 3, got %d", count)
+	}
+
+	if calls := repo.getAllCalls.Load(); calls != 0 {
+		t.Errorf("Expected no rows to be fetched, got %d GetAll calls", calls)
+	}
+}
+
+func TestGuestBookService_CountMessages_Filtered(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	repo.messages = seedMessages(4)
+	repo.messages[0].Tags = []string{"greeting"}
+	repo.messages[2].Tags = []string{"greeting"}
+	repo.messages[2].Email = "user1@example.com"
+	repo.messages[3].Email = "user1@example.com"
+	repo.messages[3].Status = models.StatusRejected
+
+	// Counts must agree with the totals the filtered lists report
+	count, err := svc.CountMessagesByEmail(context.Background(), "user1@example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, total, _ := svc.GetMessagesByEmail(context.Background(), "user1@example.com", 1, 10); count != 2 || count != total {
+		t.Errorf("Expected an email count of 2 matching the list total %d, got %d", total, count)
+	}
+
+	count, err = svc.CountMessagesByTag(context.Background(), " Greeting")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, total, _ := svc.GetMessagesByTag(context.Background(), "greeting", 1, 10); count != 2 || count != total {
+		t.Errorf("Expected a tag count of 2 matching the list total %d, got %d", total, count)
+	}
+
+	if _, err := svc.CountMessagesByEmail(context.Background(), "not-an-email"); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an invalid email, got %v", err)
+	}
+	if _, err := svc.CountMessagesByTag(context.Background(), "not a tag"); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an invalid tag, got %v", err)
+	}
+}
+
+func TestGuestBookService_CreateMessage_IdempotencyKey(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	msg := &models.CreateGuestBookMessage{
+		Name:           "Ada Lovelace",
+		Email:          "ada@example.com",
+		Message:        "Hello from the analytical engine",
+		IdempotencyKey: "create-1",
+	}
+
+	first, err := svc.CreateMessage(ctx, msg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	retried, err := svc.CreateMessage(ctx, msg)
+	if err != nil {
+		t.Fatalf("Unexpected error on retry: %v", err)
+	}
+
+	if retried.ID != first.ID {
+		t.Errorf("Expected retry to return message %d, got %d", first.ID, retried.ID)
+	}
+	if len(repo.messages) != 1 {
+		t.Errorf("Expected 1 stored message after retry, got %d", len(repo.messages))
+	}
+
+	msg.IdempotencyKey = strings.Repeat("k", models.MaxIdempotencyKeyLength+1)
+	if _, err := svc.CreateMessage(ctx, msg); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an oversized key, got %v", err)
+	}
+}
+
+func TestGuestBookService_CreateMessage_IdempotencyKeyReplays(t *testing.T) {
+	newRequest := func(clientIP, message string) *models.CreateGuestBookMessage {
+		return &models.CreateGuestBookMessage{
+			Name:           "Ada Lovelace",
+			Email:          "ada@example.com",
+			Message:        message,
+			IdempotencyKey: "create-1",
+			ClientIP:       clientIP,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		retry         *models.CreateGuestBookMessage
+		age           time.Duration
+		expectedError error
+		expectReplay  bool
+	}{
+		{name: "Same client and body", retry: newRequest("203.0.113.7", "Hello from the analytical engine"), age: time.Hour, expectReplay: true},
+		{name: "Different body", retry: newRequest("203.0.113.7", "Something else entirely"), age: time.Hour, expectedError: ErrIdempotencyKeyReused},
+		{name: "Different client", retry: newRequest("198.51.100.1", "Hello from the analytical engine"), age: time.Hour},
+		{name: "Expired key", retry: newRequest("203.0.113.7", "Hello from the analytical engine"), age: 24*time.Hour + time.Second},
+		{name: "Expired key with a different body", retry: newRequest("203.0.113.7", "Something else entirely"), age: 24*time.Hour + time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock(time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC))
+			repo := NewMockGuestBookRepository()
+			repo.clock = clock
+			cfg := config.Config{Validation: config.DefaultValidationConfig(), IdempotencyKeyTTL: 24 * time.Hour, MetadataSalt: "salt"}
+			svc := NewGuestBookServiceWithClock(repo, cfg, clock)
+			ctx := context.Background()
+
+			first, err := svc.CreateMessage(ctx, newRequest("203.0.113.7", "Hello from the analytical engine"))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			clock.Advance(tt.age)
+			retried, err := svc.CreateMessage(ctx, tt.retry)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+			if tt.expectedError != nil {
+				if !errors.Is(err, apperrors.ErrConflict) {
+					t.Errorf("Expected a conflict error, got %v", err)
+				}
+				if len(repo.messages) != 1 {
+					t.Errorf("Expected nothing new to be stored, got %d messages", len(repo.messages))
+				}
+				return
+			}
+
+			if replayed := retried.ID == first.ID; replayed != tt.expectReplay {
+				t.Errorf("Expected replay %v, got message %d after %d", tt.expectReplay, retried.ID, first.ID)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_CreateMessage_CannotReplaySeedKey(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	cfg := config.Config{
+		Validation: config.DefaultValidationConfig(),
+		Seed:       config.SeedConfig{Enabled: true, Name: "Guest Book", Email: "welcome@example.com", Message: "Welcome to the guest book!"},
+	}
+	svc := NewGuestBookService(repo, cfg)
+
+	if err := svc.InitializeDatabase(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	created, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+		Name:           "Welcome Guest Book",
+		Email:          "mallory@example.com",
+		Message:        "Welcome to the guest book!",
+		IdempotencyKey: seedIdempotencyKey,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created.Email == "welcome@example.com" || len(repo.messages) != 2 {
+		t.Errorf("Expected the seed's key to create a new message, got %+v", created)
+	}
+}
+
+func TestGuestBookService_InitializeDatabase_SeedMessage(t *testing.T) {
+	seed := config.SeedConfig{
+		Enabled: true,
+		Name:    "Guest Book",
+		Email:   "welcome@example.com",
+		Message: "Welcome to the guest book!",
+	}
+
+	tests := []struct {
+		name          string
+		seed          config.SeedConfig
+		existing      int
+		expectedCount int
+	}{
+		{name: "Seeds empty table", seed: seed, existing: 0, expectedCount: 1},
+		{name: "Skips non-empty table", seed: seed, existing: 2, expectedCount: 2},
+		{name: "Disabled", seed: config.SeedConfig{}, existing: 0, expectedCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockGuestBookRepository()
+			repo.messages = seedMessages(tt.existing)
+			repo.nextID = tt.existing + 1
+			svc := NewGuestBookService(repo, config.Config{
+				Validation: config.DefaultValidationConfig(),
+				Seed:       tt.seed,
+			})
+
+			// A restart runs initialization again and must not seed twice
+			for i := 0; i < 2; i++ {
+				if err := svc.InitializeDatabase(context.Background()); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			if len(repo.messages) != tt.expectedCount {
+				t.Fatalf("Expected %d messages, got %d", tt.expectedCount, len(repo.messages))
+			}
+
+			if tt.existing == 0 && tt.expectedCount == 1 {
+				welcome := repo.messages[0]
+				if welcome.Message != seed.Message || welcome.Status != models.StatusApproved {
+					t.Errorf("Expected approved welcome message, got %q (%s)", welcome.Message, welcome.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestGuestBookService_InitializeDatabase_InvalidSeed(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := NewGuestBookService(repo, config.Config{
+		Validation: config.DefaultValidationConfig(),
+		Seed:       config.SeedConfig{Enabled: true, Name: "G", Email: "welcome@example.com", Message: "Hi"},
+	})
+
+	if err := svc.InitializeDatabase(context.Background()); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an invalid seed, got %v", err)
+	}
+}
+
+func TestGuestBookService_CreateMessage_CaptureMetadata(t *testing.T) {
+	newMsg := func() *models.CreateGuestBookMessage {
+		return &models.CreateGuestBookMessage{
+			Name:      "Ada Lovelace",
+			Email:     "ada@example.com",
+			Message:   "Hello from the analytical engine",
+			ClientIP:  "203.0.113.7",
+			UserAgent: "Mozilla/5.0",
+		}
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		repo := NewMockGuestBookRepository()
+		svc := newTestService(repo)
+
+		created, err := svc.CreateMessage(context.Background(), newMsg())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if created.Metadata != nil {
+			t.Errorf("Expected no metadata when capture is disabled, got %+v", created.Metadata)
+		}
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		repo := NewMockGuestBookRepository()
+		svc := NewGuestBookService(repo, config.Config{
+			Validation:      config.DefaultValidationConfig(),
+			CaptureMetadata: true,
+			MetadataSalt:    "pepper",
+		})
+
+		first, err := svc.CreateMessage(context.Background(), newMsg())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		second, err := svc.CreateMessage(context.Background(), newMsg())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if first.Metadata == nil {
+			t.Fatal("Expected metadata when capture is enabled")
+		}
+		if first.Metadata.UserAgent != "Mozilla/5.0" {
+			t.Errorf("Expected user agent to be stored, got %q", first.Metadata.UserAgent)
+		}
+		if strings.Contains(first.Metadata.IPHash, "203.0.113.7") || len(first.Metadata.IPHash) != 64 {
+			t.Errorf("Expected a hex SHA-256 hash of the IP, got %q", first.Metadata.IPHash)
+		}
+		if second.Metadata.IPHash != first.Metadata.IPHash {
+			t.Error("Expected the same IP to hash identically")
+		}
+		if hashIP("other-salt", "203.0.113.7") == first.Metadata.IPHash {
+			t.Error("Expected the hash to depend on the salt")
+		}
+	})
+}
+
+func TestGuestBookService_SearchMessages(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = []models.GuestBookMessage{
+		{ID: 1, Message: "Hello from Cairo", Status: models.StatusApproved},
+		{ID: 2, Message: "Hello hello, lovely guest book", Status: models.StatusApproved},
+		{ID: 3, Message: "Hello from the moderation queue", Status: models.StatusPending},
+		{ID: 4, Message: "Nothing to see here", Status: models.StatusApproved},
+	}
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	results, err := svc.SearchMessages(ctx, "  hello\x00 ", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repo.lastSearch != "hello" {
+		t.Errorf("Expected control characters and surrounding space to be stripped, got %q", repo.lastSearch)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 approved matches, got %d", len(results))
+	}
+	if results[0].ID != 2 || results[0].Rank <= results[1].Rank {
+		t.Errorf("Expected the most relevant message first, got IDs %d, %d", results[0].ID, results[1].ID)
+	}
+
+	for _, q := range []string{"", "   ", "\t\n", strings.Repeat("a", MaxSearchQueryLength+1)} {
+		_, err := svc.SearchMessages(ctx, q, 0)
+		if !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for query %q, got %v", q, err)
+		}
+	}
+}
+
+func TestGuestBookService_GetMessageNeighbors(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	repo := NewMockGuestBookRepository()
+	repo.messages = []models.GuestBookMessage{
+		{ID: 1, Message: "first", Status: models.StatusApproved, CreatedAt: base},
+		{ID: 2, Message: "hidden", Status: models.StatusPending, CreatedAt: base.Add(time.Minute)},
+		{ID: 3, Message: "second", Status: models.StatusApproved, CreatedAt: base.Add(2 * time.Minute)},
+		{ID: 4, Message: "third", Status: models.StatusApproved, CreatedAt: base.Add(3 * time.Minute)},
+	}
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	tests := []struct {
+		id       string
+		previous int
+		next     int
+	}{
+		{id: "1", previous: 0, next: 3},
+		{id: "3", previous: 1, next: 4},
+		{id: "4", previous: 3, next: 0},
+	}
+
+	idOf := func(msg *models.GuestBookMessage) int {
+		if msg == nil {
+			return 0
+		}
+		return msg.ID
+	}
+
+	for _, tt := range tests {
+		t.Run("Message "+tt.id, func(t *testing.T) {
+			neighbors, err := svc.GetMessageNeighbors(ctx, tt.id)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if idOf(neighbors.Previous) != tt.previous || idOf(neighbors.Next) != tt.next {
+				t.Errorf("Expected neighbors %d/%d, got %d/%d", tt.previous, tt.next, idOf(neighbors.Previous), idOf(neighbors.Next))
+			}
+		})
+	}
+
+	if _, err := svc.GetMessageNeighbors(ctx, "2"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a pending message, got %v", err)
+	}
+	if _, err := svc.GetMessageNeighbors(ctx, "abc"); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a non-numeric ID, got %v", err)
+	}
+}
+
+func TestGuestBookService_GetMessages_HugePage(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(3)
+	svc := newTestService(repo)
+
+	messages, total, err := svc.GetMessages(context.Background(), 99999999999, 100)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(messages) != 0 || messages == nil {
+		t.Errorf("Expected an empty, non-nil page, got %v", messages)
+	}
+	if total != 3 {
+		t.Errorf("Expected total 3, got %d", total)
+	}
+	if calls := repo.getAllCalls.Load(); calls != 0 {
+		t.Errorf("Expected no row query for an out-of-range page, got %d", calls)
+	}
+}
+
+func TestPageOffset(t *testing.T) {
+	tests := []struct {
+		name       string
+		page       int
+		pageSize   int
+		wantOffset int
+		wantOK     bool
+	}{
+		{name: "First page", page: 1, pageSize: 10, wantOffset: 0, wantOK: true},
+		{name: "Later page", page: 3, pageSize: 25, wantOffset: 50, wantOK: true},
+		{name: "Last allowed page", page: MaxPage, pageSize: 10, wantOffset: (MaxPage - 1) * 10, wantOK: true},
+		{name: "Past MaxPage", page: MaxPage + 1, pageSize: 10},
+		{name: "Overflowing page", page: math.MaxInt, pageSize: MaxPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, ok := pageOffset(tt.page, tt.pageSize)
+			if ok != tt.wantOK || offset != tt.wantOffset {
+				t.Errorf("Expected (%d, %v), got (%d, %v)", tt.wantOffset, tt.wantOK, offset, ok)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_GetMessageByID_InvalidIDs(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(1)
+	svc := newTestService(repo)
+
+	for _, id := range []string{"0", "-1", "abc", "", "999999999999999999999999999999"} {
+		_, err := svc.GetMessageByID(context.Background(), id)
+		if !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ID %q: expected ErrInvalidID, got %v", id, err)
+		}
+		if !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Errorf("ID %q: expected an invalid input error, got %v", id, err)
+		}
+	}
+
+	_, err := svc.GetMessageByID(context.Background(), "999999999999999999999999999999")
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("Expected an out of range error, got %v", err)
+	}
+
+	if _, err := svc.GetMessageByID(context.Background(), "1"); err != nil {
+		t.Errorf("Expected no error for a valid ID, got %v", err)
+	}
+}
+
+func TestGuestBookService_GetMessageByID_CoalescesConcurrentLookups(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(1)
+	repo.delay = 50 * time.Millisecond
+	svc := newTestService(repo)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]*models.GuestBookMessage, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = svc.GetMessageByID(context.Background(), "1")
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Caller %d got error: %v", i, errs[i])
+		}
+		if results[i].ID != 1 {
+			t.Errorf("Caller %d got message %d", i, results[i].ID)
+		}
+	}
+	if results[0] == results[1] {
+		t.Error("Expected each caller to get its own copy of the message")
+	}
+	if calls := repo.getByIDCalls.Load(); calls != 1 {
+		t.Errorf("Expected 1 repository call for concurrent lookups, got %d", calls)
+	}
+
+	// Nothing is cached once the shared lookup finishes
+	repo.delay = 0
+	if _, err := svc.GetMessageByID(context.Background(), "2"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	repo.messages = seedMessages(2)
+	if _, err := svc.GetMessageByID(context.Background(), "2"); err != nil {
+		t.Errorf("Expected the earlier error not to be cached, got %v", err)
+	}
+	if calls := repo.getByIDCalls.Load(); calls != 3 {
+		t.Errorf("Expected 3 repository calls, got %d", calls)
+	}
+}
+
+func TestGuestBookService_GetMessageByID_CallerCancellation(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(1)
+	repo.delay = 100 * time.Millisecond
+	svc := newTestService(repo)
+
+	// The first caller gives up early; a second caller sharing the lookup
+	// must still get the message
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var firstErr error
+	go func() {
+		defer wg.Done()
+		_, firstErr = svc.GetMessageByID(ctx, "1")
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	msg, err := svc.GetMessageByID(context.Background(), "1")
+	wg.Wait()
+
+	if !errors.Is(firstErr, context.DeadlineExceeded) {
+		t.Errorf("Expected the first caller to time out, got %v", firstErr)
+	}
+	if err != nil || msg.ID != 1 {
+		t.Errorf("Expected the second caller to get message 1, got %v, %v", msg, err)
+	}
+}
+
+func TestGuestBookService_GetMessageByID_AbandonedLookupIsCancelled(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(1)
+	repo.delay = time.Minute
+	svc := newTestService(repo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := svc.GetMessageByID(ctx, "1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the caller to time out, got %v", err)
+	}
+
+	// With nobody left waiting, the query itself must stop promptly
+	deadline := time.Now().Add(time.Second)
+	for repo.cancelledQueries.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the abandoned query to be cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A later caller starts a fresh query instead of joining the cancelled one
+	repo.delay = 0
+	msg, err := svc.GetMessageByID(context.Background(), "1")
+	if err != nil || msg.ID != 1 {
+		t.Errorf("Expected a later caller to get message 1, got %v, %v", msg, err)
+	}
+}
+
+func TestGuestBookService_DeleteMessages(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(3)
+	svc := newTestService(repo)
+
+	deleted, err := svc.DeleteMessages(context.Background(), []int{1, 3, 42})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted, got %d", deleted)
+	}
+	if len(repo.messages) != 1 || repo.messages[0].ID != 2 {
+		t.Errorf("Expected only message 2 to remain, got %v", repo.messages)
+	}
+
+	for _, ids := range [][]int{nil, {}, {-1}, make([]int, models.MaxDeleteIDs+1)} {
+		if _, err := svc.DeleteMessages(context.Background(), ids); !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Errorf("Expected an invalid input error for %d ids, got %v", len(ids), err)
+		}
+	}
+}
+
+func TestGuestBookService_GetLastModified_AdvancedByDelete(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(3)
+	for i := range repo.messages {
+		repo.messages[i].UpdatedAt = time.Now().Add(time.Duration(i-3) * time.Hour)
+	}
+	svc := newTestService(repo)
+
+	before, err := svc.GetLastModified(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Deleting the most recently updated message would move MAX(updated_at)
+	// back, letting clients holding the old Last-Modified get a 304
+	if _, err := svc.DeleteMessages(context.Background(), []int{3}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	after, err := svc.GetLastModified(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Last-Modified has a resolution of one second
+	if !after.Truncate(time.Second).After(before.Truncate(time.Second)) {
+		t.Errorf("Expected the delete to advance the last modified time past %v, got %v", before, after)
+	}
+}
+
+func TestGuestBookService_StreamMessages_MatchesGetMessages(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(25)
+	svc := newTestService(repo)
+
+	for _, page := range []int{0, 1, 3, 4, MaxPage + 1} {
+		expected, expectedTotal, err := svc.GetMessages(context.Background(), page, 10)
+		if err != nil {
+			t.Fatalf("Page %d: expected no error, got %v", page, err)
+		}
+
+		stream, total, err := svc.StreamMessages(context.Background(), page, 10)
+		if err != nil {
+			t.Fatalf("Page %d: expected no error, got %v", page, err)
+		}
+		streamed := []models.GuestBookMessage{}
+		for msg, err := range stream {
+			if err != nil {
+				t.Fatalf("Page %d: expected no error, got %v", page, err)
+			}
+			streamed = append(streamed, msg)
+		}
+
+		if total != expectedTotal || !reflect.DeepEqual(streamed, expected) {
+			t.Errorf("Page %d: expected %d messages of %d, got %d of %d", page, len(expected), expectedTotal, len(streamed), total)
+		}
+	}
+}
+
+func TestGuestBookService_StreamMessages_PastEndSkipsQuery(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(3)
+	svc := newTestService(repo)
+
+	stream, total, err := svc.StreamMessages(context.Background(), 2, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for range stream {
+		t.Error("Expected no messages past the end")
+	}
+	if total != 3 {
+		t.Errorf("Expected total 3, got %d", total)
+	}
+	if calls := repo.getAllCalls.Load(); calls != 0 {
+		t.Errorf("Expected no row query past the end, got %d", calls)
+	}
+}
+
+func TestGuestBookService_PatchMessage(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name            string
+		id              string
+		patch           models.PatchGuestBookMessage
+		expectedError   error
+		expectedName    string
+		expectedMessage string
+		expectedTags    []string
+	}{
+		{
+			name:            "Just the message",
+			id:              "1",
+			patch:           models.PatchGuestBookMessage{Message: ptr("An edited message")},
+			expectedName:    "User 1",
+			expectedMessage: "An edited message",
+		},
+		{
+			name:            "Just the name",
+			id:              "1",
+			patch:           models.PatchGuestBookMessage{Name: ptr("Renamed")},
+			expectedName:    "Renamed",
+			expectedMessage: "Test message number 1",
+		},
+		{
+			name:            "Tags are normalized",
+			id:              "1",
+			patch:           models.PatchGuestBookMessage{Tags: &[]string{" Greeting", "greeting"}},
+			expectedName:    "User 1",
+			expectedMessage: "Test message number 1",
+			expectedTags:    []string{"greeting"},
+		},
+		{
+			name:          "Empty patch",
+			id:            "1",
+			patch:         models.PatchGuestBookMessage{},
+			expectedError: apperrors.ErrInvalidInput,
+		},
+		{
+			name:          "Present empty field is validated",
+			id:            "1",
+			patch:         models.PatchGuestBookMessage{Message: ptr("")},
+			expectedError: apperrors.ErrInvalidInput,
+		},
+		{
+			name:          "Hidden message",
+			id:            "2",
+			patch:         models.PatchGuestBookMessage{Name: ptr("Renamed")},
+			expectedError: apperrors.ErrNotFound,
+		},
+		{
+			name:          "Missing message",
+			id:            "99",
+			patch:         models.PatchGuestBookMessage{Name: ptr("Renamed")},
+			expectedError: apperrors.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockGuestBookRepository()
+			repo.messages = seedMessages(2)
+			repo.messages[1].Status = models.StatusPending
+			for i := range repo.messages {
+				repo.messages[i].EditTokenHash = hashEditToken("token")
+			}
+			svc := newTestService(repo)
+
+			updated, err := svc.PatchMessage(context.Background(), tt.id, "token", &tt.patch)
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Fatalf("Expected %v, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if updated.Name != tt.expectedName || updated.Message != tt.expectedMessage {
+				t.Errorf("Expected name %q and message %q, got %q and %q", tt.expectedName, tt.expectedMessage, updated.Name, updated.Message)
+			}
+			if updated.Email != "user1@example.com" {
+				t.Errorf("Expected the email to be left unchanged, got %q", updated.Email)
+			}
+			if !reflect.DeepEqual(updated.Tags, tt.expectedTags) {
+				t.Errorf("Expected tags %v, got %v", tt.expectedTags, updated.Tags)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_PatchMessage_Moderation(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(1)
+	repo.messages[0].EditTokenHash = hashEditToken("token")
+	cfg := config.Config{Validation: config.DefaultValidationConfig(), ModerationEnabled: true, SanitizeInput: SanitizeEscape}
+	svc := NewGuestBookService(repo, cfg)
+
+	message := "<b>edited</b> message"
+	updated, err := svc.PatchMessage(context.Background(), "1", "token", &models.PatchGuestBookMessage{Message: &message})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if updated.Message != "&lt;b&gt;edited&lt;/b&gt; message" {
+		t.Errorf("Expected the message to be sanitized like a new one, got %q", updated.Message)
+	}
+	// An edit must not skip review
+	if updated.Status != models.StatusPending {
+		t.Errorf("Expected the edited message to go back to %q, got %q", models.StatusPending, updated.Status)
+	}
+}
+
+func TestGuestBookService_PatchMessage_EditToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        string
+		hash          string
+		token         string
+		expectedError error
+		expectedKind  error
+	}{
+		{name: "Matching token", hash: hashEditToken("token"), token: "token"},
+		{name: "Hidden message with a wrong token", status: models.StatusPending, hash: hashEditToken("token"), token: "other", expectedError: apperrors.ErrNotFound, expectedKind: apperrors.ErrNotFound},
+		{name: "Missing token", hash: hashEditToken("token"), token: "", expectedError: ErrEditTokenRequired, expectedKind: apperrors.ErrUnauthorized},
+		{name: "Wrong token", hash: hashEditToken("token"), token: "other", expectedError: ErrEditTokenInvalid, expectedKind: apperrors.ErrForbidden},
+		{name: "Message without a token", hash: "", token: "token", expectedError: ErrEditTokenInvalid, expectedKind: apperrors.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockGuestBookRepository()
+			repo.messages = seedMessages(1)
+			repo.messages[0].EditTokenHash = tt.hash
+			if tt.status != "" {
+				repo.messages[0].Status = tt.status
+			}
+			svc := newTestService(repo)
+
+			name := "Renamed"
+			_, err := svc.PatchMessage(context.Background(), "1", tt.token, &models.PatchGuestBookMessage{Name: &name})
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+			if tt.expectedError == nil {
+				return
+			}
+
+			if !errors.Is(err, tt.expectedKind) {
+				t.Errorf("Expected a %v error, got %v", tt.expectedKind, err)
+			}
+			if repo.messages[0].Name != "User 1" {
+				t.Errorf("Expected the message to be left unchanged, got name %q", repo.messages[0].Name)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_CreateMessage_EditToken(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newTestService(repo)
+
+	req := models.CreateGuestBookMessage{Name: "Ada Lovelace", Email: "ada@example.com", Message: "Hello from the analytical engine", IdempotencyKey: "key-1"}
+	created, err := svc.CreateMessage(context.Background(), &req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created.EditToken == "" {
+		t.Fatal("Expected a new message to come with an edit token")
+	}
+	if stored := repo.messages[len(repo.messages)-1].EditTokenHash; stored != hashEditToken(created.EditToken) {
+		t.Errorf("Expected the token's hash to be stored, got %q", stored)
+	}
+
+	name := "Ada King"
+	if _, err := svc.PatchMessage(context.Background(), strconv.Itoa(created.ID), created.EditToken, &models.PatchGuestBookMessage{Name: &name}); err != nil {
+		t.Errorf("Expected the edit token to authorize an edit, got %v", err)
+	}
+
+	// A replay isn't proof of authorship, so it doesn't hand out the token
+	replay := models.CreateGuestBookMessage{Name: "Ada Lovelace", Email: "ada@example.com", Message: "Hello from the analytical engine", IdempotencyKey: "key-1"}
+	replayed, err := svc.CreateMessage(context.Background(), &replay)
+	if err != nil {
+		t.Fatalf("Expected the replay to succeed, got %v", err)
+	}
+	if replayed.EditToken != "" {
+		t.Errorf("Expected a replay to come without an edit token, got %q", replayed.EditToken)
+	}
+}
+
+func TestGuestBookService_CreateMessage_MaxMessagesPerEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		existing      int
+		expectedError error
+	}{
+		{name: "Below the limit", limit: 3, existing: 2},
+		{name: "At the limit", limit: 3, existing: 3, expectedError: ErrTooManyMessages},
+		{name: "Over the limit", limit: 3, existing: 5, expectedError: ErrTooManyMessages},
+		{name: "No limit", limit: 0, existing: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockGuestBookRepository()
+			repo.messages = seedMessages(tt.existing)
+			for i := range repo.messages {
+				repo.messages[i].Email = "ada@example.com"
+				// Messages count against the author whatever their status
+				if i%2 == 1 {
+					repo.messages[i].Status = models.StatusRejected
+				}
+			}
+			svc := NewGuestBookService(repo, config.Config{Validation: config.DefaultValidationConfig(), MaxMessagesPerEmail: tt.limit})
+
+			_, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+				Name:    "Ada Lovelace",
+				Email:   "ada@example.com",
+				Message: "Hello from the analytical engine",
+			})
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+			if tt.expectedError != nil && !errors.Is(err, apperrors.ErrTooManyRequests) {
+				t.Errorf("Expected a too many requests error, got %v", err)
+			}
+
+			// Other authors are unaffected
+			if _, err := svc.CreateMessage(context.Background(), &models.CreateGuestBookMessage{
+				Name:    "Grace Hopper",
+				Email:   "grace@example.com",
+				Message: "Hello from the compiler",
+			}); err != nil {
+				t.Errorf("Expected another author to post, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_CreateMessage_ReplayAtEmailLimit(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := NewGuestBookService(repo, config.Config{Validation: config.DefaultValidationConfig(), MaxMessagesPerEmail: 1})
+	ctx := context.Background()
+
+	newRequest := func(key string) *models.CreateGuestBookMessage {
+		return &models.CreateGuestBookMessage{
+			Name:           "Ada Lovelace",
+			Email:          "ada@example.com",
+			Message:        "Hello from the analytical engine",
+			IdempotencyKey: key,
+		}
+	}
+
+	first, err := svc.CreateMessage(ctx, newRequest("create-1"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The first message reached the limit; retrying it must still replay
+	replayed, err := svc.CreateMessage(ctx, newRequest("create-1"))
+	if err != nil {
+		t.Fatalf("Expected the retry to replay, got %v", err)
+	}
+	if replayed.ID != first.ID {
+		t.Errorf("Expected message %d to be replayed, got %d", first.ID, replayed.ID)
+	}
+
+	if _, err := svc.CreateMessage(ctx, newRequest("create-2")); !errors.Is(err, ErrTooManyMessages) {
+		t.Errorf("Expected a new key to be held to the limit, got %v", err)
+	}
+}
+
+func TestGuestBookService_PatchMessage_EditWindow(t *testing.T) {
+	created := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		window        time.Duration
+		age           time.Duration
+		expectedError error
+	}{
+		{name: "Inside the window", window: 15 * time.Minute, age: 5 * time.Minute},
+		{name: "At the end of the window", window: 15 * time.Minute, age: 15 * time.Minute},
+		{name: "Outside the window", window: 15 * time.Minute, age: 15*time.Minute + time.Second, expectedError: ErrEditWindowExpired},
+		{name: "No window", window: 0, age: 365 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockGuestBookRepository()
+			repo.messages = seedMessages(1)
+			repo.messages[0].CreatedAt = created
+			repo.messages[0].EditTokenHash = hashEditToken("token")
+			cfg := config.Config{Validation: config.DefaultValidationConfig(), EditWindow: tt.window}
+			svc := NewGuestBookServiceWithClock(repo, cfg, newFakeClock(created.Add(tt.age)))
+
+			name := "Renamed"
+			_, err := svc.PatchMessage(context.Background(), "1", "token", &models.PatchGuestBookMessage{Name: &name})
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, apperrors.ErrForbidden) {
+					t.Errorf("Expected an expired edit to be forbidden, got %v", err)
+				}
+				if repo.messages[0].Name != "User 1" {
+					t.Errorf("Expected the message to be left unchanged, got name %q", repo.messages[0].Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again
+// with a different request body. It is an apperrors.ErrConflict, so
+// handlers answer 409.
+var ErrIdempotencyKeyReused = apperrors.Newf(apperrors.ErrConflict, "idempotency key was already used with a different request")
+
+// scopeIdempotencyKey returns the key stored for a client's Idempotency-Key:
+// an HMAC of the client's IP and the key, so one client can't replay
+// another's key. Stored keys are always 64 hex characters, so a client can
+// never match keys the service stores for itself, such as
+// seedIdempotencyKey.
+func scopeIdempotencyKey(salt, clientIP, key string) string {
+	if key == "" {
+		return ""
+	}
+	return hashIP(salt, clientIP+"\x00"+key)
+}
+
+// fingerprintMessage returns a hash of the stored fields of msg, telling a
+// retry of a request from a different one sent with the same key
+func fingerprintMessage(msg *models.CreateGuestBookMessage) string {
+	// Encoding the fields as JSON keeps their boundaries unambiguous
+	b, _ := json.Marshal([]any{msg.Name, msg.Email, msg.Message, msg.Tags})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
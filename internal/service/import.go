@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// ImportRow is one message read from an import file. Err is set when the
+// row couldn't be parsed; such rows are skipped.
+type ImportRow struct {
+	// Row is the 1-based position of the message in the file, not
+	// counting a CSV header
+	Row     int
+	Message models.CreateGuestBookMessage
+	Err     error
+}
+
+// ImportSkip is a row that wasn't imported and why
+type ImportSkip struct {
+	Row int
+	Err error
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Imported int
+	Skipped  []ImportSkip
+}
+
+// ParseImportFile reads messages from a JSON or CSV file, chosen by its
+// extension. JSON files hold an array of objects with name, email, message
+// and optional tags fields. CSV files need a header row naming the name,
+// email and message columns; an optional tags column holds space-separated
+// tags, and other columns are ignored.
+func ParseImportFile(path string) ([]ImportRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ParseImportJSON(f)
+	case ".csv":
+		return ParseImportCSV(f)
+	}
+	return nil, fmt.Errorf("unsupported import file %q: must end in .json or .csv", path)
+}
+
+// ParseImportJSON reads a JSON array of messages. Elements that aren't
+// valid messages are returned with Err set; malformed JSON fails the whole
+// file, since nothing after the error can be trusted.
+func ParseImportJSON(r io.Reader) ([]ImportRow, error) {
+	var elements []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&elements); err != nil {
+		return nil, fmt.Errorf("import file must be a JSON array of messages: %w", err)
+	}
+
+	rows := make([]ImportRow, len(elements))
+	for i, element := range elements {
+		rows[i].Row = i + 1
+		if err := json.Unmarshal(element, &rows[i].Message); err != nil {
+			rows[i].Err = fmt.Errorf("not a valid message: %w", err)
+		}
+	}
+	return rows, nil
+}
+
+// ParseImportCSV reads messages from CSV with a header row. Records with
+// the wrong number of fields are returned with Err set.
+func ParseImportCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	// Field counts are checked per record so one bad row doesn't fail the file
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "email", "message"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("import CSV header is missing the %q column", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		row := ImportRow{Row: len(rows) + 1}
+		switch {
+		case err != nil:
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("failed to read import CSV: %w", err)
+			}
+			// A bare quote and the like only spoil their own record
+			row.Err = err
+		case len(record) != len(header):
+			row.Err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+		default:
+			row.Message = models.CreateGuestBookMessage{
+				Name:    field(record, "name"),
+				Email:   field(record, "email"),
+				Message: field(record, "message"),
+				Tags:    strings.Fields(field(record, "tags")),
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ImportMessages creates the parsed rows as approved messages, with the same
+// sanitization and validation as CreateMessage. Rows that failed to parse or
+// validate are skipped and reported; a database error stops the import.
+func (s *GuestBookService) ImportMessages(ctx context.Context, rows []ImportRow) (*ImportResult, error) {
+	result := &ImportResult{}
+
+	for _, row := range rows {
+		if row.Err != nil {
+			result.Skipped = append(result.Skipped, ImportSkip{Row: row.Row, Err: row.Err})
+			continue
+		}
+
+		msg, err := s.prepareMessage(&row.Message)
+		if err != nil {
+			result.Skipped = append(result.Skipped, ImportSkip{Row: row.Row, Err: err})
+			continue
+		}
+
+		// Imported messages were already public elsewhere, so they bypass moderation
+		if _, err := s.repo.Create(ctx, msg, models.StatusApproved); err != nil {
+			return result, fmt.Errorf("failed to import row %d: %w", row.Row, err)
+		}
+		result.Imported++
+	}
+
+	return result, nil
+}
+
+// importSeedFile imports the configured seed file when the guest book is
+// empty, so migrations from other systems only run once
+func (s *GuestBookService) importSeedFile(ctx context.Context) error {
+	count, err := s.repo.Count(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		slog.Info("Skipping seed file import, guest book is not empty", "file", s.config.Seed.File)
+		return nil
+	}
+
+	rows, err := ParseImportFile(s.config.Seed.File)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.ImportMessages(ctx, rows)
+	if err != nil {
+		return err
+	}
+
+	for _, skip := range result.Skipped {
+		slog.Warn("Skipped invalid row in seed file", "file", s.config.Seed.File, "row", skip.Row, "error", skip.Err)
+	}
+	slog.Info("Imported seed file", "file", s.config.Seed.File, "imported", result.Imported, "skipped", len(result.Skipped))
+	return nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/config"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+func skippedRows(result *ImportResult) []int {
+	rows := []int{}
+	for _, skip := range result.Skipped {
+		rows = append(rows, skip.Row)
+	}
+	return rows
+}
+
+func TestGuestBookService_ImportMessages_Files(t *testing.T) {
+	tests := []struct {
+		file            string
+		expectedNames   []string
+		expectedSkipped []int
+	}{
+		{
+			// Row 2 is too short, row 3 has a non-string name and row 4 isn't an object
+			file:            "testdata/import.json",
+			expectedNames:   []string{"Ada Lovelace", "Grace Hopper"},
+			expectedSkipped: []int{2, 3, 4},
+		},
+		{
+			// Row 2 is too short, row 3 has too few fields and row 5 has no email
+			file:            "testdata/import.csv",
+			expectedNames:   []string{"Ada Lovelace", "Grace Hopper"},
+			expectedSkipped: []int{2, 3, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			repo := NewMockGuestBookRepository()
+			svc := newTestService(repo)
+
+			rows, err := ParseImportFile(tt.file)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			result, err := svc.ImportMessages(context.Background(), rows)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if result.Imported != len(tt.expectedNames) {
+				t.Errorf("Expected %d imported, got %d", len(tt.expectedNames), result.Imported)
+			}
+			if got := skippedRows(result); !reflect.DeepEqual(got, tt.expectedSkipped) {
+				t.Errorf("Expected rows %v skipped, got %v", tt.expectedSkipped, got)
+			}
+
+			var names []string
+			for _, msg := range repo.messages {
+				names = append(names, msg.Name)
+				if msg.Status != models.StatusApproved {
+					t.Errorf("Expected imported message to be approved, got %q", msg.Status)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.expectedNames) {
+				t.Errorf("Expected messages %v, got %v", tt.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestParseImportCSV_Tags(t *testing.T) {
+	rows, err := ParseImportFile("testdata/import.csv")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if tags := rows[0].Message.Tags; !reflect.DeepEqual(tags, []string{"greeting", "thanks"}) {
+		t.Errorf("Expected tags [greeting thanks], got %v", tags)
+	}
+}
+
+func TestParseImport_InvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func() ([]ImportRow, error)
+		wantErr string
+	}{
+		{
+			name:    "JSON object instead of array",
+			parse:   func() ([]ImportRow, error) { return ParseImportJSON(strings.NewReader(`{"name": "Ada"}`)) },
+			wantErr: "JSON array",
+		},
+		{
+			name:    "Truncated JSON",
+			parse:   func() ([]ImportRow, error) { return ParseImportJSON(strings.NewReader(`[{"name": "Ada"`)) },
+			wantErr: "JSON array",
+		},
+		{
+			name: "CSV without message column",
+			parse: func() ([]ImportRow, error) {
+				return ParseImportCSV(strings.NewReader("name,email\nAda,ada@example.com\n"))
+			},
+			wantErr: `"message" column`,
+		},
+		{
+			name:    "Empty CSV",
+			parse:   func() ([]ImportRow, error) { return ParseImportCSV(strings.NewReader("")) },
+			wantErr: "header",
+		},
+		{
+			name:    "Unsupported extension",
+			parse:   func() ([]ImportRow, error) { return ParseImportFile("testdata/import.xml") },
+			wantErr: "import file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGuestBookService_InitializeDatabase_SeedFile(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	cfg := config.Config{
+		Validation: config.DefaultValidationConfig(),
+		Seed:       config.SeedConfig{File: "testdata/import.json"},
+	}
+	svc := NewGuestBookService(repo, cfg)
+
+	if err := svc.InitializeDatabase(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(repo.messages) != 2 {
+		t.Fatalf("Expected 2 imported messages, got %d", len(repo.messages))
+	}
+
+	// A second startup finds the guest book populated and imports nothing
+	if err := svc.InitializeDatabase(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(repo.messages) != 2 {
+		t.Errorf("Expected the import to run once, got %d messages", len(repo.messages))
+	}
+}
+
+func TestGuestBookService_InitializeDatabase_MissingSeedFile(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	cfg := config.Config{
+		Validation: config.DefaultValidationConfig(),
+		Seed:       config.SeedConfig{File: filepath.Join(t.TempDir(), "missing.csv")},
+	}
+	svc := NewGuestBookService(repo, cfg)
+
+	err := svc.InitializeDatabase(context.Background())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing file error, got %v", err)
+	}
+}
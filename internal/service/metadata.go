@@ -0,0 +1,37 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// maxUserAgentLength bounds the stored user agent; longer values are cut
+const maxUserAgentLength = 512
+
+// hashIP returns a hex HMAC-SHA256 of ip keyed with salt, so the same client
+// can be correlated across messages without storing the address itself
+func hashIP(salt, ip string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// buildMetadata derives the stored metadata from the request details on msg
+func buildMetadata(salt string, msg *models.CreateGuestBookMessage) *models.MessageMetadata {
+	metadata := &models.MessageMetadata{UserAgent: msg.UserAgent}
+	if msg.ClientIP != "" {
+		metadata.IPHash = hashIP(salt, msg.ClientIP)
+	}
+
+	if len(metadata.UserAgent) > maxUserAgentLength {
+		metadata.UserAgent = metadata.UserAgent[:maxUserAgentLength]
+	}
+
+	if metadata.IPHash == "" && metadata.UserAgent == "" {
+		return nil
+	}
+	return metadata
+}
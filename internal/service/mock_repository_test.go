@@ -0,0 +1,703 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/database"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// Ensure MockGuestBookRepository implements GuestBookRepositoryInterface
+var _ GuestBookRepositoryInterface = (*MockGuestBookRepository)(nil)
+
+// MockGuestBookRepository is an in-memory repository for service tests that
+// records how many times each query runs
+type MockGuestBookRepository struct {
+	mu       sync.Mutex
+	messages []models.GuestBookMessage
+	nextID   int
+	// idempotencyKeys maps used keys to message IDs, like the unique index
+	idempotencyKeys map[string]int
+	// lastDeletedAt is when DeleteByIDs last removed a message
+	lastDeletedAt time.Time
+
+	getAllCalls    atomic.Int32
+	countCalls     atomic.Int32
+	getByIDCalls   atomic.Int32
+	setStatusCalls atomic.Int32
+
+	// delay, when set, is how long each read query takes (honouring ctx)
+	delay time.Duration
+	// cancelledQueries counts delayed queries aborted by their context
+	cancelledQueries atomic.Int32
+	// errGetAll and errCount, when set, are returned immediately by the matching query
+	errGetAll error
+	errCount  error
+
+	// snapshotCalls counts BeginSnapshot calls, which fail with
+	// errBeginSnapshot when set; openedSnapshots are the snapshots begun
+	snapshotCalls    atomic.Int32
+	errBeginSnapshot error
+	openedSnapshots  []*mockSnapshot
+
+	// lastSearch is the query text most recently passed to Search
+	lastSearch string
+
+	// clock, when set, timestamps created messages instead of the system clock
+	clock Clock
+}
+
+func NewMockGuestBookRepository() *MockGuestBookRepository {
+	return &MockGuestBookRepository{nextID: 1}
+}
+
+func (m *MockGuestBookRepository) CreateTable(ctx context.Context) error {
+	return nil
+}
+
+// wait simulates query latency, returning early if ctx is cancelled
+func (m *MockGuestBookRepository) wait(ctx context.Context) error {
+	if m.delay == 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-time.After(m.delay):
+		return nil
+	case <-ctx.Done():
+		m.cancelledQueries.Add(1)
+		return ctx.Err()
+	}
+}
+
+func (m *MockGuestBookRepository) Create(ctx context.Context, msg *models.CreateGuestBookMessage, status string) (*models.GuestBookMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.idempotencyKeys[msg.IdempotencyKey]; ok && msg.IdempotencyKey != "" {
+		for _, existing := range m.messages {
+			if existing.ID == id {
+				return &existing, nil
+			}
+		}
+	}
+
+	now := time.Now()
+	if m.clock != nil {
+		now = m.clock.Now()
+	}
+	newMessage := models.GuestBookMessage{
+		ID:        m.nextID,
+		Name:      msg.Name,
+		Email:     msg.Email,
+		Message:   msg.Message,
+		Status:    status,
+		Tags:      msg.Tags,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Metadata:  msg.Metadata,
+
+		EditTokenHash:          msg.EditTokenHash,
+		IdempotencyFingerprint: msg.IdempotencyFingerprint,
+	}
+
+	m.messages = append(m.messages, newMessage)
+	m.nextID++
+
+	if msg.IdempotencyKey != "" {
+		if m.idempotencyKeys == nil {
+			m.idempotencyKeys = make(map[string]int)
+		}
+		m.idempotencyKeys[msg.IdempotencyKey] = newMessage.ID
+	}
+
+	return &newMessage, nil
+}
+
+func (m *MockGuestBookRepository) GetByIdempotencyKey(ctx context.Context, key string) (*models.GuestBookMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.idempotencyKeys[key]; ok {
+		for _, existing := range m.messages {
+			if existing.ID == id {
+				return &existing, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+}
+
+func (m *MockGuestBookRepository) ReleaseIdempotencyKey(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, keyID := range m.idempotencyKeys {
+		if keyID == id {
+			delete(m.idempotencyKeys, key)
+		}
+	}
+
+	return nil
+}
+
+func (m *MockGuestBookRepository) GetAll(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+	m.getAllCalls.Add(1)
+	if m.errGetAll != nil {
+		return nil, m.errGetAll
+	}
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	visible := m.approvedMessages()
+	result := make([]models.GuestBookMessage, 0)
+	for i := len(visible) - 1 - offset; i >= 0 && len(result) < limit; i-- {
+		result = append(result, visible[i])
+	}
+
+	return result, nil
+}
+
+// mockSnapshot is a snapshot of the mock's approved messages. It only
+// works with GetAllInTx and CountInTx.
+type mockSnapshot struct {
+	messages   []models.GuestBookMessage
+	rolledBack atomic.Bool
+	// busy is set while a query runs, since like a pgx.Tx the snapshot has
+	// one connection and can't run two queries at once
+	busy atomic.Bool
+}
+
+// errConnBusy is what a snapshot returns when queried concurrently, as
+// pgx does
+var errConnBusy = errors.New("conn busy")
+
+// use marks the snapshot busy for a query, returning the func that frees it
+func (s *mockSnapshot) use() (func(), error) {
+	if !s.busy.CompareAndSwap(false, true) {
+		return nil, errConnBusy
+	}
+	return func() { s.busy.Store(false) }, nil
+}
+
+func (s *mockSnapshot) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("mock snapshot can't run SQL")
+}
+
+func (s *mockSnapshot) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("mock snapshot can't run SQL")
+}
+
+func (s *mockSnapshot) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return nil
+}
+
+func (s *mockSnapshot) Rollback(ctx context.Context) error {
+	s.rolledBack.Store(true)
+	return nil
+}
+
+func (m *MockGuestBookRepository) BeginSnapshot(ctx context.Context) (database.Snapshot, error) {
+	m.snapshotCalls.Add(1)
+	if m.errBeginSnapshot != nil {
+		return nil, m.errBeginSnapshot
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := &mockSnapshot{messages: m.approvedMessages()}
+	m.openedSnapshots = append(m.openedSnapshots, snapshot)
+	return snapshot, nil
+}
+
+func (m *MockGuestBookRepository) GetAllInTx(ctx context.Context, q database.Querier, limit, offset int) ([]models.GuestBookMessage, error) {
+	snapshot := q.(*mockSnapshot)
+	done, err := snapshot.use()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if m.errGetAll != nil {
+		return nil, m.errGetAll
+	}
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	visible := snapshot.messages
+	result := make([]models.GuestBookMessage, 0)
+	for i := len(visible) - 1 - offset; i >= 0 && len(result) < limit; i-- {
+		result = append(result, visible[i])
+	}
+
+	return result, nil
+}
+
+func (m *MockGuestBookRepository) CountInTx(ctx context.Context, q database.Querier) (int, error) {
+	snapshot := q.(*mockSnapshot)
+	done, err := snapshot.use()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	if err := m.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(snapshot.messages), nil
+}
+
+func (m *MockGuestBookRepository) StreamAll(ctx context.Context, limit, offset int) iter.Seq2[models.GuestBookMessage, error] {
+	return func(yield func(models.GuestBookMessage, error) bool) {
+		messages, err := m.GetAll(ctx, limit, offset)
+		if err != nil {
+			yield(models.GuestBookMessage{}, err)
+			return
+		}
+		for _, msg := range messages {
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m *MockGuestBookRepository) GetByEmail(ctx context.Context, email string, limit, offset int) ([]models.GuestBookMessage, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	visible := m.approvedMessagesByEmail(email)
+	result := make([]models.GuestBookMessage, 0)
+	for i := len(visible) - 1 - offset; i >= 0 && len(result) < limit; i-- {
+		result = append(result, visible[i])
+	}
+
+	return result, nil
+}
+
+func (m *MockGuestBookRepository) GetByTag(ctx context.Context, tag string, limit, offset int) ([]models.GuestBookMessage, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	visible := m.approvedMessagesByTag(tag)
+	result := make([]models.GuestBookMessage, 0)
+	for i := len(visible) - 1 - offset; i >= 0 && len(result) < limit; i-- {
+		result = append(result, visible[i])
+	}
+
+	return result, nil
+}
+
+func (m *MockGuestBookRepository) GetByStatus(ctx context.Context, status string, limit, offset int) ([]models.GuestBookMessage, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Oldest first; messages are stored in creation order
+	result := make([]models.GuestBookMessage, 0)
+	skipped := 0
+	for _, msg := range m.messages {
+		if msg.Status != status {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if len(result) == limit {
+			break
+		}
+		result = append(result, msg)
+	}
+
+	return result, nil
+}
+
+func (m *MockGuestBookRepository) GetByID(ctx context.Context, id int) (*models.GuestBookMessage, error) {
+	m.getByIDCalls.Add(1)
+	if err := m.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range m.messages {
+		if msg.ID == id {
+			return &msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+}
+
+// GetByIDFromPrimary is GetByID; the mock has no replicas
+func (m *MockGuestBookRepository) GetByIDFromPrimary(ctx context.Context, id int) (*models.GuestBookMessage, error) {
+	return m.GetByID(ctx, id)
+}
+
+func (m *MockGuestBookRepository) SetStatus(ctx context.Context, id int, status string) (*models.GuestBookMessage, error) {
+	m.setStatusCalls.Add(1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			m.messages[i].Status = status
+			m.messages[i].UpdatedAt = time.Now()
+			msg := m.messages[i]
+			return &msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+}
+
+func (m *MockGuestBookRepository) Update(ctx context.Context, id int, patch *models.PatchGuestBookMessage, status string) (*models.GuestBookMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			if patch.Name != nil {
+				m.messages[i].Name = *patch.Name
+			}
+			if patch.Email != nil {
+				m.messages[i].Email = *patch.Email
+			}
+			if patch.Message != nil {
+				m.messages[i].Message = *patch.Message
+			}
+			if patch.Tags != nil {
+				m.messages[i].Tags = *patch.Tags
+			}
+			if status != "" {
+				m.messages[i].Status = status
+			}
+			m.messages[i].UpdatedAt = time.Now()
+			msg := m.messages[i]
+			return &msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("guest book message %w", apperrors.ErrNotFound)
+}
+
+func (m *MockGuestBookRepository) DeleteByIDs(ctx context.Context, ids []int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.messages[:0]
+	for _, msg := range m.messages {
+		if !slices.Contains(ids, msg.ID) {
+			kept = append(kept, msg)
+		}
+	}
+	deleted := len(m.messages) - len(kept)
+	m.messages = kept
+	if deleted > 0 {
+		m.lastDeletedAt = time.Now()
+	}
+
+	return deleted, nil
+}
+
+func (m *MockGuestBookRepository) Exists(ctx context.Context, id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range m.messages {
+		if msg.ID == id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *MockGuestBookRepository) Count(ctx context.Context) (int, error) {
+	m.countCalls.Add(1)
+	if m.errCount != nil {
+		return 0, m.errCount
+	}
+	if err := m.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.approvedMessages()), nil
+}
+
+func (m *MockGuestBookRepository) CountByEmail(ctx context.Context, email string) (int, error) {
+	if err := m.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.approvedMessagesByEmail(email)), nil
+}
+
+func (m *MockGuestBookRepository) CountAllByEmail(ctx context.Context, email string) (int, error) {
+	if err := m.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, msg := range m.messages {
+		if msg.Email == email {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MockGuestBookRepository) CountByTag(ctx context.Context, tag string) (int, error) {
+	if err := m.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.approvedMessagesByTag(tag)), nil
+}
+
+func (m *MockGuestBookRepository) CountByStatus(ctx context.Context) (models.ModerationCounts, error) {
+	if m.errCount != nil {
+		return models.ModerationCounts{}, m.errCount
+	}
+	if err := m.wait(ctx); err != nil {
+		return models.ModerationCounts{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var counts models.ModerationCounts
+	for _, msg := range m.messages {
+		switch msg.Status {
+		case models.StatusPending:
+			counts.Pending++
+		case models.StatusApproved:
+			counts.Approved++
+		case models.StatusRejected:
+			counts.Rejected++
+		}
+	}
+
+	return counts, nil
+}
+
+func (m *MockGuestBookRepository) LastChangedAt(ctx context.Context) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	latest := m.lastDeletedAt
+	for _, msg := range m.messages {
+		if msg.UpdatedAt.After(latest) {
+			latest = msg.UpdatedAt
+		}
+	}
+
+	return latest, nil
+}
+
+func (m *MockGuestBookRepository) CountByDay(ctx context.Context, since time.Time) ([]models.DailyCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byDate := make(map[string]int)
+	for _, msg := range m.approvedMessages() {
+		if !msg.CreatedAt.Before(since) {
+			byDate[msg.CreatedAt.UTC().Format(models.DateFormat)]++
+		}
+	}
+
+	counts := make([]models.DailyCount, 0, len(byDate))
+	for date, count := range byDate {
+		counts = append(counts, models.DailyCount{Date: date, Count: count})
+	}
+
+	return counts, nil
+}
+
+// MessageLengthStats computes the length stats of the approved messages as
+// the SQL query does, counting characters rather than bytes
+func (m *MockGuestBookRepository) MessageLengthStats(ctx context.Context) (models.MessageLengthStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lengths := make([]int, 0, len(m.messages))
+	for _, msg := range m.approvedMessages() {
+		lengths = append(lengths, utf8.RuneCountInString(msg.Message))
+	}
+	if len(lengths) == 0 {
+		return models.MessageLengthStats{}, nil
+	}
+	slices.Sort(lengths)
+
+	total := 0
+	for _, n := range lengths {
+		total += n
+	}
+	mid := len(lengths) / 2
+	median := float64(lengths[mid])
+	if len(lengths)%2 == 0 {
+		median = float64(lengths[mid-1]+lengths[mid]) / 2
+	}
+
+	return models.MessageLengthStats{
+		Min:    lengths[0],
+		Avg:    math.Round(float64(total)/float64(len(lengths))*100) / 100,
+		Max:    lengths[len(lengths)-1],
+		Median: median,
+	}, nil
+}
+
+// Search matches approved messages containing every word of q, ranking by the
+// number of occurrences
+func (m *MockGuestBookRepository) Search(ctx context.Context, q string, limit int) ([]models.SearchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastSearch = q
+	words := strings.Fields(strings.ToLower(q))
+
+	results := make([]models.SearchResult, 0)
+	for _, msg := range m.approvedMessages() {
+		text := strings.ToLower(msg.Message)
+		rank := 0
+		for _, word := range words {
+			n := strings.Count(text, word)
+			if n == 0 {
+				rank = 0
+				break
+			}
+			rank += n
+		}
+		if rank > 0 {
+			results = append(results, models.SearchResult{GuestBookMessage: msg, Rank: float64(rank)})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank > results[j].Rank })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+func (m *MockGuestBookRepository) Neighbors(ctx context.Context, createdAt time.Time, id int) (*models.MessageNeighbors, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// before reports whether a sorts before b by (created_at, id)
+	before := func(a, b models.GuestBookMessage) bool {
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.ID < b.ID
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	target := models.GuestBookMessage{ID: id, CreatedAt: createdAt}
+
+	neighbors := &models.MessageNeighbors{}
+	for _, msg := range m.approvedMessages() {
+		if before(msg, target) && (neighbors.Previous == nil || before(*neighbors.Previous, msg)) {
+			neighbors.Previous = &msg
+		}
+		if before(target, msg) && (neighbors.Next == nil || before(msg, *neighbors.Next)) {
+			neighbors.Next = &msg
+		}
+	}
+
+	return neighbors, nil
+}
+
+// approvedMessages returns the publicly visible messages; callers hold m.mu
+func (m *MockGuestBookRepository) approvedMessages() []models.GuestBookMessage {
+	approved := make([]models.GuestBookMessage, 0, len(m.messages))
+	for _, msg := range m.messages {
+		if msg.Status == models.StatusApproved {
+			approved = append(approved, msg)
+		}
+	}
+	return approved
+}
+
+func (m *MockGuestBookRepository) approvedMessagesByEmail(email string) []models.GuestBookMessage {
+	matching := make([]models.GuestBookMessage, 0)
+	for _, msg := range m.approvedMessages() {
+		if msg.Email == email {
+			matching = append(matching, msg)
+		}
+	}
+	return matching
+}
+
+func (m *MockGuestBookRepository) approvedMessagesByTag(tag string) []models.GuestBookMessage {
+	matching := make([]models.GuestBookMessage, 0)
+	for _, msg := range m.approvedMessages() {
+		if slices.Contains(msg.Tags, tag) {
+			matching = append(matching, msg)
+		}
+	}
+	return matching
+}
+
+// seedMessages builds n messages with ascending IDs
+func seedMessages(n int) []models.GuestBookMessage {
+	messages := make([]models.GuestBookMessage, 0, n)
+	for i := 1; i <= n; i++ {
+		messages = append(messages, models.GuestBookMessage{
+			ID:        i,
+			Name:      fmt.Sprintf("User %d", i),
+			Email:     fmt.Sprintf("user%d@example.com", i),
+			Message:   fmt.Sprintf("Test message number %d", i),
+			Status:    models.StatusApproved,
+			CreatedAt: time.Now().Add(time.Duration(i) * time.Minute),
+			UpdatedAt: time.Now().Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return messages
+}
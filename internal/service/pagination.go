@@ -0,0 +1,34 @@
+package service
+
+import "math"
+
+const (
+	// DefaultPageSize is the page size used when none, or an out-of-range
+	// one, is requested
+	DefaultPageSize = 10
+	// MaxPageSize caps how many messages one page holds
+	MaxPageSize = 100
+)
+
+// NormalizePage replaces out-of-range pagination with the defaults: pages
+// start at 1, and page sizes outside 1 to MaxPageSize become
+// DefaultPageSize
+func NormalizePage(page, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > MaxPageSize {
+		pageSize = DefaultPageSize
+	}
+	return page, pageSize
+}
+
+// pageOffset returns how many messages come before page. It reports false
+// for pages past MaxPage or whose offset would overflow an int; such a page
+// can't have rows, so callers answer it from the count alone.
+func pageOffset(page, pageSize int) (int, bool) {
+	if page > MaxPage || page-1 > math.MaxInt/pageSize {
+		return 0, false
+	}
+	return (page - 1) * pageSize, true
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Input sanitization modes for SANITIZE_INPUT
+const (
+	// SanitizeNone stores text verbatim, for clients that escape on render
+	SanitizeNone = "none"
+	// SanitizeEscape HTML-escapes <, >, &, ' and "
+	SanitizeEscape = "escape"
+	// SanitizeStrip removes HTML tags, dropping script and style content
+	SanitizeStrip = "strip"
+)
+
+var (
+	scriptOrStylePattern = regexp.MustCompile(`(?is)<(script|style)\b[^>]*>.*?</(script|style)\s*>`)
+	tagPattern           = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// sanitizeText applies the sanitization mode to s
+func sanitizeText(mode, s string) string {
+	switch mode {
+	case SanitizeEscape:
+		return html.EscapeString(s)
+	case SanitizeStrip:
+		s = scriptOrStylePattern.ReplaceAllString(s, "")
+		s = tagPattern.ReplaceAllString(s, "")
+		return strings.TrimSpace(s)
+	default:
+		return s
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/database"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// NewSnapshotToken asks GetMessagesSnapshot to begin a new snapshot
+const NewSnapshotToken = "new"
+
+// snapshotRollbackTimeout bounds rolling back a snapshot, which may happen
+// outside any request
+const snapshotRollbackTimeout = 5 * time.Second
+
+var (
+	// ErrSnapshotsDisabled is returned for snapshot requests when
+	// PAGINATION_SNAPSHOT_TTL is 0
+	ErrSnapshotsDisabled = apperrors.Newf(apperrors.ErrInvalidInput, "snapshot pagination is disabled")
+	// ErrSnapshotNotFound is returned for a token that is unknown or whose
+	// snapshot has expired; the client has to start over
+	ErrSnapshotNotFound = apperrors.Newf(apperrors.ErrNotFound, "snapshot not found or expired; start a new one with snapshot=new")
+	// ErrTooManySnapshots is returned when PAGINATION_SNAPSHOT_MAX snapshots
+	// are already open
+	ErrTooManySnapshots = apperrors.Newf(apperrors.ErrTooManyRequests, "too many open snapshots, please retry later")
+)
+
+// snapshotSession is an open snapshot clients are paging through
+type snapshotSession struct {
+	// mu serializes queries, since a transaction runs one at a time, and
+	// guards closed
+	mu        sync.Mutex
+	snapshot  database.Snapshot
+	expiresAt time.Time
+	timer     *time.Timer
+	closed    bool
+}
+
+// close rolls the snapshot back, once
+func (s *snapshotSession) close(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if err := s.snapshot.Rollback(ctx); err != nil {
+		slog.Warn("Failed to roll back pagination snapshot", "error", err)
+	}
+}
+
+// GetMessagesSnapshot is GetMessages read from a snapshot, so a client
+// paging through the guest book sees each message once and the same
+// total on every page, however many messages are written meanwhile. A
+// token of NewSnapshotToken begins a snapshot that lasts
+// PAGINATION_SNAPSHOT_TTL; any other token names one begun earlier. The
+// snapshot is returned with the page.
+func (s *GuestBookService) GetMessagesSnapshot(ctx context.Context, token string, page, pageSize int) ([]models.GuestBookMessage, int, *models.Snapshot, error) {
+	if s.config.SnapshotTTL <= 0 {
+		return nil, 0, nil, ErrSnapshotsDisabled
+	}
+
+	var (
+		session *snapshotSession
+		err     error
+	)
+	if token == NewSnapshotToken {
+		token, session, err = s.beginSnapshot(ctx)
+	} else {
+		session, err = s.lookupSnapshot(ctx, token)
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	session.mu.Lock()
+	if session.closed {
+		session.mu.Unlock()
+		return nil, 0, nil, ErrSnapshotNotFound
+	}
+	messages, total, err := listPageInTx(ctx, page, pageSize,
+		func(ctx context.Context, limit, offset int) ([]models.GuestBookMessage, error) {
+			return s.repo.GetAllInTx(ctx, session.snapshot, limit, offset)
+		},
+		func(ctx context.Context) (int, error) {
+			return s.repo.CountInTx(ctx, session.snapshot)
+		},
+	)
+	session.mu.Unlock()
+
+	if err != nil {
+		// A failed query aborts the transaction, so the snapshot is no
+		// use for later pages either
+		s.discardSnapshot(ctx, token, session)
+		return nil, 0, nil, err
+	}
+
+	return messages, total, &models.Snapshot{Token: token, ExpiresAt: session.expiresAt}, nil
+}
+
+// beginSnapshot opens a snapshot and registers it under a new token. It is
+// rolled back when it expires, whether or not it is still in use.
+func (s *GuestBookService) beginSnapshot(ctx context.Context) (string, *snapshotSession, error) {
+	// Reserve a slot first, so the limit holds while snapshots begin
+	s.snapshotMu.Lock()
+	if len(s.snapshots)+s.snapshotsOpening >= s.config.MaxSnapshots {
+		s.snapshotMu.Unlock()
+		return "", nil, ErrTooManySnapshots
+	}
+	s.snapshotsOpening++
+	s.snapshotMu.Unlock()
+
+	snapshot, err := s.repo.BeginSnapshot(ctx)
+
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	s.snapshotsOpening--
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := newSnapshotToken()
+	session := &snapshotSession{
+		snapshot:  snapshot,
+		expiresAt: s.clock.Now().Add(s.config.SnapshotTTL),
+	}
+	session.timer = time.AfterFunc(s.config.SnapshotTTL, func() {
+		s.discardSnapshot(context.Background(), token, session)
+	})
+	s.snapshots[token] = session
+
+	slog.Debug("Began pagination snapshot", "expires_at", session.expiresAt)
+	return token, session, nil
+}
+
+// lookupSnapshot finds the open snapshot for token
+func (s *GuestBookService) lookupSnapshot(ctx context.Context, token string) (*snapshotSession, error) {
+	s.snapshotMu.Lock()
+	session, ok := s.snapshots[token]
+	s.snapshotMu.Unlock()
+
+	if !ok {
+		return nil, ErrSnapshotNotFound
+	}
+	if !s.clock.Now().Before(session.expiresAt) {
+		s.discardSnapshot(ctx, token, session)
+		return nil, ErrSnapshotNotFound
+	}
+
+	return session, nil
+}
+
+// discardSnapshot unregisters session and rolls it back. The rollback
+// isn't cut short by ctx being cancelled, which may be why the snapshot
+// failed.
+func (s *GuestBookService) discardSnapshot(ctx context.Context, token string, session *snapshotSession) {
+	s.snapshotMu.Lock()
+	if s.snapshots[token] == session {
+		delete(s.snapshots, token)
+	}
+	s.snapshotMu.Unlock()
+
+	session.timer.Stop()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), snapshotRollbackTimeout)
+	defer cancel()
+	session.close(ctx)
+}
+
+// CloseSnapshots rolls back every open snapshot, releasing their
+// connections. Call it before closing the database, whose pool waits for
+// connections to be released.
+func (s *GuestBookService) CloseSnapshots(ctx context.Context) {
+	s.snapshotMu.Lock()
+	sessions := s.snapshots
+	s.snapshots = make(map[string]*snapshotSession)
+	s.snapshotMu.Unlock()
+
+	for _, session := range sessions {
+		session.timer.Stop()
+		session.close(ctx)
+	}
+}
+
+// newSnapshotToken returns a random token that can't be guessed, so one
+// client can't read from another's snapshot
+func newSnapshotToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
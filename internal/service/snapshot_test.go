@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/app/internal/config"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// newSnapshotService returns a service over repo with snapshots enabled
+func newSnapshotService(repo *MockGuestBookRepository, clock Clock) *GuestBookService {
+	cfg := config.Config{
+		Validation:   config.DefaultValidationConfig(),
+		SnapshotTTL:  time.Minute,
+		MaxSnapshots: 2,
+	}
+	return NewGuestBookServiceWithClock(repo, cfg, clock)
+}
+
+func TestGuestBookService_GetMessagesSnapshot_ConsistentAcrossInserts(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(3)
+	repo.nextID = 4
+	svc := newSnapshotService(repo, realClock{})
+	defer svc.CloseSnapshots(context.Background())
+	ctx := context.Background()
+
+	first, total, snapshot, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 3 || len(first) != 2 || first[0].ID != 3 || first[1].ID != 2 {
+		t.Fatalf("Expected messages 3 and 2 of 3, got %v of %d", messageIDs(first), total)
+	}
+	if snapshot == nil || snapshot.Token == "" || snapshot.Token == NewSnapshotToken {
+		t.Fatalf("Expected a snapshot token, got %+v", snapshot)
+	}
+
+	// New messages would push message 2 onto the second live page
+	for _, name := range []string{"Late Writer", "Later Writer"} {
+		if _, err := svc.CreateMessage(ctx, &models.CreateGuestBookMessage{Name: name, Email: "late@example.com", Message: "Written while paging"}); err != nil {
+			t.Fatalf("CreateMessage returned error: %v", err)
+		}
+	}
+
+	second, total, _, err := svc.GetMessagesSnapshot(ctx, snapshot.Token, 2, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 3 {
+		t.Errorf("Expected the snapshot total to stay 3, got %d", total)
+	}
+	if len(second) != 1 || second[0].ID != 1 {
+		t.Errorf("Expected only message 1 on the second page, got %v", messageIDs(second))
+	}
+
+	if _, liveTotal, err := svc.GetMessages(ctx, 1, 2); err != nil || liveTotal != 5 {
+		t.Errorf("Expected the live list to have 5 messages, got %d (%v)", liveTotal, err)
+	}
+	if calls := repo.snapshotCalls.Load(); calls != 1 {
+		t.Errorf("Expected one snapshot to be begun, got %d", calls)
+	}
+}
+
+func TestGuestBookService_GetMessagesSnapshot_QueriesOneAtATime(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(3)
+	// Slow queries would overlap if they ran concurrently
+	repo.delay = 10 * time.Millisecond
+	svc := newSnapshotService(repo, realClock{})
+	defer svc.CloseSnapshots(context.Background())
+	ctx := context.Background()
+
+	_, _, snapshot, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	messages, total, _, err := svc.GetMessagesSnapshot(ctx, snapshot.Token, 2, 2)
+	if err != nil {
+		t.Fatalf("Expected no error on the second page, got %v", err)
+	}
+	if total != 3 || len(messages) != 1 {
+		t.Errorf("Expected 1 message of 3, got %d of %d", len(messages), total)
+	}
+}
+
+func TestGuestBookService_GetMessagesSnapshot_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Disabled", func(t *testing.T) {
+		svc := newTestService(NewMockGuestBookRepository())
+		if _, _, _, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 10); !errors.Is(err, ErrSnapshotsDisabled) {
+			t.Errorf("Expected ErrSnapshotsDisabled, got %v", err)
+		}
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		svc := newSnapshotService(NewMockGuestBookRepository(), realClock{})
+		if _, _, _, err := svc.GetMessagesSnapshot(ctx, "made-up", 1, 10); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Too many snapshots", func(t *testing.T) {
+		repo := NewMockGuestBookRepository()
+		svc := newSnapshotService(repo, realClock{})
+		defer svc.CloseSnapshots(ctx)
+
+		for range 2 {
+			if _, _, _, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 10); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if _, _, _, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 10); !errors.Is(err, ErrTooManySnapshots) {
+			t.Errorf("Expected ErrTooManySnapshots, got %v", err)
+		}
+		if calls := repo.snapshotCalls.Load(); calls != 2 {
+			t.Errorf("Expected 2 snapshots to be begun, got %d", calls)
+		}
+	})
+
+	t.Run("Begin fails", func(t *testing.T) {
+		repo := NewMockGuestBookRepository()
+		repo.errBeginSnapshot = errors.New("connection refused")
+		svc := newSnapshotService(repo, realClock{})
+
+		if _, _, _, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 10); !errors.Is(err, repo.errBeginSnapshot) {
+			t.Errorf("Expected the begin error, got %v", err)
+		}
+
+		// The reserved slot is given back
+		repo.errBeginSnapshot = nil
+		for range 2 {
+			if _, _, _, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 10); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		svc.CloseSnapshots(ctx)
+	})
+}
+
+func TestGuestBookService_GetMessagesSnapshot_Expires(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC))
+	repo := NewMockGuestBookRepository()
+	svc := newSnapshotService(repo, clock)
+	defer svc.CloseSnapshots(context.Background())
+	ctx := context.Background()
+
+	_, _, snapshot, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := clock.Now().Add(time.Minute); !snapshot.ExpiresAt.Equal(want) {
+		t.Errorf("Expected the snapshot to expire at %s, got %s", want, snapshot.ExpiresAt)
+	}
+
+	clock.Advance(time.Minute)
+
+	if _, _, _, err := svc.GetMessagesSnapshot(ctx, snapshot.Token, 2, 10); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound after expiry, got %v", err)
+	}
+	if !repo.openedSnapshots[0].rolledBack.Load() {
+		t.Error("Expected the expired snapshot to be rolled back")
+	}
+}
+
+func TestGuestBookService_GetMessagesSnapshot_RolledBackAfterTTL(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := NewGuestBookService(repo, config.Config{SnapshotTTL: 10 * time.Millisecond, MaxSnapshots: 1})
+
+	if _, _, _, err := svc.GetMessagesSnapshot(context.Background(), NewSnapshotToken, 1, 10); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Nobody asks for it again, so the timer has to release it
+	deadline := time.Now().Add(time.Second)
+	for !repo.openedSnapshots[0].rolledBack.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the snapshot to be rolled back once its TTL passed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Its slot is free again
+	if _, _, _, err := svc.GetMessagesSnapshot(context.Background(), NewSnapshotToken, 1, 10); err != nil {
+		t.Errorf("Expected a new snapshot to begin, got %v", err)
+	}
+	svc.CloseSnapshots(context.Background())
+}
+
+func TestGuestBookService_GetMessagesSnapshot_FailedQueryDiscardsSnapshot(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	repo.messages = seedMessages(3)
+	svc := newSnapshotService(repo, realClock{})
+	ctx := context.Background()
+
+	_, _, snapshot, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	repo.errGetAll = errors.New("connection reset")
+	if _, _, _, err := svc.GetMessagesSnapshot(ctx, snapshot.Token, 2, 2); !errors.Is(err, repo.errGetAll) {
+		t.Fatalf("Expected the query error, got %v", err)
+	}
+	repo.errGetAll = nil
+
+	if !repo.openedSnapshots[0].rolledBack.Load() {
+		t.Error("Expected the failed snapshot to be rolled back")
+	}
+	if _, _, _, err := svc.GetMessagesSnapshot(ctx, snapshot.Token, 2, 2); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound after a failed query, got %v", err)
+	}
+}
+
+func TestGuestBookService_CloseSnapshots(t *testing.T) {
+	repo := NewMockGuestBookRepository()
+	svc := newSnapshotService(repo, realClock{})
+	ctx := context.Background()
+
+	_, _, snapshot, err := svc.GetMessagesSnapshot(ctx, NewSnapshotToken, 1, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	svc.CloseSnapshots(ctx)
+
+	if !repo.openedSnapshots[0].rolledBack.Load() {
+		t.Error("Expected CloseSnapshots to roll back the snapshot")
+	}
+	if _, _, _, err := svc.GetMessagesSnapshot(ctx, snapshot.Token, 1, 10); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound after closing, got %v", err)
+	}
+}
+
+// messageIDs lists the IDs of messages, for test failure output
+func messageIDs(messages []models.GuestBookMessage) []int {
+	ids := make([]int, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
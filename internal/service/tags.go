@@ -0,0 +1,61 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+// normalizeTag trims and lowercases tag so "Greeting " and "greeting" match
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags normalizes each tag and drops duplicates, keeping the first
+// occurrence's position. It returns nil for no tags.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// validateTag checks a normalized tag: 1 to MaxTagLength letters, digits,
+// hyphens or underscores. The narrow alphabet keeps tags safe to put in
+// URLs and HTML without escaping.
+func validateTag(tag string) error {
+	if tag == "" || utf8.RuneCountInString(tag) > models.MaxTagLength {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "tags must be between 1 and %d characters", models.MaxTagLength)
+	}
+
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return apperrors.Newf(apperrors.ErrInvalidInput, "tag %q may only contain letters, digits, hyphens and underscores", tag)
+		}
+	}
+
+	return nil
+}
+
+// validateTags checks the number of tags and each tag
+func validateTags(tags []string) error {
+	if len(tags) > models.MaxTags {
+		return apperrors.Newf(apperrors.ErrInvalidInput, "a message may have at most %d tags", models.MaxTags)
+	}
+
+	for _, tag := range tags {
+		if err := validateTag(tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
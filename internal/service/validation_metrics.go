@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"maps"
+	"sync"
+)
+
+// Fields reported by ValidationFailureCounts. Failures that aren't about
+// one field are counted under ValidationFieldOther.
+const (
+	ValidationFieldName           = "name"
+	ValidationFieldEmail          = "email"
+	ValidationFieldMessage        = "message"
+	ValidationFieldTags           = "tags"
+	ValidationFieldIdempotencyKey = "idempotency_key"
+	ValidationFieldOther          = "other"
+)
+
+// validationFailures counts create requests rejected by validation, by the
+// field that failed. Like the runtime stats it is reported with, it covers
+// the whole process.
+var validationFailures = struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}{
+	// Every field starts at zero, so reports always list the same keys
+	counts: map[string]int64{
+		ValidationFieldName:           0,
+		ValidationFieldEmail:          0,
+		ValidationFieldMessage:        0,
+		ValidationFieldTags:           0,
+		ValidationFieldIdempotencyKey: 0,
+		ValidationFieldOther:          0,
+	},
+}
+
+// fieldError is a validation error about one field of a request body. It
+// reads and unwraps as the error it carries.
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// invalidField tags a validation error with the field it is about; a nil
+// err stays nil
+func invalidField(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fieldError{field: field, err: err}
+}
+
+// FailedField returns the request body field a validation error is about,
+// or "" when it isn't about a single field
+func FailedField(err error) string {
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		return fe.field
+	}
+	return ""
+}
+
+// recordValidationFailure counts err against the field it is about
+func recordValidationFailure(err error) {
+	field := FailedField(err)
+	if field == "" {
+		field = ValidationFieldOther
+	}
+
+	validationFailures.mu.Lock()
+	validationFailures.counts[field]++
+	validationFailures.mu.Unlock()
+}
+
+// ValidationFailureCounts returns how many create requests, including
+// validate-only ones, have failed validation on each field since the
+// process started. A high count points at a field users find confusing.
+func ValidationFailureCounts() map[string]int64 {
+	validationFailures.mu.Lock()
+	defer validationFailures.mu.Unlock()
+	return maps.Clone(validationFailures.counts)
+}
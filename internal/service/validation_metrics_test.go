@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/moabdelazem/app/internal/apperrors"
+	"github.com/moabdelazem/app/internal/models"
+)
+
+func TestGuestBookService_CreateMessage_CountsValidationFailures(t *testing.T) {
+	valid := func() *models.CreateGuestBookMessage {
+		return &models.CreateGuestBookMessage{Name: "Ada Lovelace", Email: "ada@example.com", Message: "Hello from the engine room"}
+	}
+
+	tests := []struct {
+		field  string
+		modify func(msg *models.CreateGuestBookMessage)
+	}{
+		{field: ValidationFieldName, modify: func(msg *models.CreateGuestBookMessage) { msg.Name = "A" }},
+		{field: ValidationFieldEmail, modify: func(msg *models.CreateGuestBookMessage) { msg.Email = "" }},
+		{field: ValidationFieldMessage, modify: func(msg *models.CreateGuestBookMessage) { msg.Message = "Too short" }},
+		{field: ValidationFieldTags, modify: func(msg *models.CreateGuestBookMessage) { msg.Tags = []string{"not a tag"} }},
+		{field: ValidationFieldIdempotencyKey, modify: func(msg *models.CreateGuestBookMessage) {
+			msg.IdempotencyKey = strings.Repeat("k", models.MaxIdempotencyKeyLength+1)
+		}},
+	}
+
+	svc := newTestService(NewMockGuestBookRepository())
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			before := ValidationFailureCounts()
+
+			msg := valid()
+			tt.modify(msg)
+			_, err := svc.CreateMessage(context.Background(), msg)
+			if !errors.Is(err, apperrors.ErrInvalidInput) {
+				t.Fatalf("Expected ErrInvalidInput, got %v", err)
+			}
+			if field := FailedField(err); field != tt.field {
+				t.Errorf("Expected the error to be about %q, got %q", tt.field, field)
+			}
+
+			after := ValidationFailureCounts()
+			for field, count := range after {
+				want := before[field]
+				if field == tt.field {
+					want++
+				}
+				if count != want {
+					t.Errorf("Expected %s failures to be %d, got %d", field, want, count)
+				}
+			}
+		})
+	}
+
+	t.Run("Validate only", func(t *testing.T) {
+		before := ValidationFailureCounts()
+
+		msg := valid()
+		msg.Name = ""
+		if _, err := svc.ValidateMessage(context.Background(), msg); err == nil {
+			t.Fatal("Expected a validation error")
+		}
+
+		if got, want := ValidationFailureCounts()[ValidationFieldName], before[ValidationFieldName]+1; got != want {
+			t.Errorf("Expected name failures to be %d, got %d", want, got)
+		}
+	})
+
+	t.Run("Valid message", func(t *testing.T) {
+		before := ValidationFailureCounts()
+
+		if _, err := svc.CreateMessage(context.Background(), valid()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		for field, count := range ValidationFailureCounts() {
+			if count != before[field] {
+				t.Errorf("Expected %s failures to stay %d, got %d", field, before[field], count)
+			}
+		}
+	})
+}
+
+func TestFailedField(t *testing.T) {
+	err := invalidField(ValidationFieldEmail, apperrors.Newf(apperrors.ErrInvalidInput, "email must be a valid address"))
+
+	if FailedField(err) != ValidationFieldEmail {
+		t.Errorf("Expected field %q, got %q", ValidationFieldEmail, FailedField(err))
+	}
+	if err.Error() != "email must be a valid address" {
+		t.Errorf("Expected the wrapped message, got %q", err.Error())
+	}
+	if !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Error("Expected the field error to keep its kind")
+	}
+	if FailedField(errors.New("boom")) != "" {
+		t.Error("Expected no field for an unrelated error")
+	}
+	if invalidField(ValidationFieldName, nil) != nil {
+		t.Error("Expected a nil error to stay nil")
+	}
+}